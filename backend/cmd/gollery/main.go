@@ -0,0 +1,341 @@
+// Command gollery runs maintenance tasks against a gollery content tree.
+// With -config, commands cover every library the config lists.
+//
+// Integrity check (reports only, unless repairs are requested):
+//
+//	gollery fsck -config gollery.json
+//	gollery fsck -root /path/to/content -remove-orphans -quarantine
+//
+// fsck exits with status 1 when problems remain unrepaired. With -config
+// it checks the state where the server keeps it, in PostgreSQL if
+// state.backend is postgres, and follows the symbolic links the server
+// does. Run repairs while galleryd is stopped, or use
+// POST /api/v1/admin/fsck instead.
+//
+// Moving sidecar state out of the content tree, to the state_root set in
+// the config (run with galleryd stopped, before setting state_root):
+//
+//	gollery migrate-state -config gollery.json -dry-run
+//	gollery migrate-state -root /path/to/content -state-root /path/to/state
+//
+// Copying state between the sidecar files and the postgres state backend
+// (run with galleryd stopped; import before switching state.backend to
+// postgres, export before switching back):
+//
+//	gollery state-import -config gollery.json
+//	gollery state-export -config gollery.json -dsn postgres://...
+//
+// Upgrading sidecar state files to the current schema version (loading
+// state upgrades it anyway; this previews or applies all upgrades at once):
+//
+//	gollery migrate-schema -config gollery.json -dry-run
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/fsck"
+	"github.com/perrito666/gollery/backend/internal/state"
+	pgstate "github.com/perrito666/gollery/backend/internal/state/postgres"
+	"github.com/perrito666/gollery/backend/internal/symlink"
+)
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	cmd := args[0]
+	cmdArgs := args[1:]
+
+	switch cmd {
+	case "fsck":
+		cmdFsck(cmdArgs)
+	case "migrate-state":
+		cmdMigrateState(cmdArgs)
+	case "migrate-schema":
+		cmdMigrateSchema(cmdArgs)
+	case "state-import":
+		cmdStateCopy("state-import", cmdArgs)
+	case "state-export":
+		cmdStateCopy("state-export", cmdArgs)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", cmd)
+		usage()
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: gollery <command> [flags]
+
+Commands:
+  fsck           [-config C | -root R [-state-root S]]  Check sidecar state and album.json
+                 [-remove-orphans] [-quarantine]       files and optionally repair them
+  migrate-state  [-config C | -root R -state-root S]   Move .gallery directories from the
+                 [-dry-run]                            content tree to the state root
+  migrate-schema [-config C | -root R [-state-root S]]  Upgrade sidecar state files to the
+                 [-dry-run]                            current schema version
+  state-import   [-config C] [-dsn D]                  Copy sidecar state into PostgreSQL
+  state-export   [-config C] [-dsn D]                  Copy PostgreSQL state back to sidecars
+`)
+}
+
+// libraries resolves the content and state roots from -root and
+// -state-root or, without -root, from the server config, which may list
+// several libraries.
+func libraries(root, stateRoot, configPath string) config.Libraries {
+	if root != "" {
+		return config.Libraries{{Root: root, StateRoot: stateRoot}}
+	}
+	cfg, err := config.LoadServerConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.ContentRoot == "" && len(cfg.Libraries) == 0 {
+		fmt.Fprintf(os.Stderr, "error: %s has no content_root or libraries\n", configPath)
+		os.Exit(1)
+	}
+	return cfg.ContentLibraries()
+}
+
+func cmdFsck(args []string) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	configPath := fs.String("config", "gollery.json", "path to server config")
+	root := fs.String("root", "", "content root (overrides -config)")
+	stateRoot := fs.String("state-root", "", "state root, with -root")
+	removeOrphans := fs.Bool("remove-orphans", false, "delete sidecars whose file no longer exists")
+	quarantine := fs.Bool("quarantine", false, "move unparseable state files to .gallery/quarantine/")
+	fs.Parse(args)
+
+	libs := libraries(*root, *stateRoot, *configPath)
+	for _, lib := range libs {
+		state.SetStateRoot(lib.Root, lib.StateRoot)
+	}
+	var links *symlink.Policy
+	if *root == "" {
+		cfg, err := config.LoadServerConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		links = symlink.New(cfg.FollowSymlinks.Roots())
+		if cfg.State != nil && cfg.State.Backend == "postgres" {
+			db, err := openStateDB(context.Background(), cfg, cfg.State.PostgresDSNEnv)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+			state.SetBackend(db)
+		}
+	}
+	report, err := fsck.CheckLibraries(libs, fsck.Options{
+		Links:         links,
+		RemoveOrphans: *removeOrphans,
+		Quarantine:    *quarantine,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, f := range report.Findings {
+		action := ""
+		if f.Action != "" {
+			action = " [" + f.Action + "]"
+		}
+		fmt.Printf("%-17s %s: %s%s\n", f.Kind, f.Path, f.Detail, action)
+	}
+	unresolved := report.Unresolved()
+	fmt.Printf("Checked %d directories and %d sidecars: %d problems, %d unresolved.\n",
+		report.DirsChecked, report.SidecarsChecked, len(report.Findings), unresolved)
+	if unresolved > 0 {
+		os.Exit(1)
+	}
+}
+
+func cmdMigrateState(args []string) {
+	fs := flag.NewFlagSet("migrate-state", flag.ExitOnError)
+	configPath := fs.String("config", "gollery.json", "path to server config")
+	root := fs.String("root", "", "content root (overrides -config)")
+	stateRoot := fs.String("state-root", "", "state root, with -root")
+	dryRun := fs.Bool("dry-run", false, "report what would be moved without moving it")
+	fs.Parse(args)
+
+	var libs config.Libraries
+	for _, lib := range libraries(*root, *stateRoot, *configPath) {
+		if lib.StateRoot != "" {
+			libs = append(libs, lib)
+		}
+	}
+	if len(libs) == 0 {
+		fmt.Fprintln(os.Stderr, "error: no state root: set state_root in the config or pass -root and -state-root")
+		os.Exit(1)
+	}
+
+	var moves []state.Relocation
+	var err error
+	for _, lib := range libs {
+		var m []state.Relocation
+		m, err = state.MoveToStateRoot(lib.Root, lib.StateRoot, *dryRun)
+		moves = append(moves, m...)
+		if err != nil {
+			break
+		}
+	}
+	failed := 0
+	for _, m := range moves {
+		if m.Err != nil {
+			failed++
+			fmt.Printf("FAILED %s: %v\n", m.From, m.Err)
+			continue
+		}
+		fmt.Printf("%s -> %s\n", m.From, m.To)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	verb := "Moved"
+	if *dryRun {
+		verb = "Would move"
+	}
+	fmt.Printf("%s %d .gallery directories, %d failed.\n", verb, len(moves)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func cmdMigrateSchema(args []string) {
+	fs := flag.NewFlagSet("migrate-schema", flag.ExitOnError)
+	configPath := fs.String("config", "gollery.json", "path to server config")
+	root := fs.String("root", "", "content root (overrides -config)")
+	stateRoot := fs.String("state-root", "", "state root, with -root")
+	dryRun := fs.Bool("dry-run", false, "report what would be upgraded without writing")
+	fs.Parse(args)
+
+	var upgrades []state.SchemaUpgrade
+	var err error
+	for _, lib := range libraries(*root, *stateRoot, *configPath) {
+		state.SetStateRoot(lib.Root, lib.StateRoot)
+		var u []state.SchemaUpgrade
+		u, err = state.UpgradeSidecars(lib.Root, *dryRun)
+		upgrades = append(upgrades, u...)
+		if err != nil {
+			break
+		}
+	}
+	failed := 0
+	for _, u := range upgrades {
+		if u.Err != nil {
+			failed++
+			fmt.Printf("FAILED %s: %v\n", u.Path, u.Err)
+			continue
+		}
+		fmt.Printf("%s: %s v%d -> v%d\n", u.Path, u.Kind, u.From, u.To)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	verb := "Upgraded"
+	if *dryRun {
+		verb = "Would upgrade"
+	}
+	fmt.Printf("%s %d state files, %d failed.\n", verb, len(upgrades)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// cmdStateCopy copies state from the sidecars to PostgreSQL (state-import)
+// or back (state-export). Sidecars are read and written where the server
+// keeps them, under state_root if one is set.
+func cmdStateCopy(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := fs.String("config", "gollery.json", "path to server config")
+	dsn := fs.String("dsn", "", "postgres DSN (default: state.postgres_dsn_env from the config)")
+	fs.Parse(args)
+
+	cfg, err := config.LoadServerConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if *dsn == "" && cfg.State != nil {
+		*dsn = cfg.State.PostgresDSNEnv
+	}
+	if (cfg.ContentRoot == "" && len(cfg.Libraries) == 0) || *dsn == "" {
+		fmt.Fprintln(os.Stderr, "error: content_root or libraries and a postgres DSN (-dsn or state.postgres_dsn_env) are required")
+		os.Exit(1)
+	}
+	libs := cfg.ContentLibraries()
+	for _, lib := range libs {
+		state.SetStateRoot(lib.Root, lib.StateRoot)
+	}
+
+	db, err := openStateDB(context.Background(), cfg, *dsn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	var dst, src state.Backend = db, state.Sidecars{}
+	if name == "state-export" {
+		dst, src = src, dst
+	}
+	report := &state.CopyReport{}
+	for _, lib := range libs {
+		var r *state.CopyReport
+		r, err = state.Copy(dst, src, lib.Root)
+		if r != nil {
+			report.Albums += r.Albums
+			report.Assets += r.Assets
+			report.Errors = append(report.Errors, r.Errors...)
+		}
+		if err != nil {
+			break
+		}
+	}
+	for _, e := range report.Errors {
+		fmt.Printf("FAILED %v\n", e)
+	}
+	fmt.Printf("Copied %d albums and %d assets, %d failed.\n", report.Albums, report.Assets, len(report.Errors))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+// openStateDB connects to the postgres state backend at dsn for the
+// libraries of cfg and brings its schema up to date.
+func openStateDB(ctx context.Context, cfg *config.ServerConfig, dsn string) (*pgstate.Backend, error) {
+	pool, err := pgstate.Connect(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db := pgstate.New(pool, cfg.ContentRoot)
+	if libs := cfg.ContentLibraries(); libs.Named() {
+		db = pgstate.NewLibraries(pool, libs.Roots())
+	}
+	if err := db.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -6,6 +6,7 @@ require (
 	github.com/jackc/pgx/v5 v5.8.0
 	github.com/jackc/tern/v2 v2.3.5
 	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
+	github.com/zsefvlol/timezonemapper v1.0.0
 	golang.org/x/crypto v0.49.0
 	golang.org/x/image v0.36.0
 	golang.org/x/time v0.15.0
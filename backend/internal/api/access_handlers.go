@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
-	"path/filepath"
 
 	"github.com/perrito666/gollery/backend/internal/config"
 	"github.com/perrito666/gollery/backend/internal/state"
@@ -100,7 +99,7 @@ func (s *Server) handleAssetAccessPatch(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	albumAbsPath := filepath.Join(s.contentRoot, asset.AlbumPath)
+	albumAbsPath := s.albumDir(asset.AlbumPath)
 	st, err := state.LoadAssetState(albumAbsPath, asset.Filename)
 	if err != nil {
 		slog.Error("loading asset state", "asset_id", id, "error", err)
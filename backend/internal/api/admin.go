@@ -1,11 +1,16 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"path/filepath"
 	"time"
 
 	"github.com/perrito666/gollery/backend/internal/auth"
+	"github.com/perrito666/gollery/backend/internal/fsck"
+	"github.com/perrito666/gollery/backend/internal/index"
 )
 
 // StatusResponse is the JSON body for GET /api/v1/admin/status.
@@ -15,11 +20,63 @@ type StatusResponse struct {
 	ContentRoot string `json:"content_root"`
 	AlbumCount  int    `json:"album_count"`
 	AssetCount  int    `json:"asset_count"`
+
+	// Libraries maps library names to their roots, when the gallery spans
+	// several content roots.
+	Libraries map[string]string `json:"libraries,omitempty"`
 }
 
 // DiagnosticsResponse is the JSON body for GET /api/v1/admin/diagnostics.
 type DiagnosticsResponse struct {
 	ScanErrors []string `json:"scan_errors"`
+
+	// IdentityIssues are stable-ID problems found by the last index,
+	// such as a new file matching several vanished assets.
+	IdentityIssues []string `json:"identity_issues"`
+}
+
+// ReindexProgressResponse is the JSON body for GET /api/v1/admin/reindex.
+// The counters belong to the current run while one is in progress, and to
+// the last one otherwise.
+type ReindexProgressResponse struct {
+	// Kind is "initial", "full" or "incremental".
+	Kind string `json:"kind,omitempty"`
+	// Phase is "idle", "scanning" or "indexing".
+	Phase      string     `json:"phase"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+
+	DirsScanned int64 `json:"dirs_scanned"`
+	AlbumsDone  int64 `json:"albums_done"`
+	AlbumsTotal int64 `json:"albums_total"`
+	AssetsDone  int64 `json:"assets_done"`
+	AssetsTotal int64 `json:"assets_total"`
+}
+
+// FsckRequest is the JSON body for POST /api/v1/admin/fsck. Without
+// either flag the check only reports.
+type FsckRequest struct {
+	RemoveOrphans bool `json:"remove_orphans"`
+	Quarantine    bool `json:"quarantine"`
+}
+
+// FsckResponse is the JSON body for GET and POST /api/v1/admin/fsck.
+type FsckResponse struct {
+	DirsChecked     int           `json:"dirs_checked"`
+	SidecarsChecked int           `json:"sidecars_checked"`
+	Unresolved      int           `json:"unresolved"`
+	Findings        []FsckFinding `json:"findings"`
+}
+
+// FsckFinding is one problem in a [FsckResponse].
+type FsckFinding struct {
+	// Kind is "orphaned_sidecar", "corrupt_state", "invalid_config" or
+	// "unreadable".
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Detail string `json:"detail"`
+	Action string `json:"action,omitempty"`
 }
 
 // requireGlobalAdmin checks that the principal is a global admin.
@@ -51,6 +108,36 @@ func (s *Server) handleAdminReindex(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "reindex complete"})
 }
 
+func (s *Server) handleAdminReindexProgress(w http.ResponseWriter, r *http.Request) {
+	if !s.requireGlobalAdmin(w, r) {
+		return
+	}
+
+	if s.indexProgress == nil {
+		writeJSON(w, http.StatusOK, ReindexProgressResponse{Phase: index.PhaseIdle})
+		return
+	}
+
+	p := s.indexProgress.Report()
+	resp := ReindexProgressResponse{
+		Kind:        p.Kind,
+		Phase:       p.Phase,
+		LastError:   p.LastError,
+		DirsScanned: p.DirsScanned,
+		AlbumsDone:  p.AlbumsDone,
+		AlbumsTotal: p.AlbumsTotal,
+		AssetsDone:  p.AssetsDone,
+		AssetsTotal: p.AssetsTotal,
+	}
+	if !p.StartedAt.IsZero() {
+		resp.StartedAt = &p.StartedAt
+	}
+	if !p.FinishedAt.IsZero() {
+		resp.FinishedAt = &p.FinishedAt
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
 func (s *Server) handleAdminStatus(w http.ResponseWriter, r *http.Request) {
 	if !s.requireGlobalAdmin(w, r) {
 		return
@@ -66,6 +153,12 @@ func (s *Server) handleAdminStatus(w http.ResponseWriter, r *http.Request) {
 		AlbumCount:  len(s.albumsByID),
 		AssetCount:  len(s.assetsByID),
 	}
+	if s.libraries.Named() {
+		resp.Libraries = make(map[string]string, len(s.libraries))
+		for _, lib := range s.libraries {
+			resp.Libraries[lib.Name] = lib.Root
+		}
+	}
 	writeJSON(w, http.StatusOK, resp)
 }
 
@@ -81,5 +174,60 @@ func (s *Server) handleAdminDiagnostics(w http.ResponseWriter, r *http.Request)
 	if errs == nil {
 		errs = []string{}
 	}
-	writeJSON(w, http.StatusOK, DiagnosticsResponse{ScanErrors: errs})
+	issues := make([]string, len(s.snapshot.IdentityIssues))
+	for i, issue := range s.snapshot.IdentityIssues {
+		issues[i] = fmt.Sprintf("%s: %s", filepath.Join(issue.AlbumPath, issue.Filename), issue.Message)
+	}
+	writeJSON(w, http.StatusOK, DiagnosticsResponse{ScanErrors: errs, IdentityIssues: issues})
+}
+
+func (s *Server) handleAdminFsck(w http.ResponseWriter, r *http.Request) {
+	if !s.requireGlobalAdmin(w, r) {
+		return
+	}
+	s.runFsck(w, fsck.Options{})
+}
+
+func (s *Server) handleAdminFsckRepair(w http.ResponseWriter, r *http.Request) {
+	if !s.requireGlobalAdmin(w, r) {
+		return
+	}
+	var req FsckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	s.runFsck(w, fsck.Options{RemoveOrphans: req.RemoveOrphans, Quarantine: req.Quarantine})
+}
+
+func (s *Server) runFsck(w http.ResponseWriter, opts fsck.Options) {
+	s.mu.RLock()
+	libs := s.libraries
+	opts.Links = s.links
+	s.mu.RUnlock()
+	if len(libs) == 0 {
+		writeError(w, http.StatusServiceUnavailable, "content root not configured")
+		return
+	}
+
+	if (opts.RemoveOrphans || opts.Quarantine) && s.indexLock != nil {
+		s.indexLock.Lock()
+		defer s.indexLock.Unlock()
+	}
+	report, err := fsck.CheckLibraries(libs, opts)
+	if err != nil {
+		slog.Error("fsck failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "fsck failed")
+		return
+	}
+	resp := FsckResponse{
+		DirsChecked:     report.DirsChecked,
+		SidecarsChecked: report.SidecarsChecked,
+		Unresolved:      report.Unresolved(),
+		Findings:        make([]FsckFinding, len(report.Findings)),
+	}
+	for i, f := range report.Findings {
+		resp.Findings[i] = FsckFinding{Kind: f.Kind, Path: f.Path, Detail: f.Detail, Action: f.Action}
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
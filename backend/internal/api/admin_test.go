@@ -4,10 +4,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/perrito666/gollery/backend/internal/auth"
 	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/index"
 )
 
 func adminServer(t *testing.T) http.Handler {
@@ -99,3 +104,148 @@ func TestAdminDiagnostics(t *testing.T) {
 		t.Errorf("scan_errors count = %d, want 1", len(resp.ScanErrors))
 	}
 }
+
+func TestAdminDiagnostics_IdentityIssues(t *testing.T) {
+	snap, cfgs := testSnapshot()
+	snap.IdentityIssues = []domain.IdentityIssue{
+		{AlbumPath: "landscapes", Filename: "copy.jpg", Message: "content matches 2 vanished assets"},
+	}
+	srv := NewServer(snap, cfgs)
+	fa := &fakeAuthenticator{
+		users: map[string]*domain.Principal{"admin:admin": {Username: "admin", IsAdmin: true}},
+	}
+	srv.SetAuth(fa, auth.NewCookieSessionStore("test-secret"), "csrf-test-secret", nil)
+	handler := srv.Handler()
+	cookie, _ := loginAs(t, handler, "admin", "admin")
+
+	req := httptest.NewRequest("GET", "/api/v1/admin/diagnostics", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var resp DiagnosticsResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	want := filepath.Join("landscapes", "copy.jpg") + ": content matches 2 vanished assets"
+	if len(resp.IdentityIssues) != 1 || resp.IdentityIssues[0] != want {
+		t.Errorf("identity_issues = %q, want [%q]", resp.IdentityIssues, want)
+	}
+}
+
+func TestAdminFsck(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".gallery", "assets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	orphan := filepath.Join(root, ".gallery", "assets", "gone.jpg.json")
+	if err := os.WriteFile(orphan, []byte(`{"object_id": "ast_gone"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, cfgs := testSnapshot()
+	srv := NewServer(snap, cfgs)
+	srv.SetContentRoot(root, nil)
+	lock := &countingLocker{}
+	srv.SetIndexLock(lock)
+	fa := &fakeAuthenticator{
+		users: map[string]*domain.Principal{
+			"admin:admin": {Username: "admin", IsAdmin: true},
+			"alice:pass":  {Username: "alice"},
+		},
+	}
+	srv.SetAuth(fa, auth.NewCookieSessionStore("test-secret"), "csrf-test-secret", nil)
+	handler := srv.Handler()
+
+	aliceCookie, _ := loginAs(t, handler, "alice", "pass")
+	req := httptest.NewRequest("GET", "/api/v1/admin/fsck", nil)
+	req.AddCookie(aliceCookie)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("non-admin fsck = %d, want 403", rr.Code)
+	}
+
+	cookie, csrf := loginAs(t, handler, "admin", "admin")
+	req = httptest.NewRequest("GET", "/api/v1/admin/fsck", nil)
+	req.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	var resp FsckResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if rr.Code != http.StatusOK || resp.Unresolved != 1 || resp.Findings[0].Kind != "orphaned_sidecar" {
+		t.Fatalf("GET fsck = %d %+v", rr.Code, resp)
+	}
+	if lock.locks != 0 {
+		t.Errorf("check took the index lock %d times, want 0", lock.locks)
+	}
+
+	req = httptest.NewRequest("POST", "/api/v1/admin/fsck", strings.NewReader(`{"remove_orphans": true}`))
+	req.AddCookie(cookie)
+	req.Header.Set("X-CSRF-Token", csrf)
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	resp = FsckResponse{}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if rr.Code != http.StatusOK || resp.Unresolved != 0 || resp.Findings[0].Action != "removed" {
+		t.Fatalf("POST fsck = %d %+v", rr.Code, resp)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("orphaned sidecar should have been removed")
+	}
+	if lock.locks != 1 {
+		t.Errorf("repair took the index lock %d times, want 1", lock.locks)
+	}
+}
+
+// countingLocker is a mutex that counts how often it was locked.
+type countingLocker struct {
+	sync.Mutex
+	locks int
+}
+
+func (l *countingLocker) Lock() {
+	l.Mutex.Lock()
+	l.locks++
+}
+
+func TestAdminReindexProgress(t *testing.T) {
+	snap, cfgs := testSnapshot()
+	srv := NewServer(snap, cfgs)
+	progress := &index.Progress{}
+	srv.SetIndexProgress(progress)
+	fa := &fakeAuthenticator{
+		users: map[string]*domain.Principal{
+			"admin:admin": {Username: "admin", IsAdmin: true},
+			"alice:pass":  {Username: "alice"},
+		},
+	}
+	srv.SetAuth(fa, auth.NewCookieSessionStore("test-secret"), "csrf-test-secret", nil)
+	handler := srv.Handler()
+
+	if rr := doRequest(handler, "GET", "/api/v1/admin/reindex", nil); rr.Code != http.StatusForbidden {
+		t.Errorf("anonymous progress = %d, want 403", rr.Code)
+	}
+
+	progress.Start("full")
+	progress.DirScanned()
+	progress.DirScanned()
+	progress.Indexing()
+
+	cookie, _ := loginAs(t, handler, "admin", "admin")
+	req := httptest.NewRequest("GET", "/api/v1/admin/reindex", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("progress = %d, want 200", rr.Code)
+	}
+
+	var resp ReindexProgressResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Kind != "full" || resp.Phase != "indexing" || resp.DirsScanned != 2 {
+		t.Errorf("progress = %+v", resp)
+	}
+	if resp.StartedAt == nil || resp.FinishedAt != nil {
+		t.Errorf("running progress should have started_at only: %+v", resp)
+	}
+}
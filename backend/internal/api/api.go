@@ -6,7 +6,8 @@
 //
 //   - A [domain.Snapshot] with the full album/asset tree (read-locked).
 //   - In-memory indexes: albumsByID, albumsByPath, assetsByID — built
-//     from the snapshot for O(1) lookups.
+//     from the snapshot for O(1) lookups — and a grid spatial index of
+//     geotagged assets for map bounding-box queries.
 //   - Album configs (merged) keyed by path, used for ACL evaluation.
 //   - Optional subsystems: auth, discussions, analytics, cache/derivatives.
 //
@@ -68,6 +69,9 @@ import (
 	"github.com/perrito666/gollery/backend/internal/config"
 	"github.com/perrito666/gollery/backend/internal/discussion"
 	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/geo"
+	"github.com/perrito666/gollery/backend/internal/index"
+	"github.com/perrito666/gollery/backend/internal/symlink"
 )
 
 // APIError is the standard error response body.
@@ -87,13 +91,18 @@ type AlbumResponse struct {
 	Children    []ChildAlbumSummary `json:"children"`
 	Assets      []AssetSummary      `json:"assets"`
 	TotalAssets int                 `json:"total_assets"`
+
+	// CoverAssetID is the asset to show as the album's cover, among
+	// those the viewer may see. Empty when there is none.
+	CoverAssetID string `json:"cover_asset_id,omitempty"`
 }
 
 // ChildAlbumSummary is a brief representation of a child album.
 type ChildAlbumSummary struct {
-	ID    string `json:"id"`
-	Path  string `json:"path"`
-	Title string `json:"title,omitempty"`
+	ID           string `json:"id"`
+	Path         string `json:"path"`
+	Title        string `json:"title,omitempty"`
+	CoverAssetID string `json:"cover_asset_id,omitempty"`
 }
 
 // AssetSummary is a brief representation of an asset within an album listing.
@@ -111,6 +120,8 @@ type AssetResponse struct {
 	Filename    string   `json:"filename"`
 	Title       string   `json:"title,omitempty"`
 	Description string   `json:"description,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Rating      int      `json:"rating,omitempty"`
 	AlbumPath   string   `json:"album_path"`
 	AlbumID     string   `json:"album_id"`
 	SizeBytes   int64    `json:"size_bytes"`
@@ -119,13 +130,33 @@ type AssetResponse struct {
 	GeoURI      *string  `json:"geo_uri,omitempty"`
 	Latitude    *float64 `json:"latitude,omitempty"`
 	Longitude   *float64 `json:"longitude,omitempty"`
+	Altitude    *float64 `json:"altitude,omitempty"`
+
+	Place *PlaceResponse `json:"place,omitempty"`
 }
 
 // MetadataPatchRequest is the JSON body for PATCH /api/v1/assets/{id}/metadata
-// and PATCH /api/v1/albums/{id}/metadata.
+// and PATCH /api/v1/albums/{id}/metadata. Keywords and Rating apply to
+// assets only.
 type MetadataPatchRequest struct {
-	Title       *string `json:"title,omitempty"`
-	Description *string `json:"description,omitempty"`
+	Title       *string  `json:"title,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Rating      *int     `json:"rating,omitempty"`
+}
+
+// AlbumCoverRequest is the JSON body for PATCH /api/v1/albums/{id}/cover.
+// An empty AssetID clears the admin's pick.
+type AlbumCoverRequest struct {
+	AssetID string `json:"asset_id"`
+}
+
+// AlbumOrderRequest is the JSON body for PATCH /api/v1/albums/{id}/order,
+// listing asset and child album IDs in the order the "manual" sort orders
+// show them. An omitted list is left unchanged; an empty one clears it.
+type AlbumOrderRequest struct {
+	AssetIDs []string `json:"asset_ids,omitempty"`
+	ChildIDs []string `json:"child_ids,omitempty"`
 }
 
 // LoginRequest is the JSON body for POST /api/v1/auth/login.
@@ -200,12 +231,17 @@ type Server struct {
 	snapshot    *domain.Snapshot
 	configs     map[string]*config.AlbumConfig // keyed by album path
 	contentRoot string
+	libraries   config.Libraries
+	links       *symlink.Policy
 	cacheLayout *cache.Layout
 
 	// indexes built from snapshot
 	albumsByID   map[string]*domain.Album
 	albumsByPath map[string]*domain.Album
 	assetsByID   map[string]*domain.Asset
+	geoIndex     *geoIndex
+	takenIndex   map[string][]takenEntry
+	homeZones    []geo.Zone
 
 	// auth dependencies (optional, nil means no auth endpoints)
 	authenticator auth.Authenticator
@@ -221,6 +257,9 @@ type Server struct {
 
 	// admin support
 	reindexFunc    func() error
+	refreshFunc    func(albumPaths []string, prepare func() error) error
+	indexProgress  *index.Progress
+	indexLock      sync.Locker
 	startTime      time.Time
 	lastScanErrors []string
 }
@@ -246,12 +285,36 @@ func (s *Server) SetAuth(authenticator auth.Authenticator, sessions *auth.Cookie
 
 // SetContentRoot configures the filesystem paths for derivative generation.
 func (s *Server) SetContentRoot(contentRoot string, cacheLayout *cache.Layout) {
+	s.SetLibraries(config.Libraries{{Root: contentRoot}}, cacheLayout)
+}
+
+// SetLibraries is SetContentRoot for a gallery spanning several content
+// roots, whose album paths start with the library name.
+func (s *Server) SetLibraries(libs config.Libraries, cacheLayout *cache.Layout) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.contentRoot = contentRoot
+	s.libraries = libs
+	s.contentRoot = ""
+	if !libs.Named() && len(libs) == 1 {
+		s.contentRoot = libs[0].Root
+	}
 	s.cacheLayout = cacheLayout
 }
 
+// SetLinks sets the policy the scanner follows symbolic links by, so
+// fsck checks the albums reached through them too.
+func (s *Server) SetLinks(p *symlink.Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links = p
+}
+
+// albumDir returns the directory of the album at albumPath, or "" for the
+// virtual root above several libraries, which has none.
+func (s *Server) albumDir(albumPath string) string {
+	return s.libraries.Dir(albumPath)
+}
+
 // SetDiscussions configures the discussion service.
 func (s *Server) SetDiscussions(svc *discussion.Service) {
 	s.discussions = svc
@@ -267,6 +330,24 @@ func (s *Server) SetAdmin(reindexFunc func() error) {
 	s.reindexFunc = reindexFunc
 }
 
+// SetRefresh sets how albums are rebuilt after their state was changed
+// on a request: fn runs prepare, then rebuilds the albums at albumPaths
+// incrementally, both under the indexer's lock.
+func (s *Server) SetRefresh(fn func(albumPaths []string, prepare func() error) error) {
+	s.refreshFunc = fn
+}
+
+// SetIndexLock sets the lock (re)index runs hold. fsck repairs take it
+// so they never remove or move state files while an index run reads them.
+func (s *Server) SetIndexLock(l sync.Locker) {
+	s.indexLock = l
+}
+
+// SetIndexProgress exposes the progress of (re)index runs to admins.
+func (s *Server) SetIndexProgress(p *index.Progress) {
+	s.indexProgress = p
+}
+
 // SetScanErrors stores the last scan errors for diagnostics.
 func (s *Server) SetScanErrors(errs []string) {
 	s.mu.Lock()
@@ -285,14 +366,42 @@ func (s *Server) SetSnapshot(snap *domain.Snapshot, configs map[string]*config.A
 	s.albumsByPath = make(map[string]*domain.Album, len(snap.Albums))
 	s.assetsByID = make(map[string]*domain.Asset)
 
+	// The index re-mints duplicate IDs, so a collision here means a
+	// snapshot that bypassed it; one of the objects becomes unreachable.
 	for _, album := range snap.Albums {
+		if other, ok := s.albumsByID[album.ID]; ok {
+			slog.Warn("duplicate album ID", "id", album.ID, "path", album.Path, "other", other.Path)
+		}
 		s.albumsByID[album.ID] = album
 		s.albumsByPath[album.Path] = album
 		for i := range album.Assets {
 			asset := &album.Assets[i]
+			if other, ok := s.assetsByID[asset.ID]; ok {
+				slog.Warn("duplicate asset ID", "id", asset.ID, "album", asset.AlbumPath, "other_album", other.AlbumPath)
+			}
 			s.assetsByID[asset.ID] = asset
 		}
 	}
+	s.geoIndex = buildGeoIndex(snap, configs, s.homeZones)
+	s.takenIndex = buildTakenIndex(snap, configs)
+}
+
+// ReadSnapshot calls fn with the current snapshot, configs and scan
+// errors under the read lock, so they are not modified while fn runs
+// (e.g. by the location and metadata handlers). fn must not retain them.
+func (s *Server) ReadSnapshot(fn func(snap *domain.Snapshot, configs map[string]*config.AlbumConfig, scanErrors []string) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(s.snapshot, s.configs, s.lastScanErrors)
+}
+
+// SetHomeZones configures the private areas whose coordinates are never
+// shown to non-admins.
+func (s *Server) SetHomeZones(zones []config.HomeZone) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.homeZones = homeZones(zones)
+	s.geoIndex = buildGeoIndex(s.snapshot, s.configs, s.homeZones)
 }
 
 // Handler returns an http.Handler with all API routes registered.
@@ -305,6 +414,7 @@ func (s *Server) Handler() http.Handler {
 
 	mux.HandleFunc("GET /api/v1/albums/root", s.handleAlbumsRoot)
 	mux.HandleFunc("GET /api/v1/albums/{id}", s.handleAlbumByID)
+	mux.HandleFunc("GET /api/v1/albums/{id}/tracks.geojson", s.handleAlbumTracks)
 	mux.HandleFunc("GET /api/v1/assets/{id}", s.handleAssetByID)
 	mux.HandleFunc("GET /api/v1/assets/{id}/thumbnail", s.handleAssetThumbnail)
 	mux.HandleFunc("GET /api/v1/assets/{id}/preview", s.handleAssetPreview)
@@ -319,8 +429,11 @@ func (s *Server) Handler() http.Handler {
 
 	// Admin routes
 	mux.HandleFunc("POST /api/v1/admin/reindex", s.handleAdminReindex)
+	mux.HandleFunc("GET /api/v1/admin/reindex", s.handleAdminReindexProgress)
 	mux.HandleFunc("GET /api/v1/admin/status", s.handleAdminStatus)
 	mux.HandleFunc("GET /api/v1/admin/diagnostics", s.handleAdminDiagnostics)
+	mux.HandleFunc("GET /api/v1/admin/fsck", s.handleAdminFsck)
+	mux.HandleFunc("POST /api/v1/admin/fsck", s.handleAdminFsckRepair)
 
 	// Analytics routes
 	if s.analyticsStore != nil {
@@ -334,6 +447,13 @@ func (s *Server) Handler() http.Handler {
 	// Album path query
 	mux.HandleFunc("GET /api/v1/albums", s.handleAlbumsByPath)
 
+	// Place browsing (reverse-geocoded asset locations)
+	mux.HandleFunc("GET /api/v1/places", s.handlePlaces)
+	mux.HandleFunc("GET /api/v1/places/assets", s.handlePlaceAssets)
+
+	// Map clustering of geotagged assets
+	mux.HandleFunc("GET /api/v1/geo/assets", s.handleGeoAssets)
+
 	mux.HandleFunc("GET /api/v1/albums/{id}/access", s.handleAlbumAccess)
 	mux.HandleFunc("GET /api/v1/assets/{id}/access", s.handleAssetAccess)
 	mux.HandleFunc("PATCH /api/v1/assets/{id}/access", s.handleAssetAccessPatch)
@@ -341,6 +461,13 @@ func (s *Server) Handler() http.Handler {
 	// Metadata editing (admin only)
 	mux.HandleFunc("PATCH /api/v1/assets/{id}/metadata", s.handleAssetMetadataPatch)
 	mux.HandleFunc("PATCH /api/v1/albums/{id}/metadata", s.handleAlbumMetadataPatch)
+	mux.HandleFunc("PATCH /api/v1/albums/{id}/cover", s.handleAlbumCoverPatch)
+	mux.HandleFunc("PATCH /api/v1/albums/{id}/order", s.handleAlbumOrderPatch)
+
+	// Manual geotagging
+	mux.HandleFunc("PATCH /api/v1/assets/{id}/location", s.handleAssetLocationPatch)
+	mux.HandleFunc("POST /api/v1/assets/{id}/location/resolve", s.handleAssetLocationResolve)
+	mux.HandleFunc("PATCH /api/v1/assets/locations", s.handleBulkLocationPatch)
 
 	// Share routes for OpenGraph meta tags (no auth required, anonymous access).
 	mux.HandleFunc("GET /share/assets/{id}", s.handleShareAsset)
@@ -505,8 +632,10 @@ func (s *Server) requireAdmin(w http.ResponseWriter, r *http.Request, album *dom
 func (s *Server) responseOpts(r *http.Request) albumResponseOpts {
 	return albumResponseOpts{
 		albumsByPath: s.albumsByPath,
+		takenIndex:   s.takenIndex,
 		configs:      s.configs,
 		principal:    auth.PrincipalFromContext(r.Context()),
+		homeZones:    s.homeZones,
 	}
 }
 
@@ -572,8 +701,10 @@ const (
 // by the current user's access level.
 type albumResponseOpts struct {
 	albumsByPath map[string]*domain.Album
+	takenIndex   map[string][]takenEntry
 	configs      map[string]*config.AlbumConfig
 	principal    *domain.Principal
+	homeZones    []geo.Zone
 }
 
 func albumToResponse(a *domain.Album, opts albumResponseOpts, offset, limit int) AlbumResponse {
@@ -589,48 +720,29 @@ func albumToResponse(a *domain.Album, opts albumResponseOpts, offset, limit int)
 	}
 
 	// Sort visible assets according to album config.
-	sortOrder := ""
+	sortOrder, childSortOrder := "", ""
 	if cfg, ok := opts.configs[a.Path]; ok {
-		sortOrder = cfg.SortOrder
+		sortOrder, childSortOrder = cfg.SortOrder, cfg.ChildSortOrder
 	}
-	sortAssets(visible, sortOrder)
+	sortAssets(a, visible, sortOrder)
 
 	total := len(visible)
+	start, end := pageBounds(total, offset, limit)
 
-	// Clamp offset.
-	if offset < 0 {
-		offset = 0
-	}
-	if offset > total {
-		offset = total
-	}
-
-	// Clamp limit.
-	if limit <= 0 {
-		limit = defaultPageLimit
-	}
-	if limit > maxPageLimit {
-		limit = maxPageLimit
-	}
-
-	end := offset + limit
-	if end > total {
-		end = total
-	}
-
-	page := visible[offset:end]
+	page := visible[start:end]
+	geoPol := newGeoPolicy(opts.configs, a.Path, opts.principal, opts.homeZones)
 	assets := make([]AssetSummary, len(page))
-	for i, ast := range page {
+	for i := range page {
+		ast := &page[i]
 		summary := AssetSummary{ID: ast.ID, Filename: ast.Filename, Title: ast.Title, Description: ast.Description}
-		if ast.Metadata != nil && ast.Metadata.Latitude != nil && ast.Metadata.Longitude != nil {
-			summary.HasLocation = true
-		}
+		_, _, _, summary.HasLocation = geoPol.locate(ast)
 		assets[i] = summary
 	}
 
 	// Filter children the principal can view.
 	children := make([]ChildAlbumSummary, 0, len(a.Children))
-	for _, childPath := range a.Children {
+	taken := func(path string) time.Time { return visibleTaken(opts.takenIndex[path], opts.principal) }
+	for _, childPath := range sortChildren(a, opts.albumsByPath, childSortOrder, taken) {
 		childACL := effectiveAlbumACL(opts.configs, childPath)
 		if access.CheckView(childACL, opts.principal) == access.Deny {
 			continue
@@ -639,20 +751,48 @@ func albumToResponse(a *domain.Album, opts albumResponseOpts, offset, limit int)
 		if child, ok := opts.albumsByPath[childPath]; ok {
 			cs.ID = child.ID
 			cs.Title = child.Title
+			cs.CoverAssetID = albumCover(child, opts.configs, opts.principal)
 		}
 		children = append(children, cs)
 	}
 
 	return AlbumResponse{
-		ID:          a.ID,
-		Path:        a.Path,
-		Title:       a.Title,
-		Description: a.Description,
-		ParentPath:  a.ParentPath,
-		Children:    children,
-		Assets:      assets,
-		TotalAssets: total,
+		ID:           a.ID,
+		Path:         a.Path,
+		Title:        a.Title,
+		Description:  a.Description,
+		ParentPath:   a.ParentPath,
+		Children:     children,
+		Assets:       assets,
+		TotalAssets:  total,
+		CoverAssetID: albumCover(a, opts.configs, opts.principal),
+	}
+}
+
+// pageBounds clamps offset and limit against a list of total items and
+// returns the slice bounds of the requested page.
+func pageBounds(total, offset, limit int) (start, end int) {
+	// Clamp offset.
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+
+	// Clamp limit.
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	end = offset + limit
+	if end > total {
+		end = total
 	}
+	return offset, end
 }
 
 // effectiveAlbumACL returns the AccessConfig for an album path, or nil.
@@ -4,49 +4,117 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/perrito666/gollery/backend/internal/auth"
 	"github.com/perrito666/gollery/backend/internal/derive"
 	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/meta"
 )
 
-// formatGeoURI returns a geo: URI string for the given coordinates,
-// or nil if the asset has no location.
-func formatGeoURI(asset *domain.Asset) *string {
-	if asset.Metadata == nil || asset.Metadata.Latitude == nil || asset.Metadata.Longitude == nil {
+// formatGeoURI returns a geo: URI string for the asset's coordinates as
+// the policy shows them, or nil if it has no visible location.
+func formatGeoURI(asset *domain.Asset, p geoPolicy) *string {
+	lat, lon, _, ok := p.locate(asset)
+	if !ok {
 		return nil
 	}
-	uri := fmt.Sprintf("geo:%f,%f", *asset.Metadata.Latitude, *asset.Metadata.Longitude)
+	uri := fmt.Sprintf("geo:%f,%f", lat, lon)
 	return &uri
 }
 
-// assetLatLon returns the latitude or longitude of an asset, or nil.
-func assetLatLon(asset *domain.Asset, isLat bool) *float64 {
-	if asset.Metadata == nil {
+// assetLatLon returns the latitude or longitude of an asset as the policy
+// shows it, or nil.
+func assetLatLon(asset *domain.Asset, isLat bool, p geoPolicy) *float64 {
+	lat, lon, _, ok := p.locate(asset)
+	if !ok {
 		return nil
 	}
 	if isLat {
-		return asset.Metadata.Latitude
+		return &lat
+	}
+	return &lon
+}
+
+// assetAltitude returns the altitude of an asset in meters, or nil.
+// Altitude is only shown alongside exact coordinates.
+func assetAltitude(asset *domain.Asset, p geoPolicy) *float64 {
+	if _, _, exact, ok := p.locate(asset); !ok || !exact {
+		return nil
 	}
-	return asset.Metadata.Longitude
+	return asset.Metadata.Altitude
+}
+
+// assetPlace returns the asset's place, or nil when its location is
+// withheld by the policy.
+func assetPlace(asset *domain.Asset, p geoPolicy) *PlaceResponse {
+	if !p.placeVisible(asset) {
+		return nil
+	}
+	return asset.Place
+}
+
+// sortAssets sorts a slice of album a's assets in place according to
+// sortOrder; see [config.AlbumConfig.SortOrder]. Unknown orders, including
+// "", sort by filename.
+func sortAssets(a *domain.Album, assets []domain.Asset, sortOrder string) {
+	less := assetLess(a, sortOrder)
+	sort.Slice(assets, func(i, j int) bool {
+		return less(&assets[i], &assets[j])
+	})
 }
 
-// sortAssets sorts a slice of assets in place according to sortOrder.
-// Valid values are "date" (sort by ModTime ascending) and anything else
-// (including "" and "filename") which sorts by filename ascending.
-func sortAssets(assets []domain.Asset, sortOrder string) {
-	switch sortOrder {
+// assetLess returns the ordering of album a's assets for a sort order.
+// Assets that compare equal are ordered by filename.
+func assetLess(a *domain.Album, sortOrder string) func(x, y *domain.Asset) bool {
+	order, desc := strings.CutSuffix(sortOrder, "_desc")
+	var cmp func(x, y *domain.Asset) int
+	switch order {
 	case "date":
-		sort.Slice(assets, func(i, j int) bool {
-			return assets[i].ModTime.Before(assets[j].ModTime)
-		})
+		cmp = func(x, y *domain.Asset) int { return x.ModTime.Compare(y.ModTime) }
+	case "taken":
+		cmp = func(x, y *domain.Asset) int { return assetTaken(x).Compare(assetTaken(y)) }
+	case "title":
+		cmp = func(x, y *domain.Asset) int { return compareFold(assetTitle(x), assetTitle(y)) }
+	case "manual":
+		pos := positions(a.AssetOrder)
+		cmp = func(x, y *domain.Asset) int { return comparePositions(pos, x.ID, y.ID) }
 	default:
-		sort.Slice(assets, func(i, j int) bool {
-			return assets[i].Filename < assets[j].Filename
-		})
+		cmp = func(x, y *domain.Asset) int { return strings.Compare(x.Filename, y.Filename) }
 	}
+	return func(x, y *domain.Asset) bool {
+		c := cmp(x, y)
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			return x.Filename < y.Filename
+		}
+		return c < 0
+	}
+}
+
+// assetTaken returns when an asset was captured according to its EXIF
+// data, or its modification time when that is unknown.
+func assetTaken(a *domain.Asset) time.Time {
+	if a.Metadata != nil && a.Metadata.DateTaken != nil {
+		return *a.Metadata.DateTaken
+	}
+	return a.ModTime
+}
+
+// assetTitle returns the title an asset is sorted by: its own, or its
+// filename when it has none.
+func assetTitle(a *domain.Asset) string {
+	if a.Title != "" {
+		return a.Title
+	}
+	return a.Filename
 }
 
 // findAdjacentAssets returns the previous and next asset IDs relative to
@@ -58,7 +126,7 @@ func findAdjacentAssets(album *domain.Album, assetID string, sortOrder string) (
 
 	sorted := make([]domain.Asset, len(album.Assets))
 	copy(sorted, album.Assets)
-	sortAssets(sorted, sortOrder)
+	sortAssets(album, sorted, sortOrder)
 
 	for i, a := range sorted {
 		if a.ID == assetID {
@@ -101,19 +169,24 @@ func (s *Server) handleAssetByID(w http.ResponseWriter, r *http.Request) {
 		sortOrder = cfg.SortOrder
 	}
 	prev, next := findAdjacentAssets(album, asset.ID, sortOrder)
+	geoPol := s.geoPolicy(asset.AlbumPath, auth.PrincipalFromContext(r.Context()))
 	resp := AssetResponse{
 		ID:          asset.ID,
 		Filename:    asset.Filename,
 		Title:       asset.Title,
 		Description: asset.Description,
+		Keywords:    asset.Keywords,
+		Rating:      asset.Rating,
 		AlbumPath:   asset.AlbumPath,
 		AlbumID:     album.ID,
 		SizeBytes:   asset.SizeBytes,
 		PrevAssetID: prev,
 		NextAssetID: next,
-		GeoURI:      formatGeoURI(asset),
-		Latitude:    assetLatLon(asset, true),
-		Longitude:   assetLatLon(asset, false),
+		GeoURI:      formatGeoURI(asset, geoPol),
+		Latitude:    assetLatLon(asset, true, geoPol),
+		Longitude:   assetLatLon(asset, false, geoPol),
+		Altitude:    assetAltitude(asset, geoPol),
+		Place:       assetPlace(asset, geoPol),
 	}
 	writeJSON(w, http.StatusOK, resp)
 }
@@ -138,7 +211,7 @@ func (s *Server) resolveAssetForDerivative(w http.ResponseWriter, r *http.Reques
 		return nil, "", false
 	}
 
-	srcPath := filepath.Join(s.contentRoot, asset.AlbumPath, asset.Filename)
+	srcPath := filepath.Join(s.albumDir(asset.AlbumPath), asset.Filename)
 	return asset, srcPath, true
 }
 
@@ -208,10 +281,74 @@ func (s *Server) handleAssetOriginal(w http.ResponseWriter, r *http.Request) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	_, srcPath, ok := s.resolveAssetForDerivative(w, r)
+	asset, srcPath, ok := s.resolveAssetForDerivative(w, r)
 	if !ok {
 		return
 	}
 
-	http.ServeFile(w, r, srcPath)
+	geoPol := s.geoPolicy(asset.AlbumPath, auth.PrincipalFromContext(r.Context()))
+	if geoPol.owner {
+		http.ServeFile(w, r, srcPath)
+		return
+	}
+	if _, _, exact, _ := geoPol.locate(asset); exact {
+		http.ServeFile(w, r, srcPath)
+		return
+	}
+
+	// The file may carry coordinates the policy withholds, known or not
+	// (they may have been cleared by hand). JPEGs are served with them
+	// stripped; other formats only from albums that show locations
+	// exactly, with no home zone they could fall in.
+	ext := strings.ToLower(filepath.Ext(srcPath))
+	if ext != ".jpg" && ext != ".jpeg" {
+		if !geoPol.exactTracks() || len(geoPol.zones) > 0 {
+			writeError(w, http.StatusForbidden, "original withheld for location privacy")
+			return
+		}
+		http.ServeFile(w, r, srcPath)
+		return
+	}
+	s.serveStrippedOriginal(w, r, srcPath)
+}
+
+// serveStrippedOriginal streams a JPEG original with its embedded
+// location removed.
+func (s *Server) serveStrippedOriginal(w http.ResponseWriter, r *http.Request, srcPath string) {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "original not found")
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to read original")
+		return
+	}
+	out := &strippedWriter{w: w, modTime: fi.ModTime()}
+	if err := meta.StripJPEGLocation(out, f); err != nil {
+		slog.Warn("stripping location from original", "path", srcPath, "error", err)
+		if !out.started {
+			writeError(w, http.StatusForbidden, "original withheld for location privacy")
+		}
+	}
+}
+
+// strippedWriter sets the headers of a stripped original on its first
+// write, so that a file rejected before then can still get an error
+// response.
+type strippedWriter struct {
+	w       http.ResponseWriter
+	modTime time.Time
+	started bool
+}
+
+func (sw *strippedWriter) Write(p []byte) (int, error) {
+	if !sw.started {
+		sw.started = true
+		sw.w.Header().Set("Content-Type", "image/jpeg")
+		sw.w.Header().Set("Last-Modified", sw.modTime.UTC().Format(http.TimeFormat))
+	}
+	return sw.w.Write(p)
 }
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/perrito666/gollery/backend/internal/access"
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+// albumCover returns the ID of the asset to show as the cover of album a
+// to principal: the one an admin picked, else the one album.json names,
+// else the first in the album's sort order. Only assets principal may
+// view are considered, so a restricted cover falls back to the next
+// choice. It is empty when principal can view none of the album's assets.
+func albumCover(a *domain.Album, configs map[string]*config.AlbumConfig, principal *domain.Principal) string {
+	var coverFile, sortOrder string
+	if cfg, ok := configs[a.Path]; ok {
+		coverFile, sortOrder = cfg.Cover, cfg.SortOrder
+	}
+	albumACL := effectiveAlbumACL(configs, a.Path)
+	less := assetLess(a, sortOrder)
+
+	var named, first *domain.Asset
+	for i := range a.Assets {
+		ast := &a.Assets[i]
+		if access.CheckView(access.EffectiveAssetACL(albumACL, ast.Access), principal) != access.Allow {
+			continue
+		}
+		if a.CoverID != "" && ast.ID == a.CoverID {
+			return ast.ID
+		}
+		if coverFile != "" && ast.Filename == coverFile {
+			named = ast
+		}
+		if first == nil || less(ast, first) {
+			first = ast
+		}
+	}
+	switch {
+	case named != nil:
+		return named.ID
+	case first != nil:
+		return first.ID
+	}
+	return ""
+}
+
+// handleAlbumCoverPatch sets or, with an empty asset_id, clears the cover
+// an admin picked for an album.
+func (s *Server) handleAlbumCoverPatch(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req AlbumCoverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	album, ok := s.albumsByID[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "album not found")
+		return
+	}
+
+	if !s.requireAdmin(w, r, album) {
+		return
+	}
+	if req.AssetID != "" {
+		asset, ok := s.assetsByID[req.AssetID]
+		if !ok || asset.AlbumPath != album.Path {
+			writeError(w, http.StatusBadRequest, "asset is not in this album")
+			return
+		}
+	}
+
+	albumAbsPath := s.albumDir(album.Path)
+	if albumAbsPath == "" {
+		writeError(w, http.StatusBadRequest, "album has no directory")
+		return
+	}
+	st, err := state.LoadAlbumState(albumAbsPath)
+	if err != nil {
+		slog.Error("loading album state", "album_id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to load album state")
+		return
+	}
+	if st == nil {
+		st = &state.AlbumState{ObjectID: album.ID}
+	}
+	st.CoverID = req.AssetID
+	if err := state.SaveAlbumState(albumAbsPath, st); err != nil {
+		slog.Error("saving album state", "album_id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save album state")
+		return
+	}
+
+	// Update in-memory snapshot.
+	album.CoverID = st.CoverID
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/auth"
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+// coverServer is metadataServer with a few more assets in the vacation
+// album, one of them restricted.
+func coverServer(t *testing.T, cover string) (string, http.Handler) {
+	t.Helper()
+	snap, cfgs := testSnapshot()
+	vac := snap.Albums["vacation"]
+	vac.Assets = append(vac.Assets,
+		domain.Asset{ID: "ast_3", Filename: "aardvark.jpg", AlbumPath: "vacation"},
+		domain.Asset{
+			ID:        "ast_4",
+			Filename:  "secret.jpg",
+			AlbumPath: "vacation",
+			Access:    &domain.AccessOverride{View: "restricted"},
+		},
+	)
+	cfgs["vacation"].Cover = cover
+
+	root := t.TempDir()
+	srv := NewServer(snap, cfgs)
+	srv.SetContentRoot(root, nil)
+	fa := &fakeAuthenticator{
+		users: map[string]*domain.Principal{
+			"admin:admin": {Username: "admin", IsAdmin: true},
+		},
+	}
+	srv.SetAuth(fa, auth.NewCookieSessionStore("test-secret"), "csrf-test-secret", nil)
+	return root, srv.Handler()
+}
+
+func albumCoverID(t *testing.T, handler http.Handler, id string) string {
+	t.Helper()
+	rr := doRequest(handler, "GET", "/api/v1/albums/"+id, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET album %s: status = %d", id, rr.Code)
+	}
+	var resp AlbumResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.CoverAssetID
+}
+
+func TestAlbumCover_Fallbacks(t *testing.T) {
+	_, handler := coverServer(t, "")
+	// The first asset by filename.
+	if got := albumCoverID(t, handler, "alb_vac"); got != "ast_3" {
+		t.Errorf("default cover = %q, want ast_3", got)
+	}
+
+	_, handler = coverServer(t, "beach.jpg")
+	if got := albumCoverID(t, handler, "alb_vac"); got != "ast_2" {
+		t.Errorf("album.json cover = %q, want ast_2", got)
+	}
+
+	// A restricted cover is never shown to anonymous viewers.
+	_, handler = coverServer(t, "secret.jpg")
+	if got := albumCoverID(t, handler, "alb_vac"); got != "ast_3" {
+		t.Errorf("restricted cover = %q, want ast_3", got)
+	}
+
+	album := &domain.Album{Path: "mixed", Assets: []domain.Asset{
+		{ID: "ast_5", Filename: "a.jpg", Access: &domain.AccessOverride{View: "restricted"}},
+	}}
+	cfgs := map[string]*config.AlbumConfig{"mixed": {Access: &config.AccessConfig{View: "public"}}}
+	if got := albumCover(album, cfgs, nil); got != "" {
+		t.Errorf("cover with no visible assets = %q, want none", got)
+	}
+}
+
+func TestAlbumCover_ChildSummaries(t *testing.T) {
+	_, handler := coverServer(t, "beach.jpg")
+	rr := doRequest(handler, "GET", "/api/v1/albums/alb_root", nil)
+	var resp AlbumResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Children) != 1 || resp.Children[0].CoverAssetID != "ast_2" {
+		t.Errorf("children = %+v, want vacation with cover ast_2", resp.Children)
+	}
+}
+
+func TestAlbumCoverPatch(t *testing.T) {
+	root, handler := coverServer(t, "")
+
+	rr := patchMetadata(t, handler, "/api/v1/albums/alb_vac/cover", `{"asset_id":"ast_2"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body)
+	}
+	st, err := state.LoadAlbumState(filepath.Join(root, "vacation"))
+	if err != nil || st == nil {
+		t.Fatalf("state not saved: %v", err)
+	}
+	if st.CoverID != "ast_2" {
+		t.Errorf("cover_id = %q, want ast_2", st.CoverID)
+	}
+	if got := albumCoverID(t, handler, "alb_vac"); got != "ast_2" {
+		t.Errorf("cover = %q, want ast_2", got)
+	}
+
+	// Picking a restricted asset keeps it from anonymous viewers.
+	rr = patchMetadata(t, handler, "/api/v1/albums/alb_vac/cover", `{"asset_id":"ast_4"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body)
+	}
+	if got := albumCoverID(t, handler, "alb_vac"); got != "ast_3" {
+		t.Errorf("restricted pick = %q, want ast_3", got)
+	}
+	share := doRequest(handler, "GET", "/share/albums/alb_vac", nil)
+	if strings.Contains(share.Body.String(), "ast_4") {
+		t.Error("share page exposes a restricted cover")
+	}
+
+	rr = patchMetadata(t, handler, "/api/v1/albums/alb_vac/cover", `{"asset_id":""}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("clear: status = %d, body = %s", rr.Code, rr.Body)
+	}
+	if got := albumCoverID(t, handler, "alb_vac"); got != "ast_3" {
+		t.Errorf("cleared cover = %q, want ast_3", got)
+	}
+}
+
+func TestAlbumCoverPatch_Invalid(t *testing.T) {
+	_, handler := coverServer(t, "")
+
+	tests := []struct {
+		path, body string
+		want       int
+	}{
+		{"/api/v1/albums/alb_vac/cover", `{"asset_id":"ast_1"}`, http.StatusBadRequest},
+		{"/api/v1/albums/alb_vac/cover", `{"asset_id":"ast_nope"}`, http.StatusBadRequest},
+		{"/api/v1/albums/alb_vac/cover", `not json`, http.StatusBadRequest},
+		{"/api/v1/albums/alb_nope/cover", `{"asset_id":""}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rr := patchMetadata(t, handler, tt.path, tt.body)
+		if rr.Code != tt.want {
+			t.Errorf("PATCH %s %s: status = %d, want %d", tt.path, tt.body, rr.Code, tt.want)
+		}
+	}
+
+	rr := doRequest(handler, "PATCH", "/api/v1/albums/alb_vac/cover", nil)
+	if rr.Code == http.StatusOK {
+		t.Error("anonymous PATCH should be refused")
+	}
+}
+
+func TestShareAlbum_Cover(t *testing.T) {
+	snap, cfgs := testSnapshot()
+	snap.Albums["vacation"].Assets = append(snap.Albums["vacation"].Assets,
+		domain.Asset{ID: "ast_3", Filename: "aardvark.jpg", AlbumPath: "vacation"})
+	cfgs["vacation"] = &config.AlbumConfig{
+		Title:  "Vacation",
+		Cover:  "beach.jpg",
+		Access: &config.AccessConfig{View: "public"},
+	}
+	srv := NewServer(snap, cfgs)
+
+	rr := doRequest(srv.Handler(), "GET", "/share/albums/alb_vac", nil)
+	if !strings.Contains(rr.Body.String(), "/api/v1/assets/ast_2/thumbnail?size=1200") {
+		t.Error("expected og:image with the album.json cover")
+	}
+}
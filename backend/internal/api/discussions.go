@@ -5,7 +5,6 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
-	"path/filepath"
 	"strings"
 
 	"github.com/perrito666/gollery/backend/internal/auth"
@@ -46,7 +45,12 @@ func (s *Server) handleAlbumDiscussionsList(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	albumAbsPath := filepath.Join(s.contentRoot, album.Path)
+	albumAbsPath := s.albumDir(album.Path)
+	if albumAbsPath == "" {
+		// The virtual root above several libraries has no state.
+		writeJSON(w, http.StatusOK, bindingsToResponse(nil))
+		return
+	}
 	bindings, err := s.discussions.ListBindings(albumAbsPath, "album", "")
 	if err != nil {
 		slog.Error("listing album discussions", "album_id", id, "error", err)
@@ -89,7 +93,11 @@ func (s *Server) handleAlbumDiscussionsCreate(w http.ResponseWriter, r *http.Req
 		createdBy = principal.Username
 	}
 
-	albumAbsPath := filepath.Join(s.contentRoot, album.Path)
+	albumAbsPath := s.albumDir(album.Path)
+	if albumAbsPath == "" {
+		writeError(w, http.StatusBadRequest, "album has no directory")
+		return
+	}
 
 	var binding *state.DiscussionBinding
 	var err error
@@ -143,7 +151,7 @@ func (s *Server) handleAssetDiscussionsList(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	albumAbsPath := filepath.Join(s.contentRoot, asset.AlbumPath)
+	albumAbsPath := s.albumDir(asset.AlbumPath)
 	bindings, err := s.discussions.ListBindings(albumAbsPath, "asset", asset.Filename)
 	if err != nil {
 		slog.Error("listing asset discussions", "asset_id", id, "error", err)
@@ -192,7 +200,7 @@ func (s *Server) handleAssetDiscussionsCreate(w http.ResponseWriter, r *http.Req
 		createdBy = principal.Username
 	}
 
-	albumAbsPath := filepath.Join(s.contentRoot, asset.AlbumPath)
+	albumAbsPath := s.albumDir(asset.AlbumPath)
 
 	var binding *state.DiscussionBinding
 	var err error
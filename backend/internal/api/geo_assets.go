@@ -0,0 +1,272 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/perrito666/gollery/backend/internal/access"
+	"github.com/perrito666/gollery/backend/internal/auth"
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/geo"
+)
+
+// geoIndexCellDeg is the cell size of the spatial index in degrees.
+// Queries visit every cell overlapping the bounding box, so a whole-world
+// query costs at most 360*180 map lookups.
+const geoIndexCellDeg = 1.0
+
+// geoClustersPerTile is how many cluster buckets span one 256px map tile
+// horizontally, i.e. buckets are roughly 64px wide at any zoom.
+const geoClustersPerTile = 4
+
+// geoPoint is a geotagged asset in the spatial index.
+type geoPoint struct {
+	lat, lon float64
+	asset    *domain.Asset
+}
+
+type geoCell struct{ row, col int }
+
+// geoGrid is a fixed-grid spatial index of points.
+type geoGrid map[geoCell][]geoPoint
+
+func (g geoGrid) add(p geoPoint) {
+	cell := geoCellFor(p.lat, p.lon)
+	g[cell] = append(g[cell], p)
+}
+
+// geoIndex is the spatial index over every geotagged asset of a snapshot.
+// It is rebuilt from scratch by SetSnapshot and read under s.mu.
+//
+// Locations are indexed twice: exact for album admins, and as the album's
+// geo_privacy shows them to everyone else (coarsened, or left out when
+// hidden or in a home zone). Bounding-box queries by non-admins run
+// against the public grid only, so narrowing the box cannot reveal more
+// than the coarse position.
+type geoIndex struct {
+	exact  geoGrid
+	public geoGrid
+}
+
+func geoCellFor(lat, lon float64) geoCell {
+	row := int(math.Floor(lat / geoIndexCellDeg))
+	col := int(math.Floor(lon / geoIndexCellDeg))
+	// Points on the north pole or the antimeridian belong to the last cell.
+	row = min(row, int(90/geoIndexCellDeg)-1)
+	col = min(col, int(180/geoIndexCellDeg)-1)
+	return geoCell{row, col}
+}
+
+// buildGeoIndex indexes every asset with valid coordinates.
+func buildGeoIndex(snap *domain.Snapshot, configs map[string]*config.AlbumConfig, zones []geo.Zone) *geoIndex {
+	idx := &geoIndex{exact: make(geoGrid), public: make(geoGrid)}
+	for _, album := range snap.Albums {
+		public := newGeoPolicy(configs, album.Path, nil, zones)
+		for i := range album.Assets {
+			ast := &album.Assets[i]
+			if ast.Metadata == nil || ast.Metadata.Latitude == nil || ast.Metadata.Longitude == nil {
+				continue
+			}
+			lat, lon := *ast.Metadata.Latitude, *ast.Metadata.Longitude
+			if !validLatLon(lat, lon) {
+				continue
+			}
+			idx.exact.add(geoPoint{lat: lat, lon: lon, asset: ast})
+			if lat, lon, _, ok := public.locate(ast); ok {
+				idx.public.add(geoPoint{lat: lat, lon: lon, asset: ast})
+			}
+		}
+	}
+	return idx
+}
+
+func validLatLon(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// geoBBox is a bounding box in degrees. West may be greater than east
+// when the box crosses the antimeridian.
+type geoBBox struct {
+	west, south, east, north float64
+}
+
+// parseBBox parses "west,south,east,north" (the GeoJSON / OSM order).
+func parseBBox(s string) (geoBBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return geoBBox{}, fmt.Errorf("bbox must be west,south,east,north")
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) {
+			return geoBBox{}, fmt.Errorf("bbox must be west,south,east,north")
+		}
+		v[i] = f
+	}
+	b := geoBBox{west: v[0], south: v[1], east: v[2], north: v[3]}
+	if !validLatLon(b.south, b.west) || !validLatLon(b.north, b.east) {
+		return geoBBox{}, fmt.Errorf("bbox out of range")
+	}
+	if b.south > b.north {
+		return geoBBox{}, fmt.Errorf("bbox south must not exceed north")
+	}
+	return b, nil
+}
+
+// lonRanges splits the box into one or two non-wrapping longitude ranges.
+func (b geoBBox) lonRanges() [][2]float64 {
+	if b.west <= b.east {
+		return [][2]float64{{b.west, b.east}}
+	}
+	return [][2]float64{{b.west, 180}, {-180, b.east}}
+}
+
+// query calls fn for every point of the grid inside the box.
+func (g geoGrid) query(b geoBBox, fn func(geoPoint)) {
+	minRow, maxRow := geoCellFor(b.south, 0).row, geoCellFor(b.north, 0).row
+	for _, lr := range b.lonRanges() {
+		minCol, maxCol := geoCellFor(0, lr[0]).col, geoCellFor(0, lr[1]).col
+		for row := minRow; row <= maxRow; row++ {
+			for col := minCol; col <= maxCol; col++ {
+				for _, p := range g[geoCell{row, col}] {
+					if p.lat >= b.south && p.lat <= b.north && p.lon >= lr[0] && p.lon <= lr[1] {
+						fn(p)
+					}
+				}
+			}
+		}
+	}
+}
+
+// GeoCluster is a bucket of nearby assets in GET /api/v1/geo/assets.
+type GeoCluster struct {
+	// Lat and Lon are the centroid of the bucket's assets.
+	Lat   float64 `json:"lat"`
+	Lon   float64 `json:"lon"`
+	Count int     `json:"count"`
+	// ThumbnailAssetID is the asset to show for the bucket: the highest
+	// rated one, ties broken by ID.
+	ThumbnailAssetID string `json:"thumbnail_asset_id"`
+	// BBox is [west, south, east, north] of the bucket's assets, for
+	// zooming in on a cluster.
+	BBox [4]float64 `json:"bbox"`
+}
+
+// GeoAssetsResponse is the JSON body for GET /api/v1/geo/assets.
+type GeoAssetsResponse struct {
+	Clusters    []GeoCluster `json:"clusters"`
+	TotalAssets int          `json:"total_assets"`
+	// CellSize is the bucket size in degrees for the requested zoom.
+	CellSize float64 `json:"cell_size"`
+}
+
+type geoBucket struct {
+	cluster        GeoCluster
+	sumLat, sumLon float64
+	thumbnail      *domain.Asset
+	row, col       int
+}
+
+// handleGeoAssets returns the visible geotagged assets inside ?bbox=,
+// clustered into a grid whose cell size follows the map ?zoom= (0-22).
+// Positions follow each album's geo_privacy for the caller.
+func (s *Server) handleGeoAssets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("bbox") == "" {
+		writeError(w, http.StatusBadRequest, "bbox is required")
+		return
+	}
+	bbox, err := parseBBox(q.Get("bbox"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	zoom := 0
+	if v := q.Get("zoom"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > geo.MaxZoom {
+			writeError(w, http.StatusBadRequest, "zoom must be an integer between 0 and 22")
+			return
+		}
+		zoom = n
+	}
+	cellSize := 360 / float64(int64(geoClustersPerTile)<<zoom)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	principal := auth.PrincipalFromContext(r.Context())
+	type albumInfo struct {
+		acl   *config.AccessConfig
+		owner bool
+	}
+	albums := make(map[string]albumInfo)
+	buckets := make(map[geoCell]*geoBucket)
+	total := 0
+	add := func(p geoPoint, exact bool) {
+		info, ok := albums[p.asset.AlbumPath]
+		if !ok {
+			info.acl = effectiveAlbumACL(s.configs, p.asset.AlbumPath)
+			info.owner = access.IsObjectAdmin(info.acl, principal)
+			albums[p.asset.AlbumPath] = info
+		}
+		// Admins get the exact grid, everyone else the public one.
+		if info.owner != exact {
+			return
+		}
+		if access.CheckView(access.EffectiveAssetACL(info.acl, p.asset.Access), principal) != access.Allow {
+			return
+		}
+		total++
+
+		key := geoCell{int(math.Floor(p.lat / cellSize)), int(math.Floor(p.lon / cellSize))}
+		b, ok := buckets[key]
+		if !ok {
+			b = &geoBucket{row: key.row, col: key.col}
+			b.cluster.BBox = [4]float64{p.lon, p.lat, p.lon, p.lat}
+			buckets[key] = b
+		}
+		b.cluster.Count++
+		b.sumLat += p.lat
+		b.sumLon += p.lon
+		b.cluster.BBox[0] = min(b.cluster.BBox[0], p.lon)
+		b.cluster.BBox[1] = min(b.cluster.BBox[1], p.lat)
+		b.cluster.BBox[2] = max(b.cluster.BBox[2], p.lon)
+		b.cluster.BBox[3] = max(b.cluster.BBox[3], p.lat)
+		if t := b.thumbnail; t == nil || p.asset.Rating > t.Rating || (p.asset.Rating == t.Rating && p.asset.ID < t.ID) {
+			b.thumbnail = p.asset
+		}
+	}
+	if principal != nil {
+		s.geoIndex.exact.query(bbox, func(p geoPoint) { add(p, true) })
+	}
+	s.geoIndex.public.query(bbox, func(p geoPoint) { add(p, false) })
+
+	resp := GeoAssetsResponse{Clusters: make([]GeoCluster, 0, len(buckets)), TotalAssets: total, CellSize: cellSize}
+	ordered := make([]*geoBucket, 0, len(buckets))
+	for _, b := range buckets {
+		ordered = append(ordered, b)
+	}
+	// North to south, then west to east.
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].row != ordered[j].row {
+			return ordered[i].row > ordered[j].row
+		}
+		return ordered[i].col < ordered[j].col
+	})
+	for _, b := range ordered {
+		c := b.cluster
+		c.Lat = b.sumLat / float64(c.Count)
+		c.Lon = b.sumLon / float64(c.Count)
+		c.ThumbnailAssetID = b.thumbnail.ID
+		resp.Clusters = append(resp.Clusters, c)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
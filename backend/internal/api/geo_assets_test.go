@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/domain"
+)
+
+func geoAsset(id, album string, lat, lon float64) domain.Asset {
+	return domain.Asset{ID: id, Filename: id + ".jpg", AlbumPath: album,
+		Metadata: &domain.ImageMetadata{Latitude: &lat, Longitude: &lon}}
+}
+
+func geoServer() *Server {
+	snap, cfgs := testSnapshot()
+	// Paris: two public assets close together, one private override.
+	snap.Albums[""].Assets = append(snap.Albums[""].Assets,
+		geoAsset("ast_p1", "", 48.8566, 2.3522),
+		geoAsset("ast_p2", "", 48.8606, 2.3376),
+	)
+	hidden := geoAsset("ast_p3", "", 48.8530, 2.3499)
+	hidden.Access = &domain.AccessOverride{View: "private"}
+	snap.Albums[""].Assets = append(snap.Albums[""].Assets, hidden)
+	// Lyon in a public album, Fiji just west of the antimeridian.
+	best := geoAsset("ast_l1", "vacation", 45.7640, 4.8357)
+	best.Rating = 5
+	snap.Albums["vacation"].Assets = append(snap.Albums["vacation"].Assets,
+		geoAsset("ast_l0", "vacation", 45.7600, 4.8300), best,
+		geoAsset("ast_fj", "vacation", -17.7134, 179.9),
+	)
+	// Restricted album: only alice may see it.
+	snap.Albums["private"].Assets = []domain.Asset{geoAsset("ast_s1", "private", 48.8584, 2.2945)}
+	return NewServer(snap, cfgs)
+}
+
+func getGeoAssets(t *testing.T, srv *Server, query string, principal *domain.Principal) GeoAssetsResponse {
+	t.Helper()
+	rr := doRequest(srv.Handler(), "GET", "/api/v1/geo/assets?"+query, principal)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp GeoAssetsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestGeoAssets_ClustersByZoom(t *testing.T) {
+	srv := geoServer()
+
+	// France at a country-level zoom: Paris and Lyon fall in separate buckets.
+	resp := getGeoAssets(t, srv, "bbox=-5,42,8,51&zoom=6", nil)
+	if resp.TotalAssets != 4 || len(resp.Clusters) != 2 {
+		t.Fatalf("resp = %+v", resp)
+	}
+	paris, lyon := resp.Clusters[0], resp.Clusters[1]
+	if paris.Count != 2 || paris.ThumbnailAssetID != "ast_p1" {
+		t.Errorf("paris = %+v (private asset must not count)", paris)
+	}
+	if lyon.Count != 2 || lyon.ThumbnailAssetID != "ast_l1" {
+		t.Errorf("lyon = %+v, want highest rated thumbnail", lyon)
+	}
+	if lyon.BBox != [4]float64{4.83, 45.76, 4.8357, 45.764} {
+		t.Errorf("lyon bbox = %v", lyon.BBox)
+	}
+
+	// Zoomed all the way out, everything in the box is a single bucket.
+	resp = getGeoAssets(t, srv, "bbox=-5,42,8,51&zoom=0", nil)
+	if len(resp.Clusters) != 1 || resp.Clusters[0].Count != 4 {
+		t.Errorf("zoom 0 clusters = %+v", resp.Clusters)
+	}
+
+	// At street level the two Paris assets separate.
+	resp = getGeoAssets(t, srv, "bbox=2.3,48.8,2.4,48.9&zoom=16", nil)
+	if len(resp.Clusters) != 2 {
+		t.Errorf("zoom 16 clusters = %+v", resp.Clusters)
+	}
+}
+
+func TestGeoAssets_ACL(t *testing.T) {
+	srv := geoServer()
+	resp := getGeoAssets(t, srv, "bbox=2.2,48.8,2.4,48.9&zoom=10", &domain.Principal{Username: "alice"})
+	if resp.TotalAssets != 3 {
+		t.Errorf("alice total = %d, want 3 (restricted album visible)", resp.TotalAssets)
+	}
+	resp = getGeoAssets(t, srv, "bbox=2.2,48.8,2.4,48.9&zoom=10", nil)
+	if resp.TotalAssets != 2 {
+		t.Errorf("anonymous total = %d, want 2", resp.TotalAssets)
+	}
+}
+
+func TestGeoAssets_Antimeridian(t *testing.T) {
+	resp := getGeoAssets(t, geoServer(), "bbox=170,-30,-170,0&zoom=4", nil)
+	if resp.TotalAssets != 1 || resp.Clusters[0].ThumbnailAssetID != "ast_fj" {
+		t.Errorf("resp = %+v", resp)
+	}
+}
+
+func TestGeoAssets_ReindexedOnSetSnapshot(t *testing.T) {
+	srv := geoServer()
+	snap, cfgs := testSnapshot()
+	srv.SetSnapshot(snap, cfgs)
+	if resp := getGeoAssets(t, srv, "bbox=-180,-90,180,90", nil); resp.TotalAssets != 0 {
+		t.Errorf("stale index: %+v", resp)
+	}
+}
+
+func TestGeoAssets_BadRequest(t *testing.T) {
+	h := geoServer().Handler()
+	for _, q := range []string{
+		"",
+		"bbox=1,2,3",
+		"bbox=a,b,c,d",
+		"bbox=0,10,1,5",
+		"bbox=0,0,200,1",
+		"bbox=0,0,1,1&zoom=23",
+		"bbox=0,0,1,1&zoom=x",
+	} {
+		if rr := doRequest(h, "GET", "/api/v1/geo/assets?"+q, nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", q, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"github.com/perrito666/gollery/backend/internal/access"
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/geo"
+)
+
+// defaultGeoCoarseKm is the grid size for "coarse" geo_privacy when the
+// album does not set geo_coarse_km.
+const defaultGeoCoarseKm = 5
+
+// geoPolicy decides how precisely an album's asset locations are shown
+// to one principal. Album admins always see exact coordinates; everyone
+// else gets the album's geo_privacy level, and nothing at all for
+// locations inside a home zone.
+type geoPolicy struct {
+	level    string
+	coarseKm float64
+	zones    []geo.Zone
+	owner    bool
+}
+
+func newGeoPolicy(configs map[string]*config.AlbumConfig, albumPath string, principal *domain.Principal, zones []geo.Zone) geoPolicy {
+	p := geoPolicy{level: config.GeoPrivacyExact, coarseKm: defaultGeoCoarseKm, zones: zones}
+	if cfg, ok := configs[albumPath]; ok {
+		if cfg.GeoPrivacy != "" {
+			p.level = cfg.GeoPrivacy
+		}
+		if cfg.GeoCoarseKm != nil {
+			p.coarseKm = *cfg.GeoCoarseKm
+		}
+	}
+	p.owner = access.IsObjectAdmin(effectiveAlbumACL(configs, albumPath), principal)
+	return p
+}
+
+// geoPolicy returns the location policy for an album and principal.
+// Must be called while s.mu is held.
+func (s *Server) geoPolicy(albumPath string, principal *domain.Principal) geoPolicy {
+	return newGeoPolicy(s.configs, albumPath, principal, s.homeZones)
+}
+
+// inHomeZone reports whether the point falls in any home zone.
+func (p geoPolicy) inHomeZone(lat, lon float64) bool {
+	for _, z := range p.zones {
+		if z.Contains(lat, lon) {
+			return true
+		}
+	}
+	return false
+}
+
+// visible reports whether a point may be shown at all.
+func (p geoPolicy) visible(lat, lon float64) bool {
+	if p.owner {
+		return true
+	}
+	return p.level != config.GeoPrivacyHidden && !p.inHomeZone(lat, lon)
+}
+
+// locate returns the asset's coordinates as the policy allows them to be
+// shown. exact is false when they were coarsened; ok is false when the
+// asset has no location or it is withheld.
+func (p geoPolicy) locate(asset *domain.Asset) (lat, lon float64, exact, ok bool) {
+	if asset.Metadata == nil || asset.Metadata.Latitude == nil || asset.Metadata.Longitude == nil {
+		return 0, 0, false, false
+	}
+	lat, lon = *asset.Metadata.Latitude, *asset.Metadata.Longitude
+	if !p.visible(lat, lon) {
+		return 0, 0, false, false
+	}
+	if !p.owner && p.level == config.GeoPrivacyCoarse {
+		lat, lon = geo.Coarsen(lat, lon, p.coarseKm)
+		return lat, lon, false, true
+	}
+	return lat, lon, true, true
+}
+
+// placeVisible reports whether the asset's city-level place may be shown.
+// Places survive coarsening but not "hidden" or a home zone.
+func (p geoPolicy) placeVisible(asset *domain.Asset) bool {
+	if p.owner {
+		return true
+	}
+	if asset.Metadata != nil && asset.Metadata.Latitude != nil && asset.Metadata.Longitude != nil {
+		return p.visible(*asset.Metadata.Latitude, *asset.Metadata.Longitude)
+	}
+	return p.level != config.GeoPrivacyHidden
+}
+
+// exactTracks reports whether track lines and waypoints may be shown.
+// They trace exact positions, so coarse and hidden albums withhold them
+// from non-admins.
+func (p geoPolicy) exactTracks() bool {
+	return p.owner || p.level == config.GeoPrivacyExact || p.level == ""
+}
+
+// homeZones converts the server config into zones.
+func homeZones(cfg []config.HomeZone) []geo.Zone {
+	zones := make([]geo.Zone, len(cfg))
+	for i, z := range cfg {
+		zones[i] = geo.Zone{Lat: z.Latitude, Lon: z.Longitude, RadiusM: z.RadiusM}
+	}
+	return zones
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/geo"
+)
+
+var geoAdmin = &domain.Principal{Username: "admin", IsAdmin: true}
+
+// privacyServer puts ast_2 (vacation) at the Eiffel Tower with the
+// album's geo_privacy set to level, and ast_1 (root, exact) inside a
+// home zone.
+func privacyServer(t *testing.T, level string) *Server {
+	t.Helper()
+	snap, cfgs := testSnapshot()
+	lat, lon, ele := 48.8584, 2.2945, 35.0
+	vac := snap.Albums["vacation"]
+	vac.Assets[0].Metadata = &domain.ImageMetadata{Latitude: &lat, Longitude: &lon, Altitude: &ele}
+	vac.Assets[0].Place = &domain.Place{City: "Paris", CountryCode: "FR"}
+	vac.Tracks = []domain.Track{{Name: "Walk", Points: []domain.TrackPoint{
+		{Lat: 48.85, Lon: 2.29}, {Lat: 48.86, Lon: 2.30}, {Lat: 48.87, Lon: 2.31},
+	}}}
+	cfgs["vacation"].GeoPrivacy = level
+
+	homeLat, homeLon := 45.764, 4.8357
+	snap.Albums[""].Assets[0].Metadata = &domain.ImageMetadata{Latitude: &homeLat, Longitude: &homeLon}
+	snap.Albums[""].Assets[0].Place = &domain.Place{City: "Lyon", CountryCode: "FR"}
+
+	srv := NewServer(snap, cfgs)
+	srv.SetHomeZones([]config.HomeZone{{Latitude: 45.7641, Longitude: 4.8356, RadiusM: 200}})
+	return srv
+}
+
+func getAsset(t *testing.T, h http.Handler, id string, p *domain.Principal) AssetResponse {
+	t.Helper()
+	rr := doRequest(h, "GET", "/api/v1/assets/"+id, p)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d", rr.Code)
+	}
+	var resp AssetResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestGeoPrivacy_Coarse(t *testing.T) {
+	h := privacyServer(t, "coarse").Handler()
+
+	anon := getAsset(t, h, "ast_2", nil)
+	if anon.Latitude == nil || *anon.Latitude == 48.8584 {
+		t.Fatalf("anonymous lat = %v, want coarsened", anon.Latitude)
+	}
+	if d := geo.DistanceM(48.8584, 2.2945, *anon.Latitude, *anon.Longitude); d > 5000 {
+		t.Errorf("coarse point %.0fm away, want within the 5km cell", d)
+	}
+	if anon.Altitude != nil {
+		t.Error("altitude should be withheld with coarse coordinates")
+	}
+	if anon.GeoURI == nil || strings.Contains(*anon.GeoURI, "48.858400") {
+		t.Errorf("geo uri = %v, want coarse", anon.GeoURI)
+	}
+	if anon.Place == nil || anon.Place.City != "Paris" {
+		t.Errorf("place = %+v, want city kept", anon.Place)
+	}
+
+	admin := getAsset(t, h, "ast_2", geoAdmin)
+	if admin.Latitude == nil || *admin.Latitude != 48.8584 || admin.Altitude == nil {
+		t.Errorf("admin should see exact location: %+v", admin)
+	}
+
+	// Tracks trace exact positions and are withheld; the photo is coarse.
+	rr := doRequest(h, "GET", "/api/v1/albums/alb_vac/tracks.geojson", nil)
+	for _, f := range decodeFeatures(t, rr.Body.Bytes()) {
+		if f.Geometry.Type == "LineString" {
+			t.Error("track lines should be withheld from non-admins")
+		}
+	}
+	rr = doRequest(h, "GET", "/api/v1/albums/alb_vac/tracks.geojson", geoAdmin)
+	if !strings.Contains(rr.Body.String(), "LineString") {
+		t.Error("admin should see track lines")
+	}
+}
+
+func TestGeoPrivacy_Hidden(t *testing.T) {
+	h := privacyServer(t, "hidden").Handler()
+
+	anon := getAsset(t, h, "ast_2", nil)
+	if anon.Latitude != nil || anon.GeoURI != nil || anon.Place != nil {
+		t.Errorf("anonymous should see no location: %+v", anon)
+	}
+
+	rr := doRequest(h, "GET", "/api/v1/albums/alb_vac", nil)
+	var album AlbumResponse
+	json.NewDecoder(rr.Body).Decode(&album)
+	if album.Assets[0].HasLocation {
+		t.Error("has_location should be false when hidden")
+	}
+
+	rr = doRequest(h, "GET", "/api/v1/places", nil)
+	if strings.Contains(rr.Body.String(), "Paris") {
+		t.Errorf("hidden asset counted in places: %s", rr.Body)
+	}
+
+	rr = doRequest(h, "GET", "/share/assets/ast_2", nil)
+	if strings.Contains(rr.Body.String(), "place:location") {
+		t.Error("share page should not carry a hidden location")
+	}
+}
+
+func TestGeoPrivacy_HomeZone(t *testing.T) {
+	h := privacyServer(t, "exact").Handler()
+
+	if anon := getAsset(t, h, "ast_1", nil); anon.Latitude != nil || anon.Place != nil {
+		t.Errorf("home zone location leaked: %+v", anon)
+	}
+	if admin := getAsset(t, h, "ast_1", geoAdmin); admin.Latitude == nil {
+		t.Error("admin should still see home zone locations")
+	}
+	// Outside the zone, exact albums are unaffected.
+	if anon := getAsset(t, h, "ast_2", nil); anon.Latitude == nil || *anon.Latitude != 48.8584 {
+		t.Errorf("exact location = %v", anon.Latitude)
+	}
+
+	// Share pages leave locations out even when they are shown exactly.
+	rr := doRequest(h, "GET", "/share/assets/ast_2", nil)
+	if strings.Contains(rr.Body.String(), "place:location") {
+		t.Errorf("share page carries a location:\n%s", rr.Body)
+	}
+}
+
+func TestGeoPrivacy_HomeZoneCutsTracks(t *testing.T) {
+	snap, cfgs := testSnapshot()
+	snap.Albums["vacation"].Tracks = []domain.Track{{Points: []domain.TrackPoint{
+		{Lat: 46.00, Lon: 7.00}, {Lat: 46.01, Lon: 7.01},
+		{Lat: 46.02, Lon: 7.02}, // home
+		{Lat: 46.03, Lon: 7.03}, {Lat: 46.04, Lon: 7.04},
+	}}}
+	srv := NewServer(snap, cfgs)
+	srv.SetHomeZones([]config.HomeZone{{Latitude: 46.02, Longitude: 7.02, RadiusM: 300}})
+
+	rr := doRequest(srv.Handler(), "GET", "/api/v1/albums/alb_vac/tracks.geojson", nil)
+	var lines int
+	for _, f := range decodeFeatures(t, rr.Body.Bytes()) {
+		if f.Geometry.Type != "LineString" {
+			continue
+		}
+		lines++
+		for _, pos := range f.Geometry.Coordinates.([][]float64) {
+			if pos[1] == 46.02 {
+				t.Error("home zone point emitted")
+			}
+		}
+	}
+	if lines != 2 {
+		t.Errorf("lines = %d, want the track split in two around the zone", lines)
+	}
+}
+
+func TestGeoPrivacy_MapIndex(t *testing.T) {
+	srv := privacyServer(t, "coarse")
+
+	// A box tight around the true position must not find the asset,
+	// or shrinking the box would reveal it.
+	tight := "bbox=2.2944,48.8583,2.2946,48.8585&zoom=18"
+	if resp := getGeoAssets(t, srv, tight, nil); resp.TotalAssets != 0 {
+		t.Errorf("anonymous tight box found %d assets", resp.TotalAssets)
+	}
+	if resp := getGeoAssets(t, srv, tight, geoAdmin); resp.TotalAssets != 1 {
+		t.Errorf("admin tight box found %d assets, want 1", resp.TotalAssets)
+	}
+
+	// The home-zone asset is missing for everyone but admins.
+	lyon := "bbox=4,45,5,46&zoom=10"
+	if resp := getGeoAssets(t, srv, lyon, nil); resp.TotalAssets != 0 {
+		t.Errorf("home zone asset indexed publicly")
+	}
+	if resp := getGeoAssets(t, srv, lyon, geoAdmin); resp.TotalAssets != 1 {
+		t.Errorf("admin should see home zone asset")
+	}
+}
+
+// xmpJPEG is a minimal JPEG-framed file whose XMP packet names a GPS tag.
+func xmpJPEG() []byte {
+	xmp := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), "<exif:GPSLatitude>48,51N</exif:GPSLatitude>"...)
+	var b bytes.Buffer
+	b.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&b, binary.BigEndian, uint16(len(xmp)+2))
+	b.Write(xmp)
+	b.Write([]byte{0xFF, 0xD9})
+	return b.Bytes()
+}
+
+func TestGeoPrivacy_Originals(t *testing.T) {
+	srv := privacyServer(t, "coarse")
+	root := t.TempDir()
+	srv.SetContentRoot(root, nil)
+	os.MkdirAll(filepath.Join(root, "vacation"), 0755)
+	os.WriteFile(filepath.Join(root, "vacation", "beach.jpg"), xmpJPEG(), 0644)
+	h := srv.Handler()
+
+	rr := doRequest(h, "GET", "/api/v1/assets/ast_2/original", nil)
+	if rr.Code != http.StatusOK || bytes.Contains(rr.Body.Bytes(), []byte("GPSLatitude")) {
+		t.Errorf("anonymous original: status %d, location present = %v",
+			rr.Code, bytes.Contains(rr.Body.Bytes(), []byte("GPSLatitude")))
+	}
+	rr = doRequest(h, "GET", "/api/v1/assets/ast_2/original", geoAdmin)
+	if !bytes.Contains(rr.Body.Bytes(), []byte("GPSLatitude")) {
+		t.Error("admin should get the untouched original")
+	}
+
+	// Formats that cannot be stripped are withheld when located.
+	srv.assetsByID["ast_2"].Filename = "beach.png"
+	os.WriteFile(filepath.Join(root, "vacation", "beach.png"), []byte("png"), 0644)
+	if rr := doRequest(h, "GET", "/api/v1/assets/ast_2/original", nil); rr.Code != http.StatusForbidden {
+		t.Errorf("png original status = %d, want 403", rr.Code)
+	}
+	// And when not, since the file may still carry a location.
+	srv.assetsByID["ast_2"].Metadata = nil
+	if rr := doRequest(h, "GET", "/api/v1/assets/ast_2/original", nil); rr.Code != http.StatusForbidden {
+		t.Errorf("unlocated png original status = %d, want 403", rr.Code)
+	}
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/index"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+// LocationPatchRequest is the JSON body for PATCH /api/v1/assets/{id}/location.
+// Latitude and longitude are set together; omitting both (or sending null)
+// clears the location, including the album's fallback coordinates.
+type LocationPatchRequest struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"`
+}
+
+// BulkLocationRequest is the JSON body for PATCH /api/v1/assets/locations.
+// The location applies to every listed asset. With resolve set, the
+// location fields are ignored and each asset is re-resolved from EXIF and
+// track files instead.
+type BulkLocationRequest struct {
+	AssetIDs []string `json:"asset_ids"`
+	LocationPatchRequest
+	Resolve bool `json:"resolve,omitempty"`
+}
+
+// validate checks the coordinates and reports whether the request clears
+// the location.
+func (req *LocationPatchRequest) validate() (clear bool, msg string) {
+	switch {
+	case req.Latitude == nil && req.Longitude == nil:
+		if req.Altitude != nil {
+			return false, "altitude requires latitude and longitude"
+		}
+		return true, ""
+	case req.Latitude == nil || req.Longitude == nil:
+		return false, "latitude and longitude must be set together"
+	case !validLatLon(*req.Latitude, *req.Longitude):
+		return false, "latitude must be between -90 and 90 and longitude between -180 and 180"
+	}
+	return false, ""
+}
+
+func (s *Server) handleAssetLocationPatch(w http.ResponseWriter, r *http.Request) {
+	var req LocationPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	clear, msg := req.validate()
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	assets, ok := s.locationTargets(w, r, []string{r.PathValue("id")})
+	if !ok {
+		return
+	}
+	if !s.applyLocation(w, assets, &req, clear) {
+		return
+	}
+
+	status := "updated"
+	if clear {
+		status = "cleared"
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": status})
+}
+
+func (s *Server) handleBulkLocationPatch(w http.ResponseWriter, r *http.Request) {
+	var req BulkLocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.AssetIDs) == 0 {
+		writeError(w, http.StatusBadRequest, "asset_ids is required")
+		return
+	}
+	if req.Resolve {
+		s.resolveLocations(w, r, req.AssetIDs)
+		return
+	}
+	clear, msg := req.validate()
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	assets, ok := s.locationTargets(w, r, req.AssetIDs)
+	if !ok {
+		return
+	}
+	if !s.applyLocation(w, assets, &req.LocationPatchRequest, clear) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"status": "updated", "updated": len(assets)})
+}
+
+func (s *Server) handleAssetLocationResolve(w http.ResponseWriter, r *http.Request) {
+	s.resolveLocations(w, r, []string{r.PathValue("id")})
+}
+
+// resolveLocations resets the resolved location of the assets and
+// rebuilds their albums, which repeats EXIF extraction and track matching
+// for them. Both run under the indexer's lock, see [Server.SetRefresh].
+// Without a refresh function the reset is picked up by the next scan.
+func (s *Server) resolveLocations(w http.ResponseWriter, r *http.Request, ids []string) {
+	s.mu.RLock()
+	assets, ok := s.locationTargets(w, r, ids)
+	s.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	var albumPaths []string
+	for _, asset := range assets {
+		if !slices.Contains(albumPaths, asset.AlbumPath) {
+			albumPaths = append(albumPaths, asset.AlbumPath)
+		}
+	}
+	var resetErr error
+	reset := func() error {
+		for _, asset := range assets {
+			if resetErr = s.resetLocation(asset); resetErr != nil {
+				slog.Error("resetting asset location", "asset_id", asset.ID, "error", resetErr)
+				return resetErr
+			}
+		}
+		return nil
+	}
+
+	if s.refreshFunc == nil {
+		if reset() != nil {
+			writeError(w, http.StatusInternalServerError, "failed to reset asset state")
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]any{"status": "pending reindex", "reset": len(assets)})
+		return
+	}
+	if err := s.refreshFunc(albumPaths, reset); err != nil {
+		if resetErr != nil {
+			writeError(w, http.StatusInternalServerError, "failed to reset asset state")
+			return
+		}
+		slog.Error("reindex after location reset failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "reindex failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "resolved", "reset": len(assets)})
+}
+
+// resetLocation marks the asset's location as unresolved in its state.
+// The in-memory asset is left alone until its album is rebuilt.
+func (s *Server) resetLocation(asset *domain.Asset) error {
+	albumAbsPath := s.albumDir(asset.AlbumPath)
+	st, err := state.LoadAssetState(albumAbsPath, asset.Filename)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		st = &state.AssetState{ObjectID: asset.ID}
+	}
+	index.ResetLocation(st)
+	return state.SaveAssetState(albumAbsPath, asset.Filename, st)
+}
+
+// locationTargets looks up every asset and checks the principal
+// administers its album. All assets must pass before any is modified.
+// Must be called while s.mu is held.
+func (s *Server) locationTargets(w http.ResponseWriter, r *http.Request, ids []string) ([]*domain.Asset, bool) {
+	assets := make([]*domain.Asset, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		asset, ok := s.assetsByID[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "asset not found: "+id)
+			return nil, false
+		}
+		album, ok := s.snapshot.Albums[asset.AlbumPath]
+		if !ok {
+			writeError(w, http.StatusNotFound, "containing album not found")
+			return nil, false
+		}
+		if !s.requireAdmin(w, r, album) {
+			return nil, false
+		}
+		assets = append(assets, asset)
+	}
+	return assets, true
+}
+
+// applyLocation sets or clears the location of the assets, persists it
+// and updates the in-memory snapshot and spatial index.
+// Must be called while s.mu is write-locked.
+func (s *Server) applyLocation(w http.ResponseWriter, assets []*domain.Asset, req *LocationPatchRequest, clear bool) bool {
+	update := func(st *state.AssetState) {
+		if clear {
+			index.ClearLocation(st)
+		} else {
+			index.SetLocation(st, *req.Latitude, *req.Longitude, req.Altitude)
+		}
+	}
+	if !s.updateAssetStates(w, assets, update) {
+		return false
+	}
+	s.geoIndex = buildGeoIndex(s.snapshot, s.configs, s.homeZones)
+	return true
+}
+
+// updateAssetStates applies update to each asset's sidecar state, saves
+// it and mirrors the resolved location into the in-memory asset.
+// Must be called while s.mu is write-locked.
+func (s *Server) updateAssetStates(w http.ResponseWriter, assets []*domain.Asset, update func(*state.AssetState)) bool {
+	for _, asset := range assets {
+		albumAbsPath := s.albumDir(asset.AlbumPath)
+		st, err := state.LoadAssetState(albumAbsPath, asset.Filename)
+		if err != nil {
+			slog.Error("loading asset state", "asset_id", asset.ID, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to load asset state")
+			return false
+		}
+		if st == nil {
+			st = &state.AssetState{ObjectID: asset.ID}
+		}
+
+		update(st)
+
+		if err := state.SaveAssetState(albumAbsPath, asset.Filename, st); err != nil {
+			slog.Error("saving asset state", "asset_id", asset.ID, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to save asset state")
+			return false
+		}
+		s.writeXMPSidecar(asset, st)
+
+		if st.Latitude != nil && st.Longitude != nil {
+			if asset.Metadata == nil {
+				asset.Metadata = &domain.ImageMetadata{}
+			}
+			asset.Metadata.Latitude = st.Latitude
+			asset.Metadata.Longitude = st.Longitude
+			asset.Metadata.Altitude = st.Altitude
+		} else if asset.Metadata != nil {
+			asset.Metadata.Latitude = nil
+			asset.Metadata.Longitude = nil
+			asset.Metadata.Altitude = nil
+		}
+		asset.Place = st.Place
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/auth"
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+func locationServer(t *testing.T) (string, *Server, http.Handler) {
+	t.Helper()
+	snap, cfgs := testSnapshot()
+	root := t.TempDir()
+	srv := NewServer(snap, cfgs)
+	srv.SetContentRoot(root, nil)
+	fa := &fakeAuthenticator{
+		users: map[string]*domain.Principal{
+			"admin:admin": {Username: "admin", IsAdmin: true},
+			"bob:bob":     {Username: "bob"},
+		},
+	}
+	srv.SetAuth(fa, auth.NewCookieSessionStore("test-secret"), "csrf-test-secret", nil)
+	return root, srv, srv.Handler()
+}
+
+func authedRequest(t *testing.T, handler http.Handler, user, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	cookie, csrf := loginAs(t, handler, user, user)
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.AddCookie(cookie)
+	req.Header.Set("X-CSRF-Token", csrf)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAssetLocationPatch_SetAndClear(t *testing.T) {
+	root, _, handler := locationServer(t)
+
+	rr := authedRequest(t, handler, "admin", "PATCH", "/api/v1/assets/ast_2/location",
+		`{"latitude":48.8566,"longitude":2.3522,"altitude":35}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body)
+	}
+	st, err := state.LoadAssetState(filepath.Join(root, "vacation"), "beach.jpg")
+	if err != nil || st == nil {
+		t.Fatalf("state not saved: %v", err)
+	}
+	if !st.GeoResolved || st.GeoMatch == nil || st.GeoMatch.Source != "manual" || *st.Latitude != 48.8566 {
+		t.Errorf("state = %+v", st)
+	}
+	if st.Place == nil || st.Place.City != "Paris" {
+		t.Errorf("place = %+v, want reverse-geocoded Paris", st.Place)
+	}
+
+	// The asset, place listing and map index reflect the change at once.
+	rr = doRequest(handler, "GET", "/api/v1/assets/ast_2", nil)
+	var ast AssetResponse
+	json.NewDecoder(rr.Body).Decode(&ast)
+	if ast.Latitude == nil || *ast.Latitude != 48.8566 || ast.Altitude == nil || *ast.Altitude != 35 {
+		t.Errorf("asset = %+v", ast)
+	}
+	rr = doRequest(handler, "GET", "/api/v1/geo/assets?bbox=2,48,3,49", nil)
+	var geoResp GeoAssetsResponse
+	json.NewDecoder(rr.Body).Decode(&geoResp)
+	if geoResp.TotalAssets != 1 {
+		t.Errorf("geo index not updated: %+v", geoResp)
+	}
+
+	rr = authedRequest(t, handler, "admin", "PATCH", "/api/v1/assets/ast_2/location", `{}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("clear status = %d, body = %s", rr.Code, rr.Body)
+	}
+	st, _ = state.LoadAssetState(filepath.Join(root, "vacation"), "beach.jpg")
+	if st.Latitude != nil || !st.GeoResolved || st.Place != nil {
+		t.Errorf("cleared state = %+v", st)
+	}
+	rr = doRequest(handler, "GET", "/api/v1/geo/assets?bbox=2,48,3,49", nil)
+	json.NewDecoder(rr.Body).Decode(&geoResp)
+	if geoResp.TotalAssets != 0 {
+		t.Errorf("cleared asset still indexed: %+v", geoResp)
+	}
+}
+
+func TestAssetLocationPatch_Validation(t *testing.T) {
+	_, _, handler := locationServer(t)
+	for _, body := range []string{
+		`{"latitude":10}`,
+		`{"latitude":91,"longitude":0}`,
+		`{"latitude":0,"longitude":-181}`,
+		`{"altitude":100}`,
+		`not json`,
+	} {
+		rr := authedRequest(t, handler, "admin", "PATCH", "/api/v1/assets/ast_2/location", body)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, rr.Code)
+		}
+	}
+}
+
+func TestAssetLocationPatch_RequiresAdmin(t *testing.T) {
+	_, _, handler := locationServer(t)
+	rr := authedRequest(t, handler, "bob", "PATCH", "/api/v1/assets/ast_2/location", `{"latitude":1,"longitude":2}`)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rr.Code)
+	}
+}
+
+func TestBulkLocationPatch(t *testing.T) {
+	root, _, handler := locationServer(t)
+
+	rr := authedRequest(t, handler, "admin", "PATCH", "/api/v1/assets/locations",
+		`{"asset_ids":["ast_1","ast_2","ast_1"],"latitude":45.764,"longitude":4.8357}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body)
+	}
+	var resp struct{ Updated int }
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Updated != 2 {
+		t.Errorf("updated = %d, want 2 (duplicates collapsed)", resp.Updated)
+	}
+	for album, file := range map[string]string{"": "hello.jpg", "vacation": "beach.jpg"} {
+		st, _ := state.LoadAssetState(filepath.Join(root, album), file)
+		if st == nil || st.Longitude == nil || *st.Longitude != 4.8357 {
+			t.Errorf("%s: state = %+v", file, st)
+		}
+	}
+
+	// An unknown ID rejects the whole request before anything is written.
+	rr = authedRequest(t, handler, "admin", "PATCH", "/api/v1/assets/locations",
+		`{"asset_ids":["ast_2","ast_missing"],"latitude":1,"longitude":1}`)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rr.Code)
+	}
+	st, _ := state.LoadAssetState(filepath.Join(root, "vacation"), "beach.jpg")
+	if *st.Latitude != 45.764 {
+		t.Errorf("partial bulk update applied: %+v", st)
+	}
+
+	rr = authedRequest(t, handler, "admin", "PATCH", "/api/v1/assets/locations", `{"latitude":1,"longitude":1}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("missing asset_ids: status = %d, want 400", rr.Code)
+	}
+}
+
+func TestAssetLocationResolve(t *testing.T) {
+	root, srv, handler := locationServer(t)
+
+	authedRequest(t, handler, "admin", "PATCH", "/api/v1/assets/ast_2/location", `{"latitude":1,"longitude":2}`)
+
+	// Without a reindex function the reset waits for the next scan.
+	rr := authedRequest(t, handler, "admin", "POST", "/api/v1/assets/ast_2/location/resolve", ``)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body)
+	}
+	st, _ := state.LoadAssetState(filepath.Join(root, "vacation"), "beach.jpg")
+	if st.GeoResolved || st.Latitude != nil || st.GeoMatch != nil || st.PlaceResolved {
+		t.Errorf("state not reset: %+v", st)
+	}
+
+	srv.SetAdmin(func() error {
+		t.Error("resolving should not run a full reindex")
+		return nil
+	})
+	var refreshed []string
+	srv.SetRefresh(func(albumPaths []string, prepare func() error) error {
+		refreshed = albumPaths
+		return prepare()
+	})
+	rr = authedRequest(t, handler, "admin", "PATCH", "/api/v1/assets/locations", `{"asset_ids":["ast_1","ast_2"],"resolve":true}`)
+	if rr.Code != http.StatusOK || !slices.Equal(refreshed, []string{"", "vacation"}) {
+		t.Errorf("status = %d, refreshed = %q", rr.Code, refreshed)
+	}
+}
@@ -7,14 +7,27 @@ import (
 	"path/filepath"
 
 	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
 	"github.com/perrito666/gollery/backend/internal/state"
+	"github.com/perrito666/gollery/backend/internal/xmp"
 )
 
 func (s *Server) handleAssetMetadataPatch(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	var req MetadataPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Rating != nil && (*req.Rating < 0 || *req.Rating > 5) {
+		writeError(w, http.StatusBadRequest, "rating must be between 0 and 5")
+		return
+	}
+
+	// The snapshot is updated in place below.
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	asset, ok := s.assetsByID[id]
 	if !ok {
@@ -32,13 +45,7 @@ func (s *Server) handleAssetMetadataPatch(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var req MetadataPatchRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request body")
-		return
-	}
-
-	albumAbsPath := filepath.Join(s.contentRoot, asset.AlbumPath)
+	albumAbsPath := s.albumDir(asset.AlbumPath)
 	st, err := state.LoadAssetState(albumAbsPath, asset.Filename)
 	if err != nil {
 		slog.Error("loading asset state", "asset_id", id, "error", err)
@@ -55,16 +62,25 @@ func (s *Server) handleAssetMetadataPatch(w http.ResponseWriter, r *http.Request
 	if req.Description != nil {
 		st.Description = *req.Description
 	}
+	if req.Keywords != nil {
+		st.Keywords = req.Keywords
+	}
+	if req.Rating != nil {
+		st.Rating = *req.Rating
+	}
 
 	if err := state.SaveAssetState(albumAbsPath, asset.Filename, st); err != nil {
 		slog.Error("saving asset state", "asset_id", id, "error", err)
 		writeError(w, http.StatusInternalServerError, "failed to save asset state")
 		return
 	}
+	s.writeXMPSidecar(asset, st)
 
 	// Update in-memory snapshot.
 	asset.Title = st.Title
 	asset.Description = st.Description
+	asset.Keywords = st.Keywords
+	asset.Rating = st.Rating
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
@@ -72,8 +88,15 @@ func (s *Server) handleAssetMetadataPatch(w http.ResponseWriter, r *http.Request
 func (s *Server) handleAlbumMetadataPatch(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	var req MetadataPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// The snapshot is updated in place below.
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	album, ok := s.albumsByID[id]
 	if !ok {
@@ -85,14 +108,12 @@ func (s *Server) handleAlbumMetadataPatch(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var req MetadataPatchRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request body")
+	// Load album.json, patch, and save.
+	albumAbsPath := s.albumDir(album.Path)
+	if albumAbsPath == "" {
+		writeError(w, http.StatusBadRequest, "album has no directory")
 		return
 	}
-
-	// Load album.json, patch, and save.
-	albumAbsPath := filepath.Join(s.contentRoot, album.Path)
 	albumJSONPath := filepath.Join(albumAbsPath, "album.json")
 
 	cfg, err := config.LoadAlbumConfig(albumJSONPath)
@@ -121,3 +142,32 @@ func (s *Server) handleAlbumMetadataPatch(w http.ResponseWriter, r *http.Request
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
+
+// writeXMPSidecar mirrors an asset's editorial state into a standard .xmp
+// sidecar next to the original when the album opts in with write_xmp.
+// Failures are logged but do not fail the request: the .gallery state
+// remains the source of truth and the sidecar is rewritten on the next edit.
+// Must be called while s.mu is held.
+func (s *Server) writeXMPSidecar(asset *domain.Asset, st *state.AssetState) {
+	cfg, ok := s.configs[asset.AlbumPath]
+	if !ok || cfg.WriteXMP == nil || !*cfg.WriteXMP {
+		return
+	}
+
+	imgPath := filepath.Join(s.albumDir(asset.AlbumPath), asset.Filename)
+	fields := xmp.Fields{
+		Title:       st.Title,
+		Description: st.Description,
+		Keywords:    st.Keywords,
+		Rating:      st.Rating,
+		Latitude:    st.Latitude,
+		Longitude:   st.Longitude,
+	}
+	path, err := xmp.SidecarPath(imgPath)
+	if err == nil {
+		err = xmp.Write(path, fields)
+	}
+	if err != nil {
+		slog.Error("writing xmp sidecar", "asset_id", asset.ID, "error", err)
+	}
+}
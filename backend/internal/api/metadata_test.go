@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/auth"
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+func metadataServer(t *testing.T, writeXMP bool) (string, http.Handler) {
+	t.Helper()
+	snap, cfgs := testSnapshot()
+	cfgs["vacation"].WriteXMP = boolPtr(writeXMP)
+
+	root := t.TempDir()
+	srv := NewServer(snap, cfgs)
+	srv.SetContentRoot(root, nil)
+
+	fa := &fakeAuthenticator{
+		users: map[string]*domain.Principal{
+			"admin:admin": {Username: "admin", IsAdmin: true},
+		},
+	}
+	srv.SetAuth(fa, auth.NewCookieSessionStore("test-secret"), "csrf-test-secret", nil)
+	return root, srv.Handler()
+}
+
+func patchMetadata(t *testing.T, handler http.Handler, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	cookie, csrf := loginAs(t, handler, "admin", "admin")
+	req := httptest.NewRequest("PATCH", path, strings.NewReader(body))
+	req.AddCookie(cookie)
+	req.Header.Set("X-CSRF-Token", csrf)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAssetMetadataPatch_KeywordsAndRating(t *testing.T) {
+	root, handler := metadataServer(t, false)
+
+	rr := patchMetadata(t, handler, "/api/v1/assets/ast_2/metadata", `{"keywords":["sea","sand"],"rating":4}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body)
+	}
+
+	st, err := state.LoadAssetState(filepath.Join(root, "vacation"), "beach.jpg")
+	if err != nil || st == nil {
+		t.Fatalf("state not saved: %v", err)
+	}
+	if len(st.Keywords) != 2 || st.Rating != 4 {
+		t.Errorf("state = %+v", st)
+	}
+	if _, err := os.Stat(filepath.Join(root, "vacation", "beach.xmp")); !os.IsNotExist(err) {
+		t.Error("xmp sidecar should not be written without write_xmp")
+	}
+}
+
+func TestAssetMetadataPatch_InvalidRating(t *testing.T) {
+	_, handler := metadataServer(t, false)
+
+	rr := patchMetadata(t, handler, "/api/v1/assets/ast_2/metadata", `{"rating":7}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rr.Code)
+	}
+}
+
+func TestAssetMetadataPatch_WritesXMP(t *testing.T) {
+	root, handler := metadataServer(t, true)
+
+	rr := patchMetadata(t, handler, "/api/v1/assets/ast_2/metadata", `{"title":"Beach day","rating":5}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "vacation", "beach.xmp"))
+	if err != nil {
+		t.Fatalf("xmp sidecar not written: %v", err)
+	}
+	if !strings.Contains(string(data), "Beach day") || !strings.Contains(string(data), "<xmp:Rating>5</xmp:Rating>") {
+		t.Errorf("unexpected xmp content:\n%s", data)
+	}
+}
+
+func TestMetadataPatch_Libraries(t *testing.T) {
+	snap, cfgs := testSnapshot()
+	srv := NewServer(snap, cfgs)
+	vacation := t.TempDir()
+	srv.SetLibraries(config.Libraries{{Name: "vacation", Root: vacation}, {Name: "private", Root: t.TempDir()}}, nil)
+	fa := &fakeAuthenticator{
+		users: map[string]*domain.Principal{
+			"admin:admin": {Username: "admin", IsAdmin: true},
+		},
+	}
+	srv.SetAuth(fa, auth.NewCookieSessionStore("test-secret"), "csrf-test-secret", nil)
+	handler := srv.Handler()
+
+	// The state of an asset lives in its library's root.
+	rr := patchMetadata(t, handler, "/api/v1/assets/ast_2/metadata", `{"rating":3}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body)
+	}
+	st, err := state.LoadAssetState(vacation, "beach.jpg")
+	if err != nil || st == nil || st.Rating != 3 {
+		t.Fatalf("state = %+v, %v", st, err)
+	}
+
+	// The virtual root above the libraries has no album.json to patch.
+	rr = patchMetadata(t, handler, "/api/v1/albums/alb_root/metadata", `{"title":"Everything"}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("root patch status = %d, want 400", rr.Code)
+	}
+}
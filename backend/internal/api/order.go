@@ -0,0 +1,257 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/perrito666/gollery/backend/internal/access"
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+// sortChildren returns the child album paths of a in the order given by
+// sortOrder; see [config.AlbumConfig.ChildSortOrder]. taken returns the
+// capture time a child is sorted by for "taken". With "" or an unknown
+// order they keep directory order. Children that compare equal are
+// ordered by path.
+func sortChildren(a *domain.Album, albumsByPath map[string]*domain.Album, sortOrder string, taken func(path string) time.Time) []string {
+	order, desc := strings.CutSuffix(sortOrder, "_desc")
+	var cmp func(x, y *domain.Album) int
+	switch order {
+	case "name":
+		cmp = func(x, y *domain.Album) int { return strings.Compare(x.Path, y.Path) }
+	case "title":
+		cmp = func(x, y *domain.Album) int { return compareFold(x.Title, y.Title) }
+	case "taken":
+		times := make(map[string]time.Time, len(a.Children))
+		for _, p := range a.Children {
+			times[p] = taken(p)
+		}
+		cmp = func(x, y *domain.Album) int { return times[x.Path].Compare(times[y.Path]) }
+	case "manual":
+		pos := positions(a.ChildOrder)
+		cmp = func(x, y *domain.Album) int { return comparePositions(pos, x.ID, y.ID) }
+	default:
+		return a.Children
+	}
+
+	children := make([]*domain.Album, 0, len(a.Children))
+	for _, p := range a.Children {
+		child, ok := albumsByPath[p]
+		if !ok {
+			child = &domain.Album{Path: p}
+		}
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		c := cmp(children[i], children[j])
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			return children[i].Path < children[j].Path
+		}
+		return c < 0
+	})
+
+	paths := make([]string, len(children))
+	for i, child := range children {
+		paths[i] = child.Path
+	}
+	return paths
+}
+
+// takenEntry is the earliest capture time in an album's subtree among
+// the assets that share one effective ACL.
+type takenEntry struct {
+	taken time.Time
+	acl   *config.AccessConfig
+}
+
+// buildTakenIndex returns, for every album, the earliest capture time in
+// its subtree for each effective asset ACL found there, earliest first.
+// Child albums are sorted by capture time with [visibleTaken], which then
+// needs no walk of their subtrees on every request.
+func buildTakenIndex(snap *domain.Snapshot, configs map[string]*config.AlbumConfig) map[string][]takenEntry {
+	index := make(map[string][]takenEntry, len(snap.Albums))
+	var visit func(path string) []takenEntry
+	visit = func(path string) []takenEntry {
+		if entries, ok := index[path]; ok {
+			return entries
+		}
+		index[path] = nil
+		a, ok := snap.Albums[path]
+		if !ok {
+			return nil
+		}
+		// ACLs are told apart by pointer: assets of one album without
+		// overrides share its ACL, and equal ACLs held apart only cost
+		// an extra entry.
+		earliest := make(map[*config.AccessConfig]takenEntry)
+		add := func(e takenEntry) {
+			if cur, ok := earliest[e.acl]; !ok || e.taken.Before(cur.taken) {
+				earliest[e.acl] = e
+			}
+		}
+		albumACL := effectiveAlbumACL(configs, path)
+		for i := range a.Assets {
+			ast := &a.Assets[i]
+			add(takenEntry{assetTaken(ast), access.EffectiveAssetACL(albumACL, ast.Access)})
+		}
+		for _, p := range a.Children {
+			for _, e := range visit(p) {
+				add(e)
+			}
+		}
+		entries := make([]takenEntry, 0, len(earliest))
+		for _, e := range earliest {
+			entries = append(entries, e)
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].taken.Before(entries[j].taken) })
+		index[path] = entries
+		return entries
+	}
+	for path := range snap.Albums {
+		visit(path)
+	}
+	return index
+}
+
+// visibleTaken returns the earliest capture time among the assets of an
+// album's subtree that principal may view, given the album's entries in
+// [buildTakenIndex], or the zero time when there are none.
+func visibleTaken(entries []takenEntry, principal *domain.Principal) time.Time {
+	for _, e := range entries {
+		if access.CheckView(e.acl, principal) == access.Allow {
+			return e.taken
+		}
+	}
+	return time.Time{}
+}
+
+// positions maps each ID of a manual order to its index.
+func positions(ids []string) map[string]int {
+	pos := make(map[string]int, len(ids))
+	for i, id := range ids {
+		pos[id] = i
+	}
+	return pos
+}
+
+// comparePositions orders IDs by their position in a manual order, with
+// the IDs it does not list after those it does.
+func comparePositions(pos map[string]int, x, y string) int {
+	px, okx := pos[x]
+	py, oky := pos[y]
+	switch {
+	case okx && oky:
+		return px - py
+	case okx:
+		return -1
+	case oky:
+		return 1
+	}
+	return 0
+}
+
+// compareFold compares two strings ignoring case.
+func compareFold(x, y string) int {
+	return strings.Compare(strings.ToLower(x), strings.ToLower(y))
+}
+
+// handleAlbumOrderPatch sets the manual order of an album's assets and/or
+// child albums. Omitted lists are left unchanged and empty ones clear the
+// order.
+func (s *Server) handleAlbumOrderPatch(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req AlbumOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.AssetIDs == nil && req.ChildIDs == nil {
+		writeError(w, http.StatusBadRequest, "no order given")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	album, ok := s.albumsByID[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "album not found")
+		return
+	}
+
+	if !s.requireAdmin(w, r, album) {
+		return
+	}
+	if !uniqueIDs(req.AssetIDs, func(id string) bool {
+		asset, ok := s.assetsByID[id]
+		return ok && asset.AlbumPath == album.Path
+	}) {
+		writeError(w, http.StatusBadRequest, "asset_ids must list assets of this album once each")
+		return
+	}
+	childIDs := make(map[string]bool, len(album.Children))
+	for _, p := range album.Children {
+		if child, ok := s.albumsByPath[p]; ok {
+			childIDs[child.ID] = true
+		}
+	}
+	if !uniqueIDs(req.ChildIDs, func(id string) bool { return childIDs[id] }) {
+		writeError(w, http.StatusBadRequest, "child_ids must list child albums of this album once each")
+		return
+	}
+
+	albumAbsPath := s.albumDir(album.Path)
+	if albumAbsPath == "" {
+		writeError(w, http.StatusBadRequest, "album has no directory")
+		return
+	}
+	st, err := state.LoadAlbumState(albumAbsPath)
+	if err != nil {
+		slog.Error("loading album state", "album_id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to load album state")
+		return
+	}
+	if st == nil {
+		st = &state.AlbumState{ObjectID: album.ID}
+	}
+	if req.AssetIDs != nil {
+		st.AssetOrder = req.AssetIDs
+	}
+	if req.ChildIDs != nil {
+		st.ChildOrder = req.ChildIDs
+	}
+	if err := state.SaveAlbumState(albumAbsPath, st); err != nil {
+		slog.Error("saving album state", "album_id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save album state")
+		return
+	}
+
+	// Update in-memory snapshot.
+	album.AssetOrder = st.AssetOrder
+	album.ChildOrder = st.ChildOrder
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
+
+// uniqueIDs reports whether ids holds no duplicates and valid accepts
+// each of them.
+func uniqueIDs(ids []string, valid func(string) bool) bool {
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] || !valid(id) {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+func TestSortAssets(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC) }
+	taken := day(1)
+	album := &domain.Album{
+		AssetOrder: []string{"c", "a"},
+		Assets: []domain.Asset{
+			{ID: "a", Filename: "a.jpg", Title: "Zebra", ModTime: day(3)},
+			{ID: "b", Filename: "b.jpg", ModTime: day(2), Metadata: &domain.ImageMetadata{DateTaken: &taken}},
+			{ID: "c", Filename: "c.jpg", Title: "apple", ModTime: day(1)},
+			{ID: "d", Filename: "d.jpg", ModTime: day(2)},
+		},
+	}
+
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{"", []string{"a", "b", "c", "d"}},
+		{"filename_desc", []string{"d", "c", "b", "a"}},
+		{"date", []string{"c", "b", "d", "a"}},
+		{"date_desc", []string{"a", "b", "d", "c"}},
+		// b was taken on day 1, before it was copied on day 2.
+		{"taken", []string{"b", "c", "d", "a"}},
+		// Untitled assets sort by filename, ignoring case.
+		{"title", []string{"c", "b", "d", "a"}},
+		{"title_desc", []string{"a", "d", "b", "c"}},
+		// Unlisted assets follow the listed ones, by filename.
+		{"manual", []string{"c", "a", "b", "d"}},
+	}
+	for _, tt := range tests {
+		assets := slices.Clone(album.Assets)
+		sortAssets(album, assets, tt.order)
+		var got []string
+		for _, a := range assets {
+			got = append(got, a.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("sortAssets(%q) = %v, want %v", tt.order, got, tt.want)
+		}
+	}
+}
+
+func TestSortChildren(t *testing.T) {
+	early := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	snap := &domain.Snapshot{Albums: map[string]*domain.Album{
+		"":  {Children: []string{"b", "a", "c"}, ChildOrder: []string{"alb_c"}},
+		"a": {ID: "alb_a", Path: "a", Title: "Zoo", Assets: []domain.Asset{{ModTime: late}}},
+		"b": {ID: "alb_b", Path: "b", Title: "beach", Children: []string{"b/old"}},
+		// b has no assets of its own; its sub-album's date counts.
+		"b/old": {ID: "alb_old", Path: "b/old", Assets: []domain.Asset{{ModTime: early}}},
+		"c":     {ID: "alb_c", Path: "c", Title: "Attic"},
+	}}
+	root := snap.Albums[""]
+	index := buildTakenIndex(snap, nil)
+	taken := func(path string) time.Time { return visibleTaken(index[path], nil) }
+
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{"", []string{"b", "a", "c"}},
+		{"name", []string{"a", "b", "c"}},
+		{"name_desc", []string{"c", "b", "a"}},
+		{"title", []string{"c", "b", "a"}},
+		{"taken", []string{"c", "b", "a"}},
+		{"taken_desc", []string{"a", "b", "c"}},
+		{"manual", []string{"c", "a", "b"}},
+	}
+	for _, tt := range tests {
+		got := sortChildren(root, snap.Albums, tt.order, taken)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("sortChildren(%q) = %v, want %v", tt.order, got, tt.want)
+		}
+	}
+}
+
+func TestVisibleTaken(t *testing.T) {
+	early := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	snap := &domain.Snapshot{Albums: map[string]*domain.Album{
+		"":    {Children: []string{"a"}},
+		"a":   {Path: "a", Children: []string{"a/x"}, Assets: []domain.Asset{{ModTime: late}}},
+		"a/x": {Path: "a/x", Assets: []domain.Asset{{ModTime: early, Access: &domain.AccessOverride{View: "restricted"}}}},
+	}}
+	index := buildTakenIndex(snap, nil)
+
+	// The restricted asset only counts for those who may see it.
+	if got := visibleTaken(index["a"], nil); !got.Equal(late) {
+		t.Errorf("anonymous: %v, want %v", got, late)
+	}
+	if got := visibleTaken(index["a"], &domain.Principal{Username: "admin", IsAdmin: true}); !got.Equal(early) {
+		t.Errorf("admin: %v, want %v", got, early)
+	}
+	if got := visibleTaken(index["a/x"], nil); !got.IsZero() {
+		t.Errorf("album with nothing visible: %v, want zero", got)
+	}
+}
+
+func TestAlbumOrderPatch(t *testing.T) {
+	root, handler := coverServer(t, "")
+
+	rr := patchMetadata(t, handler, "/api/v1/albums/alb_vac/order", `{"asset_ids":["ast_2","ast_3"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body)
+	}
+	st, err := state.LoadAlbumState(filepath.Join(root, "vacation"))
+	if err != nil || st == nil {
+		t.Fatalf("state not saved: %v", err)
+	}
+	if !slices.Equal(st.AssetOrder, []string{"ast_2", "ast_3"}) {
+		t.Errorf("asset_order = %v", st.AssetOrder)
+	}
+
+	// Setting only the child order keeps the asset order.
+	rr = patchMetadata(t, handler, "/api/v1/albums/alb_vac/order", `{"child_ids":[]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body)
+	}
+	st, _ = state.LoadAlbumState(filepath.Join(root, "vacation"))
+	if st == nil || len(st.AssetOrder) != 2 {
+		t.Errorf("asset order lost: %+v", st)
+	}
+
+	tests := []struct {
+		path, body string
+		want       int
+	}{
+		{"/api/v1/albums/alb_vac/order", `{}`, http.StatusBadRequest},
+		{"/api/v1/albums/alb_vac/order", `{"asset_ids":["ast_1"]}`, http.StatusBadRequest},
+		{"/api/v1/albums/alb_vac/order", `{"asset_ids":["ast_2","ast_2"]}`, http.StatusBadRequest},
+		{"/api/v1/albums/alb_vac/order", `{"child_ids":["alb_root"]}`, http.StatusBadRequest},
+		{"/api/v1/albums/alb_root/order", `{"child_ids":["alb_vac"]}`, http.StatusOK},
+		{"/api/v1/albums/alb_nope/order", `{"asset_ids":[]}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rr := patchMetadata(t, handler, tt.path, tt.body)
+		if rr.Code != tt.want {
+			t.Errorf("PATCH %s %s: status = %d, want %d", tt.path, tt.body, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestAlbumManualOrder(t *testing.T) {
+	snap, cfgs := testSnapshot()
+	vac := snap.Albums["vacation"]
+	vac.Assets = append(vac.Assets, domain.Asset{ID: "ast_3", Filename: "aardvark.jpg", AlbumPath: "vacation"})
+	vac.AssetOrder = []string{"ast_2"}
+	cfgs["vacation"].SortOrder = "manual"
+	handler := NewServer(snap, cfgs).Handler()
+
+	rr := doRequest(handler, "GET", "/api/v1/albums/alb_vac", nil)
+	var resp AlbumResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Assets) != 2 || resp.Assets[0].ID != "ast_2" {
+		t.Errorf("assets = %+v, want ast_2 first", resp.Assets)
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/perrito666/gollery/backend/internal/access"
+	"github.com/perrito666/gollery/backend/internal/auth"
+	"github.com/perrito666/gollery/backend/internal/domain"
+)
+
+// PlaceResponse is the JSON representation of a reverse-geocoded location.
+type PlaceResponse = domain.Place
+
+// PlaceCount is one entry of GET /api/v1/places: a distinct place and
+// the number of assets the current user can see there.
+type PlaceCount struct {
+	PlaceResponse
+	Count int `json:"count"`
+}
+
+// PlaceAssetSummary is an asset in a place listing, with its album.
+type PlaceAssetSummary struct {
+	AssetSummary
+	AlbumID   string         `json:"album_id"`
+	AlbumPath string         `json:"album_path"`
+	Place     *PlaceResponse `json:"place,omitempty"`
+}
+
+// PlaceAssetsResponse is the JSON body for GET /api/v1/places/assets.
+type PlaceAssetsResponse struct {
+	Assets      []PlaceAssetSummary `json:"assets"`
+	TotalAssets int                 `json:"total_assets"`
+}
+
+// visiblePlacedAssets returns every asset with a resolved place that the
+// principal can view and whose location the album's geo_privacy does not
+// withhold, ordered by album path then filename.
+// Must be called while s.mu is held.
+func (s *Server) visiblePlacedAssets(principal *domain.Principal) []*domain.Asset {
+	var out []*domain.Asset
+	for _, album := range s.snapshot.Albums {
+		albumACL := effectiveAlbumACL(s.configs, album.Path)
+		if access.CheckView(albumACL, principal) == access.Deny {
+			continue
+		}
+		geoPol := s.geoPolicy(album.Path, principal)
+		for i := range album.Assets {
+			ast := &album.Assets[i]
+			if ast.Place == nil {
+				continue
+			}
+			if !geoPol.placeVisible(ast) {
+				continue
+			}
+			if access.CheckView(access.EffectiveAssetACL(albumACL, ast.Access), principal) == access.Deny {
+				continue
+			}
+			out = append(out, ast)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AlbumPath != out[j].AlbumPath {
+			return out[i].AlbumPath < out[j].AlbumPath
+		}
+		return out[i].Filename < out[j].Filename
+	})
+	return out
+}
+
+// handlePlaces lists the distinct places of all visible assets with
+// their asset counts, ordered by country, region and city.
+func (s *Server) handlePlaces(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[domain.Place]int)
+	for _, ast := range s.visiblePlacedAssets(auth.PrincipalFromContext(r.Context())) {
+		counts[*ast.Place]++
+	}
+
+	places := make([]PlaceCount, 0, len(counts))
+	for p, n := range counts {
+		places = append(places, PlaceCount{PlaceResponse: p, Count: n})
+	}
+	sort.Slice(places, func(i, j int) bool {
+		a, b := places[i], places[j]
+		if a.Country != b.Country {
+			return a.Country < b.Country
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.City < b.City
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{"places": places})
+}
+
+// handlePlaceAssets lists visible assets filtered by place. The
+// country_code, region and city query parameters are optional and
+// matched case-insensitively; omitted ones match anything.
+func (s *Server) handlePlaceAssets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	countryCode := q.Get("country_code")
+	region := q.Get("region")
+	city := q.Get("city")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []*domain.Asset
+	for _, ast := range s.visiblePlacedAssets(auth.PrincipalFromContext(r.Context())) {
+		if !matchPlaceField(ast.Place.CountryCode, countryCode) ||
+			!matchPlaceField(ast.Place.Region, region) ||
+			!matchPlaceField(ast.Place.City, city) {
+			continue
+		}
+		matched = append(matched, ast)
+	}
+
+	offset, limit := parsePagination(r)
+	start, end := pageBounds(len(matched), offset, limit)
+
+	assets := make([]PlaceAssetSummary, 0, end-start)
+	for _, ast := range matched[start:end] {
+		var albumID string
+		if album, ok := s.albumsByPath[ast.AlbumPath]; ok {
+			albumID = album.ID
+		}
+		assets = append(assets, PlaceAssetSummary{
+			AssetSummary: AssetSummary{
+				ID:          ast.ID,
+				Filename:    ast.Filename,
+				Title:       ast.Title,
+				Description: ast.Description,
+				HasLocation: true,
+			},
+			AlbumID:   albumID,
+			AlbumPath: ast.AlbumPath,
+			Place:     ast.Place,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, PlaceAssetsResponse{Assets: assets, TotalAssets: len(matched)})
+}
+
+func matchPlaceField(value, filter string) bool {
+	return filter == "" || strings.EqualFold(value, filter)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/domain"
+)
+
+func placesServer() http.Handler {
+	snap, cfgs := testSnapshot()
+	paris := &domain.Place{City: "Paris", Region: "Île-de-France", Country: "France", CountryCode: "FR"}
+	lyon := &domain.Place{City: "Lyon", Region: "Auvergne-Rhône-Alpes", Country: "France", CountryCode: "FR"}
+
+	snap.Albums[""].Assets[0].Place = paris
+	snap.Albums["vacation"].Assets[0].Place = lyon
+	snap.Albums["vacation"].Assets = append(snap.Albums["vacation"].Assets,
+		domain.Asset{ID: "ast_3", Filename: "tower.jpg", AlbumPath: "vacation", Place: paris},
+		domain.Asset{ID: "ast_4", Filename: "home.jpg", AlbumPath: "vacation",
+			Access: &domain.AccessOverride{View: "private"}, Place: paris},
+	)
+	snap.Albums["private"].Assets = []domain.Asset{
+		{ID: "ast_5", Filename: "secret.jpg", AlbumPath: "private", Place: lyon},
+	}
+	return NewServer(snap, cfgs).Handler()
+}
+
+func TestPlaces_CountsVisibleAssets(t *testing.T) {
+	rr := doRequest(placesServer(), "GET", "/api/v1/places", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d", rr.Code)
+	}
+
+	var resp struct {
+		Places []PlaceCount `json:"places"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Places) != 2 {
+		t.Fatalf("places = %+v", resp.Places)
+	}
+	// Sorted by country, then region: Auvergne (Lyon) before Île (Paris).
+	if resp.Places[0].City != "Lyon" || resp.Places[0].Count != 1 {
+		t.Errorf("places[0] = %+v, want Lyon x1 (private album hidden)", resp.Places[0])
+	}
+	if resp.Places[1].City != "Paris" || resp.Places[1].Count != 2 {
+		t.Errorf("places[1] = %+v, want Paris x2 (private asset hidden)", resp.Places[1])
+	}
+}
+
+func TestPlaces_RestrictedVisibleToAllowedUser(t *testing.T) {
+	alice := &domain.Principal{Username: "alice"}
+	rr := doRequest(placesServer(), "GET", "/api/v1/places/assets?city=lyon", alice)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d", rr.Code)
+	}
+
+	var resp PlaceAssetsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.TotalAssets != 2 {
+		t.Errorf("total = %d, want 2", resp.TotalAssets)
+	}
+}
+
+func TestPlaceAssets_FilterAndPaginate(t *testing.T) {
+	handler := placesServer()
+
+	rr := doRequest(handler, "GET", "/api/v1/places/assets?country_code=fr&city=Paris&limit=1", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d", rr.Code)
+	}
+	var resp PlaceAssetsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.TotalAssets != 2 || len(resp.Assets) != 1 {
+		t.Fatalf("total = %d, page = %+v", resp.TotalAssets, resp.Assets)
+	}
+	first := resp.Assets[0]
+	if first.ID != "ast_1" || first.AlbumID != "alb_root" || first.Place == nil || first.Place.City != "Paris" {
+		t.Errorf("first = %+v", first)
+	}
+
+	rr = doRequest(handler, "GET", "/api/v1/places/assets?city=Paris&offset=1", nil)
+	resp = PlaceAssetsResponse{}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if len(resp.Assets) != 1 || resp.Assets[0].ID != "ast_3" {
+		t.Errorf("second page = %+v", resp.Assets)
+	}
+}
+
+func TestAssetByID_IncludesPlace(t *testing.T) {
+	rr := doRequest(placesServer(), "GET", "/api/v1/assets/ast_2", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d", rr.Code)
+	}
+	var resp AssetResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Place == nil || resp.Place.City != "Lyon" || resp.Place.CountryCode != "FR" {
+		t.Errorf("place = %+v", resp.Place)
+	}
+}
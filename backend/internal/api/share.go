@@ -8,6 +8,7 @@
 // ACL checks use a nil principal (anonymous) so that only publicly visible
 // content gets full OG metadata. Restricted content shows placeholder text
 // ("Private photo" / "Private album") without leaking titles or thumbnails.
+// Pages never carry an asset's location.
 package api
 
 import (
@@ -153,14 +154,10 @@ func (s *Server) handleShareAlbum(w http.ResponseWriter, r *http.Request) {
 		description = "Photo album"
 	}
 
-	// Find first public asset for og:image.
+	// The cover as anonymous visitors see it, if any, for og:image.
 	var imageURL string
-	for _, ast := range album.Assets {
-		astACL := access.EffectiveAssetACL(albumACL, ast.Access)
-		if access.CheckView(astACL, nil) == access.Allow {
-			imageURL = baseURL + "/api/v1/assets/" + ast.ID + "/thumbnail?size=1200"
-			break
-		}
+	if cover := albumCover(album, s.configs, nil); cover != "" {
+		imageURL = baseURL + "/api/v1/assets/" + cover + "/thumbnail?size=1200"
 	}
 
 	data := ogData{
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/perrito666/gollery/backend/internal/access"
+	"github.com/perrito666/gollery/backend/internal/auth"
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/geo"
+)
+
+// GeoJSONFeatureCollection is a GeoJSON (RFC 7946) FeatureCollection.
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature is a single GeoJSON Feature.
+type GeoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   GeoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// GeoJSONGeometry is a Point ([lon, lat]) or LineString ([[lon, lat], ...]).
+// Track positions carry elevation as a third element when known.
+type GeoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// handleAlbumTracks serves the album's tracks and routes as GeoJSON LineStrings,
+// simplified for the requested map zoom, plus a Point for every visible
+// geotagged asset and track-file waypoint. Access follows the album ACL;
+// positions follow the album's geo_privacy for the caller. Lines and
+// waypoints are withheld unless it is exact, and cut where they pass
+// through a home zone.
+func (s *Server) handleAlbumTracks(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	zoom := geo.MaxZoom
+	if v := r.URL.Query().Get("zoom"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > geo.MaxZoom {
+			writeError(w, http.StatusBadRequest, "zoom must be an integer between 0 and 22")
+			return
+		}
+		zoom = n
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	album, ok := s.albumsByID[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "album not found")
+		return
+	}
+
+	if !s.checkAlbumAccess(w, r, album) {
+		return
+	}
+
+	fc := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []GeoJSONFeature{}}
+
+	principal := auth.PrincipalFromContext(r.Context())
+	geoPol := s.geoPolicy(album.Path, principal)
+
+	tracks := album.Tracks
+	if !geoPol.exactTracks() {
+		tracks = nil
+	}
+	epsilon := geo.ToleranceForZoom(zoom)
+	for _, trk := range tracks {
+		if trk.Kind == geo.KindWaypoint {
+			for _, p := range trk.Points {
+				if !geoPol.visible(p.Lat, p.Lon) {
+					continue
+				}
+				fc.Features = append(fc.Features, GeoJSONFeature{
+					Type:       "Feature",
+					Geometry:   GeoJSONGeometry{Type: "Point", Coordinates: trackPosition(p.Lat, p.Lon, p.Ele)},
+					Properties: map[string]any{"kind": geo.KindWaypoint},
+				})
+			}
+			continue
+		}
+
+		kind := trk.Kind
+		if kind == "" {
+			kind = geo.KindTrack
+		}
+		props := map[string]any{"kind": kind}
+		if trk.Name != "" {
+			props["name"] = trk.Name
+		}
+		for _, segment := range visibleSegments(trk.Points, geoPol) {
+			pts := geo.Simplify(segment, epsilon)
+			if len(pts) < 2 {
+				// A LineString needs at least two positions.
+				continue
+			}
+			coords := make([][]float64, len(pts))
+			for i, p := range pts {
+				coords[i] = trackPosition(p.Lat, p.Lon, p.Ele)
+			}
+			fc.Features = append(fc.Features, GeoJSONFeature{
+				Type:       "Feature",
+				Geometry:   GeoJSONGeometry{Type: "LineString", Coordinates: coords},
+				Properties: props,
+			})
+		}
+	}
+
+	albumACL := effectiveAlbumACL(s.configs, album.Path)
+	visible := make([]domain.Asset, 0, len(album.Assets))
+	for _, ast := range album.Assets {
+		if access.CheckView(access.EffectiveAssetACL(albumACL, ast.Access), principal) == access.Allow {
+			visible = append(visible, ast)
+		}
+	}
+	sortOrder := ""
+	if cfg, ok := s.configs[album.Path]; ok {
+		sortOrder = cfg.SortOrder
+	}
+	sortAssets(album, visible, sortOrder)
+
+	for i := range visible {
+		ast := &visible[i]
+		lat, lon, _, ok := geoPol.locate(ast)
+		if !ok {
+			continue
+		}
+		props := map[string]any{
+			"kind":     "photo",
+			"asset_id": ast.ID,
+			"filename": ast.Filename,
+		}
+		if ast.Title != "" {
+			props["title"] = ast.Title
+		}
+		fc.Features = append(fc.Features, GeoJSONFeature{
+			Type:       "Feature",
+			Geometry:   GeoJSONGeometry{Type: "Point", Coordinates: [2]float64{lon, lat}},
+			Properties: props,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(fc); err != nil {
+		slog.Error("failed to encode GeoJSON response", "error", err)
+	}
+}
+
+// visibleSegments splits a track into the runs of points the policy may
+// show, dropping the parts inside home zones.
+func visibleSegments(points []domain.TrackPoint, p geoPolicy) [][]geo.Trackpoint {
+	var segments [][]geo.Trackpoint
+	var cur []geo.Trackpoint
+	for _, pt := range points {
+		if !p.visible(pt.Lat, pt.Lon) {
+			if len(cur) > 0 {
+				segments = append(segments, cur)
+				cur = nil
+			}
+			continue
+		}
+		cur = append(cur, geo.Trackpoint{Lat: pt.Lat, Lon: pt.Lon, Ele: pt.Ele})
+	}
+	if len(cur) > 0 {
+		segments = append(segments, cur)
+	}
+	return segments
+}
+
+// trackPosition returns a GeoJSON position, [lon, lat] or [lon, lat, ele].
+func trackPosition(lat, lon float64, ele *float64) []float64 {
+	if ele != nil {
+		return []float64{lon, lat, *ele}
+	}
+	return []float64{lon, lat}
+}
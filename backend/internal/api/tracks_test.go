@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/domain"
+)
+
+func tracksServer() http.Handler {
+	snap, cfgs := testSnapshot()
+	lat, lon, ele := 46.5, 7.5, 2100.0
+	vac := snap.Albums["vacation"]
+	vac.Tracks = []domain.Track{
+		{Name: "Hike", Points: []domain.TrackPoint{
+			{Lat: 46.0, Lon: 7.0},
+			{Lat: 46.25, Lon: 7.2501}, // tiny wiggle, dropped at low zoom
+			{Lat: 46.5, Lon: 7.5},
+			{Lat: 46.0, Lon: 8.0},
+		}},
+		{Points: []domain.TrackPoint{{Lat: 46.0, Lon: 7.0}}},
+		{Kind: "waypoint", Points: []domain.TrackPoint{{Lat: 46.2, Lon: 7.2, Ele: &ele}}},
+	}
+	vac.Assets[0].Metadata = &domain.ImageMetadata{Latitude: &lat, Longitude: &lon}
+	vac.Assets = append(vac.Assets, domain.Asset{
+		ID: "ast_hidden", Filename: "hidden.jpg", AlbumPath: "vacation",
+		Access:   &domain.AccessOverride{View: "private"},
+		Metadata: &domain.ImageMetadata{Latitude: &lat, Longitude: &lon},
+	})
+	return NewServer(snap, cfgs).Handler()
+}
+
+func decodeFeatures(t *testing.T, body []byte) []GeoJSONFeature {
+	t.Helper()
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Type     string `json:"type"`
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(body, &fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Type != "FeatureCollection" {
+		t.Fatalf("type = %q", fc.Type)
+	}
+	out := make([]GeoJSONFeature, len(fc.Features))
+	for i, f := range fc.Features {
+		var coords any
+		if f.Geometry.Type == "LineString" {
+			var line [][]float64
+			json.Unmarshal(f.Geometry.Coordinates, &line)
+			coords = line
+		} else {
+			var pt []float64
+			json.Unmarshal(f.Geometry.Coordinates, &pt)
+			coords = pt
+		}
+		out[i] = GeoJSONFeature{
+			Type:       f.Type,
+			Geometry:   GeoJSONGeometry{Type: f.Geometry.Type, Coordinates: coords},
+			Properties: f.Properties,
+		}
+	}
+	return out
+}
+
+func TestAlbumTracks_LinesAndPhotos(t *testing.T) {
+	rr := doRequest(tracksServer(), "GET", "/api/v1/albums/alb_vac/tracks.geojson?zoom=5", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/geo+json" {
+		t.Errorf("content-type = %q", ct)
+	}
+
+	features := decodeFeatures(t, rr.Body.Bytes())
+	if len(features) != 3 {
+		t.Fatalf("features = %+v, want one line, one waypoint and one visible photo", features)
+	}
+
+	line := features[0]
+	if line.Geometry.Type != "LineString" || line.Properties["name"] != "Hike" {
+		t.Errorf("line = %+v", line)
+	}
+	coords := line.Geometry.Coordinates.([][]float64)
+	if len(coords) != 3 {
+		t.Errorf("line has %d vertices, want 3 after simplification", len(coords))
+	}
+	if len(coords[0]) != 2 || coords[0][0] != 7.0 || coords[0][1] != 46.0 {
+		t.Errorf("coordinates must be [lon, lat], got %v", coords[0])
+	}
+
+	wpt := features[1]
+	if wpt.Geometry.Type != "Point" || wpt.Properties["kind"] != "waypoint" {
+		t.Errorf("waypoint = %+v", wpt)
+	}
+
+	photo := features[2]
+	if photo.Geometry.Type != "Point" || photo.Properties["asset_id"] != "ast_2" {
+		t.Errorf("photo = %+v", photo)
+	}
+}
+
+func TestAlbumTracks_FullDetailByDefault(t *testing.T) {
+	rr := doRequest(tracksServer(), "GET", "/api/v1/albums/alb_vac/tracks.geojson", nil)
+	features := decodeFeatures(t, rr.Body.Bytes())
+	if coords := features[0].Geometry.Coordinates.([][]float64); len(coords) != 4 {
+		t.Errorf("line has %d vertices, want all 4 without a zoom", len(coords))
+	}
+}
+
+func TestAlbumTracks_InvalidZoom(t *testing.T) {
+	for _, zoom := range []string{"abc", "-1", "23"} {
+		rr := doRequest(tracksServer(), "GET", "/api/v1/albums/alb_vac/tracks.geojson?zoom="+zoom, nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("zoom=%s: status = %d, want 400", zoom, rr.Code)
+		}
+	}
+}
+
+func TestAlbumTracks_ACL(t *testing.T) {
+	handler := tracksServer()
+
+	rr := doRequest(handler, "GET", "/api/v1/albums/alb_priv/tracks.geojson", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: status = %d, want 401", rr.Code)
+	}
+
+	rr = doRequest(handler, "GET", "/api/v1/albums/alb_priv/tracks.geojson", &domain.Principal{Username: "alice"})
+	if rr.Code != http.StatusOK {
+		t.Errorf("alice: status = %d, want 200", rr.Code)
+	}
+
+	rr = doRequest(handler, "GET", "/api/v1/albums/alb_missing/tracks.geojson", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("missing: status = %d, want 404", rr.Code)
+	}
+}
+
+func TestAlbumTracks_Elevation(t *testing.T) {
+	rr := doRequest(tracksServer(), "GET", "/api/v1/albums/alb_vac/tracks.geojson", nil)
+	features := decodeFeatures(t, rr.Body.Bytes())
+	pos := features[1].Geometry.Coordinates.([]float64)
+	if len(pos) != 3 || pos[2] != 2100 {
+		t.Errorf("waypoint position = %v, want [lon, lat, ele]", pos)
+	}
+}
@@ -3,11 +3,15 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/perrito666/gollery/backend/internal/analytics"
@@ -16,9 +20,13 @@ import (
 	"github.com/perrito666/gollery/backend/internal/auth"
 	"github.com/perrito666/gollery/backend/internal/cache"
 	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
 	"github.com/perrito666/gollery/backend/internal/fswalk"
 	"github.com/perrito666/gollery/backend/internal/index"
 	"github.com/perrito666/gollery/backend/internal/logging"
+	"github.com/perrito666/gollery/backend/internal/state"
+	pgstate "github.com/perrito666/gollery/backend/internal/state/postgres"
+	"github.com/perrito666/gollery/backend/internal/symlink"
 	"github.com/perrito666/gollery/backend/internal/watch"
 )
 
@@ -38,31 +46,72 @@ func Run(ctx context.Context, configPath string) error {
 	logging.Setup()
 	slog.Info("starting gollery", "listen_addr", cfg.ListenAddr, "content_root", cfg.ContentRoot)
 
-	// 3. Initial filesystem scan and snapshot.
-	scan, err := fswalk.Scan(cfg.ContentRoot)
-	if err != nil {
-		return fmt.Errorf("initial scan: %w", err)
+	// Sidecar state lives in the content tree unless a state root is set,
+	// or in PostgreSQL with the postgres state backend.
+	libs := cfg.ContentLibraries()
+	for _, lib := range libs {
+		state.SetStateRoot(lib.Root, lib.StateRoot)
 	}
-
-	snap, err := index.BuildSnapshot(cfg.ContentRoot, scan)
-	if err != nil {
-		return fmt.Errorf("building snapshot: %w", err)
+	if cfg.State != nil && cfg.State.Backend == "postgres" {
+		backend, err := setupStateBackend(ctx, cfg)
+		if err != nil {
+			return fmt.Errorf("setting up state backend: %w", err)
+		}
+		state.SetBackend(backend)
+		defer state.SetBackend(nil)
+		defer backend.Close()
 	}
 
-	configs := extractConfigs(scan)
-	slog.Info("initial scan complete", "albums", len(snap.Albums))
-
-	// 4. Initialize API server.
-	srv := api.NewServer(snap, configs)
+	// 3. Initial snapshot. A snapshot persisted by the previous run is
+	// served immediately and validated by a full scan once the server is
+	// up; without one, the content roots are indexed before serving.
 	cacheLayout := cache.NewLayout(cfg.CacheDir)
-	srv.SetContentRoot(cfg.ContentRoot, cacheLayout)
+	ix := newIndexer(cfg, cacheLayout)
+
+	var srv *api.Server
+	cached, err := cache.LoadSnapshot(cacheLayout, ix.contentRoot, libs.Roots())
+	if err == nil {
+		srv = api.NewServer(cached.Snapshot, cached.Configs)
+		ix.builder.Remember(cached.Snapshot)
+		srv.SetScanErrors(cached.ScanErrors)
+		slog.Info("serving cached snapshot", "albums", len(cached.Snapshot.Albums), "generated_at", cached.Snapshot.GeneratedAt)
+	} else {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("ignoring cached snapshot", "error", err)
+		}
+		ix.progress.Start("initial")
+		scans, err := ix.scanAll()
+		if err != nil {
+			ix.progress.Finish(err)
+			return fmt.Errorf("initial scan: %w", err)
+		}
 
-	// Collect scan errors for diagnostics.
-	scanErrors := make([]string, len(scan.Errors))
-	for i, e := range scan.Errors {
-		scanErrors[i] = fmt.Sprintf("%s: %v", e.Path, e.Err)
+		ix.progress.Indexing()
+		scan := ix.merge(scans)
+		snap, err := ix.builder.Build(ix.contentRoot, scan)
+		ix.progress.Finish(err)
+		if err != nil {
+			return fmt.Errorf("building snapshot: %w", err)
+		}
+		for i, lib := range ix.libraries {
+			lib.scan = scans[i]
+		}
+		ix.scan, ix.snap = scan, snap
+		slog.Info("initial scan complete", "albums", len(snap.Albums))
+
+		srv = api.NewServer(ix.withRoot(snap), extractConfigs(scan))
+		srv.SetScanErrors(scanErrors(scan))
+	}
+
+	// 4. Initialize API server.
+	srv.SetLibraries(libs, cacheLayout)
+	srv.SetLinks(symlink.New(cfg.FollowSymlinks.Roots()))
+	srv.SetHomeZones(cfg.HomeZones)
+	srv.SetIndexProgress(ix.progress)
+	ix.srv = srv
+	if cached == nil {
+		ix.save()
 	}
-	srv.SetScanErrors(scanErrors)
 
 	// 5. Initialize auth if configured.
 	if cfg.Auth != nil {
@@ -91,24 +140,33 @@ func Run(ctx context.Context, configPath string) error {
 		})
 	}
 
-	// 7. Start filesystem watcher.
-	reindex := func() error {
-		return doReindex(srv, cfg.ContentRoot, cacheLayout)
-	}
-	srv.SetAdmin(reindex)
-
-	w := watch.New(watch.Config{
-		ContentRoot: cfg.ContentRoot,
-		Reconcile: func(ctx context.Context, dirtyPaths []string) error {
-			slog.Info("reconciling changes", "dirty_paths", len(dirtyPaths))
-			return doReindex(srv, cfg.ContentRoot, cacheLayout)
-		},
-	})
-	go func() {
-		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
-			slog.Error("watcher stopped", "error", err)
+	// 7. Start filesystem watcher. Admin reindexes rebuild everything;
+	// watcher changes only rescan the dirty directories.
+	srv.SetAdmin(ix.reindex)
+	srv.SetRefresh(ix.refresh)
+	srv.SetIndexLock(&ix.mu)
+
+	for _, lib := range ix.libraries {
+		watchCfg := watch.Config{
+			ContentRoot: lib.Root,
+			Links:       lib.scanner.Links,
+			Reconcile: func(ctx context.Context, dirtyPaths []string) error {
+				slog.Info("reconciling changes", "library", lib.Name, "dirty_paths", len(dirtyPaths))
+				return ix.reconcile(lib, dirtyPaths)
+			},
 		}
-	}()
+		if wc := cfg.Watcher; wc != nil {
+			watchCfg.Mode = wc.Mode
+			watchCfg.PollInterval = time.Duration(wc.PollIntervalSecs) * time.Second
+			watchCfg.DebounceDelay = time.Duration(wc.DebounceSecs) * time.Second
+		}
+		w := watch.New(watchCfg)
+		go func() {
+			if err := w.Run(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("watcher stopped", "library", lib.Name, "error", err)
+			}
+		}()
+	}
 
 	// Set up analytics recorder if analytics are available.
 	if analyticsStore != nil {
@@ -131,6 +189,14 @@ func Run(ctx context.Context, configPath string) error {
 		close(errCh)
 	}()
 
+	if cached != nil {
+		go func() {
+			if err := ix.rebuild("validate"); err != nil {
+				slog.Error("validating cached snapshot", "error", err)
+			}
+		}()
+	}
+
 	// 10. Wait for shutdown signal.
 	select {
 	case <-ctx.Done():
@@ -146,35 +212,258 @@ func Run(ctx context.Context, configPath string) error {
 	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
 		return fmt.Errorf("shutdown: %w", err)
 	}
+	ix.mu.Lock()
+	ix.save()
+	ix.mu.Unlock()
 
 	slog.Info("server stopped")
 	return nil
 }
 
-// doReindex performs a full rescan and updates the API server's snapshot.
-// If cacheLayout is non-nil, it purges orphaned derivative cache files.
-func doReindex(srv *api.Server, contentRoot string, cacheLayout *cache.Layout) error {
-	scan, err := fswalk.Scan(contentRoot)
+// indexer rebuilds the API server's snapshot. It keeps the scan and
+// snapshot it last published so watcher changes can be applied
+// incrementally. Rebuilds are serialized.
+//
+// A gallery spanning several content roots is indexed as one: the scans
+// of its libraries are merged, with paths prefixed by the library name,
+// and built by a single builder, so that asset IDs, rename matching and
+// cache purging work across libraries.
+type indexer struct {
+	srv         *api.Server
+	contentRoot string // "" with named libraries, see index.Builder.Dir
+	libs        config.Libraries
+	libraries   []*library
+	cacheLayout *cache.Layout
+	builder     index.Builder
+	progress    *index.Progress
+
+	mu   sync.Mutex
+	scan *fswalk.ScanResult // merged scan of all libraries
+	snap *domain.Snapshot   // without the virtual root, see withRoot
+}
+
+// library is one content root with the scanner for it and its last
+// published scan, with paths relative to the root.
+type library struct {
+	config.LibraryConfig
+	scanner fswalk.Scanner
+	scan    *fswalk.ScanResult
+}
+
+// virtualRootID is the ID of the album listing the libraries.
+const virtualRootID = "alb_libraries"
+
+// newIndexer returns an indexer for the content libraries of cfg.
+func newIndexer(cfg *config.ServerConfig, cacheLayout *cache.Layout) *indexer {
+	ix := &indexer{
+		libs:        cfg.ContentLibraries(),
+		cacheLayout: cacheLayout,
+		progress:    &index.Progress{},
+	}
+	ix.builder = index.Builder{Workers: cfg.IndexWorkers, Progress: ix.progress}
+	if ix.libs.Named() {
+		ix.builder.Dir = ix.libs.Dir
+	} else {
+		ix.contentRoot = ix.libs[0].Root
+	}
+	if cfg.Watcher != nil {
+		ix.builder.RenameWindow = time.Duration(cfg.Watcher.RenameWindowSecs) * time.Second
+	}
+	for _, lc := range ix.libs {
+		ix.libraries = append(ix.libraries, &library{
+			LibraryConfig: lc,
+			scanner: fswalk.Scanner{
+				Workers:   cfg.IndexWorkers,
+				OnDir:     ix.progress.DirScanned,
+				Discovery: cfg.Discovery.AlbumDefaults(),
+				Root:      lc.AlbumDefaults(),
+				Links:     symlink.New(cfg.FollowSymlinks.Roots()),
+			},
+		})
+	}
+	return ix
+}
+
+// reindex performs a full rescan and updates the API server's snapshot,
+// purging orphaned derivative cache files.
+func (ix *indexer) reindex() error {
+	return ix.rebuild("full")
+}
+
+// rebuild is reindex with the given progress kind. The result is also
+// persisted, so the next start serves it without waiting for a scan.
+func (ix *indexer) rebuild(kind string) (err error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.rebuildLocked(kind)
+}
+
+func (ix *indexer) rebuildLocked(kind string) (err error) {
+	ix.progress.Start(kind)
+	defer func() { ix.progress.Finish(err) }()
+
+	scans, err := ix.scanAll()
 	if err != nil {
 		return fmt.Errorf("rescan: %w", err)
 	}
 
-	snap, err := index.BuildSnapshot(contentRoot, scan)
+	ix.progress.Indexing()
+	scan := ix.merge(scans)
+	snap, err := ix.builder.Build(ix.contentRoot, scan)
 	if err != nil {
 		return fmt.Errorf("rebuild snapshot: %w", err)
 	}
 
-	configs := extractConfigs(scan)
+	ix.publish(scans, scan, snap, true)
+	ix.save()
+	slog.Info("reindex complete", "kind", kind, "albums", len(snap.Albums))
+	return nil
+}
+
+// reconcile rescans only the dirty directories of lib and splices the
+// rebuilt albums into a copy of the current snapshot. While a cached
+// snapshot is still being validated there is no scan to splice into, so
+// it rebuilds everything instead.
+func (ix *indexer) reconcile(lib *library, dirtyPaths []string) (err error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.scan == nil {
+		return ix.rebuildLocked("full")
+	}
+	ix.progress.Start("incremental")
+	defer func() { ix.progress.Finish(err) }()
 
-	// Purge orphaned cache files before updating snapshot.
-	if cacheLayout != nil {
+	libScan, changed, err := lib.scanner.Rescan(lib.Root, lib.scan, dirtyPaths)
+	if err != nil {
+		return fmt.Errorf("rescan: %w", err)
+	}
+	scans := make([]*fswalk.ScanResult, len(ix.libraries))
+	for i, l := range ix.libraries {
+		scans[i] = l.scan
+		if l == lib {
+			scans[i] = libScan
+		}
+	}
+	for i, p := range changed {
+		changed[i] = lib.AlbumPath(p)
+	}
+
+	ix.progress.Indexing()
+	scan := ix.merge(scans)
+	snap, err := ix.builder.Update(ix.contentRoot, ix.snap, scan, changed)
+	if err != nil {
+		return fmt.Errorf("update snapshot: %w", err)
+	}
+
+	ix.publish(scans, scan, snap, assetsRemoved(ix.snap, snap, changed))
+	slog.Info("incremental reindex complete", "albums", len(snap.Albums), "changed", len(changed))
+	return nil
+}
+
+// refresh runs prepare, which changes the state of the albums at
+// albumPaths, and rebuilds those albums from the last scan, both under
+// the lock, so no index run reads the state half changed. While a cached
+// snapshot is still unvalidated there is nothing to rebuild from, and the
+// next index run picks the change up.
+func (ix *indexer) refresh(albumPaths []string, prepare func() error) (err error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if err := prepare(); err != nil {
+		return err
+	}
+	if ix.scan == nil {
+		return nil
+	}
+	ix.progress.Start("incremental")
+	defer func() { ix.progress.Finish(err) }()
+
+	ix.progress.Indexing()
+	snap, err := ix.builder.Update(ix.contentRoot, ix.snap, ix.scan, albumPaths)
+	if err != nil {
+		return fmt.Errorf("update snapshot: %w", err)
+	}
+	scans := make([]*fswalk.ScanResult, len(ix.libraries))
+	for i, lib := range ix.libraries {
+		scans[i] = lib.scan
+	}
+	ix.publish(scans, ix.scan, snap, false)
+	slog.Info("albums refreshed", "changed", len(albumPaths))
+	return nil
+}
+
+// scanAll scans every library, returning the scans in library order.
+func (ix *indexer) scanAll() ([]*fswalk.ScanResult, error) {
+	scans := make([]*fswalk.ScanResult, len(ix.libraries))
+	for i, lib := range ix.libraries {
+		scan, err := lib.scanner.Scan(lib.Root)
+		if err != nil {
+			if lib.Name != "" {
+				err = fmt.Errorf("library %s: %w", lib.Name, err)
+			}
+			return nil, err
+		}
+		scans[i] = scan
+	}
+	return scans, nil
+}
+
+// merge combines the scans of the libraries into one, with paths
+// prefixed by the library name. A single unnamed library's scan is
+// returned as is.
+func (ix *indexer) merge(scans []*fswalk.ScanResult) *fswalk.ScanResult {
+	if !ix.libs.Named() {
+		return scans[0]
+	}
+	merged := &fswalk.ScanResult{Albums: make(map[string]*fswalk.ScannedAlbum)}
+	for i, lib := range ix.libraries {
+		for _, album := range scans[i].Albums {
+			cp := *album
+			cp.Path = lib.AlbumPath(album.Path)
+			cp.ChildPaths = make([]string, len(album.ChildPaths))
+			for j, child := range album.ChildPaths {
+				cp.ChildPaths[j] = lib.AlbumPath(child)
+			}
+			merged.Albums[cp.Path] = &cp
+		}
+		for _, e := range scans[i].Errors {
+			e.Path = lib.AlbumPath(e.Path)
+			merged.Errors = append(merged.Errors, e)
+		}
+	}
+	return merged
+}
+
+// withRoot returns snap with the virtual root album above several
+// libraries, listing them in configuration order, or snap itself for a
+// single content root. The root has no directory, config or assets.
+func (ix *indexer) withRoot(snap *domain.Snapshot) *domain.Snapshot {
+	if !ix.libs.Named() {
+		return snap
+	}
+	root := &domain.Album{ID: virtualRootID}
+	for _, lib := range ix.libs {
+		if _, ok := snap.Albums[lib.Name]; ok {
+			root.Children = append(root.Children, lib.Name)
+		}
+	}
+	cp := *snap
+	cp.Albums = maps.Clone(snap.Albums)
+	cp.Albums[""] = root
+	return &cp
+}
+
+// publish swaps the new snapshot into the server, optionally purging
+// cache files of assets that no longer exist first. scans are the
+// libraries' scans that scan merges. Must be called with ix.mu held.
+func (ix *indexer) publish(scans []*fswalk.ScanResult, scan *fswalk.ScanResult, snap *domain.Snapshot, purge bool) {
+	if purge && ix.cacheLayout != nil {
 		knownIDs := make(map[string]bool)
 		for _, album := range snap.Albums {
 			for _, asset := range album.Assets {
 				knownIDs[asset.ID] = true
 			}
 		}
-		removed, err := cache.PurgeOrphans(cacheLayout, knownIDs)
+		removed, err := cache.PurgeOrphans(ix.cacheLayout, knownIDs)
 		if err != nil {
 			slog.Error("cache purge failed", "error", err)
 		} else if removed > 0 {
@@ -182,16 +471,67 @@ func doReindex(srv *api.Server, contentRoot string, cacheLayout *cache.Layout) e
 		}
 	}
 
-	srv.SetSnapshot(snap, configs)
+	ix.srv.SetSnapshot(ix.withRoot(snap), extractConfigs(scan))
+	ix.srv.SetScanErrors(scanErrors(scan))
 
-	scanErrors := make([]string, len(scan.Errors))
-	for i, e := range scan.Errors {
-		scanErrors[i] = fmt.Sprintf("%s: %v", e.Path, e.Err)
+	for i, lib := range ix.libraries {
+		lib.scan = scans[i]
 	}
-	srv.SetScanErrors(scanErrors)
+	ix.scan = scan
+	ix.snap = snap
+}
 
-	slog.Info("reindex complete", "albums", len(snap.Albums))
-	return nil
+// save persists the server's current snapshot to the cache directory.
+// Failures are logged: the persisted snapshot only speeds up startup.
+func (ix *indexer) save() {
+	if ix.cacheLayout == nil {
+		return
+	}
+	err := ix.srv.ReadSnapshot(func(snap *domain.Snapshot, configs map[string]*config.AlbumConfig, scanErrors []string) error {
+		return cache.SaveSnapshot(ix.cacheLayout, &cache.PersistedSnapshot{
+			ContentRoot: ix.contentRoot,
+			Libraries:   ix.libs.Roots(),
+			Snapshot:    snap,
+			Configs:     configs,
+			ScanErrors:  scanErrors,
+		})
+	})
+	if err != nil {
+		slog.Error("persisting snapshot failed", "error", err)
+	}
+}
+
+// assetsRemoved reports whether any asset of the changed albums in prev
+// is missing from the changed albums in next. Only then can derivative
+// cache files have become orphans.
+func assetsRemoved(prev, next *domain.Snapshot, changed []string) bool {
+	kept := make(map[string]bool)
+	for _, p := range changed {
+		if album, ok := next.Albums[p]; ok {
+			for _, asset := range album.Assets {
+				kept[asset.ID] = true
+			}
+		}
+	}
+	for _, p := range changed {
+		if album, ok := prev.Albums[p]; ok {
+			for _, asset := range album.Assets {
+				if !kept[asset.ID] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// scanErrors formats the scan errors for diagnostics.
+func scanErrors(scan *fswalk.ScanResult) []string {
+	errs := make([]string, len(scan.Errors))
+	for i, e := range scan.Errors {
+		errs[i] = fmt.Sprintf("%s: %v", e.Path, e.Err)
+	}
+	return errs
 }
 
 // extractConfigs pulls album configs from the scan result.
@@ -250,6 +590,27 @@ func setupAuth(srv *api.Server, cfg *config.ServerConfig, configPath string) err
 	return nil
 }
 
+// setupStateBackend connects the postgres state backend and runs its
+// migrations.
+func setupStateBackend(ctx context.Context, cfg *config.ServerConfig) (*pgstate.Backend, error) {
+	pool, err := pgstate.Connect(ctx, cfg.State.PostgresDSNEnv)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to postgres: %w", err)
+	}
+	var backend *pgstate.Backend
+	if libs := cfg.ContentLibraries(); libs.Named() {
+		backend = pgstate.NewLibraries(pool, libs.Roots())
+	} else {
+		backend = pgstate.New(pool, cfg.ContentRoot)
+	}
+	if err := backend.Migrate(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("running migrations: %w", err)
+	}
+	slog.Info("state backend connected", "backend", "postgres")
+	return backend, nil
+}
+
 // setupAnalytics connects to PostgreSQL and runs migrations.
 func setupAnalytics(ctx context.Context, cfg *config.GlobalAnalyticsConfig) (*pganalytics.Store, error) {
 	dsn := cfg.PostgresDSNEnv
@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/perrito666/gollery/backend/internal/api"
+	"github.com/perrito666/gollery/backend/internal/cache"
 	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
 	"github.com/perrito666/gollery/backend/internal/fswalk"
 	"github.com/perrito666/gollery/backend/internal/index"
 )
@@ -135,3 +139,226 @@ func createTestServer(t *testing.T, contentRoot string) *api.Server {
 	}
 	return api.NewServer(snap, extractConfigs(scan))
 }
+
+func TestIndexer_ReconcileIsIncremental(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"", "a", "b"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "album.json"), []byte(`{"title": "Root"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"a/one.jpg", "b/two.jpg"} {
+		if err := os.WriteFile(filepath.Join(root, f), []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan, err := fswalk.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := index.BuildSnapshot(root, scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := newIndexer(&config.ServerConfig{ContentRoot: root}, nil)
+	ix.srv = api.NewServer(snap, extractConfigs(scan))
+	ix.libraries[0].scan, ix.scan, ix.snap = scan, scan, snap
+
+	if err := os.WriteFile(filepath.Join(root, "a", "three.jpg"), []byte("fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.reconcile(ix.libraries[0], []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(ix.snap.Albums["a"].Assets); n != 2 {
+		t.Errorf("album a has %d assets, want 2", n)
+	}
+	if ix.snap.Albums["b"] != snap.Albums["b"] {
+		t.Error("album b should not have been rebuilt")
+	}
+
+	// A full reindex still picks up everything.
+	if err := ix.reindex(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(ix.snap.Albums); n != 3 {
+		t.Errorf("got %d albums, want 3", n)
+	}
+}
+
+func TestIndexer_RefreshRebuildsGivenAlbums(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "album.json"), []byte(`{"title": "Root"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"a/one.jpg", "b/two.jpg"} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(f)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, f), []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scan, err := fswalk.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := index.BuildSnapshot(root, scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := newIndexer(&config.ServerConfig{ContentRoot: root}, nil)
+	ix.srv = api.NewServer(snap, extractConfigs(scan))
+	ix.libraries[0].scan, ix.scan, ix.snap = scan, scan, snap
+
+	err = ix.refresh([]string{"a"}, func() error {
+		if ix.mu.TryLock() {
+			t.Error("prepare should run under the indexer lock")
+			ix.mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := ix.snap.Albums["a"]; a == nil || a == snap.Albums["a"] {
+		t.Error("album a should have been rebuilt")
+	}
+	if ix.snap.Albums["b"] != snap.Albums["b"] {
+		t.Error("album b should not have been rebuilt")
+	}
+}
+
+func TestRun_PersistsSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	contentRoot := filepath.Join(dir, "content")
+	cacheDir := filepath.Join(dir, "cache")
+	if err := os.MkdirAll(filepath.Join(contentRoot, "trip"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(contentRoot, "album.json"), []byte(`{"title": "Root"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(contentRoot, "trip", "a.jpg"), []byte("fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfgPath := filepath.Join(dir, "config.json")
+	data, _ := json.Marshal(config.ServerConfig{
+		ContentRoot: contentRoot,
+		CacheDir:    cacheDir,
+		ListenAddr:  "127.0.0.1:0",
+	})
+	if err := os.WriteFile(cfgPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Run(ctx, cfgPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cached, err := cache.LoadSnapshot(cache.NewLayout(cacheDir), contentRoot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(cached.Snapshot.Albums); n != 2 {
+		t.Errorf("cached %d albums, want 2", n)
+	}
+	if cached.Configs[""].Title != "Root" {
+		t.Errorf("cached root config = %+v", cached.Configs[""])
+	}
+}
+
+func TestIndexer_ReconcileWithoutScanRebuilds(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "album.json"), []byte(`{"title": "Root"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv := createTestServer(t, root)
+	cacheDir := t.TempDir()
+
+	// As when serving a cached snapshot that was not validated yet.
+	ix := newIndexer(&config.ServerConfig{ContentRoot: root}, cache.NewLayout(cacheDir))
+	ix.srv = srv
+	if err := os.MkdirAll(filepath.Join(root, "new"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "new", "a.jpg"), []byte("fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.reconcile(ix.libraries[0], []string{"new"}); err != nil {
+		t.Fatal(err)
+	}
+	if ix.scan == nil || len(ix.snap.Albums) != 2 {
+		t.Fatalf("reconcile did not rebuild: %+v", ix.snap)
+	}
+	if _, err := cache.LoadSnapshot(ix.cacheLayout, root, nil); err != nil {
+		t.Errorf("rebuild was not persisted: %v", err)
+	}
+}
+
+func TestIndexer_Libraries(t *testing.T) {
+	roots := map[string]string{"family": t.TempDir(), "work": t.TempDir()}
+	for _, f := range []string{"family/trip/a.jpg", "work/b.jpg"} {
+		name, rel, _ := strings.Cut(f, "/")
+		path := filepath.Join(roots[name], rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("fake"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &config.ServerConfig{Libraries: []config.LibraryConfig{
+		{Name: "work", Root: roots["work"], Title: "Work"},
+		{Name: "family", Root: roots["family"]},
+	}}
+	cacheDir := t.TempDir()
+	ix := newIndexer(cfg, cache.NewLayout(cacheDir))
+	ix.srv = api.NewServer(&domain.Snapshot{Albums: map[string]*domain.Album{}}, nil)
+	ix.srv.SetLibraries(cfg.ContentLibraries(), ix.cacheLayout)
+
+	if err := ix.reindex(); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"work", "family", "family/trip"} {
+		if ix.snap.Albums[p] == nil {
+			t.Errorf("album %q missing", p)
+		}
+	}
+	if ix.snap.Albums["work"].Title != "Work" {
+		t.Errorf("work title = %q, want Work", ix.snap.Albums["work"].Title)
+	}
+	if ix.snap.Albums[""] != nil {
+		t.Error("the virtual root should only be published")
+	}
+
+	// A change in one library is reconciled under its name.
+	if err := os.WriteFile(filepath.Join(roots["family"], "trip", "c.jpg"), []byte("fake2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.reconcile(ix.libraries[1], []string{"trip"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(ix.snap.Albums["family/trip"].Assets); n != 2 {
+		t.Errorf("family/trip has %d assets, want 2", n)
+	}
+	if ix.snap.Albums["work"] == nil {
+		t.Error("work library lost by reconciling family")
+	}
+
+	cached, err := cache.LoadSnapshot(ix.cacheLayout, "", cfg.ContentLibraries().Roots())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := cached.Snapshot.Albums[""]
+	if root == nil || root.ID != virtualRootID || !slices.Equal(root.Children, []string{"work", "family"}) {
+		t.Errorf("virtual root = %+v", root)
+	}
+}
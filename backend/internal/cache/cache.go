@@ -1,5 +1,5 @@
 // Package cache manages the gallery-cache directory layout for generated
-// image derivatives (thumbnails and previews).
+// image derivatives (thumbnails and previews) and the persisted snapshot.
 //
 // # Directory structure
 //
@@ -7,6 +7,7 @@
 // A typical layout:
 //
 //	<cache-root>/
+//	├── snapshot.json.gz # last published index, see [SaveSnapshot]
 //	├── thumbs/          # thumbnails (small, square-ish images for grids)
 //	│   ├── ast_a1b2c3_400.jpg
 //	│   └── ast_d4e5f6_400.jpg
@@ -37,6 +38,15 @@
 //     are immutable. A changed source image gets a new asset ID (new
 //     sidecar entry), so old cache entries become orphans and are purged.
 //
+// # Persisted snapshot
+//
+// [SaveSnapshot] stores the last published [domain.Snapshot] together with
+// the album configs and scan errors, so that a restart can serve from it
+// immediately while a full scan validates it in the background.
+// [LoadSnapshot] rejects a file written in another format or for another
+// content root; the caller then indexes synchronously as on a first start.
+// The snapshot is only a startup accelerator: deleting it is always safe.
+//
 // # Path safety
 //
 // All paths are constructed by [Layout] methods using [filepath.Join] on
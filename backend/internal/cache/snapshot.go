@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
+)
+
+// snapshotFormat is bumped whenever the persisted shape of the snapshot
+// changes incompatibly; files of another format are ignored.
+const snapshotFormat = 1
+
+// ErrSnapshotStale is returned by [LoadSnapshot] for a snapshot that was
+// written in an older format or for other content roots.
+var ErrSnapshotStale = errors.New("cached snapshot does not match")
+
+// PersistedSnapshot is the last published index, saved so that a restart
+// can serve immediately instead of waiting for a full scan.
+type PersistedSnapshot struct {
+	Format      int                            `json:"format"`
+	ContentRoot string                         `json:"content_root"`
+	Libraries   map[string]string              `json:"libraries,omitempty"`
+	Snapshot    *domain.Snapshot               `json:"snapshot"`
+	Configs     map[string]*config.AlbumConfig `json:"configs"`
+	ScanErrors  []string                       `json:"scan_errors,omitempty"`
+}
+
+// SnapshotPath returns the path of the persisted snapshot. It sits at the
+// cache root, outside the directories [PurgeOrphans] cleans.
+func (l *Layout) SnapshotPath() string {
+	return filepath.Join(l.Root, "snapshot.json.gz")
+}
+
+// SaveSnapshot writes the snapshot atomically (temp file + rename), so a
+// crash mid-write leaves the previous one in place.
+func SaveSnapshot(layout *Layout, p *PersistedSnapshot) error {
+	p.Format = snapshotFormat
+	if err := os.MkdirAll(layout.Root, 0755); err != nil {
+		return fmt.Errorf("creating cache dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(layout.Root, ".tmp-snapshot-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+
+	zw := gzip.NewWriter(tmp)
+	err = json.NewEncoder(zw).Encode(p)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := os.Rename(tmpName, layout.SnapshotPath()); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("renaming snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot reads the persisted snapshot for contentRoot, or for the
+// given libraries (name to root) when serving several. It returns an
+// error wrapping [os.ErrNotExist] when there is none and
+// [ErrSnapshotStale] when it cannot be used.
+func LoadSnapshot(layout *Layout, contentRoot string, libraries map[string]string) (*PersistedSnapshot, error) {
+	f, err := os.Open(layout.SnapshotPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	var p PersistedSnapshot
+	if err := json.NewDecoder(zr).Decode(&p); err != nil {
+		return nil, fmt.Errorf("decoding snapshot: %w", err)
+	}
+	if p.Format != snapshotFormat {
+		return nil, fmt.Errorf("%w: format %d, want %d", ErrSnapshotStale, p.Format, snapshotFormat)
+	}
+	if p.ContentRoot != contentRoot {
+		return nil, fmt.Errorf("%w: content root %q", ErrSnapshotStale, p.ContentRoot)
+	}
+	if !maps.Equal(p.Libraries, libraries) {
+		return nil, fmt.Errorf("%w: libraries %v", ErrSnapshotStale, p.Libraries)
+	}
+	if p.Snapshot == nil || p.Snapshot.Albums == nil {
+		return nil, fmt.Errorf("decoding snapshot: no albums")
+	}
+	if p.Configs == nil {
+		p.Configs = make(map[string]*config.AlbumConfig)
+	}
+	return &p, nil
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
+)
+
+func testPersisted() *PersistedSnapshot {
+	return &PersistedSnapshot{
+		ContentRoot: "/srv/photos",
+		Snapshot: &domain.Snapshot{
+			GeneratedAt: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+			Albums: map[string]*domain.Album{
+				"": {ID: "alb_root", Path: "", Title: "Root", Children: []string{"trip"}},
+				"trip": {
+					ID: "alb_trip", Path: "trip", ParentPath: "",
+					Assets: []domain.Asset{{
+						ID: "ast_a", Filename: "a.jpg", AlbumPath: "trip", SizeBytes: 4,
+						ModTime: time.Date(2025, 5, 1, 8, 30, 0, 0, time.UTC),
+					}},
+				},
+			},
+		},
+		Configs:    map[string]*config.AlbumConfig{"": {Title: "Root"}},
+		ScanErrors: []string{"broken: invalid album.json"},
+	}
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	l := NewLayout(filepath.Join(t.TempDir(), "cache"))
+	want := testPersisted()
+	if err := SaveSnapshot(l, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadSnapshot(l, "/srv/photos", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", got, want)
+	}
+
+	// No temp files are left behind.
+	entries, err := os.ReadDir(l.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("cache dir has %d entries, want 1", len(entries))
+	}
+}
+
+func TestLoadSnapshot_Missing(t *testing.T) {
+	_, err := LoadSnapshot(NewLayout(t.TempDir()), "/srv/photos", nil)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("err = %v, want ErrNotExist", err)
+	}
+}
+
+func TestLoadSnapshot_OtherContentRoot(t *testing.T) {
+	l := NewLayout(t.TempDir())
+	if err := SaveSnapshot(l, testPersisted()); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadSnapshot(l, "/srv/other", nil)
+	if !errors.Is(err, ErrSnapshotStale) {
+		t.Errorf("err = %v, want ErrSnapshotStale", err)
+	}
+}
+
+func TestLoadSnapshot_OtherLibraries(t *testing.T) {
+	l := NewLayout(t.TempDir())
+	p := testPersisted()
+	p.ContentRoot = ""
+	p.Libraries = map[string]string{"photos": "/srv/photos", "scans": "/srv/scans"}
+	if err := SaveSnapshot(l, p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSnapshot(l, "", map[string]string{"photos": "/srv/photos", "scans": "/srv/scans"}); err != nil {
+		t.Errorf("same libraries: %v", err)
+	}
+	_, err := LoadSnapshot(l, "", map[string]string{"photos": "/srv/photos"})
+	if !errors.Is(err, ErrSnapshotStale) {
+		t.Errorf("err = %v, want ErrSnapshotStale", err)
+	}
+}
+
+func TestLoadSnapshot_Corrupt(t *testing.T) {
+	l := NewLayout(t.TempDir())
+	if err := os.WriteFile(l.SnapshotPath(), []byte("not gzip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSnapshot(l, "/srv/photos", nil); err == nil {
+		t.Error("expected error for corrupt snapshot")
+	}
+}
+
+func TestPurgeOrphans_KeepsSnapshot(t *testing.T) {
+	l := NewLayout(t.TempDir())
+	if err := SaveSnapshot(l, testPersisted()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PurgeOrphans(l, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(l.SnapshotPath()); err != nil {
+		t.Errorf("snapshot was purged: %v", err)
+	}
+}
@@ -6,6 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezones must validate and resolve on minimal images
 )
 
 // ServerConfig holds the global server configuration.
@@ -13,9 +17,22 @@ type ServerConfig struct {
 	// ContentRoot is the filesystem path to the root content directory.
 	ContentRoot string `json:"content_root"`
 
+	// Libraries, in place of ContentRoot, serves several content roots
+	// as one gallery, each as a top-level album named after it.
+	Libraries []LibraryConfig `json:"libraries,omitempty"`
+
 	// CacheDir is the path to the gallery-cache directory for derivatives.
 	CacheDir string `json:"cache_dir"`
 
+	// StateRoot, if set, holds the sidecar state (.gallery directories) in
+	// a tree mirroring the content root instead of inside the album
+	// directories, so the content can be mounted read-only. With
+	// libraries, each one's state goes in a directory named after it.
+	StateRoot string `json:"state_root,omitempty"`
+
+	// State selects where album and asset state is stored.
+	State *StateConfig `json:"state,omitempty"`
+
 	// ListenAddr is the address the server listens on (e.g. ":8080").
 	ListenAddr string `json:"listen_addr"`
 
@@ -30,6 +47,220 @@ type ServerConfig struct {
 
 	// Timeouts configures HTTP server timeouts.
 	Timeouts *TimeoutConfig `json:"timeouts,omitempty"`
+
+	// HomeZones are private areas whose coordinates are never shown to
+	// anyone but album admins, whatever the album's geo_privacy. They live
+	// here rather than in album.json so the zones themselves stay private.
+	HomeZones []HomeZone `json:"home_zones,omitempty"`
+
+	// Watcher configures how content changes are detected.
+	Watcher *WatcherConfig `json:"watcher,omitempty"`
+
+	// IndexWorkers bounds how many directories, albums or images are
+	// scanned and indexed concurrently. Zero uses the number of CPUs.
+	IndexWorkers int `json:"index_workers,omitempty"`
+
+	// Discovery publishes directories that contain images but have no
+	// album.json, so a fresh content root shows something without
+	// hand-written configs.
+	Discovery *DiscoveryConfig `json:"discovery,omitempty"`
+
+	// FollowSymlinks makes scans follow symbolic links into the allowed
+	// roots, so albums can be assembled from directories kept elsewhere.
+	FollowSymlinks *SymlinkConfig `json:"follow_symlinks,omitempty"`
+}
+
+// StateConfig selects the state backend.
+type StateConfig struct {
+	// Backend is "sidecar" (the default: JSON files in .gallery
+	// directories) or "postgres".
+	Backend string `json:"backend,omitempty"`
+
+	// PostgresDSNEnv is the DSN of the postgres backend.
+	PostgresDSNEnv string `json:"postgres_dsn_env,omitempty"`
+}
+
+// DiscoveryConfig holds discovery mode settings.
+type DiscoveryConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// Access is the access given to discovered albums. When unset, or
+	// when its view is empty, discovered albums are restricted, which
+	// without allowed users or groups means only global admins see them.
+	Access *AccessConfig `json:"access,omitempty"`
+}
+
+// AlbumDefaults returns the config given to discovered albums, or nil
+// when discovery is off.
+func (d *DiscoveryConfig) AlbumDefaults() *AlbumConfig {
+	if d == nil || !d.Enabled {
+		return nil
+	}
+	return &AlbumConfig{Access: restrictedByDefault(d.Access)}
+}
+
+// SymlinkConfig holds the settings for following symbolic links.
+type SymlinkConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// AllowedRoots are the directories links may point into. Links to
+	// anywhere else, or back into a content root, are not followed.
+	AllowedRoots []string `json:"allowed_roots,omitempty"`
+}
+
+// Roots returns the directories links may point into, or nil when links
+// are not followed.
+func (s *SymlinkConfig) Roots() []string {
+	if s == nil || !s.Enabled {
+		return nil
+	}
+	return s.AllowedRoots
+}
+
+// restrictedByDefault returns a copy of acl whose view, if unset, is
+// "restricted".
+func restrictedByDefault(acl *AccessConfig) *AccessConfig {
+	cp := AccessConfig{View: "restricted"}
+	if acl != nil {
+		cp = *acl
+		if cp.View == "" {
+			cp.View = "restricted"
+		}
+	}
+	return &cp
+}
+
+// LibraryConfig is one content root of a gallery that spans several.
+type LibraryConfig struct {
+	// Name is the path of the library's top-level album. It is a single
+	// path segment, unique among the libraries.
+	Name string `json:"name"`
+
+	// Root is the library's content directory.
+	Root string `json:"root"`
+
+	// Title is the title of the top-level album, unless the root's
+	// album.json sets one. Defaults to the name.
+	Title string `json:"title,omitempty"`
+
+	// StateRoot holds the library's sidecar state outside Root. Defaults
+	// to a directory named after the library under the global
+	// state_root, if one is set.
+	StateRoot string `json:"state_root,omitempty"`
+
+	// Access is the default access of the library's albums, as if set in
+	// an album.json above its root. When unset, or when its view is
+	// empty, they are restricted unless their album.json says otherwise.
+	Access *AccessConfig `json:"access,omitempty"`
+}
+
+// AlbumDefaults returns the config the library root's album.json is
+// merged over, or nil for the unnamed library of a single content_root.
+// A library's root is always published, whether or not it has an
+// album.json.
+func (l *LibraryConfig) AlbumDefaults() *AlbumConfig {
+	if l.Name == "" {
+		return nil
+	}
+	title := l.Title
+	if title == "" {
+		title = l.Name
+	}
+	return &AlbumConfig{Title: title, Access: restrictedByDefault(l.Access)}
+}
+
+// AlbumPath returns the gallery path of the album at relPath within the
+// library.
+func (l *LibraryConfig) AlbumPath(relPath string) string {
+	if l.Name == "" || relPath == "" {
+		return l.Name + relPath
+	}
+	return filepath.Join(l.Name, relPath)
+}
+
+// Libraries are the content roots served as one gallery. With more than
+// one, album paths start with the library name, and the root album ""
+// is virtual: it has no directory, and lists the libraries.
+type Libraries []LibraryConfig
+
+// Named reports whether the libraries are named ones below a virtual
+// root, rather than the single content_root.
+func (ls Libraries) Named() bool {
+	return len(ls) > 0 && ls[0].Name != ""
+}
+
+// Roots maps the names of named libraries to their roots, or returns nil
+// for a single content root.
+func (ls Libraries) Roots() map[string]string {
+	if !ls.Named() {
+		return nil
+	}
+	roots := make(map[string]string, len(ls))
+	for _, l := range ls {
+		roots[l.Name] = l.Root
+	}
+	return roots
+}
+
+// Dir returns the directory of the album at the gallery path albumPath.
+// It returns "" for the virtual root and for paths in no library.
+func (ls Libraries) Dir(albumPath string) string {
+	for _, l := range ls {
+		if l.Name == "" {
+			return filepath.Join(l.Root, albumPath)
+		}
+		if albumPath == l.Name {
+			return l.Root
+		}
+		if rest, ok := strings.CutPrefix(albumPath, l.Name+string(filepath.Separator)); ok {
+			return filepath.Join(l.Root, rest)
+		}
+	}
+	return ""
+}
+
+// ContentLibraries returns the content roots to serve: the configured
+// libraries, with their state roots resolved, or a single unnamed
+// library for ContentRoot.
+func (c *ServerConfig) ContentLibraries() Libraries {
+	if len(c.Libraries) == 0 {
+		return Libraries{{Root: c.ContentRoot, StateRoot: c.StateRoot}}
+	}
+	libs := make(Libraries, len(c.Libraries))
+	for i, l := range c.Libraries {
+		if l.StateRoot == "" && c.StateRoot != "" {
+			l.StateRoot = filepath.Join(c.StateRoot, l.Name)
+		}
+		libs[i] = l
+	}
+	return libs
+}
+
+// WatcherConfig holds filesystem watcher settings.
+type WatcherConfig struct {
+	// Mode is "inotify", "poll", or empty to use inotify where available
+	// and poll otherwise. Polling is needed on network filesystems, where
+	// inotify does not see changes made by other hosts.
+	Mode string `json:"mode,omitempty"`
+
+	// PollIntervalSecs is how often the polling watcher walks the tree.
+	PollIntervalSecs int `json:"poll_interval_seconds,omitempty"`
+
+	// DebounceSecs is how long the tree must be quiet before changes are
+	// reconciled.
+	DebounceSecs int `json:"debounce_seconds,omitempty"`
+
+	// RenameWindowSecs is how long a vanished file can still be matched
+	// with a new one by content, keeping its asset ID across a rename or
+	// move that spans several reconciles.
+	RenameWindowSecs int `json:"rename_window_seconds,omitempty"`
+}
+
+// HomeZone is a circle around a sensitive location.
+type HomeZone struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	RadiusM   float64 `json:"radius_m"`
 }
 
 // TimeoutConfig holds HTTP server timeout settings.
@@ -99,9 +330,23 @@ type AlbumConfig struct {
 	Derivatives *DerivativesConfig `json:"derivatives,omitempty"`
 
 	// SortOrder controls how assets are ordered when listing an album.
-	// Valid values: "filename" (default), "date" (sort by file modification time).
+	// Valid values: "filename" (default), "date" (file modification time),
+	// "taken" (EXIF capture time, falling back to modification time),
+	// "title" (falling back to filename), each reversed with a "_desc"
+	// suffix, and "manual" (the order an admin set, then by filename).
 	SortOrder string `json:"sort_order,omitempty"`
 
+	// ChildSortOrder controls how child albums are ordered when listing
+	// an album. Valid values: "" (directory order), "name", "title",
+	// "taken" (earliest capture time of the album's assets), each reversed
+	// with a "_desc" suffix, and "manual" (the order an admin set).
+	ChildSortOrder string `json:"child_sort_order,omitempty"`
+
+	// Cover is the filename of the asset shown as the album's cover,
+	// unless an admin picked another one. It names a file in the album's
+	// own directory, so it is not inherited.
+	Cover string `json:"cover,omitempty"`
+
 	// Latitude is the album-level default latitude for assets without
 	// individual GPS coordinates. Used as a fallback only.
 	Latitude *float64 `json:"latitude,omitempty"`
@@ -109,6 +354,38 @@ type AlbumConfig struct {
 	// Longitude is the album-level default longitude for assets without
 	// individual GPS coordinates. Used as a fallback only.
 	Longitude *float64 `json:"longitude,omitempty"`
+
+	// WriteXMP opts the album in to mirroring asset metadata edits
+	// (title, description, keywords, rating, GPS) into standard .xmp
+	// sidecars next to the originals. The originals are never modified.
+	WriteXMP *bool `json:"write_xmp,omitempty"`
+
+	// Timezone is the IANA zone (e.g. "Europe/Lisbon") the camera clock
+	// was set to. It turns zoneless EXIF capture times into absolute times
+	// for GPX matching. If unset, the zone is inferred from coordinates.
+	Timezone string `json:"timezone,omitempty"`
+
+	// CameraClockOffset corrects a camera clock that was wrong, as a Go
+	// duration added to every capture time (e.g. "-1h2m30s").
+	CameraClockOffset string `json:"camera_clock_offset,omitempty"`
+
+	// GPXTolerance is the largest time distance, as a Go duration, at
+	// which a photo snaps to a single trackpoint. Default "30s".
+	GPXTolerance string `json:"gpx_tolerance,omitempty"`
+
+	// GPXMaxGap is the longest gap between two trackpoints, as a Go
+	// duration, that photo positions may be interpolated across.
+	// "0s" disables interpolation. Default "unlimited" (any gap).
+	GPXMaxGap string `json:"gpx_max_gap,omitempty"`
+
+	// GeoPrivacy controls how precisely asset locations are shown to
+	// viewers who do not administer the album: "exact" (default),
+	// "coarse" (snapped to a GeoCoarseKm grid) or "hidden".
+	GeoPrivacy string `json:"geo_privacy,omitempty"`
+
+	// GeoCoarseKm is the grid size, 1 to 10 km, used by "coarse"
+	// geo_privacy. Default 5.
+	GeoCoarseKm *float64 `json:"geo_coarse_km,omitempty"`
 }
 
 // AccessConfig defines visibility and ACL rules.
@@ -149,11 +426,50 @@ var ValidAccessModes = map[string]bool{
 
 // ValidSortOrders lists the allowed values for AlbumConfig.SortOrder.
 var ValidSortOrders = map[string]bool{
-	"":         true, // empty means default (filename)
-	"filename": true,
-	"date":     true,
+	"":              true, // empty means default (filename)
+	"filename":      true,
+	"filename_desc": true,
+	"date":          true,
+	"date_desc":     true,
+	"taken":         true,
+	"taken_desc":    true,
+	"title":         true,
+	"title_desc":    true,
+	"manual":        true,
+}
+
+// ValidChildSortOrders lists the allowed values for
+// AlbumConfig.ChildSortOrder.
+var ValidChildSortOrders = map[string]bool{
+	"":           true, // empty means directory order
+	"name":       true,
+	"name_desc":  true,
+	"title":      true,
+	"title_desc": true,
+	"taken":      true,
+	"taken_desc": true,
+	"manual":     true,
+}
+
+// Geo privacy levels for AlbumConfig.GeoPrivacy.
+const (
+	GeoPrivacyExact  = "exact"
+	GeoPrivacyCoarse = "coarse"
+	GeoPrivacyHidden = "hidden"
+)
+
+// ValidGeoPrivacy lists the allowed values for AlbumConfig.GeoPrivacy.
+var ValidGeoPrivacy = map[string]bool{
+	"":               true, // empty means default (exact)
+	GeoPrivacyExact:  true,
+	GeoPrivacyCoarse: true,
+	GeoPrivacyHidden: true,
 }
 
+// GPXMaxGapUnlimited is the AlbumConfig.GPXMaxGap value that allows
+// interpolating across any gap.
+const GPXMaxGapUnlimited = "unlimited"
+
 // LoadAlbumConfig reads and parses an album.json file.
 func LoadAlbumConfig(path string) (*AlbumConfig, error) {
 	data, err := os.ReadFile(path)
@@ -187,6 +503,38 @@ func (c *AlbumConfig) Validate() error {
 	if !ValidSortOrders[c.SortOrder] {
 		return fmt.Errorf("invalid sort_order: %q", c.SortOrder)
 	}
+	if !ValidChildSortOrders[c.ChildSortOrder] {
+		return fmt.Errorf("invalid child_sort_order: %q", c.ChildSortOrder)
+	}
+	if c.Cover != "" && (filepath.Base(c.Cover) != c.Cover || c.Cover == "." || c.Cover == "..") {
+		return fmt.Errorf("invalid cover: %q (must be a filename in the album)", c.Cover)
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %q", c.Timezone)
+		}
+	}
+	if c.CameraClockOffset != "" {
+		if _, err := time.ParseDuration(c.CameraClockOffset); err != nil {
+			return fmt.Errorf("invalid camera_clock_offset: %q", c.CameraClockOffset)
+		}
+	}
+	if c.GPXTolerance != "" {
+		if d, err := time.ParseDuration(c.GPXTolerance); err != nil || d < 0 {
+			return fmt.Errorf("invalid gpx_tolerance: %q", c.GPXTolerance)
+		}
+	}
+	if c.GPXMaxGap != "" && c.GPXMaxGap != GPXMaxGapUnlimited {
+		if d, err := time.ParseDuration(c.GPXMaxGap); err != nil || d < 0 {
+			return fmt.Errorf("invalid gpx_max_gap: %q", c.GPXMaxGap)
+		}
+	}
+	if !ValidGeoPrivacy[c.GeoPrivacy] {
+		return fmt.Errorf("invalid geo_privacy: %q", c.GeoPrivacy)
+	}
+	if c.GeoCoarseKm != nil && (*c.GeoCoarseKm < 1 || *c.GeoCoarseKm > 10) {
+		return fmt.Errorf("invalid geo_coarse_km: %v (must be between 1 and 10)", *c.GeoCoarseKm)
+	}
 	return nil
 }
 
@@ -195,6 +543,7 @@ func (c *AlbumConfig) Validate() error {
 //   - scalar values: child overrides parent
 //   - objects/maps: merge by key
 //   - arrays/lists: child replaces parent
+//   - cover: never inherited, since it names a file of the child's own
 //
 // If child.Inherit is false, the parent is ignored and only the child
 // is returned (server defaults are applied elsewhere).
@@ -223,12 +572,37 @@ func MergeAlbumConfigs(parent, child *AlbumConfig) *AlbumConfig {
 	if child.SortOrder != "" {
 		merged.SortOrder = child.SortOrder
 	}
+	if child.ChildSortOrder != "" {
+		merged.ChildSortOrder = child.ChildSortOrder
+	}
 	if child.Latitude != nil {
 		merged.Latitude = child.Latitude
 	}
 	if child.Longitude != nil {
 		merged.Longitude = child.Longitude
 	}
+	if child.WriteXMP != nil {
+		merged.WriteXMP = child.WriteXMP
+	}
+	if child.Timezone != "" {
+		merged.Timezone = child.Timezone
+	}
+	if child.CameraClockOffset != "" {
+		merged.CameraClockOffset = child.CameraClockOffset
+	}
+	if child.GPXTolerance != "" {
+		merged.GPXTolerance = child.GPXTolerance
+	}
+	if child.GPXMaxGap != "" {
+		merged.GPXMaxGap = child.GPXMaxGap
+	}
+	if child.GeoPrivacy != "" {
+		merged.GeoPrivacy = child.GeoPrivacy
+	}
+	if child.GeoCoarseKm != nil {
+		merged.GeoCoarseKm = child.GeoCoarseKm
+	}
+	merged.Cover = child.Cover
 	merged.Inherit = child.Inherit
 
 	// Objects: merge by key.
@@ -331,6 +705,7 @@ func mergeDerivatives(parent, child *DerivativesConfig) *DerivativesConfig {
 //   - GOLLERY_LISTEN_ADDR overrides listen_addr
 //   - GOLLERY_POSTGRES_DSN overrides analytics.postgres_dsn_env
 //   - GOLLERY_SESSION_SECRET overrides auth.session_secret
+//   - GOLLERY_STATE_POSTGRES_DSN overrides state.postgres_dsn_env
 func LoadServerConfig(path string) (*ServerConfig, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -357,22 +732,81 @@ func LoadServerConfig(path string) (*ServerConfig, error) {
 		}
 		cfg.Auth.SessionSecret = v
 	}
+	if v := os.Getenv("GOLLERY_STATE_POSTGRES_DSN"); v != "" {
+		if cfg.State == nil {
+			cfg.State = &StateConfig{}
+		}
+		cfg.State.PostgresDSNEnv = v
+	}
 
 	return &cfg, nil
 }
 
+// validateLibraries checks that the libraries have distinct names usable
+// as album paths, and roots that do not overlap each other or any
+// library's state root.
+func (c *ServerConfig) validateLibraries() []error {
+	var errs []error
+	libs := c.ContentLibraries()
+	names := make(map[string]bool)
+	for i, l := range c.Libraries {
+		switch {
+		case l.Name == "":
+			errs = append(errs, fmt.Errorf("libraries[%d]: name is required", i))
+		case strings.HasPrefix(l.Name, ".") || strings.ContainsAny(l.Name, `/\`):
+			errs = append(errs, fmt.Errorf("libraries[%d]: name %q must be a single path segment not starting with \".\"", i, l.Name))
+		case names[l.Name]:
+			errs = append(errs, fmt.Errorf("libraries[%d]: duplicate name %q", i, l.Name))
+		}
+		names[l.Name] = true
+		if l.Root == "" {
+			errs = append(errs, fmt.Errorf("libraries[%d]: root is required", i))
+			continue
+		}
+		for j, other := range c.Libraries[:i] {
+			if other.Root != "" && (within(l.Root, other.Root) || within(other.Root, l.Root)) {
+				errs = append(errs, fmt.Errorf("libraries[%d]: root overlaps libraries[%d]", i, j))
+			}
+		}
+		for _, other := range libs {
+			if other.StateRoot != "" && within(other.StateRoot, l.Root) {
+				errs = append(errs, fmt.Errorf("libraries[%d]: root contains the state root of library %q", i, other.Name))
+			}
+		}
+		if d := l.AlbumDefaults(); d != nil {
+			if err := d.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("libraries[%d]: %w", i, err))
+			}
+		}
+	}
+	return errs
+}
+
+// within reports whether path is dir or inside it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // Validate checks server config for required fields.
 func (c *ServerConfig) Validate() error {
 	var errs []error
-	if c.ContentRoot == "" {
-		errs = append(errs, fmt.Errorf("content_root is required"))
+	switch {
+	case c.ContentRoot == "" && len(c.Libraries) == 0:
+		errs = append(errs, fmt.Errorf("content_root or libraries is required"))
+	case c.ContentRoot != "" && len(c.Libraries) > 0:
+		errs = append(errs, fmt.Errorf("content_root and libraries are mutually exclusive"))
 	}
+	errs = append(errs, c.validateLibraries()...)
 	if c.CacheDir == "" {
 		errs = append(errs, fmt.Errorf("cache_dir is required"))
 	}
 	if c.ListenAddr == "" {
 		errs = append(errs, fmt.Errorf("listen_addr is required"))
 	}
+	if c.StateRoot != "" && c.ContentRoot != "" && within(c.StateRoot, c.ContentRoot) {
+		errs = append(errs, fmt.Errorf("state_root must be outside content_root"))
+	}
 	if c.Auth != nil {
 		if c.Auth.Provider == "" {
 			errs = append(errs, fmt.Errorf("auth.provider is required when auth is configured"))
@@ -389,5 +823,59 @@ func (c *ServerConfig) Validate() error {
 			errs = append(errs, fmt.Errorf("analytics.postgres_dsn_env is required for postgres backend"))
 		}
 	}
+	if c.Watcher != nil {
+		switch c.Watcher.Mode {
+		case "", "inotify", "poll":
+		default:
+			errs = append(errs, fmt.Errorf("watcher.mode must be \"inotify\" or \"poll\", got %q", c.Watcher.Mode))
+		}
+		if c.Watcher.PollIntervalSecs < 0 || c.Watcher.DebounceSecs < 0 || c.Watcher.RenameWindowSecs < 0 {
+			errs = append(errs, fmt.Errorf("watcher intervals must not be negative"))
+		}
+	}
+	if c.IndexWorkers < 0 {
+		errs = append(errs, fmt.Errorf("index_workers must not be negative"))
+	}
+	if c.State != nil {
+		switch c.State.Backend {
+		case "", "sidecar":
+		case "postgres":
+			if c.State.PostgresDSNEnv == "" {
+				errs = append(errs, fmt.Errorf("state.postgres_dsn_env is required for postgres backend"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("state.backend must be \"sidecar\" or \"postgres\", got %q", c.State.Backend))
+		}
+	}
+	if s := c.FollowSymlinks; s != nil && s.Enabled {
+		if len(s.AllowedRoots) == 0 {
+			errs = append(errs, fmt.Errorf("follow_symlinks.allowed_roots is required when following symlinks"))
+		}
+		for i, root := range s.AllowedRoots {
+			if !filepath.IsAbs(root) {
+				errs = append(errs, fmt.Errorf("follow_symlinks.allowed_roots[%d] must be an absolute path", i))
+				continue
+			}
+			for _, lib := range c.ContentLibraries() {
+				if lib.Root != "" && within(root, lib.Root) {
+					errs = append(errs, fmt.Errorf("follow_symlinks.allowed_roots[%d] must be outside the content roots", i))
+					break
+				}
+			}
+		}
+	}
+	if d := c.Discovery.AlbumDefaults(); d != nil {
+		if err := d.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("discovery: %w", err))
+		}
+	}
+	for i, z := range c.HomeZones {
+		if z.Latitude < -90 || z.Latitude > 90 || z.Longitude < -180 || z.Longitude > 180 {
+			errs = append(errs, fmt.Errorf("home_zones[%d]: coordinates out of range", i))
+		}
+		if z.RadiusM <= 0 {
+			errs = append(errs, fmt.Errorf("home_zones[%d]: radius_m must be positive", i))
+		}
+	}
 	return errors.Join(errs...)
 }
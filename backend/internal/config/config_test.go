@@ -101,6 +101,92 @@ func TestAlbumConfigValidate(t *testing.T) {
 			cfg:     AlbumConfig{SortOrder: "random"},
 			wantErr: true,
 		},
+		{
+			name: "valid sort_order taken_desc",
+			cfg:  AlbumConfig{SortOrder: "taken_desc"},
+		},
+		{
+			name: "valid sort_order manual",
+			cfg:  AlbumConfig{SortOrder: "manual"},
+		},
+		{
+			name:    "manual cannot be reversed",
+			cfg:     AlbumConfig{SortOrder: "manual_desc"},
+			wantErr: true,
+		},
+		{
+			name: "valid child_sort_order title",
+			cfg:  AlbumConfig{ChildSortOrder: "title"},
+		},
+		{
+			name:    "invalid child_sort_order",
+			cfg:     AlbumConfig{ChildSortOrder: "filename"},
+			wantErr: true,
+		},
+		{
+			name: "valid cover",
+			cfg:  AlbumConfig{Cover: "beach.jpg"},
+		},
+		{
+			name:    "cover outside the album",
+			cfg:     AlbumConfig{Cover: "../other/beach.jpg"},
+			wantErr: true,
+		},
+		{
+			name: "valid timezone",
+			cfg:  AlbumConfig{Timezone: "Europe/Lisbon"},
+		},
+		{
+			name:    "invalid timezone",
+			cfg:     AlbumConfig{Timezone: "Mars/Olympus_Mons"},
+			wantErr: true,
+		},
+		{
+			name: "valid camera_clock_offset",
+			cfg:  AlbumConfig{CameraClockOffset: "-1h2m30s"},
+		},
+		{
+			name:    "invalid camera_clock_offset",
+			cfg:     AlbumConfig{CameraClockOffset: "an hour"},
+			wantErr: true,
+		},
+		{
+			name: "valid gpx matching settings",
+			cfg:  AlbumConfig{GPXTolerance: "1m", GPXMaxGap: "0s"},
+		},
+		{
+			name: "unlimited gpx_max_gap",
+			cfg:  AlbumConfig{GPXMaxGap: "unlimited"},
+		},
+		{
+			name:    "negative gpx_max_gap",
+			cfg:     AlbumConfig{GPXMaxGap: "-1s"},
+			wantErr: true,
+		},
+		{
+			name:    "negative gpx_tolerance",
+			cfg:     AlbumConfig{GPXTolerance: "-30s"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid gpx_max_gap",
+			cfg:     AlbumConfig{GPXMaxGap: "forever"},
+			wantErr: true,
+		},
+		{
+			name: "valid coarse geo_privacy",
+			cfg:  AlbumConfig{GeoPrivacy: "coarse", GeoCoarseKm: float64Ptr(2)},
+		},
+		{
+			name:    "invalid geo_privacy",
+			cfg:     AlbumConfig{GeoPrivacy: "fuzzy"},
+			wantErr: true,
+		},
+		{
+			name:    "geo_coarse_km out of range",
+			cfg:     AlbumConfig{GeoPrivacy: "coarse", GeoCoarseKm: float64Ptr(50)},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -210,6 +296,22 @@ func TestMergeAlbumConfigs_SortOrderInheritance(t *testing.T) {
 	if merged2.SortOrder != "filename" {
 		t.Errorf("sort_order = %q, want %q (overridden by child)", merged2.SortOrder, "filename")
 	}
+
+	parent3 := &AlbumConfig{ChildSortOrder: "taken_desc"}
+	merged3 := MergeAlbumConfigs(parent3, child)
+	if merged3.ChildSortOrder != "taken_desc" {
+		t.Errorf("child_sort_order = %q, want %q (inherited from parent)", merged3.ChildSortOrder, "taken_desc")
+	}
+}
+
+func TestMergeAlbumConfigs_CoverNotInherited(t *testing.T) {
+	parent := &AlbumConfig{Cover: "beach.jpg"}
+	child := &AlbumConfig{Title: "Child"}
+
+	merged := MergeAlbumConfigs(parent, child)
+	if merged.Cover != "" {
+		t.Errorf("cover = %q, want none (not inherited)", merged.Cover)
+	}
 }
 
 func float64Ptr(v float64) *float64 { return &v }
@@ -243,6 +345,34 @@ func TestMergeAlbumConfigs_LatLonInheritance(t *testing.T) {
 	}
 }
 
+func TestMergeAlbumConfigs_WriteXMPInheritance(t *testing.T) {
+	parent := &AlbumConfig{WriteXMP: boolPtr(true)}
+
+	merged := MergeAlbumConfigs(parent, &AlbumConfig{Title: "Child"})
+	if merged.WriteXMP == nil || !*merged.WriteXMP {
+		t.Errorf("write_xmp = %v, want true (inherited)", merged.WriteXMP)
+	}
+
+	merged2 := MergeAlbumConfigs(parent, &AlbumConfig{WriteXMP: boolPtr(false)})
+	if *merged2.WriteXMP {
+		t.Error("write_xmp = true, want false (overridden)")
+	}
+}
+
+func TestMergeAlbumConfigs_GeoPrivacyInheritance(t *testing.T) {
+	parent := &AlbumConfig{GeoPrivacy: "coarse", GeoCoarseKm: float64Ptr(3)}
+
+	merged := MergeAlbumConfigs(parent, &AlbumConfig{Title: "Child"})
+	if merged.GeoPrivacy != "coarse" || *merged.GeoCoarseKm != 3 {
+		t.Errorf("merged = %q/%v, want inherited coarse/3", merged.GeoPrivacy, *merged.GeoCoarseKm)
+	}
+
+	merged = MergeAlbumConfigs(parent, &AlbumConfig{GeoPrivacy: "hidden"})
+	if merged.GeoPrivacy != "hidden" {
+		t.Errorf("geo_privacy = %q, want hidden (overridden)", merged.GeoPrivacy)
+	}
+}
+
 func TestMergeAlbumConfigs_AnalyticsMerge(t *testing.T) {
 	parent := &AlbumConfig{
 		Analytics: &AlbumAnalyticsConfig{
@@ -356,6 +486,249 @@ func TestServerConfigValidate_Analytics(t *testing.T) {
 	}
 }
 
+func TestServerConfigValidate_HomeZones(t *testing.T) {
+	cfg := ServerConfig{
+		ContentRoot: "/data",
+		CacheDir:    "/cache",
+		ListenAddr:  ":8080",
+		HomeZones:   []HomeZone{{Latitude: 48.85, Longitude: 2.35, RadiusM: 300}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("valid home zone should pass: %v", err)
+	}
+
+	cfg.HomeZones[0].RadiusM = 0
+	if err := cfg.Validate(); err == nil {
+		t.Error("zero radius should fail")
+	}
+
+	cfg.HomeZones[0] = HomeZone{Latitude: 95, Longitude: 0, RadiusM: 100}
+	if err := cfg.Validate(); err == nil {
+		t.Error("out-of-range latitude should fail")
+	}
+}
+
+func TestServerConfigValidate_Watcher(t *testing.T) {
+	cfg := ServerConfig{
+		ContentRoot: "/data",
+		CacheDir:    "/cache",
+		ListenAddr:  ":8080",
+		Watcher:     &WatcherConfig{Mode: "poll", PollIntervalSecs: 30},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("poll mode should pass: %v", err)
+	}
+
+	cfg.Watcher.Mode = "fanotify"
+	if err := cfg.Validate(); err == nil {
+		t.Error("unknown mode should fail")
+	}
+
+	cfg.Watcher = &WatcherConfig{DebounceSecs: -1}
+	if err := cfg.Validate(); err == nil {
+		t.Error("negative debounce should fail")
+	}
+
+	cfg.Watcher = &WatcherConfig{RenameWindowSecs: -1}
+	if err := cfg.Validate(); err == nil {
+		t.Error("negative rename window should fail")
+	}
+}
+
+func TestServerConfigValidate_StateRoot(t *testing.T) {
+	cfg := ServerConfig{
+		ContentRoot: "/data/content",
+		CacheDir:    "/cache",
+		ListenAddr:  ":8080",
+		StateRoot:   "/data/state",
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("sibling state root should pass: %v", err)
+	}
+
+	for _, inside := range []string{"/data/content", "/data/content/state"} {
+		cfg.StateRoot = inside
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("state root %q inside the content root should fail", inside)
+		}
+	}
+}
+
+func TestServerConfigValidate_Libraries(t *testing.T) {
+	valid := func() ServerConfig {
+		return ServerConfig{
+			CacheDir:   "/cache",
+			ListenAddr: ":8080",
+			StateRoot:  "/state",
+			Libraries: []LibraryConfig{
+				{Name: "photos", Root: "/disk1/photos"},
+				{Name: "scans", Root: "/disk2", Access: &AccessConfig{View: "public"}},
+			},
+		}
+	}
+	cfg := valid()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("valid libraries should pass: %v", err)
+	}
+
+	tests := map[string]func(*ServerConfig){
+		"with content_root":  func(c *ServerConfig) { c.ContentRoot = "/data" },
+		"no name":            func(c *ServerConfig) { c.Libraries[0].Name = "" },
+		"nested name":        func(c *ServerConfig) { c.Libraries[0].Name = "a/b" },
+		"hidden name":        func(c *ServerConfig) { c.Libraries[0].Name = ".gallery" },
+		"duplicate name":     func(c *ServerConfig) { c.Libraries[1].Name = "photos" },
+		"no root":            func(c *ServerConfig) { c.Libraries[1].Root = "" },
+		"nested roots":       func(c *ServerConfig) { c.Libraries[1].Root = "/disk1" },
+		"state in root":      func(c *ServerConfig) { c.StateRoot = "/disk2/state" },
+		"own state in root":  func(c *ServerConfig) { c.Libraries[0].StateRoot = "/disk1/photos/.state" },
+		"invalid access":     func(c *ServerConfig) { c.Libraries[0].Access = &AccessConfig{View: "secret"} },
+		"neither root given": func(c *ServerConfig) { c.Libraries = nil },
+	}
+	for name, mutate := range tests {
+		cfg := valid()
+		mutate(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: should fail", name)
+		}
+	}
+}
+
+func TestContentLibraries(t *testing.T) {
+	single := ServerConfig{ContentRoot: "/data", StateRoot: "/state"}
+	libs := single.ContentLibraries()
+	if libs.Named() || len(libs) != 1 || libs[0].Root != "/data" || libs[0].StateRoot != "/state" {
+		t.Errorf("single content root: %+v", libs)
+	}
+	if got := libs.Dir(filepath.Join("a", "b")); got != filepath.Join("/data", "a", "b") {
+		t.Errorf("Dir = %q", got)
+	}
+
+	multi := ServerConfig{
+		StateRoot: "/state",
+		Libraries: []LibraryConfig{
+			{Name: "photos", Root: "/disk1"},
+			{Name: "scans", Root: "/disk2", StateRoot: "/elsewhere"},
+		},
+	}
+	libs = multi.ContentLibraries()
+	if !libs.Named() || libs[0].StateRoot != filepath.Join("/state", "photos") || libs[1].StateRoot != "/elsewhere" {
+		t.Errorf("libraries: %+v", libs)
+	}
+	for path, want := range map[string]string{
+		"":                             "",
+		"photos":                       "/disk1",
+		filepath.Join("scans", "1990"): filepath.Join("/disk2", "1990"),
+		"photosynthesis":               "",
+		filepath.Join("other", "a"):    "",
+	} {
+		if got := libs.Dir(path); got != want {
+			t.Errorf("Dir(%q) = %q, want %q", path, got, want)
+		}
+	}
+	if roots := libs.Roots(); len(roots) != 2 || roots["scans"] != "/disk2" {
+		t.Errorf("Roots = %v", roots)
+	}
+	if single.ContentLibraries().Roots() != nil {
+		t.Error("a single content root has no named roots")
+	}
+	if got := libs[1].AlbumPath(""); got != "scans" {
+		t.Errorf("AlbumPath = %q", got)
+	}
+
+	defaults := libs[0].AlbumDefaults()
+	if defaults.Title != "photos" || defaults.Access.View != "restricted" {
+		t.Errorf("AlbumDefaults = %+v", defaults)
+	}
+	if single.ContentLibraries()[0].AlbumDefaults() != nil {
+		t.Error("the unnamed library should have no defaults")
+	}
+}
+
+func TestServerConfigValidate_StateBackend(t *testing.T) {
+	cfg := ServerConfig{
+		ContentRoot: "/data",
+		CacheDir:    "/cache",
+		ListenAddr:  ":8080",
+		State:       &StateConfig{Backend: "sidecar"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("sidecar backend should pass: %v", err)
+	}
+
+	cfg.State = &StateConfig{Backend: "postgres"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("postgres backend without DSN should fail")
+	}
+	cfg.State.PostgresDSNEnv = "postgres://localhost/gollery"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("postgres backend with DSN should pass: %v", err)
+	}
+
+	cfg.State = &StateConfig{Backend: "sqlite"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("unknown backend should fail")
+	}
+}
+
+func TestServerConfigValidate_Discovery(t *testing.T) {
+	cfg := ServerConfig{
+		ContentRoot: "/data",
+		CacheDir:    "/cache",
+		ListenAddr:  ":8080",
+		Discovery:   &DiscoveryConfig{Enabled: true},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("default discovery should pass: %v", err)
+	}
+	if got := cfg.Discovery.AlbumDefaults().Access.View; got != "restricted" {
+		t.Errorf("default access = %q, want restricted", got)
+	}
+
+	cfg.Discovery.Access = &AccessConfig{View: "everyone"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("invalid discovery access should fail")
+	}
+
+	cfg.Discovery.Enabled = false
+	if cfg.Discovery.AlbumDefaults() != nil {
+		t.Error("disabled discovery should have no album defaults")
+	}
+}
+
+func TestServerConfigValidate_FollowSymlinks(t *testing.T) {
+	cfg := ServerConfig{
+		ContentRoot:    "/data",
+		CacheDir:       "/cache",
+		ListenAddr:     ":8080",
+		FollowSymlinks: &SymlinkConfig{Enabled: true, AllowedRoots: []string{"/nas/photos"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("valid follow_symlinks should pass: %v", err)
+	}
+	if got := cfg.FollowSymlinks.Roots(); len(got) != 1 {
+		t.Errorf("Roots() = %v", got)
+	}
+
+	for name, roots := range map[string][]string{
+		"no roots":        nil,
+		"relative root":   {"nas"},
+		"in content root": {"/data/elsewhere"},
+	} {
+		cfg.FollowSymlinks.AllowedRoots = roots
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	cfg.FollowSymlinks = &SymlinkConfig{AllowedRoots: []string{"/nas"}}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("disabled follow_symlinks should pass: %v", err)
+	}
+	if cfg.FollowSymlinks.Roots() != nil {
+		t.Error("disabled follow_symlinks should have no roots")
+	}
+}
+
 func TestLoadServerConfig(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "config.json")
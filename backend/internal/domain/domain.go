@@ -52,6 +52,40 @@ type Album struct {
 
 	// Assets contains the assets discovered in this album.
 	Assets []Asset
+
+	// Tracks holds the album's tracklogs, routes and waypoints from
+	// track files (GPX, KML, GeoJSON, TCX, FIT), in file order.
+	Tracks []Track
+
+	// CoverID is the ID of the asset an admin picked as cover, from
+	// sidecar state. Empty when none was picked.
+	CoverID string
+
+	// AssetOrder and ChildOrder are the asset and child album IDs in the
+	// order an admin set, from sidecar state. Used by the "manual" sort
+	// orders.
+	AssetOrder []string
+	ChildOrder []string
+}
+
+// Track is a recorded track, planned route or set of waypoints, such as
+// one GPX track segment.
+type Track struct {
+	Name string
+
+	// Kind is "track", "route" or "waypoint". Waypoint points are
+	// unconnected.
+	Kind   string
+	Points []TrackPoint
+}
+
+// TrackPoint is a single vertex of a [Track].
+type TrackPoint struct {
+	Lat float64
+	Lon float64
+
+	// Ele is the elevation in meters, nil if unknown.
+	Ele *float64
 }
 
 // Asset represents an image file discovered in an album.
@@ -68,6 +102,12 @@ type Asset struct {
 	// Description is an optional description from sidecar state.
 	Description string
 
+	// Keywords are optional editorial tags from sidecar state.
+	Keywords []string
+
+	// Rating is an optional 0-5 star rating from sidecar state.
+	Rating int
+
 	// AlbumPath is the relative path of the containing album.
 	AlbumPath string
 
@@ -84,6 +124,19 @@ type Asset struct {
 	// Metadata holds extracted EXIF/image metadata.
 	// May be nil if metadata extraction was not performed.
 	Metadata *ImageMetadata
+
+	// Place is the reverse-geocoded location of the asset's coordinates.
+	// Nil if the asset has no location or it could not be resolved.
+	Place *Place
+}
+
+// Place is a human-readable location resolved from coordinates. It is
+// cached in asset state and served by the API as it is.
+type Place struct {
+	City        string `json:"city,omitempty"`
+	Region      string `json:"region,omitempty"`
+	Country     string `json:"country,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
 }
 
 // ImageMetadata holds extracted image metadata (EXIF, dimensions, etc.).
@@ -96,6 +149,15 @@ type ImageMetadata struct {
 	Orientation int        `json:"orientation,omitempty"`
 	Latitude    *float64   `json:"latitude,omitempty"`
 	Longitude   *float64   `json:"longitude,omitempty"`
+	Altitude    *float64   `json:"altitude,omitempty"` // meters above sea level
+
+	// DateTakenHasOffset reports whether the camera recorded its UTC
+	// offset with the capture time (EXIF OffsetTimeOriginal). When false,
+	// DateTaken as extracted is the camera's wall-clock reading in a UTC
+	// location and must be resolved against a time zone before comparing
+	// it with absolute timestamps such as GPX trackpoints. In snapshots it
+	// has been resolved already, from the album's timezone or position.
+	DateTakenHasOffset bool `json:"date_taken_has_offset,omitempty"`
 }
 
 // AccessOverride holds per-asset ACL overrides.
@@ -112,6 +174,23 @@ type Snapshot struct {
 
 	// Albums is the full set of discovered albums keyed by relative path.
 	Albums map[string]*Album
+
+	// IdentityIssues lists problems found while assigning stable IDs,
+	// sorted by album path, for admin diagnostics.
+	IdentityIssues []IdentityIssue
+}
+
+// IdentityIssue is a problem with an object's stable ID, such as a new
+// file whose content matches several vanished assets.
+type IdentityIssue struct {
+	// AlbumPath is the album the affected object is in.
+	AlbumPath string
+
+	// Filename is the affected asset, or empty for the album itself.
+	Filename string
+
+	// Message describes the problem and how it was resolved.
+	Message string
 }
 
 // Principal represents an authenticated user for ACL evaluation.
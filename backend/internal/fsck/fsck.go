@@ -0,0 +1,301 @@
+// Package fsck checks the integrity of the sidecar state and album configs
+// in a content tree.
+//
+// # What is checked
+//
+// [Check] visits every directory under the content root that is neither
+// hidden nor ignored by a .galleryignore, the same directories the
+// scanner does, following the symbolic links its [symlink.Policy] allows,
+// and reports:
+//
+//   - Orphaned sidecars: .gallery/assets/<file>.json whose file no longer
+//     exists. They are left behind when an image is deleted, together with
+//     its discussions and ACL override. The indexer still uses them to
+//     recognise renames and moves, so they are only removed on request.
+//   - Corrupt state: album or asset state files that cannot be parsed.
+//     The indexer quarantines these on its own when it meets them; fsck
+//     finds them everywhere, including in directories that are not albums.
+//   - Invalid configs: album.json files that cannot be parsed or that fail
+//     [config.AlbumConfig.Validate] once merged with their parent's config,
+//     as the scanner merges them.
+//
+// # Repairs
+//
+// By default Check only reports. [Options] enable removing orphaned
+// sidecars and moving corrupt state files to .gallery/quarantine/ (see
+// [state.QuarantineAssetState]). album.json is never modified: it is owned
+// by the user.
+//
+// Sidecars are looked up where the state package keeps them, so with a
+// state root set through [state.SetStateRoot] their paths in findings are
+// absolute rather than relative to the content root.
+//
+// [CheckLibraries] checks every library of a gallery spanning several
+// content roots, with paths in findings starting with the library name.
+package fsck
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/ignore"
+	"github.com/perrito666/gollery/backend/internal/state"
+	"github.com/perrito666/gollery/backend/internal/symlink"
+)
+
+// Finding kinds.
+const (
+	KindOrphanedSidecar = "orphaned_sidecar"
+	KindCorruptState    = "corrupt_state"
+	KindInvalidConfig   = "invalid_config"
+	KindUnreadable      = "unreadable"
+)
+
+// Options selects the repairs [Check] performs.
+type Options struct {
+	// Links is the scanner's policy for symbolic links, so the albums it
+	// reaches through links are checked too. nil follows none.
+	Links *symlink.Policy
+
+	// RemoveOrphans deletes sidecars whose file no longer exists.
+	RemoveOrphans bool
+
+	// Quarantine moves unparseable state files to .gallery/quarantine/.
+	Quarantine bool
+}
+
+// Finding is one problem found by [Check].
+type Finding struct {
+	Kind string
+
+	// Path is the affected file, relative to the content root.
+	Path string
+
+	// Detail describes the problem.
+	Detail string
+
+	// Action describes the repair made, or is empty if none was.
+	Action string
+}
+
+// Report is the result of [Check].
+type Report struct {
+	DirsChecked     int
+	SidecarsChecked int
+	Findings        []Finding
+}
+
+// Unresolved returns how many findings were not repaired.
+func (r *Report) Unresolved() int {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Action == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Check walks the content tree and reports, and optionally repairs, the
+// problems described in the package documentation. Findings are in walk
+// order. An error is returned only if the content root cannot be read.
+func Check(contentRoot string, opts Options) (*Report, error) {
+	return check(contentRoot, nil, opts)
+}
+
+// CheckLibraries runs [Check] on every library and merges the reports.
+// Relative paths in findings are prefixed with the library name, and
+// album.json files are validated as merged over the library's defaults.
+func CheckLibraries(libs config.Libraries, opts Options) (*Report, error) {
+	report := &Report{}
+	for _, lib := range libs {
+		r, err := check(lib.Root, lib.AlbumDefaults(), opts)
+		if err != nil {
+			if lib.Name != "" {
+				err = fmt.Errorf("library %s: %w", lib.Name, err)
+			}
+			return nil, err
+		}
+		report.DirsChecked += r.DirsChecked
+		report.SidecarsChecked += r.SidecarsChecked
+		for _, f := range r.Findings {
+			if !filepath.IsAbs(f.Path) {
+				f.Path = lib.AlbumPath(f.Path)
+			}
+			report.Findings = append(report.Findings, f)
+		}
+	}
+	return report, nil
+}
+
+// check is Check with the config the content root's album.json is merged
+// over, like the scanner's Root config.
+func check(contentRoot string, rootCfg *config.AlbumConfig, opts Options) (*Report, error) {
+	if _, err := os.ReadDir(contentRoot); err != nil {
+		return nil, fmt.Errorf("reading content root: %w", err)
+	}
+
+	c := &checker{
+		root:    contentRoot,
+		rootCfg: rootCfg,
+		opts:    opts,
+		configs: make(map[string]*config.AlbumConfig),
+		report:  &Report{},
+	}
+	var follow ignore.FollowFunc
+	if opts.Links != nil {
+		follow = func(relPath string) (fs.FileInfo, error) {
+			return opts.Links.Follow(contentRoot, relPath)
+		}
+	}
+	err := ignore.WalkDirFollow(contentRoot, contentRoot, follow, func(absPath string, d fs.DirEntry, err error) error {
+		relPath := c.rel(absPath)
+		if err != nil {
+			c.add(KindUnreadable, relPath, err.Error(), "")
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if relPath != "" && strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+		c.checkDir(absPath, relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.report, nil
+}
+
+type checker struct {
+	root    string
+	rootCfg *config.AlbumConfig
+	opts    Options
+	configs map[string]*config.AlbumConfig // resolved, by directory
+	report  *Report
+}
+
+// rel returns absPath relative to the content root, or unchanged when it
+// lies outside it, as sidecars under a state root do.
+func (c *checker) rel(absPath string) string {
+	rel, err := filepath.Rel(c.root, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return absPath
+	}
+	if rel == "." {
+		return ""
+	}
+	return rel
+}
+
+func (c *checker) add(kind, path, detail, action string) {
+	c.report.Findings = append(c.report.Findings, Finding{Kind: kind, Path: path, Detail: detail, Action: action})
+}
+
+func (c *checker) checkDir(absPath, relPath string) {
+	c.report.DirsChecked++
+	c.checkConfig(absPath, relPath)
+
+	if _, err := state.LoadAlbumState(absPath); errors.Is(err, state.ErrCorrupt) {
+		c.corrupt(c.rel(state.Location(absPath, "")), err, func() (string, error) {
+			return state.QuarantineAlbumState(absPath)
+		})
+	} else if err != nil {
+		c.add(KindUnreadable, c.rel(state.Location(absPath, "")), err.Error(), "")
+	}
+
+	names, err := state.ListAssetStates(absPath)
+	if err != nil {
+		c.add(KindUnreadable, c.rel(state.GalleryDir(absPath)), err.Error(), "")
+		return
+	}
+	for _, name := range names {
+		c.report.SidecarsChecked++
+		sidecar := c.rel(state.Location(absPath, name))
+		st, err := state.LoadAssetState(absPath, name)
+		if errors.Is(err, state.ErrCorrupt) {
+			c.corrupt(sidecar, err, func() (string, error) {
+				return state.QuarantineAssetState(absPath, name)
+			})
+			continue
+		}
+		if err != nil {
+			c.add(KindUnreadable, sidecar, err.Error(), "")
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(absPath, name)); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		detail := fmt.Sprintf("%s no longer exists", name)
+		if st != nil && st.ObjectID != "" {
+			detail = fmt.Sprintf("%s (asset %s, %d discussions) no longer exists", name, st.ObjectID, len(st.Discussions))
+		}
+		action := ""
+		if c.opts.RemoveOrphans {
+			if err := state.DeleteAssetState(absPath, name); err != nil {
+				detail += "; removing failed: " + err.Error()
+			} else {
+				action = "removed"
+			}
+		}
+		c.add(KindOrphanedSidecar, sidecar, detail, action)
+	}
+}
+
+// corrupt records a corrupt state file, quarantining it if requested.
+func (c *checker) corrupt(path string, err error, quarantine func() (string, error)) {
+	detail, action := err.Error(), ""
+	if c.opts.Quarantine {
+		dest, qerr := quarantine()
+		if qerr != nil {
+			detail += "; quarantine failed: " + qerr.Error()
+		} else {
+			action = "quarantined to " + c.rel(dest)
+		}
+	}
+	c.add(KindCorruptState, path, detail, action)
+}
+
+// checkConfig validates the directory's album.json merged with its
+// parent's resolved config, and records the resolved config for its
+// children the way the scanner resolves it.
+func (c *checker) checkConfig(absPath, relPath string) {
+	parent := c.rootCfg
+	if relPath != "" {
+		parentRel := filepath.Dir(relPath)
+		if parentRel == "." {
+			parentRel = ""
+		}
+		parent = c.configs[parentRel]
+	}
+	c.configs[relPath] = parent
+
+	cfgPath := filepath.Join(absPath, "album.json")
+	local, err := config.LoadAlbumConfig(cfgPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		c.add(KindInvalidConfig, c.rel(cfgPath), err.Error(), "")
+		return
+	}
+	resolved := local
+	if parent != nil {
+		resolved = config.MergeAlbumConfigs(parent, local)
+	}
+	if err := resolved.Validate(); err != nil {
+		c.add(KindInvalidConfig, c.rel(cfgPath), err.Error(), "")
+		return
+	}
+	c.configs[relPath] = resolved
+}
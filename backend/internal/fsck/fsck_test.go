@@ -0,0 +1,194 @@
+package fsck
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/state"
+	"github.com/perrito666/gollery/backend/internal/symlink"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setupTree creates one problem of each kind next to healthy files.
+func setupTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "album.json"), `{"title": "Root", "access": {"view": "public"}}`)
+	writeFile(t, filepath.Join(root, "trip", "a.jpg"), "a")
+	if err := state.SaveAssetState(filepath.Join(root, "trip"), "a.jpg", &state.AssetState{ObjectID: "ast_a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SaveAssetState(filepath.Join(root, "trip"), "gone.jpg", &state.AssetState{ObjectID: "ast_gone"}); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, state.AssetStatePath(filepath.Join(root, "trip"), "b.jpg"), "{not json")
+	writeFile(t, filepath.Join(root, "trip", "b.jpg"), "b")
+	writeFile(t, state.AlbumStatePath(filepath.Join(root, "broken")), "")
+	writeFile(t, filepath.Join(root, "private", "album.json"), `{"sort_order": "random"}`)
+	writeFile(t, filepath.Join(root, "bad", "album.json"), `{`)
+	return root
+}
+
+func findingsByKind(r *Report) map[string][]Finding {
+	m := make(map[string][]Finding)
+	for _, f := range r.Findings {
+		m[f.Kind] = append(m[f.Kind], f)
+	}
+	return m
+}
+
+func TestCheck_ReportsWithoutChanging(t *testing.T) {
+	root := setupTree(t)
+	report, err := Check(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKind := findingsByKind(report)
+
+	orphans := byKind[KindOrphanedSidecar]
+	if len(orphans) != 1 || orphans[0].Path != filepath.Join("trip", ".gallery", "assets", "gone.jpg.json") ||
+		!strings.Contains(orphans[0].Detail, "ast_gone") {
+		t.Errorf("orphans = %+v", orphans)
+	}
+	if n := len(byKind[KindCorruptState]); n != 2 {
+		t.Errorf("corrupt = %+v, want 2", byKind[KindCorruptState])
+	}
+	configs := byKind[KindInvalidConfig]
+	if len(configs) != 2 {
+		t.Errorf("invalid configs = %+v, want 2", configs)
+	}
+	if report.Unresolved() != len(report.Findings) {
+		t.Errorf("nothing should have been repaired: %+v", report.Findings)
+	}
+	if report.SidecarsChecked != 3 {
+		t.Errorf("sidecars checked = %d, want 3", report.SidecarsChecked)
+	}
+
+	if _, err := os.Stat(state.AssetStatePath(filepath.Join(root, "trip"), "gone.jpg")); err != nil {
+		t.Error("orphan should not be removed without RemoveOrphans")
+	}
+}
+
+func TestCheck_Repairs(t *testing.T) {
+	root := setupTree(t)
+	report, err := Check(root, Options{RemoveOrphans: true, Quarantine: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the album.json problems are left for the user.
+	if n := report.Unresolved(); n != 2 {
+		t.Errorf("unresolved = %d, want 2: %+v", n, report.Findings)
+	}
+	for _, f := range report.Findings {
+		if f.Kind == KindCorruptState && !strings.HasPrefix(f.Action, "quarantined to ") {
+			t.Errorf("corrupt finding action = %q", f.Action)
+		}
+	}
+
+	again, err := Check(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKind := findingsByKind(again)
+	if len(byKind[KindOrphanedSidecar]) != 0 || len(byKind[KindCorruptState]) != 0 {
+		t.Errorf("after repair: %+v", again.Findings)
+	}
+	quarantined, _ := os.ReadDir(filepath.Join(root, "trip", ".gallery", "quarantine"))
+	if len(quarantined) != 1 {
+		t.Errorf("quarantine holds %d files, want 1", len(quarantined))
+	}
+}
+
+func TestCheck_MissingRoot(t *testing.T) {
+	if _, err := Check(filepath.Join(t.TempDir(), "nope"), Options{}); err == nil {
+		t.Error("expected error for missing content root")
+	}
+}
+
+func TestCheck_SkipsIgnored(t *testing.T) {
+	root := setupTree(t)
+	writeFile(t, filepath.Join(root, ".galleryignore"), "trip\nbad/\n")
+
+	report, err := Check(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range report.Findings {
+		if strings.HasPrefix(f.Path, "trip") || strings.HasPrefix(f.Path, "bad") {
+			t.Errorf("finding in an ignored directory: %+v", f)
+		}
+	}
+	if len(report.Findings) != 2 {
+		t.Errorf("findings = %+v, want the 2 outside ignored directories", report.Findings)
+	}
+}
+
+func TestCheck_FollowsAllowedLinks(t *testing.T) {
+	root := t.TempDir()
+	nas := t.TempDir()
+	if err := state.SaveAssetState(filepath.Join(nas, "trip"), "gone.jpg", &state.AssetState{ObjectID: "ast_gone"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(nas, "trip"), filepath.Join(root, "trip")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	report, err := Check(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Findings) != 0 {
+		t.Errorf("findings without a link policy = %+v, want none", report.Findings)
+	}
+
+	report, err = Check(root, Options{Links: symlink.New([]string{nas})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphans := findingsByKind(report)[KindOrphanedSidecar]
+	if len(orphans) != 1 || orphans[0].Path != filepath.Join("trip", ".gallery", "assets", "gone.jpg.json") {
+		t.Errorf("orphans = %+v, want the one below the link", orphans)
+	}
+}
+
+func TestCheckLibraries(t *testing.T) {
+	photos := setupTree(t)
+	scans := t.TempDir()
+	writeFile(t, filepath.Join(scans, "1990", "album.json"), `{"access": {"view": "secret"}}`)
+	libs := config.Libraries{
+		{Name: "photos", Root: photos},
+		{Name: "scans", Root: scans, Access: &config.AccessConfig{View: "public"}},
+	}
+
+	report, err := CheckLibraries(libs, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, err := Check(photos, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKind := findingsByKind(report)
+	if orphans := byKind[KindOrphanedSidecar]; len(orphans) != 1 || orphans[0].Path != filepath.Join("photos", "trip", ".gallery", "assets", "gone.jpg.json") {
+		t.Errorf("orphans = %+v", orphans)
+	}
+	invalid := byKind[KindInvalidConfig]
+	if len(invalid) != len(findingsByKind(single)[KindInvalidConfig])+1 || invalid[len(invalid)-1].Path != filepath.Join("scans", "1990", "album.json") {
+		t.Errorf("invalid configs = %+v", invalid)
+	}
+	if report.DirsChecked != single.DirsChecked+2 {
+		t.Errorf("dirs checked = %d, want %d", report.DirsChecked, single.DirsChecked+2)
+	}
+}
@@ -3,7 +3,14 @@ package fswalk
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"sync/atomic"
 	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/ignore"
+	"github.com/perrito666/gollery/backend/internal/symlink"
 )
 
 // writeAlbumJSON writes an album.json file in the given directory.
@@ -144,6 +151,82 @@ func TestScan_UnpublishedSubtreeIgnored(t *testing.T) {
 	}
 }
 
+func TestScan_Root(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.jpg"))
+	writeAlbumJSON(t, filepath.Join(root, "private"), `{"title": "Private", "access": {"view": "restricted"}}`)
+	writeFile(t, filepath.Join(root, "misc", "b.jpg"))
+
+	sc := &Scanner{Root: &config.AlbumConfig{Title: "Disk", Access: &config.AccessConfig{View: "public"}}}
+	result, err := sc.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Albums) != 3 {
+		t.Fatalf("albums = %d, want root, misc and private", len(result.Albums))
+	}
+	if top := result.Albums[""]; top.Config.Title != "Disk" || top.Config.Access.View != "public" {
+		t.Errorf("root config = %+v", top.Config)
+	}
+	if misc := result.Albums["misc"]; misc.Config.Access.View != "public" {
+		t.Errorf("misc should inherit the root config, got %+v", misc.Config)
+	}
+	if private := result.Albums["private"]; private.Config.Title != "Private" || private.Config.Access.View != "restricted" {
+		t.Errorf("private config = %+v", private.Config)
+	}
+}
+
+func TestScan_Discovery(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "2024", "summer", "beach.jpg"))
+	writeFile(t, filepath.Join(root, "2024", "notes.txt"))
+	writeFile(t, filepath.Join(root, "docs", "readme.txt"))
+	writeAlbumJSON(t, filepath.Join(root, "2024", "winter"), `{"description": "Snow"}`)
+	writeFile(t, filepath.Join(root, "2024", "winter", "ski.jpg"))
+	writeFile(t, filepath.Join(root, "2024", "winter", "day1", "lift.jpg"))
+
+	sc := &Scanner{Discovery: &config.AlbumConfig{Access: &config.AccessConfig{View: "authenticated"}}}
+	result, err := sc.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"", "2024", "2024/summer", "2024/winter", "2024/winter/day1"}
+	var got []string
+	for path := range result.Albums {
+		got = append(got, path)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("albums = %v, want %v", got, want)
+	}
+
+	summer := result.Albums["2024/summer"]
+	if !summer.Discovered || summer.Config.Title != "summer" || summer.Config.Access.View != "authenticated" {
+		t.Errorf("summer = discovered %v, config %+v", summer.Discovered, summer.Config)
+	}
+	if top := result.Albums[""]; !top.Discovered || top.Config.Title != filepath.Base(root) {
+		t.Errorf("root = discovered %v, title %q", top.Discovered, top.Config.Title)
+	}
+
+	// album.json is merged over the discovery defaults, and its subtree
+	// inherits as usual.
+	winter := result.Albums["2024/winter"]
+	if winter.Discovered || winter.Config.Title != "winter" || winter.Config.Description != "Snow" || winter.Config.Access.View != "authenticated" {
+		t.Errorf("winter = discovered %v, config %+v", winter.Discovered, winter.Config)
+	}
+	if day1 := result.Albums["2024/winter/day1"]; day1.Discovered || day1.Config.Description != "Snow" {
+		t.Errorf("day1 should inherit winter's config, got %+v", day1.Config)
+	}
+
+	if !reflect.DeepEqual(result.Albums["2024"].ChildPaths, []string{"2024/summer", "2024/winter"}) {
+		t.Errorf("2024 children = %v", result.Albums["2024"].ChildPaths)
+	}
+	if !reflect.DeepEqual(result.Albums[""].ChildPaths, []string{"2024"}) {
+		t.Errorf("root children = %v, docs should not be an album", result.Albums[""].ChildPaths)
+	}
+}
+
 func TestScan_HiddenDirsSkipped(t *testing.T) {
 	root := t.TempDir()
 	writeAlbumJSON(t, root, `{"title": "Root"}`)
@@ -164,6 +247,122 @@ func TestScan_HiddenDirsSkipped(t *testing.T) {
 	}
 }
 
+// writeIgnore writes a .galleryignore file in the given directory.
+func writeIgnore(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ignore.FileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScan_GalleryIgnore(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeIgnore(t, root, "_rejects\n*.tmp.jpg\n")
+	writeIgnore(t, filepath.Join(root, "trip"), "exports/\n")
+	writeFile(t, filepath.Join(root, "keep.jpg"))
+	writeFile(t, filepath.Join(root, "edit.tmp.jpg"))
+	writeFile(t, filepath.Join(root, "_rejects", "bad.jpg"))
+	writeFile(t, filepath.Join(root, "trip", "a.jpg"))
+	writeFile(t, filepath.Join(root, "trip", "b.tmp.jpg"))
+	writeFile(t, filepath.Join(root, "trip", "exports", "a.jpg"))
+	writeFile(t, filepath.Join(root, "exports", "c.jpg"))
+
+	result, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for p := range result.Albums {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	want := []string{"", "exports", "trip"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("albums = %v, want %v", paths, want)
+	}
+	for path, files := range map[string][]string{"": {"keep.jpg"}, "trip": {"a.jpg"}} {
+		var got []string
+		for _, a := range result.Albums[path].Assets {
+			got = append(got, a.Filename)
+		}
+		if !reflect.DeepEqual(got, files) {
+			t.Errorf("album %q assets = %v, want %v", path, got, files)
+		}
+	}
+	if len(result.Ignores) != 2 {
+		t.Errorf("recorded ignore rules for %d directories, want 2", len(result.Ignores))
+	}
+}
+
+func TestScan_Symlinks(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "content")
+	nas := filepath.Join(base, "nas")
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeFile(t, filepath.Join(nas, "trip", "a.jpg"))
+	writeFile(t, filepath.Join(nas, "trip", "day2", "b.jpg"))
+	writeFile(t, filepath.Join(nas, "single.jpg"))
+	writeFile(t, filepath.Join(base, "private", "c.jpg"))
+	for target, name := range map[string]string{
+		filepath.Join(nas, "trip"):       "trip",
+		filepath.Join(nas, "single.jpg"): "single.jpg",
+		filepath.Join(base, "private"):   "private",
+		root:                             "loop",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(nas, "trip"), filepath.Join(nas, "trip", "day2", "again")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a policy, linked directories are skipped.
+	result, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Albums) != 1 {
+		t.Errorf("without following: %d albums, want 1", len(result.Albums))
+	}
+
+	sc := &Scanner{Links: symlink.New([]string{nas})}
+	result, err = sc.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for p := range result.Albums {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	want := []string{"", "trip", filepath.Join("trip", "day2")}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("albums = %v, want %v", paths, want)
+	}
+	rootAlbum := result.Albums[""]
+	if len(rootAlbum.Assets) != 1 || rootAlbum.Assets[0].Filename != "single.jpg" || rootAlbum.Assets[0].SizeBytes != int64(len("fake")) {
+		t.Errorf("root assets = %+v, want the linked file's", rootAlbum.Assets)
+	}
+	if got := result.Albums["trip"].Config.Title; got != "Root" {
+		t.Errorf("linked album title = %q, want it inherited", got)
+	}
+
+	// The link out of the allowed roots, the one back into the content
+	// root and the one to its own ancestor are reported where they are.
+	errPaths := make(map[string]int)
+	for _, e := range result.Errors {
+		errPaths[e.Path]++
+	}
+	if errPaths[""] != 2 || errPaths[filepath.Join("trip", "day2")] != 1 || len(result.Errors) != 3 {
+		t.Errorf("errors = %v", result.Errors)
+	}
+}
+
 func TestScan_InvalidAlbumJSON(t *testing.T) {
 	root := t.TempDir()
 	writeAlbumJSON(t, root, `{"title": "Root"}`)
@@ -216,6 +415,27 @@ func TestScan_ChildPaths(t *testing.T) {
 	}
 }
 
+func TestScan_TrackFormatsDiscovered(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	for _, name := range []string{"ride.FIT", "run.tcx", "trip.kml", "walk.geojson", "notes.txt"} {
+		writeFile(t, filepath.Join(root, name))
+	}
+
+	result, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	album := result.Albums[""]
+	if len(album.TrackFiles) != 4 {
+		t.Errorf("expected 4 track files, got %d: %v", len(album.TrackFiles), album.TrackFiles)
+	}
+	if len(album.Assets) != 0 {
+		t.Errorf("track files must not be assets: %v", album.Assets)
+	}
+}
+
 func TestScan_GPXFilesDiscovered(t *testing.T) {
 	root := t.TempDir()
 	writeAlbumJSON(t, root, `{"title": "Root"}`)
@@ -232,11 +452,11 @@ func TestScan_GPXFilesDiscovered(t *testing.T) {
 	if len(album.Assets) != 1 {
 		t.Errorf("expected 1 asset, got %d", len(album.Assets))
 	}
-	if len(album.GPXFiles) != 2 {
-		t.Errorf("expected 2 GPX files, got %d: %v", len(album.GPXFiles), album.GPXFiles)
+	if len(album.TrackFiles) != 2 {
+		t.Errorf("expected 2 GPX files, got %d: %v", len(album.TrackFiles), album.TrackFiles)
 	}
 	// GPX files should be absolute paths.
-	for _, f := range album.GPXFiles {
+	for _, f := range album.TrackFiles {
 		if !filepath.IsAbs(f) {
 			t.Errorf("GPX path should be absolute: %s", f)
 		}
@@ -264,3 +484,46 @@ func TestScan_ImageExtensions(t *testing.T) {
 		t.Errorf("expected %d assets, got %d", len(exts), len(album.Assets))
 	}
 }
+
+func TestScanner_DeterministicAcrossWorkers(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	for _, year := range []string{"2019", "2020", "2021"} {
+		for _, trip := range []string{"alps", "coast", "city", "lakes"} {
+			dir := filepath.Join(root, year, trip)
+			writeFile(t, filepath.Join(dir, "a.jpg"))
+			writeFile(t, filepath.Join(dir, "b.png"))
+			writeFile(t, filepath.Join(dir, "route.gpx"))
+		}
+	}
+	writeAlbumJSON(t, filepath.Join(root, "2020", "coast"), `{broken`)
+	writeAlbumJSON(t, filepath.Join(root, "2021"), `{"sort_order": "bogus"}`)
+
+	var dirs atomic.Int64
+	want, err := (&Scanner{Workers: 1}).Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{2, 8, 32} {
+		dirs.Store(0)
+		got, err := (&Scanner{Workers: workers, OnDir: func() { dirs.Add(1) }}).Scan(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("workers=%d: result differs from sequential scan", workers)
+		}
+		if n := dirs.Load(); n != 16 {
+			t.Errorf("workers=%d: OnDir called %d times, want 16", workers, n)
+		}
+	}
+	if len(want.Errors) != 2 || want.Errors[0].Path != filepath.Join("2020", "coast") {
+		t.Errorf("errors = %v, want 2020/coast then 2021", want.Errors)
+	}
+}
+
+func TestScan_UnreadableRootFails(t *testing.T) {
+	if _, err := Scan(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("scanning a missing root should fail")
+	}
+}
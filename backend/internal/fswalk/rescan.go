@@ -0,0 +1,388 @@
+package fswalk
+
+import (
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/ignore"
+)
+
+// Rescan updates a previous scan for a set of changed directories (relative
+// paths, as reported by the watcher) and returns the new result together
+// with the sorted paths of every album that was rescanned, added or
+// removed. prev is not modified; unchanged albums are shared with it.
+//
+// A dirty directory whose resolved config is unchanged is rescanned on its
+// own: its files are re-read and only child directories that appeared are
+// walked. When the config changed (its album.json, or an ancestor's), or the
+// directory is new, the whole subtree is walked again so that config
+// inheritance is re-resolved for every descendant; the same goes for a
+// directory whose .galleryignore changed. Directories that vanished, left
+// the published tree, became ignored or are reached through a link no
+// longer followed are dropped with their subtree. In discovery
+// mode the ancestors of every dirty directory are then settled, since a
+// discovered album appears or goes away with the images below it.
+func Rescan(contentRoot string, prev *ScanResult, dirtyPaths []string) (*ScanResult, []string, error) {
+	return new(Scanner).Rescan(contentRoot, prev, dirtyPaths)
+}
+
+// Rescan is like the package-level [Rescan], using the scanner's workers.
+func (sc *Scanner) Rescan(contentRoot string, prev *ScanResult, dirtyPaths []string) (*ScanResult, []string, error) {
+	result := &ScanResult{
+		Albums:  make(map[string]*ScannedAlbum, len(prev.Albums)),
+		Ignores: maps.Clone(prev.Ignores),
+	}
+	for p, a := range prev.Albums {
+		result.Albums[p] = a
+	}
+
+	// Parents before children, so a child is skipped once its parent's
+	// subtree has been walked and sees its parent's fresh config otherwise.
+	dirty := slices.Clone(dirtyPaths)
+	sort.Slice(dirty, func(i, j int) bool {
+		di, dj := depth(dirty[i]), depth(dirty[j])
+		if di != dj {
+			return di < dj
+		}
+		return dirty[i] < dirty[j]
+	})
+
+	touched := make(map[string]bool)
+	var walked, rescanned []string
+	for _, relPath := range dirty {
+		if slices.ContainsFunc(walked, func(root string) bool { return within(relPath, root) }) {
+			continue
+		}
+
+		parentCfg := sc.parentConfig(result, relPath)
+		var parentRules *ignore.Rules
+		if relPath != "" {
+			parentRules = rulesFor(result, parentDir(relPath))
+		}
+		absPath := filepath.Join(contentRoot, relPath)
+		if info, err := os.Stat(absPath); err != nil || !info.IsDir() || ignored(result, relPath) || !sc.reachable(contentRoot, relPath) {
+			removeTree(result, relPath, touched)
+			walked = append(walked, relPath)
+			continue
+		}
+
+		rules, err := ignore.Load(absPath, relPath, parentRules)
+		var own *ignore.Rules
+		if rules != parentRules {
+			own = rules
+		}
+		ignoreChanged := !own.Equal(result.Ignores[relPath])
+
+		cfg, discovered, errs := sc.resolveConfig(absPath, parentCfg)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		old, wasAlbum := result.Albums[relPath]
+		switch {
+		case !wasAlbum && cfg == nil && !ignoreChanged:
+			// Still outside the published tree, but published subtrees
+			// may have appeared or vanished below it.
+			for _, e := range errs {
+				result.Errors = append(result.Errors, ScanError{Path: relPath, Err: e})
+			}
+			if _, err := sc.rescanChildren(contentRoot, relPath, nil, rules, result, touched); err != nil {
+				return nil, nil, err
+			}
+			rescanned = append(rescanned, relPath)
+		case !wasAlbum || cfg == nil || ignoreChanged || old.Discovered != discovered || !reflect.DeepEqual(old.Config, cfg):
+			removeTree(result, relPath, touched)
+			if err := sc.walkTree(contentRoot, relPath, parentCfg, parentRules, result, touched); err != nil {
+				return nil, nil, err
+			}
+			link(result, relPath)
+			walked = append(walked, relPath)
+		default:
+			for _, e := range errs {
+				result.Errors = append(result.Errors, ScanError{Path: relPath, Err: e})
+			}
+			if err := sc.rescanDir(contentRoot, old, rules, result, touched); err != nil {
+				return nil, nil, err
+			}
+			rescanned = append(rescanned, relPath)
+		}
+	}
+	if sc.Discovery != nil {
+		for _, relPath := range dirty {
+			sc.settle(contentRoot, relPath, result, touched)
+		}
+	}
+
+	// Keep the previous errors of everything that was not looked at again.
+	// A child walked while reconciling a directory may report an error it
+	// already had, so duplicates are dropped.
+	errs := append(slices.Clone(prev.Errors), result.Errors...)
+	result.Errors = nil
+	seen := make(map[string]bool, len(errs))
+	for i, e := range errs {
+		if i < len(prev.Errors) && (slices.Contains(rescanned, e.Path) ||
+			slices.ContainsFunc(walked, func(root string) bool { return within(e.Path, root) })) {
+			continue
+		}
+		key := e.Path + "\x00" + e.Err.Error()
+		if !seen[key] {
+			seen[key] = true
+			result.Errors = append(result.Errors, e)
+		}
+	}
+
+	changed := make([]string, 0, len(touched))
+	for p := range touched {
+		changed = append(changed, p)
+	}
+	sort.Strings(changed)
+	return result, changed, nil
+}
+
+// rescanDir re-reads the files of an album whose config and ignore rules
+// are unchanged and reconciles its child directories.
+func (sc *Scanner) rescanDir(contentRoot string, old *ScannedAlbum, rules *ignore.Rules, result *ScanResult, touched map[string]bool) error {
+	album := &ScannedAlbum{Path: old.Path, Config: old.Config, Discovered: old.Discovered}
+	var scanErr error
+	album.Assets, album.TrackFiles, scanErr = sc.scanDir(contentRoot, old.Path, rules)
+	if scanErr != nil {
+		result.Errors = append(result.Errors, ScanError{Path: old.Path, Err: scanErr})
+	}
+	cfg := album.Config
+	if album.Discovered {
+		cfg = nil
+	}
+	children, err := sc.rescanChildren(contentRoot, old.Path, cfg, rules, result, touched)
+	if err != nil {
+		return err
+	}
+	album.ChildPaths = children
+	result.Albums[old.Path] = album
+	touched[old.Path] = true
+	return nil
+}
+
+// rescanChildren walks child directories of dirPath that have no albums
+// in result yet, drops the subtrees of children that vanished and keeps
+// the rest as they were. rules are the ignore rules in effect in dirPath.
+// It returns the child albums in walk order.
+func (sc *Scanner) rescanChildren(contentRoot, dirPath string, cfg *config.AlbumConfig, rules *ignore.Rules, result *ScanResult, touched map[string]bool) ([]string, error) {
+	// Children that currently hold albums, at any depth below them.
+	known := make(map[string]bool)
+	for p := range result.Albums {
+		if p != dirPath && within(p, dirPath) {
+			known[childOf(dirPath, p)] = true
+		}
+	}
+
+	entries, errs, err := sc.readDir(contentRoot, dirPath, rules)
+	if err != nil {
+		// Reported by scanDir for albums; otherwise keep what we had.
+		return nil, nil
+	}
+	result.Errors = append(result.Errors, errs...)
+	var children []string
+	present := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		childPath := filepath.Join(dirPath, e.Name())
+		present[childPath] = true
+		if !known[childPath] {
+			if err := sc.walkTree(contentRoot, childPath, cfg, rules, result, touched); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := result.Albums[childPath]; ok {
+			children = append(children, childPath)
+		}
+	}
+	for childPath := range known {
+		if !present[childPath] {
+			removeTree(result, childPath, touched)
+		}
+	}
+	return children, nil
+}
+
+// settle applies the discovery rule to relPath and each of its ancestors,
+// deepest first: a discovered album left with no images and no child
+// albums is dropped, and a directory that is not an album but has child
+// albums becomes one.
+func (sc *Scanner) settle(contentRoot, relPath string, result *ScanResult, touched map[string]bool) {
+	for p := relPath; ; p = parentDir(p) {
+		album, ok := result.Albums[p]
+		switch {
+		case ok && album.Discovered && p != "" && len(album.Assets) == 0 && len(album.ChildPaths) == 0:
+			delete(result.Albums, p)
+			touched[p] = true
+			link(result, p)
+		case !ok:
+			var children []string
+			for c := range result.Albums {
+				if c != "" && c != p && parentDir(c) == p {
+					children = append(children, c)
+				}
+			}
+			if len(children) == 0 {
+				break
+			}
+			absPath := filepath.Join(contentRoot, p)
+			cfg, discovered, errs := sc.resolveConfig(absPath, sc.parentConfig(result, p))
+			for _, e := range errs {
+				result.Errors = append(result.Errors, ScanError{Path: p, Err: e})
+			}
+			assets, trackFiles, err := sc.scanDir(contentRoot, p, rulesFor(result, p))
+			if err != nil {
+				result.Errors = append(result.Errors, ScanError{Path: p, Err: err})
+			}
+			if cfg == nil || err != nil {
+				break
+			}
+			sort.Strings(children)
+			result.Albums[p] = &ScannedAlbum{
+				Path:       p,
+				Config:     cfg,
+				Assets:     assets,
+				ChildPaths: children,
+				TrackFiles: trackFiles,
+				Discovered: discovered,
+			}
+			touched[p] = true
+			link(result, p)
+		}
+		if p == "" {
+			return
+		}
+	}
+}
+
+// removeTree drops the album at relPath and all its descendants, with the
+// ignore rules found there, and unlinks it from its parent.
+func removeTree(result *ScanResult, relPath string, touched map[string]bool) {
+	for p := range result.Albums {
+		if within(p, relPath) {
+			delete(result.Albums, p)
+			touched[p] = true
+		}
+	}
+	maps.DeleteFunc(result.Ignores, func(p string, _ *ignore.Rules) bool { return within(p, relPath) })
+	link(result, relPath)
+}
+
+// reachable reports whether a walk would reach the directory at relPath,
+// that is whether the scanner follows every link on the way to it.
+func (sc *Scanner) reachable(contentRoot, relPath string) bool {
+	for p := relPath; p != ""; p = parentDir(p) {
+		info, err := os.Lstat(filepath.Join(contentRoot, p))
+		if err != nil {
+			return false
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		if sc.Links == nil {
+			return false
+		}
+		if _, err := sc.Links.Follow(contentRoot, p); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// rulesFor returns the ignore rules in effect in the directory at
+// relPath: those of the closest directory at or above it that has a
+// .galleryignore.
+func rulesFor(result *ScanResult, relPath string) *ignore.Rules {
+	for p := relPath; ; p = parentDir(p) {
+		if r, ok := result.Ignores[p]; ok {
+			return r
+		}
+		if p == "" {
+			return nil
+		}
+	}
+}
+
+// ignored reports whether the directory at relPath, or one of its
+// ancestors, is ignored.
+func ignored(result *ScanResult, relPath string) bool {
+	for p := relPath; p != ""; p = parentDir(p) {
+		if rulesFor(result, parentDir(p)).Match(p, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// link makes the parent's ChildPaths agree with whether relPath is
+// currently an album. The parent is copied rather than modified, since it
+// may be shared with the previous scan.
+func link(result *ScanResult, relPath string) {
+	if relPath == "" {
+		return
+	}
+	parentPath := parentDir(relPath)
+	parent, ok := result.Albums[parentPath]
+	if !ok {
+		return
+	}
+	_, isAlbum := result.Albums[relPath]
+	if slices.Contains(parent.ChildPaths, relPath) == isAlbum {
+		return
+	}
+
+	cp := *parent
+	cp.ChildPaths = slices.DeleteFunc(slices.Clone(parent.ChildPaths), func(p string) bool { return p == relPath })
+	if isAlbum {
+		// Same order as the walk: directory entries sorted by name.
+		cp.ChildPaths = append(cp.ChildPaths, relPath)
+		sort.Strings(cp.ChildPaths)
+	}
+	result.Albums[parentPath] = &cp
+}
+
+// parentConfig returns the resolved config of relPath's parent, or nil
+// when the parent is not published or was discovered. The content root's
+// parent config is [Scanner.Root].
+func (sc *Scanner) parentConfig(result *ScanResult, relPath string) *config.AlbumConfig {
+	if relPath == "" {
+		return sc.Root
+	}
+	if parent, ok := result.Albums[parentDir(relPath)]; ok && !parent.Discovered {
+		return parent.Config
+	}
+	return nil
+}
+
+// childOf returns the direct child of dirPath on the way to relPath,
+// which must lie below dirPath.
+func childOf(dirPath, relPath string) string {
+	rest := relPath
+	if dirPath != "" {
+		rest = strings.TrimPrefix(relPath, dirPath+string(filepath.Separator))
+	}
+	name, _, _ := strings.Cut(rest, string(filepath.Separator))
+	return filepath.Join(dirPath, name)
+}
+
+// within reports whether relPath is root or lies below it.
+func within(relPath, root string) bool {
+	return root == "" || relPath == root || strings.HasPrefix(relPath, root+string(filepath.Separator))
+}
+
+// depth returns the number of path components of a relative path.
+func depth(relPath string) int {
+	if relPath == "" {
+		return 0
+	}
+	return strings.Count(relPath, string(filepath.Separator)) + 1
+}
@@ -0,0 +1,384 @@
+package fswalk
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/ignore"
+	"github.com/perrito666/gollery/backend/internal/symlink"
+)
+
+// assertMatchesScan checks that an incremental result equals a full scan
+// of the same tree.
+func assertMatchesScan(t *testing.T, root string, got *ScanResult) {
+	t.Helper()
+	assertMatchesScanner(t, new(Scanner), root, got)
+}
+
+// assertMatchesScanner is assertMatchesScan for a configured scanner.
+func assertMatchesScanner(t *testing.T, sc *Scanner, root string, got *ScanResult) {
+	t.Helper()
+	want, err := sc.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Albums) != len(want.Albums) {
+		t.Fatalf("got %d albums, want %d", len(got.Albums), len(want.Albums))
+	}
+	for path, w := range want.Albums {
+		g, ok := got.Albums[path]
+		if !ok {
+			t.Errorf("album %q missing", path)
+			continue
+		}
+		if !reflect.DeepEqual(g.Config, w.Config) {
+			t.Errorf("album %q config = %+v, want %+v", path, g.Config, w.Config)
+		}
+		if g.Discovered != w.Discovered {
+			t.Errorf("album %q discovered = %v, want %v", path, g.Discovered, w.Discovered)
+		}
+		if !slices.Equal(g.ChildPaths, w.ChildPaths) {
+			t.Errorf("album %q children = %v, want %v", path, g.ChildPaths, w.ChildPaths)
+		}
+		if !slices.Equal(g.TrackFiles, w.TrackFiles) {
+			t.Errorf("album %q tracks = %v, want %v", path, g.TrackFiles, w.TrackFiles)
+		}
+		var gotFiles, wantFiles []string
+		for _, a := range g.Assets {
+			gotFiles = append(gotFiles, a.Filename)
+		}
+		for _, a := range w.Assets {
+			wantFiles = append(wantFiles, a.Filename)
+		}
+		if !slices.Equal(gotFiles, wantFiles) {
+			t.Errorf("album %q assets = %v, want %v", path, gotFiles, wantFiles)
+		}
+	}
+	if len(got.Errors) != len(want.Errors) {
+		t.Errorf("got %d errors, want %d", len(got.Errors), len(want.Errors))
+	}
+}
+
+func TestRescan_NewFileTouchesOnlyItsAlbum(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeFile(t, filepath.Join(root, "a", "one.jpg"))
+	writeFile(t, filepath.Join(root, "b", "two.jpg"))
+
+	prev, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "a", "three.jpg"))
+
+	got, changed, err := Rescan(root, prev, []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changed, []string{"a"}) {
+		t.Errorf("changed = %v, want [a]", changed)
+	}
+	if got.Albums["b"] != prev.Albums["b"] || got.Albums[""] != prev.Albums[""] {
+		t.Error("untouched albums should be shared with the previous scan")
+	}
+	if len(prev.Albums["a"].Assets) != 1 {
+		t.Error("previous scan was modified")
+	}
+	assertMatchesScan(t, root, got)
+}
+
+func TestRescan_ConfigChangeReachesDescendants(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root", "access": {"view": "public"}}`)
+	writeFile(t, filepath.Join(root, "trips", "italy", "rome", "colosseum.jpg"))
+	writeFile(t, filepath.Join(root, "other", "x.jpg"))
+
+	prev, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAlbumJSON(t, filepath.Join(root, "trips"), `{"title": "Trips", "access": {"view": "authenticated"}}`)
+
+	got, changed, err := Rescan(root, prev, []string{"trips"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"trips", "trips/italy", "trips/italy/rome"}
+	if !slices.Equal(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	if v := got.Albums["trips/italy/rome"].Config.Access.View; v != "authenticated" {
+		t.Errorf("inherited view = %q, want authenticated", v)
+	}
+	assertMatchesScan(t, root, got)
+}
+
+func TestRescan_AddAndRemoveDirectories(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeFile(t, filepath.Join(root, "keep", "k.jpg"))
+	writeFile(t, filepath.Join(root, "gone", "deep", "g.jpg"))
+
+	prev, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(root, "gone")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "new", "n.jpg"))
+
+	got, changed, err := Rescan(root, prev, []string{"", "gone", "gone/deep", "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "gone", "gone/deep", "new"}
+	if !slices.Equal(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	if got.Albums["keep"] != prev.Albums["keep"] {
+		t.Error("untouched sibling should be shared with the previous scan")
+	}
+	assertMatchesScan(t, root, got)
+}
+
+func TestRescan_PublishedSubtreeUnderUnpublishedRoot(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, filepath.Join(root, "public"), `{"title": "Public"}`)
+	writeFile(t, filepath.Join(root, "public", "p.jpg"))
+	writeFile(t, filepath.Join(root, "drafts", "d.jpg"))
+
+	prev, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAlbumJSON(t, filepath.Join(root, "drafts"), `{"title": "Drafts"}`)
+	writeAlbumJSON(t, filepath.Join(root, "fresh"), `{"title": "Fresh"}`)
+
+	got, changed, err := Rescan(root, prev, []string{"", "drafts", "fresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changed, []string{"drafts", "fresh"}) {
+		t.Errorf("changed = %v, want [drafts fresh]", changed)
+	}
+	assertMatchesScan(t, root, got)
+
+	// Unpublishing drops the album again.
+	if err := os.Remove(filepath.Join(root, "drafts", "album.json")); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err = Rescan(root, got, []string{"drafts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Albums["drafts"]; ok {
+		t.Error("unpublished album should be removed")
+	}
+	assertMatchesScan(t, root, got)
+}
+
+func TestRescan_InvalidConfigErrorsReplaced(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeAlbumJSON(t, filepath.Join(root, "bad"), `{invalid`)
+
+	prev, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prev.Errors) != 1 {
+		t.Fatalf("expected 1 scan error, got %d", len(prev.Errors))
+	}
+
+	writeAlbumJSON(t, filepath.Join(root, "bad"), `{"title": "Fixed"}`)
+	got, _, err := Rescan(root, prev, []string{"bad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Errors) != 0 {
+		t.Errorf("errors = %v, want none", got.Errors)
+	}
+	assertMatchesScan(t, root, got)
+}
+
+func TestRescan_DiscoveredAlbumsFollowImages(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "trips", "rome", "r.jpg"))
+	if err := os.MkdirAll(filepath.Join(root, "trips", "paris"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sc := &Scanner{Discovery: &config.AlbumConfig{}}
+
+	prev, err := sc.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "trips", "paris", "p.jpg"))
+	writeFile(t, filepath.Join(root, "misc", "deep", "d.jpg"))
+
+	got, changed, err := sc.Rescan(root, prev, []string{"trips/paris", "misc/deep"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"misc", "misc/deep", "trips/paris"}; !slices.Equal(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	assertMatchesScanner(t, sc, root, got)
+
+	// Emptying a branch drops it up to the first album that keeps content.
+	if err := os.Remove(filepath.Join(root, "misc", "deep", "d.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err = sc.Rescan(root, got, []string{"misc/deep"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Albums["misc"]; ok {
+		t.Error("misc should be dropped once nothing below it has images")
+	}
+	assertMatchesScanner(t, sc, root, got)
+}
+
+func TestRescan_Root(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.jpg"))
+	sc := &Scanner{Root: &config.AlbumConfig{Title: "Disk"}}
+
+	prev, err := sc.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAlbumJSON(t, root, `{"description": "Scans"}`)
+	got, changed, err := sc.Rescan(root, prev, []string{""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changed, []string{""}) {
+		t.Errorf("changed = %v", changed)
+	}
+	if cfg := got.Albums[""].Config; cfg.Title != "Disk" || cfg.Description != "Scans" {
+		t.Errorf("root config = %+v", cfg)
+	}
+	assertMatchesScanner(t, sc, root, got)
+}
+
+func TestRescan_GalleryIgnoreChanges(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeFile(t, filepath.Join(root, "a", "one.jpg"))
+	writeFile(t, filepath.Join(root, "a", "one.tmp.jpg"))
+	writeFile(t, filepath.Join(root, "_rejects", "bad.jpg"))
+
+	prev, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ignoring paths drops them, below the directory of the file too.
+	writeIgnore(t, root, "_rejects\n*.tmp.jpg\n")
+	got, changed, err := Rescan(root, prev, []string{""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Albums["_rejects"]; ok {
+		t.Error("_rejects should be dropped")
+	}
+	if n := len(got.Albums["a"].Assets); n != 1 {
+		t.Errorf("album a has %d assets, want 1", n)
+	}
+	if !slices.Contains(changed, "_rejects") || !slices.Contains(changed, "a") {
+		t.Errorf("changed = %v", changed)
+	}
+	assertMatchesScan(t, root, got)
+
+	// A change in an ignored directory changes nothing.
+	writeFile(t, filepath.Join(root, "_rejects", "worse.jpg"))
+	got2, changed, err := Rescan(root, got, []string{"_rejects"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("changed = %v, want nothing", changed)
+	}
+
+	// Removing the file brings everything back.
+	if err := os.Remove(filepath.Join(root, ignore.FileName)); err != nil {
+		t.Fatal(err)
+	}
+	got3, _, err := Rescan(root, got2, []string{""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got3.Ignores) != 0 {
+		t.Errorf("ignores = %v, want none", got3.Ignores)
+	}
+	assertMatchesScan(t, root, got3)
+}
+
+func TestRescan_Symlinks(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "content")
+	nas := filepath.Join(base, "nas")
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeFile(t, filepath.Join(nas, "trip", "a.jpg"))
+	writeFile(t, filepath.Join(base, "private", "b.jpg"))
+	sc := &Scanner{Links: symlink.New([]string{nas})}
+
+	prev, err := sc.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new link is walked like a new directory.
+	link := filepath.Join(root, "trip")
+	if err := os.Symlink(filepath.Join(nas, "trip"), link); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := sc.Rescan(root, prev, []string{""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Albums["trip"]; !ok {
+		t.Fatal("linked album missing")
+	}
+	assertMatchesScanner(t, sc, root, got)
+
+	// Changes below the link are picked up at the link's path.
+	writeFile(t, filepath.Join(nas, "trip", "c.jpg"))
+	got, changed, err := sc.Rescan(root, got, []string{"trip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changed, []string{"trip"}) || len(got.Albums["trip"].Assets) != 2 {
+		t.Errorf("changed = %v, assets = %v", changed, got.Albums["trip"].Assets)
+	}
+
+	// Pointed out of the allowed roots, the album goes away, even when
+	// only the link's own path is reported.
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "private"), link); err != nil {
+		t.Fatal(err)
+	}
+	got2, _, err := sc.Rescan(root, got, []string{"trip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got2.Albums["trip"]; ok {
+		t.Error("album behind a rejected link should be dropped")
+	}
+	got3, _, err := sc.Rescan(root, got, []string{""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMatchesScanner(t, sc, root, got3)
+	if len(got3.Errors) != 1 {
+		t.Errorf("errors = %v, want the rejected link", got3.Errors)
+	}
+}
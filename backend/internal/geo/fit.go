@@ -0,0 +1,232 @@
+package geo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+func init() {
+	RegisterReader(".fit", readFIT)
+}
+
+// FIT protocol constants. Only what is needed to pull positions out of
+// "record" messages is implemented; every other message is skipped using
+// the sizes from its definition.
+const (
+	fitMinHeaderSize = 12
+
+	fitMsgRecord = 20
+
+	fitFieldTimestamp        = 253
+	fitFieldPositionLat      = 0
+	fitFieldPositionLong     = 1
+	fitFieldAltitude         = 2
+	fitFieldEnhancedAltitude = 78
+
+	fitInvalidSint32 = 0x7FFFFFFF
+	fitInvalidUint32 = 0xFFFFFFFF
+	fitInvalidUint16 = 0xFFFF
+)
+
+// fitEpoch is the FIT time origin, 1989-12-31T00:00:00Z.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+type fitFieldDef struct {
+	num  byte
+	size byte
+}
+
+type fitDefinition struct {
+	order     binary.ByteOrder
+	global    uint16
+	fields    []fitFieldDef
+	devFields int // total size in bytes of developer fields
+}
+
+// readFIT decodes Garmin FIT activity and course files. Each FIT file in
+// a chained stream becomes one track of its record messages. Trailing
+// bytes too short to hold another file's header, such as padding, are
+// ignored.
+func readFIT(r io.Reader) ([]Track, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []Track
+	for first := true; len(data) > 0; first = false {
+		if !first && len(data) < fitMinHeaderSize {
+			break
+		}
+		pts, rest, err := readFITFile(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(pts) > 0 {
+			tracks = append(tracks, Track{Kind: KindTrack, Points: pts})
+		}
+		data = rest
+	}
+	return tracks, nil
+}
+
+// readFITFile decodes one FIT file from the start of data and returns the
+// bytes that follow it.
+func readFITFile(data []byte) ([]Trackpoint, []byte, error) {
+	if len(data) < fitMinHeaderSize {
+		return nil, nil, errors.New("fit: short header")
+	}
+	headerSize := int(data[0])
+	if headerSize < fitMinHeaderSize || len(data) < headerSize || string(data[8:12]) != ".FIT" {
+		return nil, nil, errors.New("fit: not a FIT file")
+	}
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	end := headerSize + dataSize
+	if end > len(data) {
+		return nil, nil, errors.New("fit: truncated file")
+	}
+	records := data[headerSize:end]
+	rest := data[end:]
+	if len(rest) >= 2 {
+		rest = rest[2:] // file CRC, not verified
+	}
+
+	defs := make(map[byte]*fitDefinition)
+	var pts []Trackpoint
+	var lastTimestamp uint32
+	pos := 0
+	for pos < len(records) {
+		header := records[pos]
+		pos++
+
+		var local byte
+		compressedTS := header&0x80 != 0
+		if compressedTS {
+			local = (header >> 5) & 0x03
+		} else {
+			local = header & 0x0F
+		}
+
+		if !compressedTS && header&0x40 != 0 {
+			def, n, err := parseFITDefinition(records[pos:], header&0x20 != 0)
+			if err != nil {
+				return nil, nil, err
+			}
+			defs[local] = def
+			pos += n
+			continue
+		}
+
+		def, ok := defs[local]
+		if !ok {
+			return nil, nil, fmt.Errorf("fit: data message for undefined local type %d", local)
+		}
+
+		if compressedTS {
+			offset := uint32(header & 0x1F)
+			ts := lastTimestamp&^0x1F + offset
+			if offset < lastTimestamp&0x1F {
+				ts += 0x20
+			}
+			lastTimestamp = ts
+		}
+
+		pt := Trackpoint{Lat: math.NaN(), Lon: math.NaN()}
+		hasTS := compressedTS
+		for _, f := range def.fields {
+			if pos+int(f.size) > len(records) {
+				return nil, nil, errors.New("fit: truncated data message")
+			}
+			b := records[pos : pos+int(f.size)]
+			pos += int(f.size)
+
+			switch {
+			case f.num == fitFieldTimestamp && f.size == 4:
+				if v := def.order.Uint32(b); v != fitInvalidUint32 {
+					lastTimestamp = v
+					hasTS = true
+				}
+			case def.global != fitMsgRecord:
+				// Only record messages carry positions.
+			case f.num == fitFieldPositionLat && f.size == 4:
+				if v := def.order.Uint32(b); v != fitInvalidSint32 {
+					pt.Lat = semicirclesToDegrees(int32(v))
+				}
+			case f.num == fitFieldPositionLong && f.size == 4:
+				if v := def.order.Uint32(b); v != fitInvalidSint32 {
+					pt.Lon = semicirclesToDegrees(int32(v))
+				}
+			case f.num == fitFieldEnhancedAltitude && f.size == 4:
+				if v := def.order.Uint32(b); v != fitInvalidUint32 {
+					ele := float64(v)/5 - 500
+					pt.Ele = &ele
+				}
+			case f.num == fitFieldAltitude && f.size == 2:
+				// enhanced_altitude wins when both are present.
+				if v := def.order.Uint16(b); v != fitInvalidUint16 && pt.Ele == nil {
+					ele := float64(v)/5 - 500
+					pt.Ele = &ele
+				}
+			}
+		}
+		pos += def.devFields
+		if pos > len(records) {
+			return nil, nil, errors.New("fit: truncated data message")
+		}
+
+		if def.global != fitMsgRecord || math.IsNaN(pt.Lat) || math.IsNaN(pt.Lon) {
+			continue
+		}
+		if hasTS {
+			pt.Time = fitEpoch.Add(time.Duration(lastTimestamp) * time.Second)
+		}
+		pts = append(pts, pt)
+	}
+	return pts, rest, nil
+}
+
+// parseFITDefinition parses a definition message body and returns it with
+// the number of bytes consumed.
+func parseFITDefinition(b []byte, hasDevFields bool) (*fitDefinition, int, error) {
+	if len(b) < 5 {
+		return nil, 0, errors.New("fit: truncated definition")
+	}
+	def := &fitDefinition{order: binary.LittleEndian}
+	if b[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.global = def.order.Uint16(b[2:4])
+	n := int(b[4])
+	pos := 5
+	if len(b) < pos+3*n {
+		return nil, 0, errors.New("fit: truncated definition")
+	}
+	def.fields = make([]fitFieldDef, n)
+	for i := range def.fields {
+		def.fields[i] = fitFieldDef{num: b[pos], size: b[pos+1]}
+		pos += 3
+	}
+	if hasDevFields {
+		if len(b) < pos+1 {
+			return nil, 0, errors.New("fit: truncated definition")
+		}
+		nd := int(b[pos])
+		pos++
+		if len(b) < pos+3*nd {
+			return nil, 0, errors.New("fit: truncated definition")
+		}
+		for range nd {
+			def.devFields += int(b[pos+1])
+			pos += 3
+		}
+	}
+	return def, pos, nil
+}
+
+func semicirclesToDegrees(v int32) float64 {
+	return float64(v) * (180.0 / (1 << 31))
+}
@@ -0,0 +1,153 @@
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+func init() {
+	RegisterReader(".geojson", readGeoJSON)
+}
+
+type geoJSONObject struct {
+	Type       string          `json:"type"`
+	Features   []geoJSONObject `json:"features"`
+	Geometry   *geoJSONObject  `json:"geometry"`
+	Geometries []geoJSONObject `json:"geometries"`
+	Properties struct {
+		Name string `json:"name"`
+		Time string `json:"time"`
+		// CoordTimes holds per-vertex timestamps, the convention used by
+		// togeojson and most GPX converters. For MultiLineString it is a
+		// list of lists.
+		CoordTimes json.RawMessage `json:"coordTimes"`
+	} `json:"properties"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// readGeoJSON reads LineString and MultiLineString features as tracks
+// (timed when properties.coordTimes is present, routes otherwise) and
+// Point and MultiPoint features as waypoints.
+func readGeoJSON(r io.Reader) ([]Track, error) {
+	var root geoJSONObject
+	if err := json.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	if root.Type == "" {
+		return nil, errors.New("not a GeoJSON object")
+	}
+	var c geoJSONCollector
+	if err := c.object(&root, "", "", nil); err != nil {
+		return nil, err
+	}
+	if len(c.waypoints) > 0 {
+		c.tracks = append(c.tracks, Track{Kind: KindWaypoint, Points: c.waypoints})
+	}
+	return c.tracks, nil
+}
+
+type geoJSONCollector struct {
+	tracks    []Track
+	waypoints []Trackpoint
+}
+
+// object walks any GeoJSON object. name, timeStr and coordTimes come from
+// the enclosing Feature's properties.
+func (c *geoJSONCollector) object(o *geoJSONObject, name, timeStr string, coordTimes json.RawMessage) error {
+	switch o.Type {
+	case "FeatureCollection":
+		for i := range o.Features {
+			if err := c.object(&o.Features[i], "", "", nil); err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		if o.Geometry != nil {
+			return c.object(o.Geometry, o.Properties.Name, o.Properties.Time, o.Properties.CoordTimes)
+		}
+	case "GeometryCollection":
+		for i := range o.Geometries {
+			if err := c.object(&o.Geometries[i], name, timeStr, nil); err != nil {
+				return err
+			}
+		}
+	case "Point":
+		var pos []float64
+		if err := json.Unmarshal(o.Coordinates, &pos); err != nil {
+			return err
+		}
+		if pt, ok := geoJSONPosition(pos); ok {
+			pt.Time = parseTime(timeStr)
+			c.waypoints = append(c.waypoints, pt)
+		}
+	case "MultiPoint":
+		var line [][]float64
+		if err := json.Unmarshal(o.Coordinates, &line); err != nil {
+			return err
+		}
+		c.waypoints = append(c.waypoints, geoJSONLine(line, nil)...)
+	case "LineString":
+		var line [][]float64
+		if err := json.Unmarshal(o.Coordinates, &line); err != nil {
+			return err
+		}
+		var times []string
+		json.Unmarshal(coordTimes, &times)
+		c.addLine(name, geoJSONLine(line, times), len(times) > 0)
+	case "MultiLineString":
+		var lines [][][]float64
+		if err := json.Unmarshal(o.Coordinates, &lines); err != nil {
+			return err
+		}
+		var times [][]string
+		json.Unmarshal(coordTimes, &times)
+		for i, line := range lines {
+			var t []string
+			if i < len(times) {
+				t = times[i]
+			}
+			c.addLine(name, geoJSONLine(line, t), len(t) > 0)
+		}
+	}
+	return nil
+}
+
+func (c *geoJSONCollector) addLine(name string, pts []Trackpoint, timed bool) {
+	if len(pts) == 0 {
+		return
+	}
+	kind := KindRoute
+	if timed {
+		kind = KindTrack
+	}
+	c.tracks = append(c.tracks, Track{Name: name, Kind: kind, Points: pts})
+}
+
+func geoJSONLine(line [][]float64, times []string) []Trackpoint {
+	var pts []Trackpoint
+	for i, pos := range line {
+		pt, ok := geoJSONPosition(pos)
+		if !ok {
+			continue
+		}
+		if i < len(times) {
+			pt.Time = parseTime(times[i])
+		}
+		pts = append(pts, pt)
+	}
+	return pts
+}
+
+// geoJSONPosition converts a [lon, lat, ele?] position.
+func geoJSONPosition(pos []float64) (Trackpoint, bool) {
+	if len(pos) < 2 {
+		return Trackpoint{}, false
+	}
+	pt := Trackpoint{Lat: pos[1], Lon: pos[0]}
+	if len(pos) > 2 {
+		ele := pos[2]
+		pt.Ele = &ele
+	}
+	return pt, true
+}
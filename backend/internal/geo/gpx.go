@@ -1,100 +1,134 @@
-// Package geo provides GPS coordinate resolution from GPX tracklogs.
+// Package geo provides GPS coordinate resolution from tracklogs.
+//
+// Track files are decoded by format-specific readers registered with
+// [RegisterReader] (GPX, KML, GeoJSON, TCX and FIT are built in) into
+// [Track] values, which [TimedPoints] flattens into the time-sorted
+// points used by [MatchTrack].
 package geo
 
 import (
 	"encoding/xml"
-	"fmt"
+	"io"
 	"math"
-	"os"
 	"sort"
 	"time"
 )
 
-// Trackpoint is a single GPS position with a timestamp.
-type Trackpoint struct {
-	Lat  float64
-	Lon  float64
-	Time time.Time
+func init() {
+	RegisterReader(".gpx", readGPX)
 }
 
 // gpxFile represents the top-level GPX XML structure.
 type gpxFile struct {
-	XMLName xml.Name `xml:"gpx"`
-	Tracks  []gpxTrk `xml:"trk"`
+	XMLName   xml.Name `xml:"gpx"`
+	Waypoints []gpxPt  `xml:"wpt"`
+	Routes    []gpxRte `xml:"rte"`
+	Tracks    []gpxTrk `xml:"trk"`
 }
 
 type gpxTrk struct {
+	Name     string      `xml:"name"`
 	Segments []gpxTrkSeg `xml:"trkseg"`
 }
 
 type gpxTrkSeg struct {
-	Points []gpxTrkPt `xml:"trkpt"`
+	Points []gpxPt `xml:"trkpt"`
 }
 
-type gpxTrkPt struct {
-	Lat  float64 `xml:"lat,attr"`
-	Lon  float64 `xml:"lon,attr"`
-	Time string  `xml:"time"`
+type gpxRte struct {
+	Name   string  `xml:"name"`
+	Points []gpxPt `xml:"rtept"`
 }
 
-// ParseGPXFiles reads one or more GPX files and returns all trackpoints
-// sorted by time. Points without a parseable timestamp are silently skipped.
-func ParseGPXFiles(paths []string) ([]Trackpoint, error) {
-	var all []Trackpoint
-	for _, path := range paths {
-		pts, err := parseOneGPX(path)
-		if err != nil {
-			return nil, fmt.Errorf("parsing %s: %w", path, err)
-		}
-		all = append(all, pts...)
-	}
-	sort.Slice(all, func(i, j int) bool {
-		return all[i].Time.Before(all[j].Time)
-	})
-	return all, nil
+// gpxPt is the shared wptType used by trkpt, rtept and wpt.
+type gpxPt struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele"`
+	Time string   `xml:"time"`
 }
 
-func parseOneGPX(path string) ([]Trackpoint, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
+func (p gpxPt) trackpoint() Trackpoint {
+	return Trackpoint{Lat: p.Lat, Lon: p.Lon, Ele: p.Ele, Time: parseTime(p.Time)}
+}
+
+// readGPX returns one track per track segment, one per route, and a
+// single waypoint track holding all wpt elements.
+func readGPX(r io.Reader) ([]Track, error) {
 	var gpx gpxFile
-	if err := xml.Unmarshal(data, &gpx); err != nil {
+	if err := xml.NewDecoder(r).Decode(&gpx); err != nil {
 		return nil, err
 	}
 
-	var pts []Trackpoint
+	var tracks []Track
 	for _, trk := range gpx.Tracks {
 		for _, seg := range trk.Segments {
-			for _, pt := range seg.Points {
-				t, err := time.Parse(time.RFC3339, pt.Time)
-				if err != nil {
-					// Try RFC3339Nano as fallback.
-					t, err = time.Parse(time.RFC3339Nano, pt.Time)
-					if err != nil {
-						continue
-					}
-				}
-				pts = append(pts, Trackpoint{
-					Lat:  pt.Lat,
-					Lon:  pt.Lon,
-					Time: t,
-				})
+			if len(seg.Points) > 0 {
+				tracks = append(tracks, Track{Name: trk.Name, Kind: KindTrack, Points: gpxPoints(seg.Points)})
 			}
 		}
 	}
-	return pts, nil
+	for _, rte := range gpx.Routes {
+		if len(rte.Points) > 0 {
+			tracks = append(tracks, Track{Name: rte.Name, Kind: KindRoute, Points: gpxPoints(rte.Points)})
+		}
+	}
+	if len(gpx.Waypoints) > 0 {
+		tracks = append(tracks, Track{Kind: KindWaypoint, Points: gpxPoints(gpx.Waypoints)})
+	}
+	return tracks, nil
+}
+
+func gpxPoints(pts []gpxPt) []Trackpoint {
+	out := make([]Trackpoint, len(pts))
+	for i, p := range pts {
+		out[i] = p.trackpoint()
+	}
+	return out
 }
 
-// MatchNearest finds the best GPS coordinate for a given timestamp from a
-// sorted trackpoint slice. It first looks for the single closest point
-// within tolerance. If no single point qualifies but the timestamp falls
-// between two consecutive points, it linearly interpolates between them.
-// Returns ok=false if no match is possible.
-func MatchNearest(points []Trackpoint, t time.Time, tolerance time.Duration) (lat, lon float64, ok bool) {
+// Match methods reported in [Match.Method].
+const (
+	MethodNearest      = "nearest"
+	MethodInterpolated = "interpolated"
+)
+
+// MatchOptions configures [MatchTrack].
+type MatchOptions struct {
+	// Tolerance is the largest time distance at which a photo snaps to a
+	// single trackpoint.
+	Tolerance time.Duration
+
+	// MaxGap is the longest time between two consecutive trackpoints that
+	// may be interpolated across. Zero disables interpolation; a negative
+	// value allows any gap.
+	MaxGap time.Duration
+}
+
+// Match is a position resolved from a tracklog.
+type Match struct {
+	Lat, Lon float64
+
+	// Ele is the elevation in meters, nil if the track has none.
+	Ele *float64
+
+	// Method is [MethodNearest] or [MethodInterpolated].
+	Method string
+
+	// Offset is the time distance between the photo and the nearest
+	// recorded trackpoint, a measure of how trustworthy the match is.
+	Offset time.Duration
+}
+
+// MatchTrack finds the position for a timestamp in a time-sorted
+// trackpoint slice. It prefers the single closest point within
+// opts.Tolerance; failing that, it linearly interpolates between the two
+// points bracketing t, provided they are no more than opts.MaxGap apart
+// (so a long GPS dropout does not place photos on a straight line
+// between distant points). Returns ok=false if no match is possible.
+func MatchTrack(points []Trackpoint, t time.Time, opts MatchOptions) (Match, bool) {
 	if len(points) == 0 {
-		return 0, 0, false
+		return Match{}, false
 	}
 
 	// Binary search for the insertion point.
@@ -122,22 +156,31 @@ func MatchNearest(points []Trackpoint, t time.Time, tolerance time.Duration) (la
 	}
 
 	// Exact or near match within tolerance.
-	if bestIdx >= 0 && bestDist <= tolerance {
-		return points[bestIdx].Lat, points[bestIdx].Lon, true
+	if bestIdx >= 0 && bestDist <= opts.Tolerance {
+		p := points[bestIdx]
+		return Match{Lat: p.Lat, Lon: p.Lon, Ele: p.Ele, Method: MethodNearest, Offset: bestDist}, true
 	}
 
 	// Interpolation: t falls between two consecutive points.
-	if idx > 0 && idx < len(points) {
+	if idx > 0 && idx < len(points) && opts.MaxGap != 0 {
 		before := points[idx-1]
 		after := points[idx]
 		span := after.Time.Sub(before.Time)
-		if span > 0 {
+		if span > 0 && (opts.MaxGap < 0 || span <= opts.MaxGap) {
 			frac := float64(t.Sub(before.Time)) / float64(span)
-			lat = before.Lat + frac*(after.Lat-before.Lat)
-			lon = before.Lon + frac*(after.Lon-before.Lon)
-			return lat, lon, true
+			m := Match{
+				Lat:    before.Lat + frac*(after.Lat-before.Lat),
+				Lon:    before.Lon + frac*(after.Lon-before.Lon),
+				Method: MethodInterpolated,
+				Offset: bestDist,
+			}
+			if before.Ele != nil && after.Ele != nil {
+				ele := *before.Ele + frac*(*after.Ele-*before.Ele)
+				m.Ele = &ele
+			}
+			return m, true
 		}
 	}
 
-	return 0, 0, false
+	return Match{}, false
 }
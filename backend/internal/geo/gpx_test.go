@@ -34,14 +34,15 @@ func writeGPX(t *testing.T, dir, name, content string) string {
 	return path
 }
 
-func TestParseGPXFiles_Basic(t *testing.T) {
+func TestParseTrackFiles_GPXBasic(t *testing.T) {
 	dir := t.TempDir()
 	path := writeGPX(t, dir, "track.gpx", sampleGPX)
 
-	pts, err := ParseGPXFiles([]string{path})
+	tracks, err := ParseTrackFiles([]string{path})
 	if err != nil {
 		t.Fatal(err)
 	}
+	pts := TimedPoints(tracks)
 	if len(pts) != 3 {
 		t.Fatalf("got %d points, want 3", len(pts))
 	}
@@ -50,7 +51,7 @@ func TestParseGPXFiles_Basic(t *testing.T) {
 	}
 }
 
-func TestParseGPXFiles_Multiple(t *testing.T) {
+func TestParseTrackFiles_GPXMultiple(t *testing.T) {
 	dir := t.TempDir()
 	gpx2 := `<?xml version="1.0"?>
 <gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1">
@@ -63,10 +64,11 @@ func TestParseGPXFiles_Multiple(t *testing.T) {
 	p1 := writeGPX(t, dir, "a.gpx", sampleGPX)
 	p2 := writeGPX(t, dir, "b.gpx", gpx2)
 
-	pts, err := ParseGPXFiles([]string{p1, p2})
+	tracks, err := ParseTrackFiles([]string{p1, p2})
 	if err != nil {
 		t.Fatal(err)
 	}
+	pts := TimedPoints(tracks)
 	if len(pts) != 4 {
 		t.Fatalf("got %d points, want 4", len(pts))
 	}
@@ -76,56 +78,58 @@ func TestParseGPXFiles_Multiple(t *testing.T) {
 	}
 }
 
-func TestParseGPXFiles_InvalidFile(t *testing.T) {
+func TestParseTrackFiles_GPXInvalidFile(t *testing.T) {
 	dir := t.TempDir()
 	path := writeGPX(t, dir, "bad.gpx", "not xml at all {{{")
 
-	_, err := ParseGPXFiles([]string{path})
+	_, err := ParseTrackFiles([]string{path})
 	if err == nil {
 		t.Error("expected error for invalid XML")
 	}
 }
 
-func TestParseGPXFiles_MissingFile(t *testing.T) {
-	_, err := ParseGPXFiles([]string{"/nonexistent/track.gpx"})
+func TestParseTrackFiles_GPXMissingFile(t *testing.T) {
+	_, err := ParseTrackFiles([]string{"/nonexistent/track.gpx"})
 	if err == nil {
 		t.Error("expected error for missing file")
 	}
 }
 
-func TestMatchNearest_ExactMatch(t *testing.T) {
+// matchOpts snaps within 30 seconds and interpolates across any gap.
+var matchOpts = MatchOptions{Tolerance: 30 * time.Second, MaxGap: -1}
+
+func TestMatchTrack_ExactMatch(t *testing.T) {
 	pts := []Trackpoint{
 		{Lat: 48.8566, Lon: 2.3522, Time: time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)},
 		{Lat: 48.8570, Lon: 2.3530, Time: time.Date(2024, 6, 15, 10, 1, 0, 0, time.UTC)},
 	}
 
-	lat, lon, ok := MatchNearest(pts, pts[0].Time, 30*time.Second)
+	m, ok := MatchTrack(pts, pts[0].Time, matchOpts)
 	if !ok {
 		t.Fatal("expected match")
 	}
-	if lat != 48.8566 || lon != 2.3522 {
-		t.Errorf("got (%f, %f), want (48.8566, 2.3522)", lat, lon)
+	if m.Lat != 48.8566 || m.Lon != 2.3522 {
+		t.Errorf("got (%f, %f), want (48.8566, 2.3522)", m.Lat, m.Lon)
 	}
 }
 
-func TestMatchNearest_WithinTolerance(t *testing.T) {
+func TestMatchTrack_WithinTolerance(t *testing.T) {
 	pts := []Trackpoint{
 		{Lat: 48.8566, Lon: 2.3522, Time: time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)},
 	}
 
 	// 20 seconds after — within 30s tolerance.
 	query := pts[0].Time.Add(20 * time.Second)
-	lat, lon, ok := MatchNearest(pts, query, 30*time.Second)
+	m, ok := MatchTrack(pts, query, matchOpts)
 	if !ok {
 		t.Fatal("expected match within tolerance")
 	}
-	if lat != 48.8566 {
-		t.Errorf("lat = %f, want 48.8566", lat)
+	if m.Lat != 48.8566 || m.Method != MethodNearest {
+		t.Errorf("match = %+v, want nearest at lat 48.8566", m)
 	}
-	_ = lon
 }
 
-func TestMatchNearest_OutsideTolerance_Interpolates(t *testing.T) {
+func TestMatchTrack_OutsideTolerance_Interpolates(t *testing.T) {
 	t1 := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)
 	t2 := time.Date(2024, 6, 15, 10, 2, 0, 0, time.UTC) // 2 minutes apart
 
@@ -136,19 +140,19 @@ func TestMatchNearest_OutsideTolerance_Interpolates(t *testing.T) {
 
 	// Midpoint: 1 minute in.
 	query := t1.Add(1 * time.Minute)
-	lat, lon, ok := MatchNearest(pts, query, 30*time.Second)
-	if !ok {
-		t.Fatal("expected interpolated match")
+	m, ok := MatchTrack(pts, query, matchOpts)
+	if !ok || m.Method != MethodInterpolated {
+		t.Fatalf("match = %+v, %v; want interpolated", m, ok)
 	}
-	if math.Abs(lat-41.0) > 0.001 {
-		t.Errorf("lat = %f, want ~41.0 (midpoint)", lat)
+	if math.Abs(m.Lat-41.0) > 0.001 {
+		t.Errorf("lat = %f, want ~41.0 (midpoint)", m.Lat)
 	}
-	if math.Abs(lon-(-73.0)) > 0.001 {
-		t.Errorf("lon = %f, want ~-73.0 (midpoint)", lon)
+	if math.Abs(m.Lon-(-73.0)) > 0.001 {
+		t.Errorf("lon = %f, want ~-73.0 (midpoint)", m.Lon)
 	}
 }
 
-func TestMatchNearest_OutsideTolerance_QuarterPoint(t *testing.T) {
+func TestMatchTrack_OutsideTolerance_QuarterPoint(t *testing.T) {
 	t1 := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)
 	t2 := time.Date(2024, 6, 15, 10, 4, 0, 0, time.UTC) // 4 minutes apart
 
@@ -159,47 +163,166 @@ func TestMatchNearest_OutsideTolerance_QuarterPoint(t *testing.T) {
 
 	// 1 minute in = 25% of the way.
 	query := t1.Add(1 * time.Minute)
-	lat, lon, ok := MatchNearest(pts, query, 30*time.Second)
-	if !ok {
-		t.Fatal("expected interpolated match")
+	m, ok := MatchTrack(pts, query, matchOpts)
+	if !ok || m.Method != MethodInterpolated {
+		t.Fatalf("match = %+v, %v; want interpolated", m, ok)
 	}
-	if math.Abs(lat-41.0) > 0.001 {
-		t.Errorf("lat = %f, want ~41.0 (25%%)", lat)
+	if math.Abs(m.Lat-41.0) > 0.001 {
+		t.Errorf("lat = %f, want ~41.0 (25%%)", m.Lat)
 	}
-	if math.Abs(lon-(-73.0)) > 0.001 {
-		t.Errorf("lon = %f, want ~-73.0 (25%%)", lon)
+	if math.Abs(m.Lon-(-73.0)) > 0.001 {
+		t.Errorf("lon = %f, want ~-73.0 (25%%)", m.Lon)
 	}
 }
 
-func TestMatchNearest_BeforeAllPoints(t *testing.T) {
+func TestMatchTrack_BeforeAllPoints(t *testing.T) {
 	pts := []Trackpoint{
 		{Lat: 48.8566, Lon: 2.3522, Time: time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)},
 	}
 
 	// Way before the only point — no interpolation possible.
 	query := time.Date(2024, 6, 15, 9, 0, 0, 0, time.UTC)
-	_, _, ok := MatchNearest(pts, query, 30*time.Second)
+	_, ok := MatchTrack(pts, query, matchOpts)
 	if ok {
 		t.Error("expected no match for time far before all points")
 	}
 }
 
-func TestMatchNearest_AfterAllPoints(t *testing.T) {
+func TestMatchTrack_AfterAllPoints(t *testing.T) {
 	pts := []Trackpoint{
 		{Lat: 48.8566, Lon: 2.3522, Time: time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)},
 	}
 
 	// Way after the only point.
 	query := time.Date(2024, 6, 15, 11, 0, 0, 0, time.UTC)
-	_, _, ok := MatchNearest(pts, query, 30*time.Second)
+	_, ok := MatchTrack(pts, query, matchOpts)
 	if ok {
 		t.Error("expected no match for time far after all points")
 	}
 }
 
-func TestMatchNearest_EmptyPoints(t *testing.T) {
-	_, _, ok := MatchNearest(nil, time.Now(), 30*time.Second)
+func TestMatchTrack_EmptyPoints(t *testing.T) {
+	_, ok := MatchTrack(nil, time.Now(), matchOpts)
 	if ok {
 		t.Error("expected no match for empty points")
 	}
 }
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestMatchTrack_MaxGap(t *testing.T) {
+	base := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)
+	pts := []Trackpoint{
+		{Lat: 40.0, Lon: -74.0, Time: base, Ele: floatPtr(100)},
+		{Lat: 42.0, Lon: -72.0, Time: base.Add(2 * time.Minute), Ele: floatPtr(200)},
+		// A six-hour GPS dropout.
+		{Lat: 50.0, Lon: -60.0, Time: base.Add(6*time.Hour + 2*time.Minute)},
+	}
+	opts := MatchOptions{Tolerance: 30 * time.Second, MaxGap: 10 * time.Minute}
+
+	m, ok := MatchTrack(pts, base.Add(time.Minute), opts)
+	if !ok {
+		t.Fatal("expected interpolation within the gap limit")
+	}
+	if m.Method != MethodInterpolated || m.Offset != time.Minute {
+		t.Errorf("match = %+v", m)
+	}
+	if m.Ele == nil || math.Abs(*m.Ele-150) > 1e-9 {
+		t.Errorf("ele = %v, want 150", m.Ele)
+	}
+
+	if _, ok := MatchTrack(pts, base.Add(3*time.Hour), opts); ok {
+		t.Error("must not interpolate across a gap longer than MaxGap")
+	}
+
+	opts.MaxGap = 0
+	if _, ok := MatchTrack(pts, base.Add(time.Minute), opts); ok {
+		t.Error("MaxGap 0 should disable interpolation")
+	}
+}
+
+func TestMatchTrack_NearestCarriesElevationAndOffset(t *testing.T) {
+	base := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)
+	pts := []Trackpoint{{Lat: 1, Lon: 2, Time: base, Ele: floatPtr(321)}}
+
+	m, ok := MatchTrack(pts, base.Add(10*time.Second), MatchOptions{Tolerance: 30 * time.Second})
+	if !ok {
+		t.Fatal("expected match")
+	}
+	if m.Method != MethodNearest || m.Offset != 10*time.Second || m.Ele == nil || *m.Ele != 321 {
+		t.Errorf("match = %+v", m)
+	}
+}
+
+func TestParseGPXTracks_KeepsSegmentsAndUntimedPoints(t *testing.T) {
+	dir := t.TempDir()
+	path := writeGPX(t, dir, "hike.gpx", `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk>
+    <name>Summit</name>
+    <trkseg>
+      <trkpt lat="46.0" lon="7.0"><time>2024-06-15T10:00:00Z</time></trkpt>
+      <trkpt lat="46.1" lon="7.1"></trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="46.2" lon="7.2"><time>2024-06-15T11:00:00Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`)
+
+	tracks, err := ParseTrackFiles([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks, want one per segment", len(tracks))
+	}
+	if tracks[0].Name != "Summit" || len(tracks[0].Points) != 2 {
+		t.Errorf("first track = %+v", tracks[0])
+	}
+
+	timed := TimedPoints(tracks)
+	if len(timed) != 2 {
+		t.Errorf("timed points = %d, want 2 (untimed point skipped)", len(timed))
+	}
+}
+
+func TestReadGPX_RoutesWaypointsAndElevation(t *testing.T) {
+	dir := t.TempDir()
+	path := writeGPX(t, dir, "plan.gpx", `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="46.5" lon="7.5"><ele>2100.5</ele><time>2024-06-15T12:00:00Z</time><name>Hut</name></wpt>
+  <rte>
+    <name>Planned</name>
+    <rtept lat="46.0" lon="7.0"/>
+    <rtept lat="46.1" lon="7.1"/>
+  </rte>
+  <trk>
+    <trkseg>
+      <trkpt lat="46.2" lon="7.2"><ele>1500</ele><time>2024-06-15T10:00:00Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`)
+
+	tracks, err := ParseTrackFiles([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 3 {
+		t.Fatalf("got %d tracks, want track, route and waypoints", len(tracks))
+	}
+	if tracks[0].Kind != KindTrack || tracks[0].Points[0].Ele == nil || *tracks[0].Points[0].Ele != 1500 {
+		t.Errorf("track = %+v", tracks[0])
+	}
+	if tracks[1].Kind != KindRoute || tracks[1].Name != "Planned" || len(tracks[1].Points) != 2 {
+		t.Errorf("route = %+v", tracks[1])
+	}
+	if tracks[2].Kind != KindWaypoint || *tracks[2].Points[0].Ele != 2100.5 {
+		t.Errorf("waypoints = %+v", tracks[2])
+	}
+
+	// The timed waypoint is usable for matching; untimed route points are not.
+	if timed := TimedPoints(tracks); len(timed) != 2 {
+		t.Errorf("timed points = %d, want 2", len(timed))
+	}
+}
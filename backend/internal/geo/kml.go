@@ -0,0 +1,164 @@
+package geo
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterReader(".kml", readKML)
+}
+
+// kmlPlacemark holds the geometries gollery understands. Element names
+// are matched without namespace, so both <Track> and <gx:Track> decode.
+type kmlPlacemark struct {
+	Name          string            `xml:"name"`
+	Point         *kmlCoords        `xml:"Point"`
+	LineString    *kmlCoords        `xml:"LineString"`
+	Track         *kmlTrack         `xml:"Track"`
+	MultiTrack    *kmlMultiGeometry `xml:"MultiTrack"`
+	MultiGeometry *kmlMultiGeometry `xml:"MultiGeometry"`
+}
+
+type kmlCoords struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+// kmlTrack is a gx:Track: parallel lists of timestamps and "lon lat alt"
+// coordinates.
+type kmlTrack struct {
+	When  []string `xml:"when"`
+	Coord []string `xml:"coord"`
+}
+
+type kmlMultiGeometry struct {
+	Points      []kmlCoords `xml:"Point"`
+	LineStrings []kmlCoords `xml:"LineString"`
+	Tracks      []kmlTrack  `xml:"Track"`
+}
+
+// readKML collects Placemarks at any depth (Documents and Folders nest
+// arbitrarily). LineStrings become untimed routes, gx:Tracks become timed
+// tracks and Points become waypoints.
+func readKML(r io.Reader) ([]Track, error) {
+	dec := xml.NewDecoder(r)
+	var tracks []Track
+	var waypoints []Trackpoint
+	sawRoot := false
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !sawRoot {
+			if se.Name.Local != "kml" {
+				return nil, errors.New("not a KML document")
+			}
+			sawRoot = true
+		}
+		if se.Name.Local != "Placemark" {
+			continue
+		}
+		var pm kmlPlacemark
+		if err := dec.DecodeElement(&pm, &se); err != nil {
+			return nil, err
+		}
+
+		var lines []kmlCoords
+		var timed []kmlTrack
+		var points []kmlCoords
+		if pm.LineString != nil {
+			lines = append(lines, *pm.LineString)
+		}
+		if pm.Track != nil {
+			timed = append(timed, *pm.Track)
+		}
+		if pm.Point != nil {
+			points = append(points, *pm.Point)
+		}
+		for _, mg := range []*kmlMultiGeometry{pm.MultiGeometry, pm.MultiTrack} {
+			if mg != nil {
+				lines = append(lines, mg.LineStrings...)
+				timed = append(timed, mg.Tracks...)
+				points = append(points, mg.Points...)
+			}
+		}
+
+		for _, ls := range lines {
+			if pts := parseKMLCoordinates(ls.Coordinates); len(pts) > 0 {
+				tracks = append(tracks, Track{Name: pm.Name, Kind: KindRoute, Points: pts})
+			}
+		}
+		for _, trk := range timed {
+			if pts := parseKMLTrack(trk); len(pts) > 0 {
+				tracks = append(tracks, Track{Name: pm.Name, Kind: KindTrack, Points: pts})
+			}
+		}
+		for _, p := range points {
+			waypoints = append(waypoints, parseKMLCoordinates(p.Coordinates)...)
+		}
+	}
+	if !sawRoot {
+		return nil, errors.New("not a KML document")
+	}
+	if len(waypoints) > 0 {
+		tracks = append(tracks, Track{Kind: KindWaypoint, Points: waypoints})
+	}
+	return tracks, nil
+}
+
+// parseKMLCoordinates parses a whitespace-separated list of "lon,lat[,alt]"
+// tuples. Malformed tuples are skipped.
+func parseKMLCoordinates(s string) []Trackpoint {
+	var pts []Trackpoint
+	for _, tuple := range strings.Fields(s) {
+		if pt, ok := parseKMLTuple(strings.Split(tuple, ",")); ok {
+			pts = append(pts, pt)
+		}
+	}
+	return pts
+}
+
+// parseKMLTrack pairs each gx:coord ("lon lat alt") with its <when>.
+func parseKMLTrack(trk kmlTrack) []Trackpoint {
+	var pts []Trackpoint
+	for i, c := range trk.Coord {
+		pt, ok := parseKMLTuple(strings.Fields(c))
+		if !ok {
+			continue
+		}
+		if i < len(trk.When) {
+			pt.Time = parseTime(trk.When[i])
+		}
+		pts = append(pts, pt)
+	}
+	return pts
+}
+
+func parseKMLTuple(fields []string) (Trackpoint, bool) {
+	if len(fields) < 2 {
+		return Trackpoint{}, false
+	}
+	lon, err1 := strconv.ParseFloat(fields[0], 64)
+	lat, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil {
+		return Trackpoint{}, false
+	}
+	pt := Trackpoint{Lat: lat, Lon: lon}
+	if len(fields) > 2 {
+		if ele, err := strconv.ParseFloat(fields[2], 64); err == nil {
+			pt.Ele = &ele
+		}
+	}
+	return pt, true
+}
@@ -0,0 +1,48 @@
+package geo
+
+import "math"
+
+const (
+	earthRadiusM = 6371000
+	kmPerDegree  = 111.32
+)
+
+// Zone is a circular area, used to suppress locations near sensitive
+// places such as a home address.
+type Zone struct {
+	Lat, Lon float64
+	RadiusM  float64
+}
+
+// Contains reports whether the point lies within the zone.
+func (z Zone) Contains(lat, lon float64) bool {
+	return DistanceM(z.Lat, z.Lon, lat, lon) <= z.RadiusM
+}
+
+// DistanceM returns the great-circle distance in meters between two points.
+func DistanceM(lat1, lon1, lat2, lon2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusM * math.Asin(math.Sqrt(min(a, 1)))
+}
+
+// Coarsen snaps a point to the center of a grid cell roughly km wide.
+// Every point in a cell maps to the same center, so coarse positions of
+// many photos cannot be averaged back to the true one. Cells keep their
+// width in km away from the equator by widening in degrees of longitude.
+func Coarsen(lat, lon, km float64) (float64, float64) {
+	latStep := km / kmPerDegree
+	cLat := (math.Floor(lat/latStep) + 0.5) * latStep
+	cLat = math.Max(-90, math.Min(90, cLat))
+
+	lonStep := 360.0
+	if c := math.Cos(cLat * math.Pi / 180); c > 0 {
+		lonStep = math.Min(360, km/(kmPerDegree*c))
+	}
+	cLon := (math.Floor((lon+180)/lonStep)+0.5)*lonStep - 180
+	cLon = math.Max(-180, math.Min(180, cLon))
+	return cLat, cLon
+}
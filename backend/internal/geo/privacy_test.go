@@ -0,0 +1,37 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestZoneContains(t *testing.T) {
+	home := Zone{Lat: 48.8566, Lon: 2.3522, RadiusM: 500}
+	if !home.Contains(48.8580, 2.3530) {
+		t.Error("point ~170m away should be inside")
+	}
+	if home.Contains(48.8666, 2.3522) {
+		t.Error("point ~1.1km away should be outside")
+	}
+}
+
+func TestCoarsen(t *testing.T) {
+	lat, lon := Coarsen(48.8566, 2.3522, 5)
+	if d := DistanceM(48.8566, 2.3522, lat, lon); d > 5000 || d == 0 {
+		t.Errorf("coarse point %f,%f is %.0fm away, want within a 5km cell", lat, lon, d)
+	}
+
+	// Nearby points in the same cell map to the same center.
+	lat2, lon2 := Coarsen(48.8570, 2.3530, 5)
+	if lat2 != lat || lon2 != lon {
+		t.Errorf("same cell gave %f,%f and %f,%f", lat, lon, lat2, lon2)
+	}
+
+	// Stays in range at the poles and the antimeridian.
+	for _, p := range [][2]float64{{90, 180}, {-90, -180}, {89.99, 179.99}} {
+		lat, lon := Coarsen(p[0], p[1], 10)
+		if math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+			t.Errorf("Coarsen(%v) = %f,%f out of range", p, lat, lon)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package geo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Track kinds. A track is a recorded log, a route is a planned path and
+// waypoints are standalone points of interest.
+const (
+	KindTrack    = "track"
+	KindRoute    = "route"
+	KindWaypoint = "waypoint"
+)
+
+// Trackpoint is a single GPS position with a timestamp. Time is zero for
+// points that carry no timestamp (planned routes, KML LineStrings); such
+// points describe a path but are never used for photo matching.
+type Trackpoint struct {
+	Lat  float64
+	Lon  float64
+	Time time.Time
+
+	// Ele is the elevation in meters above sea level, nil if unknown.
+	Ele *float64
+}
+
+// Track is an ordered list of points read from a track file, typically
+// one GPX track segment. For [KindWaypoint] the points are unconnected.
+type Track struct {
+	Name   string
+	Kind   string
+	Points []Trackpoint
+}
+
+// TrackReader decodes every track, route and waypoint in one file.
+type TrackReader func(r io.Reader) ([]Track, error)
+
+var (
+	readersMu sync.RWMutex
+	readers   = make(map[string]TrackReader)
+)
+
+// RegisterReader makes a track reader available for files with the given
+// extension (including the dot, matched case-insensitively). It panics
+// if the extension is already registered, like [database/sql.Register].
+func RegisterReader(ext string, fn TrackReader) {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+	ext = strings.ToLower(ext)
+	if _, dup := readers[ext]; dup {
+		panic("geo: RegisterReader called twice for " + ext)
+	}
+	readers[ext] = fn
+}
+
+// Extensions returns the registered track file extensions, sorted.
+func Extensions() []string {
+	readersMu.RLock()
+	defer readersMu.RUnlock()
+	exts := make([]string, 0, len(readers))
+	for ext := range readers {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// IsTrackFile reports whether name has a registered track file extension.
+func IsTrackFile(name string) bool {
+	return readerFor(name) != nil
+}
+
+func readerFor(name string) TrackReader {
+	readersMu.RLock()
+	defer readersMu.RUnlock()
+	return readers[strings.ToLower(filepath.Ext(name))]
+}
+
+// ParseTrackFiles reads track files of any registered format and returns
+// their tracks in file order. Points without a timestamp are kept (with a
+// zero Time) since they still describe the route.
+func ParseTrackFiles(paths []string) ([]Track, error) {
+	var all []Track
+	for _, path := range paths {
+		tracks, err := parseTrackFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		all = append(all, tracks...)
+	}
+	return all, nil
+}
+
+func parseTrackFile(path string) ([]Track, error) {
+	read := readerFor(path)
+	if read == nil {
+		return nil, fmt.Errorf("unsupported track format %q", filepath.Ext(path))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return read(f)
+}
+
+// TimedPoints flattens tracks into the timestamped points usable for
+// photo matching, sorted by time.
+func TimedPoints(tracks []Track) []Trackpoint {
+	var all []Trackpoint
+	for _, trk := range tracks {
+		for _, pt := range trk.Points {
+			if !pt.Time.IsZero() {
+				all = append(all, pt)
+			}
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Time.Before(all[j].Time)
+	})
+	return all
+}
+
+// parseTime parses the RFC 3339 timestamps used by GPX, KML, TCX and
+// GeoJSON. It returns the zero time for empty or malformed values.
+func parseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,276 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_BuiltinFormats(t *testing.T) {
+	got := strings.Join(Extensions(), ",")
+	if got != ".fit,.geojson,.gpx,.kml,.tcx" {
+		t.Errorf("Extensions() = %s", got)
+	}
+	for name, want := range map[string]bool{
+		"ride.FIT":     true,
+		"hike.gpx":     true,
+		"a.geojson":    true,
+		"album.json":   false,
+		"photo.jpg":    false,
+		"no-extension": false,
+	} {
+		if IsTrackFile(name) != want {
+			t.Errorf("IsTrackFile(%q) = %v, want %v", name, !want, want)
+		}
+	}
+}
+
+func TestRegisterReader_DuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on duplicate registration")
+		}
+	}()
+	RegisterReader(".GPX", readGPX)
+}
+
+func TestParseTrackFiles_UnsupportedFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.txt")
+	os.WriteFile(path, []byte("x"), 0644)
+	if _, err := ParseTrackFiles([]string{path}); err == nil {
+		t.Error("expected error for unsupported extension")
+	}
+}
+
+func TestReadKML(t *testing.T) {
+	kml := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">
+ <Document>
+  <Folder>
+   <Placemark>
+    <name>Drive</name>
+    <gx:Track>
+     <when>2024-06-15T10:00:00Z</when>
+     <when>2024-06-15T10:01:00Z</when>
+     <gx:coord>2.3522 48.8566 35</gx:coord>
+     <gx:coord>2.3530 48.8570 36</gx:coord>
+    </gx:Track>
+   </Placemark>
+  </Folder>
+  <Placemark>
+   <name>Path</name>
+   <LineString><coordinates>
+     2.0,48.0,10 2.1,48.1
+   </coordinates></LineString>
+  </Placemark>
+  <Placemark><Point><coordinates>2.2,48.2</coordinates></Point></Placemark>
+ </Document>
+</kml>`
+	tracks, err := readKML(strings.NewReader(kml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 3 {
+		t.Fatalf("got %d tracks: %+v", len(tracks), tracks)
+	}
+
+	drive, path, wpts := tracks[0], tracks[1], tracks[2]
+	if path.Kind != KindRoute || path.Name != "Path" || len(path.Points) != 2 {
+		t.Errorf("path = %+v", path)
+	}
+	if path.Points[0].Ele == nil || *path.Points[0].Ele != 10 || path.Points[1].Ele != nil {
+		t.Errorf("path elevation = %+v", path.Points)
+	}
+	if drive.Kind != KindTrack || len(drive.Points) != 2 {
+		t.Fatalf("drive = %+v", drive)
+	}
+	if drive.Points[1].Lat != 48.8570 || !drive.Points[1].Time.Equal(time.Date(2024, 6, 15, 10, 1, 0, 0, time.UTC)) {
+		t.Errorf("drive point = %+v", drive.Points[1])
+	}
+	if wpts.Kind != KindWaypoint || wpts.Points[0].Lon != 2.2 {
+		t.Errorf("waypoints = %+v", wpts)
+	}
+}
+
+func TestReadKML_RejectsOtherXML(t *testing.T) {
+	if _, err := readKML(strings.NewReader(`<gpx></gpx>`)); err == nil {
+		t.Error("expected error for non-KML root")
+	}
+}
+
+func TestReadGeoJSON(t *testing.T) {
+	doc := `{
+  "type": "FeatureCollection",
+  "features": [
+    {"type": "Feature",
+     "properties": {"name": "Ride", "coordTimes": ["2024-06-15T10:00:00Z", "2024-06-15T10:01:00Z"]},
+     "geometry": {"type": "LineString", "coordinates": [[2.35, 48.85, 30], [2.36, 48.86, 31]]}},
+    {"type": "Feature", "properties": {},
+     "geometry": {"type": "MultiLineString", "coordinates": [[[1, 2], [3, 4]], [[5, 6], [7, 8]]]}},
+    {"type": "Feature", "properties": {"time": "2024-06-15T11:00:00Z"},
+     "geometry": {"type": "Point", "coordinates": [2.4, 48.9]}}
+  ]
+}`
+	tracks, err := readGeoJSON(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 4 {
+		t.Fatalf("got %d tracks: %+v", len(tracks), tracks)
+	}
+	ride := tracks[0]
+	if ride.Kind != KindTrack || ride.Name != "Ride" || ride.Points[1].Time.IsZero() {
+		t.Errorf("ride = %+v", ride)
+	}
+	if ride.Points[0].Lat != 48.85 || ride.Points[0].Ele == nil || *ride.Points[0].Ele != 30 {
+		t.Errorf("position must be [lon, lat, ele]: %+v", ride.Points[0])
+	}
+	if tracks[1].Kind != KindRoute || tracks[2].Kind != KindRoute {
+		t.Errorf("untimed lines should be routes: %+v", tracks[1:3])
+	}
+	if wp := tracks[3]; wp.Kind != KindWaypoint || wp.Points[0].Time.IsZero() {
+		t.Errorf("waypoint = %+v", wp)
+	}
+}
+
+func TestReadTCX(t *testing.T) {
+	tcx := `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+ <Activities>
+  <Activity Sport="Biking">
+   <Id>2024-06-15T10:00:00Z</Id>
+   <Lap StartTime="2024-06-15T10:00:00Z">
+    <Track>
+     <Trackpoint>
+      <Time>2024-06-15T10:00:00Z</Time>
+      <Position><LatitudeDegrees>45.0</LatitudeDegrees><LongitudeDegrees>6.0</LongitudeDegrees></Position>
+      <AltitudeMeters>812.4</AltitudeMeters>
+     </Trackpoint>
+     <Trackpoint><Time>2024-06-15T10:00:01Z</Time><HeartRateBpm><Value>120</Value></HeartRateBpm></Trackpoint>
+     <Trackpoint>
+      <Time>2024-06-15T10:00:02Z</Time>
+      <Position><LatitudeDegrees>45.001</LatitudeDegrees><LongitudeDegrees>6.001</LongitudeDegrees></Position>
+     </Trackpoint>
+    </Track>
+   </Lap>
+   <Creator><Name>Edge 530</Name></Creator>
+  </Activity>
+ </Activities>
+ <Courses>
+  <Course><Name>Col</Name><Track><Trackpoint>
+   <Position><LatitudeDegrees>45.1</LatitudeDegrees><LongitudeDegrees>6.1</LongitudeDegrees></Position>
+  </Trackpoint></Track></Course>
+ </Courses>
+</TrainingCenterDatabase>`
+	tracks, err := readTCX(strings.NewReader(tcx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks: %+v", len(tracks), tracks)
+	}
+	act := tracks[0]
+	if act.Name != "" || len(act.Points) != 2 {
+		t.Errorf("activity = %+v (position-less point should be skipped)", act)
+	}
+	if act.Points[0].Ele == nil || *act.Points[0].Ele != 812.4 || act.Points[0].Time.IsZero() {
+		t.Errorf("first point = %+v", act.Points[0])
+	}
+	if tracks[1].Name != "Col" {
+		t.Errorf("course name = %q", tracks[1].Name)
+	}
+}
+
+// fitBuilder assembles a minimal FIT file for tests.
+type fitBuilder struct{ buf bytes.Buffer }
+
+func (b *fitBuilder) define(local byte, global uint16, fields ...[2]byte) {
+	b.buf.WriteByte(0x40 | local)
+	b.buf.Write([]byte{0, 0}) // reserved, little-endian
+	binary.Write(&b.buf, binary.LittleEndian, global)
+	b.buf.WriteByte(byte(len(fields)))
+	for _, f := range fields {
+		b.buf.Write([]byte{f[0], f[1], 0x86})
+	}
+}
+
+func (b *fitBuilder) data(header byte, values ...any) {
+	b.buf.WriteByte(header)
+	for _, v := range values {
+		binary.Write(&b.buf, binary.LittleEndian, v)
+	}
+}
+
+func (b *fitBuilder) bytes() []byte {
+	hdr := make([]byte, 14)
+	hdr[0] = 14
+	hdr[1] = 0x20
+	binary.LittleEndian.PutUint16(hdr[2:], 2132)
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(b.buf.Len()))
+	copy(hdr[8:], ".FIT")
+	return append(append(hdr, b.buf.Bytes()...), 0, 0) // trailing CRC
+}
+
+func degreesToSemicircles(d float64) int32 {
+	return int32(math.Round(d * (1 << 31) / 180))
+}
+
+func TestReadFIT(t *testing.T) {
+	var b fitBuilder
+	// file_id message (global 0), skipped.
+	b.define(0, 0, [2]byte{4, 4})
+	b.data(0x00, uint32(12345))
+	// record: timestamp, lat, long, enhanced_altitude
+	b.define(1, fitMsgRecord, [2]byte{253, 4}, [2]byte{0, 4}, [2]byte{1, 4}, [2]byte{78, 4})
+	ts := uint32(time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC).Sub(fitEpoch) / time.Second)
+	b.data(0x01, ts, degreesToSemicircles(45.5), degreesToSemicircles(6.25), uint32((812+500)*5))
+	// A record without a GPS fix.
+	b.data(0x01, ts+1, uint32(fitInvalidSint32), uint32(fitInvalidSint32), uint32(fitInvalidUint32))
+	// record with compressed timestamp (local 2): lat, long only.
+	b.define(2, fitMsgRecord, [2]byte{0, 4}, [2]byte{1, 4})
+	b.data(0x80|2<<5|byte((ts+3)&0x1F), degreesToSemicircles(45.6), degreesToSemicircles(6.3))
+
+	tracks, err := readFIT(bytes.NewReader(b.bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || len(tracks[0].Points) != 2 {
+		t.Fatalf("tracks = %+v", tracks)
+	}
+	first, second := tracks[0].Points[0], tracks[0].Points[1]
+	if math.Abs(first.Lat-45.5) > 1e-6 || math.Abs(first.Lon-6.25) > 1e-6 {
+		t.Errorf("first = %+v", first)
+	}
+	if want := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC); !first.Time.Equal(want) {
+		t.Errorf("first time = %v, want %v", first.Time, want)
+	}
+	if first.Ele == nil || *first.Ele != 812 {
+		t.Errorf("first ele = %v", first.Ele)
+	}
+	if want := time.Date(2024, 6, 15, 10, 0, 3, 0, time.UTC); !second.Time.Equal(want) {
+		t.Errorf("compressed timestamp = %v, want %v", second.Time, want)
+	}
+
+	// Padding after the last file is not another file.
+	padded := append(b.bytes(), 0, 0, 0, 0)
+	if tracks, err := readFIT(bytes.NewReader(padded)); err != nil || len(tracks) != 1 {
+		t.Errorf("padded file: tracks = %d, err = %v", len(tracks), err)
+	}
+}
+
+func TestReadFIT_Invalid(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":     {},
+		"not fit":   []byte("this is definitely not a FIT file"),
+		"truncated": append([]byte{14, 0x20, 0, 0, 0xFF, 0, 0, 0}, ".FIT\x00\x00"...),
+	} {
+		if _, err := readFIT(bytes.NewReader(data)); err == nil && name != "empty" {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package geo
+
+import "math"
+
+// MaxZoom is the highest web-map zoom level accepted by [ToleranceForZoom].
+const MaxZoom = 22
+
+// ToleranceForZoom returns the Douglas-Peucker tolerance, in degrees,
+// matching one 256px web-map tile pixel at the given zoom level. Vertices
+// closer than that to the simplified line are invisible when drawn.
+func ToleranceForZoom(zoom int) float64 {
+	zoom = max(0, min(zoom, MaxZoom))
+	return 360.0 / float64(int64(256)<<zoom)
+}
+
+// Simplify reduces a polyline with the Douglas-Peucker algorithm, keeping
+// every vertex farther than epsilon degrees from the simplified line.
+// Distances are measured on an equirectangular projection scaled at the
+// polyline's mean latitude, which is accurate enough at track scale. The
+// first and last points are always kept and the input is not modified.
+func Simplify(points []Trackpoint, epsilon float64) []Trackpoint {
+	if len(points) <= 2 || epsilon <= 0 {
+		return append([]Trackpoint(nil), points...)
+	}
+
+	var sumLat float64
+	for _, p := range points {
+		sumLat += p.Lat
+	}
+	lonScale := math.Cos(sumLat / float64(len(points)) * math.Pi / 180)
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	// Iterative to stay safe on very long tracks.
+	type span struct{ first, last int }
+	stack := []span{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		sp := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		maxDist, maxIdx := 0.0, -1
+		for i := sp.first + 1; i < sp.last; i++ {
+			d := segmentDistance(points[i], points[sp.first], points[sp.last], lonScale)
+			if d > maxDist {
+				maxDist, maxIdx = d, i
+			}
+		}
+		if maxIdx >= 0 && maxDist > epsilon {
+			keep[maxIdx] = true
+			stack = append(stack, span{sp.first, maxIdx}, span{maxIdx, sp.last})
+		}
+	}
+
+	out := make([]Trackpoint, 0, len(points))
+	for i, k := range keep {
+		if k {
+			out = append(out, points[i])
+		}
+	}
+	return out
+}
+
+// segmentDistance returns the distance from p to the segment a-b in
+// projected degrees.
+func segmentDistance(p, a, b Trackpoint, lonScale float64) float64 {
+	px, py := p.Lon*lonScale, p.Lat
+	ax, ay := a.Lon*lonScale, a.Lat
+	bx, by := b.Lon*lonScale, b.Lat
+
+	dx, dy := bx-ax, by-ay
+	if dx == 0 && dy == 0 {
+		return math.Hypot(px-ax, py-ay)
+	}
+	t := ((px-ax)*dx + (py-ay)*dy) / (dx*dx + dy*dy)
+	t = max(0, min(1, t))
+	return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
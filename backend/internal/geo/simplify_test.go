@@ -0,0 +1,59 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimplify_DropsCollinearPoints(t *testing.T) {
+	pts := []Trackpoint{
+		{Lat: 0, Lon: 0},
+		{Lat: 0, Lon: 1},
+		{Lat: 0, Lon: 2},
+		{Lat: 0, Lon: 3},
+	}
+	got := Simplify(pts, 0.001)
+	if len(got) != 2 || got[0].Lon != 0 || got[1].Lon != 3 {
+		t.Errorf("got %+v, want endpoints only", got)
+	}
+}
+
+func TestSimplify_KeepsSignificantVertex(t *testing.T) {
+	pts := []Trackpoint{
+		{Lat: 0, Lon: 0},
+		{Lat: 0.5001, Lon: 1}, // on the way to the corner
+		{Lat: 1, Lon: 2},      // a real corner
+		{Lat: 0, Lon: 4},
+	}
+	got := Simplify(pts, 0.01)
+	if len(got) != 3 {
+		t.Fatalf("got %d points, want 3: %+v", len(got), got)
+	}
+	if got[1].Lat != 1 || got[1].Lon != 2 {
+		t.Errorf("corner not kept: %+v", got[1])
+	}
+}
+
+func TestSimplify_ZeroEpsilonCopies(t *testing.T) {
+	pts := []Trackpoint{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 1}, {Lat: 0, Lon: 2}}
+	got := Simplify(pts, 0)
+	if len(got) != 3 {
+		t.Errorf("got %d points, want 3", len(got))
+	}
+	got[0].Lat = 9
+	if pts[0].Lat != 0 {
+		t.Error("input was modified")
+	}
+}
+
+func TestToleranceForZoom(t *testing.T) {
+	if got := ToleranceForZoom(0); math.Abs(got-360.0/256) > 1e-12 {
+		t.Errorf("zoom 0 = %v", got)
+	}
+	if ToleranceForZoom(10) >= ToleranceForZoom(9) {
+		t.Error("tolerance should shrink as zoom grows")
+	}
+	if ToleranceForZoom(99) != ToleranceForZoom(MaxZoom) {
+		t.Error("zoom should be clamped to MaxZoom")
+	}
+}
@@ -0,0 +1,98 @@
+package geo
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+func init() {
+	RegisterReader(".tcx", readTCX)
+}
+
+type tcxTrack struct {
+	Points []tcxTrackpoint `xml:"Trackpoint"`
+}
+
+type tcxTrackpoint struct {
+	Time     string `xml:"Time"`
+	Position *struct {
+		Lat float64 `xml:"LatitudeDegrees"`
+		Lon float64 `xml:"LongitudeDegrees"`
+	} `xml:"Position"`
+	Altitude *float64 `xml:"AltitudeMeters"`
+}
+
+// readTCX reads every <Track> in a Garmin Training Center file, whether
+// under Activities/Activity/Lap or Courses/Course. Trackpoints without a
+// position (indoor laps, sensor-only samples) are skipped.
+func readTCX(r io.Reader) ([]Track, error) {
+	dec := xml.NewDecoder(r)
+	var tracks []Track
+	// Course names precede their Track; activities have no name.
+	var name string
+	var stack []string
+	sawRoot := false
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := tok.(xml.EndElement); ok && len(stack) > 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		parent := ""
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+		if !sawRoot {
+			if se.Name.Local != "TrainingCenterDatabase" {
+				return nil, errors.New("not a TCX document")
+			}
+			sawRoot = true
+		}
+		switch {
+		case se.Name.Local == "Activity" || se.Name.Local == "Course":
+			name = ""
+		case se.Name.Local == "Name" && parent == "Course":
+			if err := dec.DecodeElement(&name, &se); err != nil {
+				return nil, err
+			}
+			continue
+		case se.Name.Local == "Track":
+			var trk tcxTrack
+			if err := dec.DecodeElement(&trk, &se); err != nil {
+				return nil, err
+			}
+			var pts []Trackpoint
+			for _, tp := range trk.Points {
+				if tp.Position == nil {
+					continue
+				}
+				pts = append(pts, Trackpoint{
+					Lat:  tp.Position.Lat,
+					Lon:  tp.Position.Lon,
+					Ele:  tp.Altitude,
+					Time: parseTime(tp.Time),
+				})
+			}
+			if len(pts) > 0 {
+				tracks = append(tracks, Track{Name: name, Kind: KindTrack, Points: pts})
+			}
+			continue
+		}
+		stack = append(stack, se.Name.Local)
+	}
+	if !sawRoot {
+		return nil, errors.New("not a TCX document")
+	}
+	return tracks, nil
+}
@@ -0,0 +1,96 @@
+package geo
+
+import (
+	"sort"
+	"time"
+
+	"github.com/zsefvlol/timezonemapper"
+)
+
+// TimezoneAt returns the IANA time zone covering the given coordinates.
+// The lookup uses an embedded offline boundary table, so it never touches
+// the network. ok is false over open ocean, for invalid coordinates, or
+// when the zone is missing from the local tz database.
+func TimezoneAt(lat, lon float64) (*time.Location, bool) {
+	name := timezonemapper.LatLngToTimezoneString(lat, lon)
+	if name == "" {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, false
+	}
+	return loc, true
+}
+
+// CaptureClock holds the per-album settings used to turn a camera's
+// wall-clock reading into an absolute time.
+type CaptureClock struct {
+	// Location is the zone the camera clock was set to. Nil means the
+	// zone should be inferred from coordinates.
+	Location *time.Location
+
+	// Offset corrects a wrong camera clock and is added to every
+	// capture time before zone resolution.
+	Offset time.Duration
+}
+
+// ResolveCaptureTime converts an EXIF capture time into an absolute time.
+// If hasOffset is true, taken already carries the camera's UTC offset and
+// only the clock correction is applied. Otherwise taken's wall-clock
+// fields are interpreted in the first zone found from:
+//
+//  1. clock.Location (album "timezone" setting)
+//  2. the zone at lat/lon, when both are non-nil
+//  3. the zone at the trackpoint nearest to the wall-clock reading;
+//     a camera is at most ±14h off UTC, so this lands on the right leg
+//     of the trip for all but the shortest of multi-zone tracks
+//  4. the server's local zone
+func ResolveCaptureTime(taken time.Time, hasOffset bool, clock CaptureClock, lat, lon *float64, points []Trackpoint) time.Time {
+	taken = taken.Add(clock.Offset)
+	if hasOffset {
+		return taken
+	}
+
+	loc := clock.Location
+	if loc == nil && lat != nil && lon != nil {
+		loc, _ = TimezoneAt(*lat, *lon)
+	}
+	if loc == nil {
+		wall := InLocation(taken, time.UTC)
+		if pt, ok := NearestPoint(points, wall); ok {
+			loc, _ = TimezoneAt(pt.Lat, pt.Lon)
+		}
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	return InLocation(taken, loc)
+}
+
+// InLocation reinterprets the wall-clock fields of t, ignoring t's own
+// location, as a time in loc.
+func InLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// NearestPoint returns the trackpoint closest in time to t from a sorted
+// slice, with no tolerance applied. ok is false if points is empty.
+func NearestPoint(points []Trackpoint, t time.Time) (Trackpoint, bool) {
+	if len(points) == 0 {
+		return Trackpoint{}, false
+	}
+	idx := sort.Search(len(points), func(i int) bool {
+		return !points[i].Time.Before(t)
+	})
+	switch {
+	case idx == 0:
+		return points[0], true
+	case idx == len(points):
+		return points[idx-1], true
+	case t.Sub(points[idx-1].Time) <= points[idx].Time.Sub(t):
+		return points[idx-1], true
+	default:
+		return points[idx], true
+	}
+}
@@ -0,0 +1,111 @@
+package geo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimezoneAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     string
+	}{
+		{"Paris", 48.8566, 2.3522, "Europe/Paris"},
+		{"New York", 40.7128, -74.0060, "America/New_York"},
+		{"Tokyo", 35.6762, 139.6503, "Asia/Tokyo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, ok := TimezoneAt(tt.lat, tt.lon)
+			if !ok {
+				t.Fatal("expected a zone")
+			}
+			if loc.String() != tt.want {
+				t.Errorf("zone = %q, want %q", loc, tt.want)
+			}
+		})
+	}
+
+	if _, ok := TimezoneAt(200, 0); ok {
+		t.Error("invalid coordinates should not resolve")
+	}
+}
+
+func TestResolveCaptureTime_HasOffset(t *testing.T) {
+	taken := time.Date(2024, 6, 15, 12, 0, 0, 0, time.FixedZone("+02:00", 2*3600))
+	got := ResolveCaptureTime(taken, true, CaptureClock{Location: time.UTC}, nil, nil, nil)
+	if !got.Equal(taken) {
+		t.Errorf("got %v, want %v (offset from EXIF wins)", got, taken)
+	}
+}
+
+func TestResolveCaptureTime_AlbumTimezone(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	wall := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	got := ResolveCaptureTime(wall, false, CaptureClock{Location: tokyo}, nil, nil, nil)
+	want := time.Date(2024, 6, 15, 3, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("got %v, want %v", got.UTC(), want)
+	}
+}
+
+func TestResolveCaptureTime_ClockOffset(t *testing.T) {
+	wall := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	clock := CaptureClock{Location: time.UTC, Offset: -90 * time.Second}
+
+	got := ResolveCaptureTime(wall, false, clock, nil, nil, nil)
+	want := time.Date(2024, 6, 15, 11, 58, 30, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestResolveCaptureTime_InferredFromCoordinates(t *testing.T) {
+	wall := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	lat, lon := 40.7128, -74.0060 // New York, UTC-5 in January
+
+	got := ResolveCaptureTime(wall, false, CaptureClock{}, &lat, &lon, nil)
+	want := time.Date(2024, 1, 15, 17, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("got %v, want %v", got.UTC(), want)
+	}
+}
+
+func TestResolveCaptureTime_InferredFromTrack(t *testing.T) {
+	// A hike in Tokyo (UTC+9): the camera shows 12:00 local time,
+	// the GPX logged 03:00Z.
+	pts := []Trackpoint{
+		{Lat: 35.6762, Lon: 139.6503, Time: time.Date(2024, 6, 15, 2, 0, 0, 0, time.UTC)},
+		{Lat: 35.6800, Lon: 139.6600, Time: time.Date(2024, 6, 15, 4, 0, 0, 0, time.UTC)},
+	}
+	wall := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	got := ResolveCaptureTime(wall, false, CaptureClock{}, nil, nil, pts)
+	want := time.Date(2024, 6, 15, 3, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("got %v, want %v", got.UTC(), want)
+	}
+}
+
+func TestNearestPoint(t *testing.T) {
+	base := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)
+	pts := []Trackpoint{
+		{Lat: 1, Time: base},
+		{Lat: 2, Time: base.Add(10 * time.Minute)},
+	}
+
+	if _, ok := NearestPoint(nil, base); ok {
+		t.Error("empty slice should not match")
+	}
+	if pt, _ := NearestPoint(pts, base.Add(-time.Hour)); pt.Lat != 1 {
+		t.Errorf("before range: lat = %v, want 1", pt.Lat)
+	}
+	if pt, _ := NearestPoint(pts, base.Add(7*time.Minute)); pt.Lat != 2 {
+		t.Errorf("closer to second: lat = %v, want 2", pt.Lat)
+	}
+	if pt, _ := NearestPoint(pts, base.Add(time.Hour)); pt.Lat != 2 {
+		t.Errorf("after range: lat = %v, want 2", pt.Lat)
+	}
+}
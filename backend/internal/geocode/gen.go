@@ -0,0 +1,98 @@
+//go:build ignore
+
+// gen.go regenerates data/cities.tsv.gz from the GeoNames-derived
+// cities.json and admin1.json files published by
+// https://github.com/lutangar/cities.json.
+//
+// Usage:
+//
+//	go run gen.go -cities cities.json -admin1 admin1.json
+//
+// Country names live in data/countries.tsv and are maintained by hand.
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type city struct {
+	Name    string `json:"name"`
+	Lat     string `json:"lat"`
+	Lng     string `json:"lng"`
+	Country string `json:"country"`
+	Admin1  string `json:"admin1"`
+}
+
+type admin1 struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+func main() {
+	citiesPath := flag.String("cities", "cities.json", "path to cities.json")
+	admin1Path := flag.String("admin1", "admin1.json", "path to admin1.json")
+	out := flag.String("out", "data/cities.tsv.gz", "output file")
+	flag.Parse()
+
+	var cities []city
+	readJSON(*citiesPath, &cities)
+	var regions []admin1
+	readJSON(*admin1Path, &regions)
+
+	regionNames := make(map[string]string, len(regions))
+	for _, r := range regions {
+		regionNames[r.Code] = r.Name
+	}
+
+	lines := make([]string, 0, len(cities))
+	for _, c := range cities {
+		lat, err1 := strconv.ParseFloat(c.Lat, 64)
+		lon, err2 := strconv.ParseFloat(c.Lng, 64)
+		if err1 != nil || err2 != nil || c.Name == "" || c.Country == "" {
+			continue
+		}
+		region := regionNames[c.Country+"."+c.Admin1]
+		lines = append(lines, fmt.Sprintf("%.4f\t%.4f\t%s\t%s\t%s",
+			lat, lon, c.Country, clean(region), clean(c.Name)))
+	}
+	// Sorted output keeps regenerated files diff-friendly.
+	sort.Strings(lines)
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	zw, _ := gzip.NewWriterLevel(f, gzip.BestCompression)
+	for _, l := range lines {
+		fmt.Fprintln(zw, l)
+	}
+	if err := zw.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d cities to %s", len(lines), *out)
+}
+
+func readJSON(path string, v any) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		log.Fatalf("%s: %v", path, err)
+	}
+}
+
+func clean(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ").Replace(strings.TrimSpace(s))
+}
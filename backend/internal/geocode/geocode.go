@@ -0,0 +1,171 @@
+// Package geocode resolves coordinates to place names without network
+// access.
+//
+// # Dataset
+//
+// The package embeds a trimmed copy of the GeoNames cities database
+// (populated places with 1000+ inhabitants, via lutangar/cities.json),
+// with first-level administrative division names folded in, plus a
+// hand-maintained country name table. The data is licensed CC BY 3.0 by
+// GeoNames (https://www.geonames.org/); see ATTRIBUTIONS.md. gen.go
+// regenerates data/cities.tsv.gz from upstream.
+//
+// # Lookup
+//
+// The dataset is decompressed and indexed on first use into a grid of
+// one-degree cells. [Lookup] scans the cells around the query point and
+// returns the nearest populated place, so the answer for a remote
+// location is the closest town, not the administrative area the point
+// falls in. Points farther than [MaxDistanceKm] from any place (open
+// ocean, polar regions) are reported as unresolved.
+package geocode
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/perrito666/gollery/backend/internal/domain"
+)
+
+// MaxDistanceKm is the largest distance between a point and the nearest
+// known place for which [Lookup] still reports a match.
+const MaxDistanceKm = 100
+
+const earthRadiusKm = 6371.0
+
+//go:embed data/cities.tsv.gz
+var citiesGz []byte
+
+//go:embed data/countries.tsv
+var countriesTSV string
+
+type city struct {
+	lat, lon float64
+	place    *domain.Place
+}
+
+type cellKey struct{ lat, lon int }
+
+var (
+	loadOnce sync.Once
+	grid     map[cellKey][]city
+)
+
+// Lookup returns the nearest known place to the given coordinates.
+// ok is false for invalid coordinates or when nothing lies within
+// [MaxDistanceKm].
+func Lookup(lat, lon float64) (domain.Place, bool) {
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return domain.Place{}, false
+	}
+	loadOnce.Do(load)
+
+	// One degree of latitude is ~111km everywhere; a degree of longitude
+	// shrinks with the cosine of the latitude, so widen the scan there.
+	latSpan := int(math.Ceil(MaxDistanceKm / 111.0))
+	lonSpan := 180
+	if c := math.Cos(toRad(math.Min(math.Abs(lat)+float64(latSpan), 90))); c > 0.01 {
+		lonSpan = min(int(math.Ceil(MaxDistanceKm/(111.0*c))), 180)
+	}
+
+	center := cellFor(lat, lon)
+	var best *city
+	bestDist := math.Inf(1)
+	for dlat := -latSpan; dlat <= latSpan; dlat++ {
+		for dlon := -lonSpan; dlon <= lonSpan; dlon++ {
+			key := cellKey{center.lat + dlat, wrapLon(center.lon + dlon)}
+			for i := range grid[key] {
+				c := &grid[key][i]
+				if d := distanceKm(lat, lon, c.lat, c.lon); d < bestDist {
+					best, bestDist = c, d
+				}
+			}
+		}
+	}
+	if best == nil || bestDist > MaxDistanceKm {
+		return domain.Place{}, false
+	}
+	return *best.place, true
+}
+
+func load() {
+	grid = make(map[cellKey][]city)
+
+	countries := make(map[string]string)
+	for _, line := range strings.Split(countriesTSV, "\n") {
+		code, name, ok := strings.Cut(line, "\t")
+		if ok {
+			countries[code] = name
+		}
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(citiesGz))
+	if err != nil {
+		slog.Error("geocode: corrupt embedded dataset", "error", err)
+		return
+	}
+	defer zr.Close()
+
+	// Many cities share a region; intern region strings to keep the
+	// resident set small.
+	interned := make(map[string]string)
+	intern := func(s string) string {
+		if v, ok := interned[s]; ok {
+			return v
+		}
+		interned[s] = s
+		return s
+	}
+
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), "\t")
+		if len(fields) != 5 {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(fields[0], 64)
+		lon, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		cc := intern(fields[2])
+		p := &domain.Place{
+			City:        fields[4],
+			Region:      intern(fields[3]),
+			Country:     intern(countries[cc]),
+			CountryCode: cc,
+		}
+		key := cellFor(lat, lon)
+		grid[key] = append(grid[key], city{lat: lat, lon: lon, place: p})
+	}
+	if err := sc.Err(); err != nil {
+		slog.Error("geocode: reading embedded dataset", "error", err)
+	}
+}
+
+func cellFor(lat, lon float64) cellKey {
+	return cellKey{int(math.Floor(lat)), wrapLon(int(math.Floor(lon)))}
+}
+
+// wrapLon folds a longitude cell index into [-180, 180) so scans across
+// the antimeridian find places on the other side.
+func wrapLon(l int) int {
+	return ((l+180)%360+360)%360 - 180
+}
+
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(math.Min(a, 1)))
+}
+
+func toRad(deg float64) float64 { return deg * math.Pi / 180 }
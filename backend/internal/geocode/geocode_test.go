@@ -0,0 +1,79 @@
+package geocode
+
+import "testing"
+
+func TestLookup_KnownCities(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		city     string
+		cc       string
+		country  string
+	}{
+		{"paris", 48.8566, 2.3522, "Paris", "FR", "France"},
+		{"buenos aires", -34.6037, -58.3816, "Buenos Aires", "AR", "Argentina"},
+		{"tokyo", 35.6895, 139.6917, "Tokyo", "JP", "Japan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := Lookup(tt.lat, tt.lon)
+			if !ok {
+				t.Fatal("expected a match")
+			}
+			if p.City != tt.city || p.CountryCode != tt.cc || p.Country != tt.country {
+				t.Errorf("got %+v", p)
+			}
+		})
+	}
+}
+
+func TestLookup_Region(t *testing.T) {
+	p, ok := Lookup(40.7128, -74.0060) // New York City
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if p.Region != "New York" || p.CountryCode != "US" {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestLookup_AcrossAntimeridian(t *testing.T) {
+	// Just east of the antimeridian, nearest places are in Fiji.
+	p, ok := Lookup(-16.80, 179.99)
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if p.CountryCode != "FJ" {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestLookup_Unresolved(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+	}{
+		{"mid pacific", 0, -140},
+		{"south pole", -90, 0},
+		{"invalid lat", 91, 0},
+		{"invalid lon", 0, 181},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if p, ok := Lookup(tt.lat, tt.lon); ok {
+				t.Errorf("expected no match, got %+v", p)
+			}
+		})
+	}
+}
+
+func TestWrapLon(t *testing.T) {
+	tests := []struct{ in, want int }{
+		{0, 0}, {179, 179}, {180, -180}, {181, -179}, {-181, 179}, {-180, -180},
+	}
+	for _, tt := range tests {
+		if got := wrapLon(tt.in); got != tt.want {
+			t.Errorf("wrapLon(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
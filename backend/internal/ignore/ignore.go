@@ -0,0 +1,327 @@
+// Package ignore matches content paths against .galleryignore files.
+//
+// # Syntax
+//
+// A .galleryignore file holds gitignore-style patterns, one per line,
+// applying to the directory it is in and everything below it:
+//
+//   - Blank lines and lines starting with "#" are skipped; "\#" and "\!"
+//     escape a leading "#" or "!". Trailing spaces are dropped.
+//   - "*", "?" and "[...]" match within one path element, as in
+//     [path.Match]; "**" matches any number of elements.
+//   - A pattern with a "/" at the start or in the middle is matched
+//     against the path relative to the file's directory; one without is
+//     matched against the name of an entry at any depth.
+//   - A trailing "/" matches directories only.
+//   - A leading "!" re-includes what an earlier pattern ignored.
+//
+// The last pattern that matches decides, and patterns in a deeper file
+// override those above it. As with git, nothing below an ignored
+// directory can be re-included, since walkers never enter it.
+//
+// # Walking
+//
+// [Rules] are loaded one directory at a time, each chained to its
+// parent's, so that walkers read every ignore file once. [WalkDir] does
+// this for [filepath.WalkDir]-style walks, and [WalkDirFollow] for walks
+// that follow symbolic links; the scanner, which reads directories
+// concurrently, threads them itself.
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileName is the name of ignore files.
+const FileName = ".galleryignore"
+
+// Rules are the patterns in effect in one directory: those of its
+// .galleryignore and of its ancestors'. A nil *Rules ignores nothing.
+type Rules struct {
+	parent   *Rules
+	dir      string // relative to the content root, "" for the root
+	source   []byte
+	patterns []pattern
+}
+
+type pattern struct {
+	elems   []string
+	negate  bool
+	dirOnly bool
+}
+
+// Load returns the rules in effect in the directory absDir, at relPath
+// below the content root, given those in effect in its parent (nil for
+// the root). Without a .galleryignore in absDir it returns parent. When
+// the file cannot be read, or some of its patterns are malformed, the
+// error is returned together with the rules that could be loaded.
+func Load(absDir, relPath string, parent *Rules) (*Rules, error) {
+	data, err := os.ReadFile(filepath.Join(absDir, FileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return parent, nil
+	}
+	if err != nil {
+		return parent, err
+	}
+	r := &Rules{parent: parent, dir: relPath, source: data}
+	var errs []error
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		p, ok, err := parse(sc.Text())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s line %d: %w", FileName, n, err))
+			continue
+		}
+		if ok {
+			r.patterns = append(r.patterns, p)
+		}
+	}
+	return r, errors.Join(errs...)
+}
+
+// For returns the rules in effect in the directory at relPath below
+// root, loading the ignore files of root and of every directory down to
+// relPath. Errors are returned as by [Load], the first one met.
+func For(root, relPath string) (*Rules, error) {
+	r, firstErr := Load(root, "", nil)
+	if relPath == "" {
+		return r, firstErr
+	}
+	cur := ""
+	for _, elem := range strings.Split(relPath, string(filepath.Separator)) {
+		cur = filepath.Join(cur, elem)
+		var err error
+		r, err = Load(filepath.Join(root, cur), cur, r)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return r, firstErr
+}
+
+// parse reads one line of an ignore file. ok is false for lines that
+// hold no pattern.
+func parse(line string) (p pattern, ok bool, err error) {
+	line = strings.TrimSuffix(line, "\r")
+	if !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return p, false, nil
+	}
+	p.elems = strings.Split(line, "/")
+	if !anchored {
+		p.elems = append([]string{"**"}, p.elems...)
+	}
+	for _, e := range p.elems {
+		if _, err := path.Match(e, ""); err != nil {
+			return p, false, fmt.Errorf("%q: %w", line, err)
+		}
+	}
+	return p, true, nil
+}
+
+// Match reports whether the entry at relPath, relative to the content
+// root, is ignored. isDir tells whether it is a directory. Only the entry
+// itself is matched: a walker that skips ignored directories never asks
+// about what is below them.
+func (r *Rules) Match(relPath string, isDir bool) bool {
+	for ; r != nil; r = r.parent {
+		rest := relPath
+		if r.dir != "" {
+			var ok bool
+			rest, ok = strings.CutPrefix(relPath, r.dir+string(filepath.Separator))
+			if !ok {
+				continue
+			}
+		}
+		elems := strings.Split(rest, string(filepath.Separator))
+		for i := len(r.patterns) - 1; i >= 0; i-- {
+			p := r.patterns[i]
+			if p.dirOnly && !isDir {
+				continue
+			}
+			if matchElems(p.elems, elems) {
+				return !p.negate
+			}
+		}
+	}
+	return false
+}
+
+// Equal reports whether r and o come from the same ignore file, with the
+// same contents. Their parents are not compared.
+func (r *Rules) Equal(o *Rules) bool {
+	if r == nil || o == nil {
+		return r == o
+	}
+	return r.dir == o.dir && bytes.Equal(r.source, o.source)
+}
+
+// matchElems matches path elements against pattern elements, where "**"
+// matches any number of elements, or at least one at the end of the
+// pattern ("dir/**" matches what is inside dir, not dir itself).
+func matchElems(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			if len(pat) == 1 {
+				return len(name) > 0
+			}
+			for i := range len(name) + 1 {
+				if matchElems(pat[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// WalkDir walks the directory dir of the content tree at root like
+// [filepath.WalkDir], but skips the entries ignored by the .galleryignore
+// files of dir, its ancestors up to root and the directories below it.
+// Pass root as dir to walk the whole tree. Ignore files that cannot be
+// read are treated as empty; hidden entries are left to fn.
+func WalkDir(root, dir string, fn fs.WalkDirFunc) error {
+	return WalkDirFollow(root, dir, nil, fn)
+}
+
+// FollowFunc resolves the symbolic link at relPath below the content
+// root, returning the info of its target or an error when it is not to
+// be followed.
+type FollowFunc func(relPath string) (fs.FileInfo, error)
+
+// WalkDirFollow is like [WalkDir], but the symbolic links for which
+// follow succeeds are walked as what they point to, under their own
+// path. Links it rejects, and all links when follow is nil, are passed to
+// fn as they are. follow must reject links that would make the walk
+// endless.
+func WalkDirFollow(root, dir string, follow FollowFunc, fn fs.WalkDirFunc) error {
+	start, err := rel(root, dir)
+	if err != nil {
+		return err
+	}
+	var parent *Rules
+	if start != "" {
+		parent, _ = For(root, parentDir(start))
+		if parent.Match(start, true) {
+			return nil
+		}
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		err = fn(dir, nil, err)
+	} else {
+		err = walk(root, dir, start, resolveLink(info, start, follow), parent, follow, fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walk is filepath.WalkDir's walk, with ignore rules and links. parent
+// holds the rules in effect in the directory containing absPath.
+func walk(root, absPath, relPath string, d fs.DirEntry, parent *Rules, follow FollowFunc, fn fs.WalkDirFunc) error {
+	if !d.IsDir() {
+		return fn(absPath, d, nil)
+	}
+	rules, _ := Load(absPath, relPath, parent)
+	if err := fn(absPath, d, nil); err != nil {
+		if err == fs.SkipDir {
+			err = nil
+		}
+		return err
+	}
+	entries, err := os.ReadDir(absPath)
+	if err != nil {
+		if err := fn(absPath, d, err); err != nil {
+			if err == fs.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, e := range entries {
+		childRel := filepath.Join(relPath, e.Name())
+		if e.Type()&fs.ModeSymlink != 0 && follow != nil {
+			if info, err := e.Info(); err == nil {
+				e = resolveLink(info, childRel, follow)
+			}
+		}
+		if rules.Match(childRel, e.IsDir()) {
+			continue
+		}
+		if err := walk(root, filepath.Join(absPath, e.Name()), childRel, e, rules, follow, fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveLink returns the entry for info at relPath: that of the link's
+// target if info is a link follow accepts, else info's own.
+func resolveLink(info fs.FileInfo, relPath string, follow FollowFunc) fs.DirEntry {
+	if info.Mode()&fs.ModeSymlink != 0 && follow != nil {
+		if target, err := follow(relPath); err == nil {
+			return fs.FileInfoToDirEntry(target)
+		}
+	}
+	return fs.FileInfoToDirEntry(info)
+}
+
+// rel returns absPath relative to root, with root itself as "".
+func rel(root, absPath string) (string, error) {
+	r, err := filepath.Rel(root, absPath)
+	if err != nil {
+		return "", err
+	}
+	if r == "." {
+		return "", nil
+	}
+	return r, nil
+}
+
+// parentDir returns the relative path of relPath's parent directory,
+// with the content root as "".
+func parentDir(relPath string) string {
+	parent := filepath.Dir(relPath)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
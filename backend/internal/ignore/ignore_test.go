@@ -0,0 +1,216 @@
+package ignore
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeIgnore(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	root := t.TempDir()
+	writeIgnore(t, root, strings.Join([]string{
+		"# comment",
+		"",
+		"_rejects",
+		"exports/",
+		"*.tmp.jpg",
+		"/top.jpg",
+		"a/**/deep",
+		"Lightroom/**",
+		"!keep.tmp.jpg",
+		`\#hash.jpg`,
+	}, "\n"))
+	writeIgnore(t, filepath.Join(root, "sub"), "!_rejects\n*.png\n")
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"_rejects", true, true},
+		{filepath.Join("x", "_rejects"), true, true},
+		{"exports", true, true},
+		{"exports", false, false}, // directories only
+		{"photo.tmp.jpg", false, true},
+		{filepath.Join("x", "photo.tmp.jpg"), false, true},
+		{"keep.tmp.jpg", false, false},
+		{"top.jpg", false, true},
+		{filepath.Join("x", "top.jpg"), false, false}, // anchored
+		{filepath.Join("a", "deep"), true, true},
+		{filepath.Join("a", "b", "c", "deep"), true, true},
+		{"Lightroom", true, false},
+		{filepath.Join("Lightroom", "previews"), true, true},
+		{"#hash.jpg", false, true},
+		{"photo.jpg", false, false},
+		// Patterns of the deeper file come first.
+		{filepath.Join("sub", "_rejects"), true, false},
+		{filepath.Join("sub", "a.png"), false, true},
+		{"a.png", false, false},
+	}
+	rules, err := For(root, "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootRules, _ := For(root, "")
+	for _, tt := range tests {
+		r := rootRules
+		if strings.HasPrefix(tt.path, "sub") {
+			r = rules
+		}
+		if got := r.Match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+
+	var none *Rules
+	if none.Match("anything", false) {
+		t.Error("nil rules should ignore nothing")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	parent := &Rules{}
+	r, err := Load(dir, "", parent)
+	if err != nil || r != parent {
+		t.Fatalf("without a file: %v, %v", r, err)
+	}
+
+	writeIgnore(t, dir, "good\n[bad\n")
+	r, err = Load(dir, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("err = %v, want an error for line 2", err)
+	}
+	if !r.Match("good", false) {
+		t.Error("valid patterns should still apply")
+	}
+
+	same, _ := Load(dir, "", parent)
+	if !r.Equal(same) {
+		t.Error("rules from the same file should be equal")
+	}
+	writeIgnore(t, dir, "other\n")
+	other, _ := Load(dir, "", nil)
+	if r.Equal(other) || r.Equal(nil) {
+		t.Error("rules from different files should differ")
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	root := t.TempDir()
+	for _, f := range []string{"a/one.jpg", "a/one.tmp.jpg", "_rejects/x.jpg", "b/c/two.jpg", "b/c/skip/three.jpg"} {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeIgnore(t, root, "_rejects\n*.tmp.jpg\n")
+	writeIgnore(t, filepath.Join(root, "b"), "skip/\n")
+
+	walk := func(dir string) []string {
+		var got []string
+		err := WalkDir(root, dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Name() == FileName {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, path)
+			got = append(got, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	want := []string{".", "a", "a/one.jpg", "b", "b/c", "b/c/two.jpg"}
+	if got := walk(root); !slices.Equal(got, want) {
+		t.Errorf("WalkDir(root) = %v, want %v", got, want)
+	}
+	// A subtree is walked with its ancestors' rules.
+	if got := walk(filepath.Join(root, "b", "c")); !slices.Equal(got, []string{"b/c", "b/c/two.jpg"}) {
+		t.Errorf("WalkDir(b/c) = %v", got)
+	}
+	if got := walk(filepath.Join(root, "_rejects")); got != nil {
+		t.Errorf("WalkDir of an ignored directory = %v, want nothing", got)
+	}
+}
+
+func TestWalkDirFollow(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "content")
+	for _, f := range []string{"a/one.jpg", "../nas/trip/two.jpg", "../nas/trip/skip.tmp.jpg"} {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeIgnore(t, root, "*.tmp.jpg\n")
+	if err := os.Symlink(filepath.Join(base, "nas", "trip"), filepath.Join(root, "trip")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "nas"), filepath.Join(root, "nas")); err != nil {
+		t.Fatal(err)
+	}
+	follow := func(relPath string) (fs.FileInfo, error) {
+		if relPath != "trip" {
+			return nil, fs.ErrPermission
+		}
+		return os.Stat(filepath.Join(root, relPath))
+	}
+
+	walk := func(follow FollowFunc) []string {
+		var got []string
+		err := WalkDirFollow(root, root, follow, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Name() == FileName {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, path)
+			if d.Type()&fs.ModeSymlink != 0 {
+				rel += "@"
+			}
+			got = append(got, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	want := []string{".", "a", "a/one.jpg", "nas@", "trip@"}
+	if got := walk(nil); !slices.Equal(got, want) {
+		t.Errorf("without following = %v, want %v", got, want)
+	}
+	// Followed links are walked under their own path, with the rules of
+	// the directory they are in.
+	want = []string{".", "a", "a/one.jpg", "nas@", "trip", "trip/two.jpg"}
+	if got := walk(follow); !slices.Equal(got, want) {
+		t.Errorf("following = %v, want %v", got, want)
+	}
+}
@@ -11,9 +11,17 @@
 //     create the album's stable ID from the sidecar file.
 //  2. For each asset, it calls [state.EnsureAssetID] similarly, and loads
 //     any per-asset ACL overrides from the sidecar.
-//  3. It assembles [domain.Album] and [domain.Asset] objects and stores
+//  3. New files whose content matches an asset that vanished (a rename or
+//     a move) take over that asset's sidecar, and so its ID; see
+//     [Builder.RenameWindow]. Before that, new albums holding the files of
+//     an album that vanished take over its state, for state that does not
+//     move with the directory.
+//  4. It assembles [domain.Album] and [domain.Asset] objects and stores
 //     them in the snapshot's Albums map (keyed by relative path).
 //
+// Albums and then assets are processed by a bounded pool of workers (see
+// [Builder]); the resulting snapshot is the same for any number of workers.
+//
 // # Memory model
 //
 // The resulting Snapshot is a fully self-contained, read-only data structure.
@@ -22,186 +30,441 @@
 // reads (all API requests) take the read lock, while re-indexing takes the
 // write lock to swap in a new Snapshot.
 //
-// There is no incremental update mechanism. Every re-index rebuilds the
-// full Snapshot from a fresh filesystem scan. This is simple and avoids
-// consistency issues but means rebuild time is proportional to the total
-// number of albums and assets.
+// [UpdateSnapshot] is the incremental counterpart: given the albums an
+// [fswalk.Rescan] reported as changed, it rebuilds only those into a copy
+// of the previous Snapshot and shares every other album with it. Snapshots
+// are never modified by a rebuild, so the previous one stays valid for
+// readers until the new one is swapped in.
 //
 // # Sidecar side effects
 //
 // [BuildSnapshot] writes sidecar state files for albums and assets that
-// don't have stable IDs yet. This is the only place the server writes to
-// the content tree (aside from admin-triggered state updates). The writes
-// use temp-file + rename for atomicity.
+// don't have stable IDs yet, and moves the sidecars of renamed or moved
+// files. This is the only place the server writes to the content tree
+// (aside from admin-triggered state updates). The writes use temp-file +
+// rename for atomicity.
 package index
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/perrito666/gollery/backend/internal/config"
 	"github.com/perrito666/gollery/backend/internal/domain"
 	"github.com/perrito666/gollery/backend/internal/fswalk"
 	"github.com/perrito666/gollery/backend/internal/geo"
+	"github.com/perrito666/gollery/backend/internal/geocode"
 	"github.com/perrito666/gollery/backend/internal/meta"
 	"github.com/perrito666/gollery/backend/internal/state"
 )
 
-const gpxTolerance = 30 * time.Second
+// Track matching defaults, overridable per album with gpx_tolerance and
+// gpx_max_gap.
+const (
+	defaultGPXTolerance = 30 * time.Second
+	defaultGPXMaxGap    = time.Duration(-1) // any gap
+)
+
+// GeoMatch sources recorded in the asset sidecar.
+const (
+	geoSourceEXIF   = "exif"
+	geoSourceTrack  = "track"
+	geoSourceManual = "manual"
+)
 
 // BuildSnapshot combines scanner output with sidecar state to produce
 // a point-in-time Snapshot with stable IDs and album hierarchy.
 func BuildSnapshot(contentRoot string, scan *fswalk.ScanResult) (*domain.Snapshot, error) {
-	snap := &domain.Snapshot{
-		GeneratedAt: time.Now(),
-		Albums:      make(map[string]*domain.Album, len(scan.Albums)),
+	return new(Builder).Build(contentRoot, scan)
+}
+
+// UpdateSnapshot rebuilds the albums listed in changed into a copy of prev,
+// dropping those no longer in scan. Other albums are shared with prev,
+// except that their child lists follow the scan.
+func UpdateSnapshot(contentRoot string, prev *domain.Snapshot, scan *fswalk.ScanResult, changed []string) (*domain.Snapshot, error) {
+	return new(Builder).Update(contentRoot, prev, scan, changed)
+}
+
+// albumBuild is an album whose sidecar state and geo inputs are loaded,
+// with its assets still to be built into their slots.
+type albumBuild struct {
+	album   *domain.Album
+	absPath string
+	scanned *fswalk.ScannedAlbum
+	ag      albumGeo
+
+	// arrivals indexes the scanned assets without a sidecar, and orphans
+	// names the sidecars without a scanned file (see [Builder.matchMoves]).
+	arrivals []int
+	orphans  []string
+
+	// fingerprints holds content fingerprints already computed, by asset.
+	fingerprints []string
+
+	mu     sync.Mutex
+	issues []domain.IdentityIssue
+}
+
+func (ab *albumBuild) addIssue(filename, format string, args ...any) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	ab.issues = append(ab.issues, domain.IdentityIssue{
+		AlbumPath: ab.album.Path,
+		Filename:  filename,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// prepareAlbum loads the sidecar state and tracks of a scanned album
+// whose directory is absPath.
+func prepareAlbum(absPath, relPath string, scanned *fswalk.ScannedAlbum) (*albumBuild, error) {
+	// Ensure album has a stable ID. An unparseable state file is moved
+	// aside rather than failing the whole index.
+	albumState, _, err := state.EnsureAlbumID(absPath)
+	var quarantined string
+	if errors.Is(err, state.ErrCorrupt) {
+		slog.Warn("quarantining corrupt album state", "album", relPath, "error", err)
+		if quarantined, err = state.QuarantineAlbumState(absPath); err == nil {
+			albumState, _, err = state.EnsureAlbumID(absPath)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ensuring album ID for %q: %w", relPath, err)
+	}
+
+	// Resolve title and description from config.
+	var title, description string
+	if scanned.Config != nil {
+		title = scanned.Config.Title
+		description = scanned.Config.Description
 	}
 
-	for relPath, scanned := range scan.Albums {
-		absPath := filepath.Join(contentRoot, relPath)
+	// Determine parent path.
+	parentPath := ""
+	if relPath != "" {
+		parentPath = filepath.Dir(relPath)
+		if parentPath == "." {
+			parentPath = ""
+		}
+	}
 
-		// Ensure album has a stable ID.
-		albumState, _, err := state.EnsureAlbumID(absPath)
+	// Parse track files for this album (once, shared across assets).
+	// A malformed file is skipped without discarding the others.
+	var gpxTracks []geo.Track
+	for _, path := range scanned.TrackFiles {
+		tracks, err := geo.ParseTrackFiles([]string{path})
 		if err != nil {
-			return nil, fmt.Errorf("ensuring album ID for %q: %w", relPath, err)
+			slog.Warn("failed to parse track file", "album", relPath, "error", err)
+			continue
 		}
+		gpxTracks = append(gpxTracks, tracks...)
+	}
+	gpxPoints := geo.TimedPoints(gpxTracks)
 
-		// Resolve title and description from config.
-		var title, description string
-		if scanned.Config != nil {
-			title = scanned.Config.Title
-			description = scanned.Config.Description
+	// Album-level fallback coordinates, capture clock and track
+	// matching settings from config.
+	ag := albumGeo{points: gpxPoints, match: matchOptions(scanned.Config)}
+	if scanned.Config != nil {
+		ag.lat = scanned.Config.Latitude
+		ag.lon = scanned.Config.Longitude
+		ag.clock = captureClock(scanned.Config)
+	}
+	if ag.lat != nil && ag.lon != nil {
+		if p, ok := geocode.Lookup(*ag.lat, *ag.lon); ok {
+			ag.place = &p
 		}
+	}
 
-		// Determine parent path.
-		parentPath := ""
-		if relPath != "" {
-			parentPath = filepath.Dir(relPath)
-			if parentPath == "." {
-				parentPath = ""
-			}
+	album := &domain.Album{
+		ID:          albumState.ObjectID,
+		Path:        relPath,
+		Title:       title,
+		Description: description,
+		ParentPath:  parentPath,
+		Children:    scanned.ChildPaths,
+		Assets:      make([]domain.Asset, len(scanned.Assets)),
+		Tracks:      toDomainTracks(gpxTracks),
+		CoverID:     albumState.CoverID,
+		AssetOrder:  albumState.AssetOrder,
+		ChildOrder:  albumState.ChildOrder,
+	}
+	ab := &albumBuild{
+		album:        album,
+		absPath:      absPath,
+		scanned:      scanned,
+		ag:           ag,
+		fingerprints: make([]string, len(scanned.Assets)),
+	}
+	if quarantined != "" {
+		ab.addIssue("", "album state was unparseable; moved to %s and assigned new ID %s", relTo(absPath, quarantined), album.ID)
+	}
+
+	// Find new files and orphaned sidecars, the two sides of a rename.
+	sidecars, err := state.ListAssetStates(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("listing asset states for %q: %w", relPath, err)
+	}
+	hasSidecar := make(map[string]bool, len(sidecars))
+	for _, name := range sidecars {
+		hasSidecar[name] = true
+	}
+	scannedFiles := make(map[string]bool, len(scanned.Assets))
+	for i, sa := range scanned.Assets {
+		scannedFiles[sa.Filename] = true
+		if !hasSidecar[sa.Filename] {
+			ab.arrivals = append(ab.arrivals, i)
+		}
+	}
+	for _, name := range sidecars {
+		if !scannedFiles[name] {
+			ab.orphans = append(ab.orphans, name)
 		}
+	}
+	return ab, nil
+}
+
+// buildAsset loads the i-th asset's stable ID and sidecar state, resolves
+// its coordinates and stores it in the album's i-th slot. Assets of one
+// album touch separate sidecar files, so they can be built concurrently.
+func (ab *albumBuild) buildAsset(i int) error {
+	sa := ab.scanned.Assets[i]
+	ag := ab.ag
+	relPath := ab.album.Path
 
-		// Parse GPX files for this album (once, shared across assets).
-		var gpxPoints []geo.Trackpoint
-		if len(scanned.GPXFiles) > 0 {
-			pts, err := geo.ParseGPXFiles(scanned.GPXFiles)
-			if err != nil {
-				slog.Warn("failed to parse GPX files", "album", relPath, "error", err)
-			} else {
-				gpxPoints = pts
+	assetState, _, err := state.EnsureAssetID(ab.absPath, sa.Filename)
+	if errors.Is(err, state.ErrCorrupt) {
+		slog.Warn("quarantining corrupt asset state", "album", relPath, "file", sa.Filename, "error", err)
+		var quarantined string
+		if quarantined, err = state.QuarantineAssetState(ab.absPath, sa.Filename); err == nil {
+			if assetState, _, err = state.EnsureAssetID(ab.absPath, sa.Filename); err == nil {
+				ab.addIssue(sa.Filename, "asset state was unparseable; moved to %s and assigned new ID %s", relTo(ab.absPath, quarantined), assetState.ObjectID)
 			}
 		}
+	}
+	if err != nil {
+		return fmt.Errorf("ensuring asset ID for %q in %q: %w", sa.Filename, relPath, err)
+	}
 
-		// Album-level fallback coordinates from config.
-		var albumLat, albumLon *float64
-		if scanned.Config != nil {
-			albumLat = scanned.Config.Latitude
-			albumLon = scanned.Config.Longitude
+	// Record the content fingerprint, so a later rename or move can be
+	// matched with this sidecar: on unresolved sidecars, which
+	// resolveCoords saves below anyway, and when the size shows a
+	// recorded one is stale. Resolved sidecars written before
+	// fingerprints existed are not read and rewritten just to add one.
+	stale := assetState.Fingerprint != "" && fingerprintSize(assetState.Fingerprint) != sa.SizeBytes
+	if stale || (!assetState.GeoResolved && fingerprintSize(assetState.Fingerprint) != sa.SizeBytes) {
+		fp := ab.fingerprints[i]
+		if fp == "" {
+			fp, err = fingerprint(filepath.Join(ab.absPath, sa.Filename))
 		}
-
-		// Build assets with stable IDs and resolve coordinates.
-		assets := make([]domain.Asset, 0, len(scanned.Assets))
-		for _, sa := range scanned.Assets {
-			assetState, _, err := state.EnsureAssetID(absPath, sa.Filename)
-			if err != nil {
-				return nil, fmt.Errorf("ensuring asset ID for %q in %q: %w", sa.Filename, relPath, err)
-			}
-			asset := domain.Asset{
-				ID:          assetState.ObjectID,
-				Filename:    sa.Filename,
-				Title:       assetState.Title,
-				Description: assetState.Description,
-				AlbumPath:   relPath,
-				ModTime:     sa.ModTime,
-				SizeBytes:   sa.SizeBytes,
-			}
-			if assetState.AccessOverride != nil {
-				asset.Access = &domain.AccessOverride{
-					View:          assetState.AccessOverride.View,
-					AllowedUsers:  assetState.AccessOverride.AllowedUsers,
-					AllowedGroups: assetState.AccessOverride.AllowedGroups,
+		if err != nil {
+			slog.Warn("fingerprinting failed", "album", relPath, "file", sa.Filename, "error", err)
+		} else {
+			assetState.Fingerprint = fp
+			if assetState.GeoResolved {
+				if err := state.SaveAssetState(ab.absPath, sa.Filename, assetState); err != nil {
+					slog.Warn("failed to save asset fingerprint", "file", sa.Filename, "error", err)
 				}
 			}
+		}
+	}
+	asset := domain.Asset{
+		ID:          assetState.ObjectID,
+		Filename:    sa.Filename,
+		Title:       assetState.Title,
+		Description: assetState.Description,
+		Keywords:    assetState.Keywords,
+		Rating:      assetState.Rating,
+		AlbumPath:   relPath,
+		ModTime:     sa.ModTime,
+		SizeBytes:   sa.SizeBytes,
+	}
+	if assetState.AccessOverride != nil {
+		asset.Access = &domain.AccessOverride{
+			View:          assetState.AccessOverride.View,
+			AllowedUsers:  assetState.AccessOverride.AllowedUsers,
+			AllowedGroups: assetState.AccessOverride.AllowedGroups,
+		}
+	}
 
-			// Resolve GPS coordinates.
-			resolvedLat, resolvedLon := resolveCoords(
-				absPath, sa.Filename, assetState, gpxPoints,
-			)
-
-			if resolvedLat != nil && resolvedLon != nil {
-				asset.Metadata = &domain.ImageMetadata{
-					Latitude:  resolvedLat,
-					Longitude: resolvedLon,
-				}
-			} else if albumLat != nil && albumLon != nil {
-				// Album-level fallback (not persisted to asset sidecar).
-				lat, lon := *albumLat, *albumLon
-				asset.Metadata = &domain.ImageMetadata{
-					Latitude:  &lat,
-					Longitude: &lon,
-				}
-			}
+	// Resolve GPS coordinates.
+	resolvedLat, resolvedLon := resolveCoords(
+		ab.absPath, sa.Filename, assetState, ag,
+	)
 
-			assets = append(assets, asset)
+	if resolvedLat != nil && resolvedLon != nil {
+		asset.Metadata = &domain.ImageMetadata{
+			Latitude:  resolvedLat,
+			Longitude: resolvedLon,
+			Altitude:  assetState.Altitude,
 		}
+		asset.Place = assetState.Place
+	} else if ag.lat != nil && ag.lon != nil && !locationCleared(assetState) {
+		// Album-level fallback (not persisted to asset sidecar).
+		lat, lon := *ag.lat, *ag.lon
+		asset.Metadata = &domain.ImageMetadata{
+			Latitude:  &lat,
+			Longitude: &lon,
+		}
+		asset.Place = ag.place
+	}
+	if assetState.DateTaken != nil {
+		if asset.Metadata == nil {
+			asset.Metadata = &domain.ImageMetadata{}
+		}
+		// The sidecar value is already resolved to an absolute time.
+		asset.Metadata.DateTaken = assetState.DateTaken
+		asset.Metadata.DateTakenHasOffset = assetState.DateTakenHasOffset
+	}
+
+	ab.album.Assets[i] = asset
+	return nil
+}
+
+// relTo returns path relative to dir, or path itself if it is not
+// within dir.
+func relTo(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		// Outside dir, as with a separate state root.
+		return path
+	}
+	return rel
+}
+
+// albumGeo carries the per-album inputs to coordinate resolution.
+type albumGeo struct {
+	// points holds the album's GPX trackpoints, sorted by time.
+	points []geo.Trackpoint
+
+	// clock resolves zoneless EXIF capture times.
+	clock geo.CaptureClock
+
+	// match holds the track matching tolerance and maximum gap.
+	match geo.MatchOptions
+
+	// lat and lon are the album-level fallback coordinates, if any.
+	lat, lon *float64
 
-		album := &domain.Album{
-			ID:          albumState.ObjectID,
-			Path:        relPath,
-			Title:       title,
-			Description: description,
-			ParentPath:  parentPath,
-			Children:    scanned.ChildPaths,
-			Assets:      assets,
+	// place is the geocoded album-level fallback location, if any.
+	place *domain.Place
+}
+
+// captureClock builds the capture clock from an album config. Invalid
+// values are ignored here; fswalk already rejects them via Validate.
+func captureClock(cfg *config.AlbumConfig) geo.CaptureClock {
+	var clock geo.CaptureClock
+	if cfg.Timezone != "" {
+		if loc, err := time.LoadLocation(cfg.Timezone); err == nil {
+			clock.Location = loc
+		}
+	}
+	if cfg.CameraClockOffset != "" {
+		if d, err := time.ParseDuration(cfg.CameraClockOffset); err == nil {
+			clock.Offset = d
 		}
-		snap.Albums[relPath] = album
 	}
+	return clock
+}
 
-	return snap, nil
+// matchOptions builds the track matching settings from an album config,
+// falling back to the defaults for unset or invalid values.
+func matchOptions(cfg *config.AlbumConfig) geo.MatchOptions {
+	opts := geo.MatchOptions{Tolerance: defaultGPXTolerance, MaxGap: defaultGPXMaxGap}
+	if cfg == nil {
+		return opts
+	}
+	if d, err := time.ParseDuration(cfg.GPXTolerance); err == nil && d >= 0 {
+		opts.Tolerance = d
+	}
+	if cfg.GPXMaxGap == config.GPXMaxGapUnlimited {
+		opts.MaxGap = -1
+	} else if d, err := time.ParseDuration(cfg.GPXMaxGap); err == nil && d >= 0 {
+		opts.MaxGap = d
+	}
+	return opts
 }
 
 // resolveCoords attempts to resolve GPS coordinates for an asset.
-// It checks: cached sidecar → EXIF → GPX matching.
+// It checks: cached sidecar → EXIF → track matching (bounded by the
+// album's tolerance and maximum interpolation gap).
 // If coordinates are found (or all sources exhausted), it persists
-// the result to the sidecar and sets GeoResolved to avoid re-processing.
+// the result, with its altitude and match quality, to the sidecar and
+// sets GeoResolved to avoid re-processing.
+// The capture time, resolved to an absolute time via [geo.ResolveCaptureTime],
+// is stored alongside so GPX matching and sorting never see a zoneless time.
 func resolveCoords(
 	albumAbsPath, filename string,
 	assetState *state.AssetState,
-	gpxPoints []geo.Trackpoint,
+	ag albumGeo,
 ) (lat, lon *float64) {
+	// A track match made with other clock or matching settings than the
+	// album's is resolved again, along with its capture time.
+	clockChanged := assetState.DateTaken != nil && !sameDateClock(assetState.DateClock, dateClock(ag.clock))
+	tracked := trackMatched(assetState) || (assetState.TrackOptions != nil && assetState.GeoMatch == nil)
+	optionsChanged := assetState.TrackOptions != nil && *assetState.TrackOptions != *trackOptions(ag.match)
+	if assetState.GeoResolved && tracked && (clockChanged || optionsChanged) {
+		ResetLocation(assetState)
+	}
+
 	// Already resolved — use cached result (may be nil if no coords found).
 	if assetState.GeoResolved {
+		backfilled := false
+		// Sidecars written before place lookup existed get it filled in once.
+		if !assetState.PlaceResolved {
+			resolvePlace(assetState)
+			backfilled = true
+		}
+		// So do those written before capture times were kept, and capture
+		// times are resolved again when the album's clock settings change.
+		if (!assetState.DateResolved && assetState.DateTaken == nil) || clockChanged {
+			resolveDateTaken(assetState, extractMeta(albumAbsPath, filename), ag)
+			backfilled = true
+		}
+		if backfilled {
+			if err := state.SaveAssetState(albumAbsPath, filename, assetState); err != nil {
+				slog.Warn("failed to save backfilled asset state", "file", filename, "error", err)
+			}
+		}
 		return assetState.Latitude, assetState.Longitude
 	}
 
-	// Try EXIF extraction.
-	filePath := filepath.Join(albumAbsPath, filename)
-	exifMeta, err := meta.Extract(filePath)
-	if err != nil {
-		slog.Warn("EXIF extraction failed", "file", filename, "error", err)
-	}
+	exifMeta := extractMeta(albumAbsPath, filename)
+	resolveDateTaken(assetState, exifMeta, ag)
 
 	if exifMeta != nil && exifMeta.Latitude != nil && exifMeta.Longitude != nil {
 		assetState.Latitude = exifMeta.Latitude
 		assetState.Longitude = exifMeta.Longitude
+		assetState.Altitude = exifMeta.Altitude
+		assetState.GeoMatch = &state.GeoMatch{Source: geoSourceEXIF}
 		assetState.GeoResolved = true
+		resolvePlace(assetState)
 		if err := state.SaveAssetState(albumAbsPath, filename, assetState); err != nil {
 			slog.Warn("failed to save asset state with EXIF coords", "file", filename, "error", err)
 		}
 		return assetState.Latitude, assetState.Longitude
 	}
 
-	// Try GPX matching (requires DateTaken from EXIF).
-	if exifMeta != nil && exifMeta.DateTaken != nil && len(gpxPoints) > 0 {
-		glat, glon, ok := geo.MatchNearest(gpxPoints, *exifMeta.DateTaken, gpxTolerance)
-		if ok {
-			assetState.Latitude = &glat
-			assetState.Longitude = &glon
+	// Try track matching (requires DateTaken from EXIF).
+	if assetState.DateTaken != nil && len(ag.points) > 0 {
+		assetState.TrackOptions = trackOptions(ag.match)
+		if m, ok := geo.MatchTrack(ag.points, *assetState.DateTaken, ag.match); ok {
+			assetState.Latitude = &m.Lat
+			assetState.Longitude = &m.Lon
+			assetState.Altitude = m.Ele
+			assetState.GeoMatch = &state.GeoMatch{
+				Source:        geoSourceTrack,
+				Method:        m.Method,
+				OffsetSeconds: m.Offset.Seconds(),
+			}
 			assetState.GeoResolved = true
+			resolvePlace(assetState)
 			if err := state.SaveAssetState(albumAbsPath, filename, assetState); err != nil {
-				slog.Warn("failed to save asset state with GPX coords", "file", filename, "error", err)
+				slog.Warn("failed to save asset state with track coords", "file", filename, "error", err)
 			}
 			return assetState.Latitude, assetState.Longitude
 		}
@@ -209,8 +472,115 @@ func resolveCoords(
 
 	// No coordinates found — mark as resolved to avoid re-processing.
 	assetState.GeoResolved = true
+	resolvePlace(assetState)
 	if err := state.SaveAssetState(albumAbsPath, filename, assetState); err != nil {
 		slog.Warn("failed to save asset state (no coords)", "file", filename, "error", err)
 	}
 	return nil, nil
 }
+
+// extractMeta reads the EXIF metadata of an asset, logging failures.
+func extractMeta(albumAbsPath, filename string) *domain.ImageMetadata {
+	m, err := meta.Extract(filepath.Join(albumAbsPath, filename))
+	if err != nil {
+		slog.Warn("EXIF extraction failed", "file", filename, "error", err)
+	}
+	return m
+}
+
+// resolveDateTaken stores the EXIF capture time, resolved to an absolute
+// time, in assetState and marks the lookup as done. The time zone is
+// inferred from the EXIF coordinates, else the cached ones, else the
+// album's. The caller persists the state.
+func resolveDateTaken(assetState *state.AssetState, exifMeta *domain.ImageMetadata, ag albumGeo) {
+	assetState.DateResolved = true
+	assetState.DateTaken = nil
+	assetState.DateTakenHasOffset = false
+	assetState.DateClock = nil
+	if exifMeta == nil || exifMeta.DateTaken == nil {
+		return
+	}
+	hintLat, hintLon := exifMeta.Latitude, exifMeta.Longitude
+	if hintLat == nil || hintLon == nil {
+		hintLat, hintLon = assetState.Latitude, assetState.Longitude
+	}
+	if hintLat == nil || hintLon == nil {
+		hintLat, hintLon = ag.lat, ag.lon
+	}
+	taken := geo.ResolveCaptureTime(
+		*exifMeta.DateTaken, exifMeta.DateTakenHasOffset, ag.clock,
+		hintLat, hintLon, ag.points,
+	)
+	assetState.DateTaken = &taken
+	assetState.DateTakenHasOffset = exifMeta.DateTakenHasOffset
+	assetState.DateClock = dateClock(ag.clock)
+}
+
+// dateClock returns the settings of clock as recorded in asset state, or
+// nil when it has none.
+func dateClock(clock geo.CaptureClock) *state.DateClock {
+	if clock.Location == nil && clock.Offset == 0 {
+		return nil
+	}
+	dc := &state.DateClock{}
+	if clock.Location != nil {
+		dc.Timezone = clock.Location.String()
+	}
+	if clock.Offset != 0 {
+		dc.CameraClockOffset = clock.Offset.String()
+	}
+	return dc
+}
+
+// trackOptions returns the track matching settings opts as recorded in
+// asset state.
+func trackOptions(opts geo.MatchOptions) *state.TrackOptions {
+	to := &state.TrackOptions{Tolerance: opts.Tolerance.String(), MaxGap: opts.MaxGap.String()}
+	if opts.MaxGap < 0 {
+		to.MaxGap = config.GPXMaxGapUnlimited
+	}
+	return to
+}
+
+// sameDateClock reports whether two recorded clock settings are equal.
+func sameDateClock(a, b *state.DateClock) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// trackMatched reports whether the asset's position was matched on a
+// track file.
+func trackMatched(assetState *state.AssetState) bool {
+	return assetState.GeoMatch != nil && assetState.GeoMatch.Source == geoSourceTrack
+}
+
+// resolvePlace reverse-geocodes the asset's cached coordinates into
+// assetState.Place and marks the lookup as done. The caller persists
+// the state.
+func resolvePlace(assetState *state.AssetState) {
+	assetState.Place = nil
+	assetState.PlaceResolved = true
+	if assetState.Latitude == nil || assetState.Longitude == nil {
+		return
+	}
+	if p, ok := geocode.Lookup(*assetState.Latitude, *assetState.Longitude); ok {
+		assetState.Place = &p
+	}
+}
+
+func toDomainTracks(tracks []geo.Track) []domain.Track {
+	if len(tracks) == 0 {
+		return nil
+	}
+	out := make([]domain.Track, len(tracks))
+	for i, trk := range tracks {
+		pts := make([]domain.TrackPoint, len(trk.Points))
+		for j, p := range trk.Points {
+			pts[j] = domain.TrackPoint{Lat: p.Lat, Lon: p.Lon, Ele: p.Ele}
+		}
+		out[i] = domain.Track{Name: trk.Name, Kind: trk.Kind, Points: pts}
+	}
+	return out
+}
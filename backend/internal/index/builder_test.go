@@ -1,6 +1,7 @@
 package index
 
 import (
+	"encoding/binary"
 	"os"
 	"path/filepath"
 	"strings"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/domain"
 	"github.com/perrito666/gollery/backend/internal/fswalk"
 	"github.com/perrito666/gollery/backend/internal/geo"
 	"github.com/perrito666/gollery/backend/internal/state"
@@ -164,7 +166,7 @@ func TestResolveCoords_CachedSidecar(t *testing.T) {
 		GeoResolved: true,
 	}
 
-	lat, lon := resolveCoords(dir, "photo.jpg", as, nil)
+	lat, lon := resolveCoords(dir, "photo.jpg", as, albumGeo{})
 	if lat == nil || *lat != 48.8566 {
 		t.Errorf("lat = %v, want 48.8566", lat)
 	}
@@ -182,7 +184,7 @@ func TestResolveCoords_GeoResolvedNoCoords(t *testing.T) {
 		GeoResolved: true,
 	}
 
-	lat, lon := resolveCoords(dir, "photo.jpg", as, nil)
+	lat, lon := resolveCoords(dir, "photo.jpg", as, albumGeo{})
 	if lat != nil || lon != nil {
 		t.Errorf("expected nil coords for resolved-no-coords, got (%v, %v)", lat, lon)
 	}
@@ -195,7 +197,7 @@ func TestResolveCoords_NoExifMarksResolved(t *testing.T) {
 
 	as := &state.AssetState{ObjectID: "ast_test"}
 
-	lat, lon := resolveCoords(dir, "photo.jpg", as, nil)
+	lat, lon := resolveCoords(dir, "photo.jpg", as, albumGeo{})
 	if lat != nil || lon != nil {
 		t.Errorf("expected nil coords, got (%v, %v)", lat, lon)
 	}
@@ -206,28 +208,40 @@ func TestResolveCoords_NoExifMarksResolved(t *testing.T) {
 
 func TestResolveCoords_GPXMatch(t *testing.T) {
 	dir := t.TempDir()
-	writeFile(t, filepath.Join(dir, "photo.jpg"))
+	writeDatedJPEG(t, filepath.Join(dir, "photo.jpg"), "2024:06:15 12:01:00", "+02:00")
 
-	// Simulate: EXIF gave us a DateTaken but no GPS.
-	// We can't easily produce a real EXIF file in tests, so test
-	// resolveCoords with GPX points directly by pre-populating
-	// the asset state as if EXIF extraction yielded nothing.
-	// Instead, test the GPX matching function directly.
-	pts := []geo.Trackpoint{
-		{Lat: 40.0, Lon: -74.0, Time: time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)},
-		{Lat: 42.0, Lon: -72.0, Time: time.Date(2024, 6, 15, 10, 2, 0, 0, time.UTC)},
+	ag := albumGeo{
+		points: []geo.Trackpoint{
+			{Lat: 40.0, Lon: -74.0, Time: time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)},
+			{Lat: 42.0, Lon: -72.0, Time: time.Date(2024, 6, 15, 10, 2, 0, 0, time.UTC)},
+		},
+		match: geo.MatchOptions{Tolerance: 30 * time.Second, MaxGap: 5 * time.Minute},
 	}
-
-	query := time.Date(2024, 6, 15, 10, 1, 0, 0, time.UTC)
-	lat, lon, ok := geo.MatchNearest(pts, query, 30*time.Second)
-	if !ok {
+	as := &state.AssetState{ObjectID: "ast_test"}
+	lat, lon := resolveCoords(dir, "photo.jpg", as, ag)
+	if lat == nil || lon == nil {
 		t.Fatal("expected GPX match")
 	}
-	if lat < 40.9 || lat > 41.1 {
-		t.Errorf("lat = %f, want ~41.0", lat)
+	if *lat < 40.9 || *lat > 41.1 {
+		t.Errorf("lat = %f, want ~41.0", *lat)
+	}
+	if *lon < -73.1 || *lon > -72.9 {
+		t.Errorf("lon = %f, want ~-73.0", *lon)
+	}
+	if as.TrackOptions == nil || *as.TrackOptions != (state.TrackOptions{Tolerance: "30s", MaxGap: "5m0s"}) {
+		t.Errorf("track options = %+v", as.TrackOptions)
+	}
+
+	// Changing the album's matching settings matches the photo again,
+	// whether or not the previous settings found a position.
+	ag.match.MaxGap = 0
+	if lat, _ := resolveCoords(dir, "photo.jpg", as, ag); lat != nil {
+		t.Fatalf("lat = %f, want no match without interpolation", *lat)
 	}
-	if lon < -73.1 || lon > -72.9 {
-		t.Errorf("lon = %f, want ~-73.0", lon)
+	ag.match.Tolerance = 2 * time.Minute
+	lat, _ = resolveCoords(dir, "photo.jpg", as, ag)
+	if lat == nil || *lat != 40.0 || as.GeoMatch == nil || as.GeoMatch.Method != geo.MethodNearest {
+		t.Errorf("lat = %v, match = %+v, want the nearest trackpoint", lat, as.GeoMatch)
 	}
 }
 
@@ -268,6 +282,175 @@ func TestBuildSnapshot_AlbumFallbackCoords(t *testing.T) {
 	if asset.Metadata.Longitude == nil || *asset.Metadata.Longitude != 2.3522 {
 		t.Errorf("lon = %v, want 2.3522", asset.Metadata.Longitude)
 	}
+	if asset.Place == nil || asset.Place.City != "Paris" || asset.Place.CountryCode != "FR" {
+		t.Errorf("place = %+v, want Paris, FR", asset.Place)
+	}
+}
+
+func TestResolveCoords_FillsPlaceForCachedCoords(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "photo.jpg"))
+
+	// A sidecar written before place lookup existed.
+	as := &state.AssetState{
+		ObjectID:    "ast_test",
+		Latitude:    float64Ptr(-34.6037),
+		Longitude:   float64Ptr(-58.3816),
+		GeoResolved: true,
+	}
+
+	resolveCoords(dir, "photo.jpg", as, albumGeo{})
+	if !as.PlaceResolved {
+		t.Fatal("PlaceResolved should be set")
+	}
+	if as.Place == nil || as.Place.City != "Buenos Aires" || as.Place.Country != "Argentina" {
+		t.Errorf("place = %+v", as.Place)
+	}
+
+	saved, err := state.LoadAssetState(dir, "photo.jpg")
+	if err != nil || saved == nil || saved.Place == nil {
+		t.Fatalf("place not persisted: %+v, %v", saved, err)
+	}
+}
+
+// writeDatedJPEG writes a JPEG whose EXIF holds only a DateTimeOriginal
+// (with an offset, so no time zone is needed to resolve it).
+func writeDatedJPEG(t *testing.T, path, taken, offset string) {
+	t.Helper()
+	le := binary.LittleEndian
+	ascii := func(s string) []byte { return append([]byte(s), 0) }
+	date, off := ascii(taken), ascii(offset)
+
+	// Header, IFD0 pointing at the Exif IFD, the Exif IFD, then values.
+	const ifd0, exifIFD = 8, 8 + 18
+	values := exifIFD + 2 + 2*12 + 4
+	tiff := []byte("II")
+	tiff = le.AppendUint16(tiff, 42)
+	tiff = le.AppendUint32(tiff, ifd0)
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = le.AppendUint32(le.AppendUint16(le.AppendUint16(tiff, 0x8769), 4), 1)
+	tiff = le.AppendUint32(le.AppendUint32(tiff, exifIFD), 0)
+	tiff = le.AppendUint16(tiff, 2)
+	for _, e := range []struct {
+		tag    uint16
+		val    []byte
+		offset int
+	}{{0x9003, date, values}, {0x9011, off, values + len(date)}} {
+		tiff = le.AppendUint16(le.AppendUint16(tiff, e.tag), 2)
+		tiff = le.AppendUint32(le.AppendUint32(tiff, uint32(len(e.val))), uint32(e.offset))
+	}
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = append(append(tiff, date...), off...)
+
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	data = binary.BigEndian.AppendUint16(data, uint16(len(app1)+2))
+	data = append(append(data, app1...), 0xFF, 0xD9)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveCoords_BackfillsDateTaken(t *testing.T) {
+	dir := t.TempDir()
+	writeAlbumJSON(t, dir, `{"title": "Root"}`)
+	writeDatedJPEG(t, filepath.Join(dir, "photo.jpg"), "2019:07:01 10:00:00", "+02:00")
+
+	// A sidecar resolved before capture times were kept.
+	if err := state.SaveAssetState(dir, "photo.jpg", &state.AssetState{
+		ObjectID:      "ast_test",
+		GeoResolved:   true,
+		PlaceResolved: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := BuildSnapshot(dir, scanTree(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2019, 7, 1, 8, 0, 0, 0, time.UTC)
+	asset := snap.Albums[""].Assets[0]
+	if asset.Metadata == nil || asset.Metadata.DateTaken == nil || !asset.Metadata.DateTaken.Equal(want) {
+		t.Fatalf("metadata = %+v, want date taken %v", asset.Metadata, want)
+	}
+	if !asset.Metadata.DateTakenHasOffset {
+		t.Error("the camera recorded an offset")
+	}
+	saved, err := state.LoadAssetState(dir, "photo.jpg")
+	if err != nil || saved == nil || saved.DateTaken == nil || !saved.DateResolved || !saved.DateTakenHasOffset {
+		t.Fatalf("date taken not persisted: %+v, %v", saved, err)
+	}
+
+	// A zoneless capture time is resolved, but not reported as recorded
+	// with an offset.
+	writeDatedJPEG(t, filepath.Join(dir, "zoneless.jpg"), "2019:07:01 10:00:00", "")
+	snap, err = BuildSnapshot(dir, scanTree(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range snap.Albums[""].Assets {
+		if a.Filename == "zoneless.jpg" && (a.Metadata == nil || a.Metadata.DateTaken == nil || a.Metadata.DateTakenHasOffset) {
+			t.Errorf("zoneless metadata = %+v", a.Metadata)
+		}
+	}
+
+	// Files without a capture time are read only once.
+	writeFile(t, filepath.Join(dir, "plain.jpg"))
+	as := &state.AssetState{ObjectID: "ast_plain", GeoResolved: true, PlaceResolved: true}
+	resolveCoords(dir, "plain.jpg", as, albumGeo{})
+	if as.DateTaken != nil || !as.DateResolved {
+		t.Errorf("state = %+v, want resolved without a date", as)
+	}
+}
+
+func TestResolveCoords_ReresolvesOnClockChange(t *testing.T) {
+	dir := t.TempDir()
+	writeAlbumJSON(t, dir, `{"title": "Root", "timezone": "Europe/Paris"}`)
+	writeDatedJPEG(t, filepath.Join(dir, "photo.jpg"), "2019:07:01 10:00:00", "")
+
+	taken := func() time.Time {
+		t.Helper()
+		snap, err := BuildSnapshot(dir, scanTree(t, dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		asset := snap.Albums[""].Assets[0]
+		if asset.Metadata == nil || asset.Metadata.DateTaken == nil {
+			t.Fatalf("metadata = %+v, want a date taken", asset.Metadata)
+		}
+		return asset.Metadata.DateTaken.UTC()
+	}
+	if got, want := taken(), time.Date(2019, 7, 1, 8, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("date taken = %v, want %v", got, want)
+	}
+
+	writeAlbumJSON(t, dir, `{"title": "Root", "timezone": "America/New_York", "camera_clock_offset": "1h"}`)
+	if got, want := taken(), time.Date(2019, 7, 1, 15, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("date taken after clock change = %v, want %v", got, want)
+	}
+	saved, err := state.LoadAssetState(dir, "photo.jpg")
+	if err != nil || saved == nil || saved.DateClock == nil || saved.DateClock.Timezone != "America/New_York" || saved.DateClock.CameraClockOffset != "1h0m0s" {
+		t.Fatalf("date clock not persisted: %+v, %v", saved, err)
+	}
+}
+
+func TestResolveCoords_KeepsCachedPlace(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "photo.jpg"))
+
+	as := &state.AssetState{
+		ObjectID:      "ast_test",
+		Latitude:      float64Ptr(48.8566),
+		Longitude:     float64Ptr(2.3522),
+		GeoResolved:   true,
+		Place:         &domain.Place{City: "Custom"},
+		PlaceResolved: true,
+	}
+
+	resolveCoords(dir, "photo.jpg", as, albumGeo{})
+	if as.Place == nil || as.Place.City != "Custom" {
+		t.Errorf("cached place should be reused, got %+v", as.Place)
+	}
 }
 
 func TestBuildSnapshot_FromManualScanResult(t *testing.T) {
@@ -291,3 +474,94 @@ func TestBuildSnapshot_FromManualScanResult(t *testing.T) {
 		t.Errorf("title = %q", snap.Albums[""].Title)
 	}
 }
+
+func TestMatchOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.AlbumConfig
+		want geo.MatchOptions
+	}{
+		{"nil config", nil, geo.MatchOptions{Tolerance: defaultGPXTolerance, MaxGap: defaultGPXMaxGap}},
+		{"unset", &config.AlbumConfig{}, geo.MatchOptions{Tolerance: defaultGPXTolerance, MaxGap: defaultGPXMaxGap}},
+		{
+			"overrides",
+			&config.AlbumConfig{GPXTolerance: "2m", GPXMaxGap: "0s"},
+			geo.MatchOptions{Tolerance: 2 * time.Minute, MaxGap: 0},
+		},
+		{
+			"unlimited gap",
+			&config.AlbumConfig{GPXMaxGap: "unlimited"},
+			geo.MatchOptions{Tolerance: defaultGPXTolerance, MaxGap: -1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchOptions(tt.cfg); got != tt.want {
+				t.Errorf("matchOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateSnapshot_RebuildsOnlyChangedAlbums(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeFile(t, filepath.Join(root, "a", "one.jpg"))
+	writeFile(t, filepath.Join(root, "b", "two.jpg"))
+
+	scan, _ := fswalk.Scan(root)
+	prev, err := BuildSnapshot(root, scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(root, "a", "three.jpg"))
+	writeFile(t, filepath.Join(root, "c", "four.jpg"))
+	next, changed, err := fswalk.Rescan(root, scan, []string{"", "a", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := UpdateSnapshot(root, prev, next, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snap.Albums) != 4 {
+		t.Fatalf("expected 4 albums, got %d", len(snap.Albums))
+	}
+	if snap.Albums["b"] != prev.Albums["b"] {
+		t.Error("unchanged album should be shared with the previous snapshot")
+	}
+	if len(prev.Albums["a"].Assets) != 1 {
+		t.Error("previous snapshot was modified")
+	}
+	a := snap.Albums["a"]
+	if a.ID != prev.Albums["a"].ID {
+		t.Error("album ID should survive an incremental update")
+	}
+	if len(a.Assets) != 2 {
+		t.Errorf("album a has %d assets, want 2", len(a.Assets))
+	}
+	if got := snap.Albums[""].Children; len(got) != 3 || got[2] != "c" {
+		t.Errorf("root children = %v, want [a b c]", got)
+	}
+
+	// Removing a directory drops its album and unlinks it.
+	if err := os.RemoveAll(filepath.Join(root, "b")); err != nil {
+		t.Fatal(err)
+	}
+	next2, changed, err := fswalk.Rescan(root, next, []string{"", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap2, err := UpdateSnapshot(root, snap, next2, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := snap2.Albums["b"]; ok {
+		t.Error("removed album still present")
+	}
+	if got := snap2.Albums[""].Children; len(got) != 2 {
+		t.Errorf("root children = %v, want [a c]", got)
+	}
+}
@@ -0,0 +1,287 @@
+package index
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+// objectRef locates an album (filename empty) or an asset in a snapshot.
+type objectRef struct {
+	albumPath string
+	filename  string
+}
+
+func (r objectRef) String() string {
+	if r.albumPath == "" && r.filename == "" {
+		return "."
+	}
+	return filepath.Join(r.albumPath, r.filename)
+}
+
+// dedupeIDs gives a new ID to every album and asset that shares its ID
+// with another, as happens when a directory is copied together with its
+// .gallery folder. One holder keeps the ID: the one that had it in prev
+// (if any), else the one whose files are older, else the first in path
+// order. Sidecars are no guide, as they are rewritten whenever state
+// changes, but a copy's files are as new as the copy unless their times
+// were preserved. Changed albums are replaced by copies in snap, so albums shared
+// with prev are never modified. Copies lose their discussion bindings,
+// which belong to the original, and the cover and manual orders copied
+// along with them follow their assets and child albums to the new IDs.
+func dedupeIDs(dir func(albumPath string) string, snap, prev *domain.Snapshot) ([]domain.IdentityIssue, error) {
+	owners := make(map[string]objectRef)
+	if prev != nil {
+		for path, album := range prev.Albums {
+			owners[album.ID] = objectRef{albumPath: path}
+			for _, asset := range album.Assets {
+				owners[asset.ID] = objectRef{albumPath: path, filename: asset.Filename}
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(snap.Albums))
+	for path := range snap.Albums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// cloned tracks albums already copied for modification.
+	cloned := make(map[string]bool)
+	mutable := func(path string) *domain.Album {
+		if !cloned[path] {
+			cp := *snap.Albums[path]
+			cp.Assets = slices.Clone(cp.Assets)
+			snap.Albums[path] = &cp
+			cloned[path] = true
+		}
+		return snap.Albums[path]
+	}
+
+	var issues []domain.IdentityIssue
+
+	// reminted maps, per album path, the IDs its assets and child albums
+	// gave up to the ones they were given.
+	reminted := make(map[string]map[string]string)
+	remap := func(path, id, newID string) {
+		if reminted[path] == nil {
+			reminted[path] = make(map[string]string)
+		}
+		reminted[path][id] = newID
+	}
+
+	albumsByID := make(map[string][]objectRef)
+	for _, path := range paths {
+		id := snap.Albums[path].ID
+		albumsByID[id] = append(albumsByID[id], objectRef{albumPath: path})
+	}
+	for _, id := range sortedDuplicates(albumsByID) {
+		keeper, copies := pickKeeper(snap, albumsByID[id], owners[id])
+		for _, ref := range copies {
+			newID, err := remintAlbum(dir(ref.albumPath))
+			if err != nil {
+				return nil, fmt.Errorf("re-minting album ID for %q: %w", ref.albumPath, err)
+			}
+			mutable(ref.albumPath).ID = newID
+			remap(snap.Albums[ref.albumPath].ParentPath, id, newID)
+			issues = append(issues, duplicateIssue(ref, id, keeper, newID))
+		}
+	}
+
+	assetsByID := make(map[string][]objectRef)
+	for _, path := range paths {
+		for _, asset := range snap.Albums[path].Assets {
+			assetsByID[asset.ID] = append(assetsByID[asset.ID], objectRef{albumPath: path, filename: asset.Filename})
+		}
+	}
+	for _, id := range sortedDuplicates(assetsByID) {
+		keeper, copies := pickKeeper(snap, assetsByID[id], owners[id])
+		for _, ref := range copies {
+			newID, err := remintAsset(dir(ref.albumPath), ref.filename)
+			if err != nil {
+				return nil, fmt.Errorf("re-minting asset ID for %q in %q: %w", ref.filename, ref.albumPath, err)
+			}
+			album := mutable(ref.albumPath)
+			for i := range album.Assets {
+				if album.Assets[i].Filename == ref.filename {
+					album.Assets[i].ID = newID
+				}
+			}
+			remap(ref.albumPath, id, newID)
+			issues = append(issues, duplicateIssue(ref, id, keeper, newID))
+		}
+	}
+
+	for _, path := range paths {
+		if reminted[path] == nil {
+			continue
+		}
+		album := snap.Albums[path]
+		cover, assetOrder, childOrder, changed := followRemints(snap, album, reminted[path])
+		if !changed {
+			continue
+		}
+		if err := saveAlbumRefs(dir(path), cover, assetOrder, childOrder); err != nil {
+			return nil, fmt.Errorf("updating cover and order of %q: %w", path, err)
+		}
+		album = mutable(path)
+		album.CoverID, album.AssetOrder, album.ChildOrder = cover, assetOrder, childOrder
+	}
+	return issues, nil
+}
+
+// followRemints returns the album's cover and manual orders with the IDs
+// in ids replaced by their new ones, unless one of the album's assets or
+// child albums still holds the old ID (the original lives alongside).
+func followRemints(snap *domain.Snapshot, album *domain.Album, ids map[string]string) (cover string, assetOrder, childOrder []string, changed bool) {
+	held := make(map[string]bool)
+	for _, asset := range album.Assets {
+		held[asset.ID] = true
+	}
+	for _, child := range album.Children {
+		if c, ok := snap.Albums[child]; ok {
+			held[c.ID] = true
+		}
+	}
+	follow := func(id string) string {
+		if newID, ok := ids[id]; ok && !held[id] {
+			changed = true
+			return newID
+		}
+		return id
+	}
+	followAll := func(list []string) []string {
+		if list == nil {
+			return nil
+		}
+		out := make([]string, len(list))
+		for i, id := range list {
+			out[i] = follow(id)
+		}
+		return out
+	}
+	cover = follow(album.CoverID)
+	assetOrder = followAll(album.AssetOrder)
+	childOrder = followAll(album.ChildOrder)
+	return cover, assetOrder, childOrder, changed
+}
+
+// sortedDuplicates returns the IDs with more than one holder, sorted.
+func sortedDuplicates(byID map[string][]objectRef) []string {
+	var ids []string
+	for id, refs := range byID {
+		if len(refs) > 1 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// pickKeeper chooses which of refs keeps the shared ID and returns the
+// others. refs are in path order.
+func pickKeeper(snap *domain.Snapshot, refs []objectRef, owner objectRef) (objectRef, []objectRef) {
+	keep := -1
+	for i, ref := range refs {
+		if ref == owner {
+			keep = i
+			break
+		}
+	}
+	if keep < 0 {
+		var oldest time.Time
+		for i, ref := range refs {
+			mod := contentModTime(snap, ref)
+			if keep < 0 || (!mod.IsZero() && (oldest.IsZero() || mod.Before(oldest))) {
+				keep, oldest = i, mod
+			}
+		}
+	}
+	copies := slices.Delete(slices.Clone(refs), keep, keep+1)
+	return refs[keep], copies
+}
+
+// contentModTime returns when the asset's file, or the oldest file of the
+// album, was last modified, or the zero time for an empty album.
+func contentModTime(snap *domain.Snapshot, ref objectRef) time.Time {
+	var oldest time.Time
+	for _, asset := range snap.Albums[ref.albumPath].Assets {
+		if ref.filename != "" && asset.Filename != ref.filename {
+			continue
+		}
+		if oldest.IsZero() || asset.ModTime.Before(oldest) {
+			oldest = asset.ModTime
+		}
+	}
+	return oldest
+}
+
+// remintAlbum gives the album a fresh ID, persisting it.
+func remintAlbum(absPath string) (string, error) {
+	s, err := state.LoadAlbumState(absPath)
+	if err != nil {
+		return "", err
+	}
+	if s == nil {
+		s = &state.AlbumState{}
+	}
+	id, err := state.GenerateAlbumID()
+	if err != nil {
+		return "", err
+	}
+	s.ObjectID = id
+	s.Discussions = nil
+	if err := state.SaveAlbumState(absPath, s); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// saveAlbumRefs persists an album's cover and manual orders.
+func saveAlbumRefs(absPath, cover string, assetOrder, childOrder []string) error {
+	s, err := state.LoadAlbumState(absPath)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		s = &state.AlbumState{}
+	}
+	s.CoverID, s.AssetOrder, s.ChildOrder = cover, assetOrder, childOrder
+	return state.SaveAlbumState(absPath, s)
+}
+
+// remintAsset gives the asset a fresh ID, persisting it.
+func remintAsset(albumAbsPath, filename string) (string, error) {
+	s, err := state.LoadAssetState(albumAbsPath, filename)
+	if err != nil {
+		return "", err
+	}
+	if s == nil {
+		s = &state.AssetState{}
+	}
+	id, err := state.GenerateAssetID()
+	if err != nil {
+		return "", err
+	}
+	s.ObjectID = id
+	s.Discussions = nil
+	if err := state.SaveAssetState(albumAbsPath, filename, s); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func duplicateIssue(ref objectRef, id string, keeper objectRef, newID string) domain.IdentityIssue {
+	slog.Warn("duplicate object ID re-minted", "path", ref.String(), "id", id, "kept_by", keeper.String(), "new_id", newID)
+	return domain.IdentityIssue{
+		AlbumPath: ref.albumPath,
+		Filename:  ref.filename,
+		Message:   fmt.Sprintf("ID %s duplicated that of %q (a copied .gallery folder?); assigned new ID %s", id, keeper.String(), newID),
+	}
+}
@@ -0,0 +1,232 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perrito666/gollery/backend/internal/fswalk"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+// copyTree copies a directory, .gallery included, and dates every copied
+// file at mtime.
+func copyTree(t *testing.T, from, to string, mtime time.Time) {
+	t.Helper()
+	err := filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(from, path)
+		dest := filepath.Join(to, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dest, 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(dest, data, 0644); err != nil {
+			return err
+		}
+		return os.Chtimes(dest, mtime, mtime)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setupCopiedAlbum(t *testing.T) (root string, b *Builder, scan *fswalk.ScanResult) {
+	t.Helper()
+	root = t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeContent(t, filepath.Join(root, "orig", "a.jpg"), "content a")
+	writeContent(t, filepath.Join(root, "orig", "b.jpg"), "content b")
+
+	b = &Builder{}
+	scan = scanTree(t, root)
+	if _, err := b.Build(root, scan); err != nil {
+		t.Fatal(err)
+	}
+	return root, b, scan
+}
+
+func TestBuild_DuplicateIDsAreReminted(t *testing.T) {
+	root, _, _ := setupCopiedAlbum(t)
+	orig, err := BuildSnapshot(root, scanTree(t, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The copy's files are newer, so the original keeps its IDs even
+	// though "copy" sorts first, and even after its sidecars are
+	// rewritten.
+	copyTree(t, filepath.Join(root, "orig"), filepath.Join(root, "copy"), time.Now().Add(time.Hour))
+	future := time.Now().Add(2 * time.Hour)
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if err := os.Chtimes(state.AssetStatePath(filepath.Join(root, "orig"), name), future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap, err := BuildSnapshot(root, scanTree(t, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, c := snap.Albums["orig"], snap.Albums["copy"]
+	if o.ID != orig.Albums["orig"].ID || o.Assets[0].ID != orig.Albums["orig"].Assets[0].ID {
+		t.Error("original album should keep its IDs")
+	}
+	if c.ID == o.ID || !strings.HasPrefix(c.ID, "alb_") {
+		t.Errorf("copy album ID = %s, original %s", c.ID, o.ID)
+	}
+	for i := range c.Assets {
+		if c.Assets[i].ID == o.Assets[i].ID {
+			t.Errorf("copy asset %s kept ID %s", c.Assets[i].Filename, c.Assets[i].ID)
+		}
+	}
+	if n := len(snap.IdentityIssues); n != 3 {
+		t.Fatalf("got %d issues, want 3: %+v", n, snap.IdentityIssues)
+	}
+	for _, issue := range snap.IdentityIssues {
+		if issue.AlbumPath != "copy" {
+			t.Errorf("issue for %q, want copy", issue.AlbumPath)
+		}
+	}
+
+	// The new IDs are persisted: the next build is clean.
+	st, err := state.LoadAssetState(filepath.Join(root, "copy"), "a.jpg")
+	if err != nil || st.ObjectID != c.Assets[0].ID {
+		t.Errorf("persisted ID = %v, %v; want %s", st, err, c.Assets[0].ID)
+	}
+	again, err := BuildSnapshot(root, scanTree(t, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.IdentityIssues) != 0 || again.Albums["copy"].ID != c.ID {
+		t.Errorf("rebuild issues = %+v", again.IdentityIssues)
+	}
+}
+
+func TestBuild_RemintedCopiesKeepTheirCoverAndOrder(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeContent(t, filepath.Join(root, "orig", "a.jpg"), "content a")
+	writeContent(t, filepath.Join(root, "orig", "b.jpg"), "content b")
+	writeContent(t, filepath.Join(root, "orig", "sub", "c.jpg"), "content c")
+	orig, err := BuildSnapshot(root, scanTree(t, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := orig.Albums["orig"]
+	a, b, sub := o.Assets[0].ID, o.Assets[1].ID, orig.Albums["orig/sub"].ID
+	st, err := state.LoadAlbumState(filepath.Join(root, "orig"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.CoverID, st.AssetOrder, st.ChildOrder = b, []string{b, a}, []string{sub}
+	if err := state.SaveAlbumState(filepath.Join(root, "orig"), st); err != nil {
+		t.Fatal(err)
+	}
+
+	copyTree(t, filepath.Join(root, "orig"), filepath.Join(root, "copy"), time.Now().Add(time.Hour))
+	snap, err := BuildSnapshot(root, scanTree(t, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o := snap.Albums["orig"]; o.CoverID != b || o.AssetOrder[0] != b || o.ChildOrder[0] != sub {
+		t.Errorf("original cover and order changed: %+v", o)
+	}
+	c := snap.Albums["copy"]
+	ca, cb, csub := c.Assets[0].ID, c.Assets[1].ID, snap.Albums["copy/sub"].ID
+	if c.CoverID != cb {
+		t.Errorf("copy cover = %s, want its own b.jpg %s", c.CoverID, cb)
+	}
+	if len(c.AssetOrder) != 2 || c.AssetOrder[0] != cb || c.AssetOrder[1] != ca {
+		t.Errorf("copy asset order = %v, want [%s %s]", c.AssetOrder, cb, ca)
+	}
+	if len(c.ChildOrder) != 1 || c.ChildOrder[0] != csub {
+		t.Errorf("copy child order = %v, want [%s]", c.ChildOrder, csub)
+	}
+	saved, err := state.LoadAlbumState(filepath.Join(root, "copy"))
+	if err != nil || saved.CoverID != cb || saved.ChildOrder[0] != csub {
+		t.Errorf("copy state = %+v, %v", saved, err)
+	}
+}
+
+func TestUpdate_PreviousHolderKeepsID(t *testing.T) {
+	root, b, scan := setupCopiedAlbum(t)
+	prev, err := b.Build(root, scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Even with older files, a copy does not take the ID from the
+	// album that held it in the previous snapshot.
+	copyTree(t, filepath.Join(root, "orig"), filepath.Join(root, "copy"), time.Now().Add(-time.Hour))
+	scan, changed, err := fswalk.Rescan(root, scan, []string{"copy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := b.Update(root, prev, scan, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Albums["orig"] != prev.Albums["orig"] {
+		t.Error("original album should be shared with the previous snapshot")
+	}
+	if snap.Albums["copy"].ID == prev.Albums["orig"].ID {
+		t.Error("copy should get a new album ID")
+	}
+	if len(snap.IdentityIssues) != 3 {
+		t.Errorf("issues = %+v", snap.IdentityIssues)
+	}
+
+	// A full rebuild remembers who held the IDs, too.
+	b2 := &Builder{}
+	b2.Remember(prev)
+	if err := os.RemoveAll(filepath.Join(root, "copy")); err != nil {
+		t.Fatal(err)
+	}
+	copyTree(t, filepath.Join(root, "orig"), filepath.Join(root, "copy"), time.Now().Add(-time.Hour))
+	full, err := b2.Build(root, scanTree(t, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Albums["orig"].ID != prev.Albums["orig"].ID {
+		t.Error("album held in the remembered snapshot should keep its ID")
+	}
+}
+
+func TestBuild_CorruptStateIsQuarantined(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeContent(t, filepath.Join(root, "trip", "a.jpg"), "content a")
+	writeContent(t, filepath.Join(root, "trip", "b.jpg"), "content b")
+	writeContent(t, state.AlbumStatePath(filepath.Join(root, "trip")), "{")
+	writeContent(t, state.AssetStatePath(filepath.Join(root, "trip"), "a.jpg"), "not json")
+
+	snap, err := BuildSnapshot(root, scanTree(t, root))
+	if err != nil {
+		t.Fatalf("corrupt state should not fail the build: %v", err)
+	}
+	trip := snap.Albums["trip"]
+	if trip.ID == "" || trip.Assets[0].ID == "" {
+		t.Errorf("album and asset should get fresh IDs: %+v", trip)
+	}
+	if len(snap.IdentityIssues) != 2 {
+		t.Fatalf("issues = %+v, want 2", snap.IdentityIssues)
+	}
+	for _, issue := range snap.IdentityIssues {
+		if !strings.Contains(issue.Message, filepath.Join(".gallery", "quarantine")) {
+			t.Errorf("issue = %+v", issue)
+		}
+	}
+	quarantined, _ := os.ReadDir(filepath.Join(root, "trip", ".gallery", "quarantine"))
+	if len(quarantined) != 2 {
+		t.Errorf("quarantine holds %d files, want 2", len(quarantined))
+	}
+}
@@ -0,0 +1,54 @@
+package index
+
+import "github.com/perrito666/gollery/backend/internal/state"
+
+// SetLocation records a manually assigned location in assetState,
+// replacing whatever EXIF or track matching found. The asset stays
+// GeoResolved so later scans keep the manual value. The caller persists
+// the state.
+func SetLocation(assetState *state.AssetState, lat, lon float64, alt *float64) {
+	assetState.Latitude = &lat
+	assetState.Longitude = &lon
+	assetState.Altitude = alt
+	assetState.GeoMatch = &state.GeoMatch{Source: geoSourceManual}
+	assetState.GeoResolved = true
+	resolvePlace(assetState)
+}
+
+// ClearLocation removes the asset's location and records that it was
+// removed on purpose: neither EXIF, track matching nor the album's
+// fallback coordinates apply until [ResetLocation] is called.
+// The caller persists the state.
+func ClearLocation(assetState *state.AssetState) {
+	assetState.Latitude = nil
+	assetState.Longitude = nil
+	assetState.Altitude = nil
+	assetState.GeoMatch = &state.GeoMatch{Source: geoSourceManual}
+	assetState.GeoResolved = true
+	resolvePlace(assetState)
+}
+
+// ResetLocation forgets the resolved location and capture time so the
+// next [BuildSnapshot] reruns EXIF extraction and track matching.
+// The caller persists the state.
+func ResetLocation(assetState *state.AssetState) {
+	assetState.Latitude = nil
+	assetState.Longitude = nil
+	assetState.Altitude = nil
+	assetState.GeoMatch = nil
+	assetState.TrackOptions = nil
+	assetState.GeoResolved = false
+	assetState.DateTaken = nil
+	assetState.DateResolved = false
+	assetState.DateTakenHasOffset = false
+	assetState.DateClock = nil
+	assetState.Place = nil
+	assetState.PlaceResolved = false
+}
+
+// locationCleared reports whether the location was removed with
+// [ClearLocation].
+func locationCleared(assetState *state.AssetState) bool {
+	return assetState.GeoMatch != nil && assetState.GeoMatch.Source == geoSourceManual &&
+		(assetState.Latitude == nil || assetState.Longitude == nil)
+}
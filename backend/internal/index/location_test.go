@@ -0,0 +1,82 @@
+package index
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/perrito666/gollery/backend/internal/config"
+	"github.com/perrito666/gollery/backend/internal/fswalk"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+func fallbackScan(lat, lon float64) *fswalk.ScanResult {
+	return &fswalk.ScanResult{
+		Albums: map[string]*fswalk.ScannedAlbum{
+			"": {
+				Path:   "",
+				Config: &config.AlbumConfig{Title: "Paris", Latitude: &lat, Longitude: &lon},
+				Assets: []fswalk.ScannedAsset{
+					{Filename: "photo.jpg", ModTime: time.Now(), SizeBytes: 4},
+				},
+			},
+		},
+	}
+}
+
+func TestBuildSnapshot_ManualLocationWins(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "photo.jpg"))
+	st := &state.AssetState{ObjectID: "ast_manual"}
+	SetLocation(st, -34.6037, -58.3816, nil)
+	if err := state.SaveAssetState(root, "photo.jpg", st); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := BuildSnapshot(root, fallbackScan(48.8566, 2.3522))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asset := snap.Albums[""].Assets[0]
+	if asset.Metadata == nil || *asset.Metadata.Latitude != -34.6037 {
+		t.Fatalf("metadata = %+v, want manual coordinates", asset.Metadata)
+	}
+	if asset.Place == nil || asset.Place.CountryCode != "AR" {
+		t.Errorf("place = %+v, want AR", asset.Place)
+	}
+}
+
+func TestBuildSnapshot_ClearedLocationSuppressesFallback(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "photo.jpg"))
+	st := &state.AssetState{ObjectID: "ast_cleared"}
+	ClearLocation(st)
+	if err := state.SaveAssetState(root, "photo.jpg", st); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := BuildSnapshot(root, fallbackScan(48.8566, 2.3522))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asset := snap.Albums[""].Assets[0]
+	if asset.Metadata != nil && asset.Metadata.Latitude != nil {
+		t.Errorf("lat = %v, want none (cleared)", *asset.Metadata.Latitude)
+	}
+	if asset.Place != nil {
+		t.Errorf("place = %+v, want none", asset.Place)
+	}
+
+	// Resetting lets resolution run again and the fallback apply.
+	ResetLocation(st)
+	if err := state.SaveAssetState(root, "photo.jpg", st); err != nil {
+		t.Fatal(err)
+	}
+	snap, err = BuildSnapshot(root, fallbackScan(48.8566, 2.3522))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md := snap.Albums[""].Assets[0].Metadata; md == nil || md.Latitude == nil {
+		t.Error("expected album fallback after reset")
+	}
+}
@@ -0,0 +1,381 @@
+package index
+
+import (
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/fswalk"
+)
+
+// Builder builds snapshots with a bounded pool of workers. The zero value
+// is ready to use.
+//
+// Albums are prepared first (stable IDs, track files), then the assets of
+// all of them are built as one pool of tasks, since opening images for
+// EXIF dominates the cost of a first index. Every task writes to its own
+// slot, so the snapshot does not depend on the number of workers or the
+// order they finish in, and when several tasks fail the error reported is
+// the one for the first album and asset in path order.
+type Builder struct {
+	// Workers bounds how many albums or assets are processed at once.
+	// Zero or less uses GOMAXPROCS.
+	Workers int
+
+	// Progress, if set, is updated as albums and assets complete.
+	Progress *Progress
+
+	// RenameWindow is how long an asset that vanished in an [Builder.Update]
+	// can still be matched with a new file by content, to keep its ID
+	// across a rename or move. Zero uses [DefaultRenameWindow].
+	RenameWindow time.Duration
+
+	// Dir, if set, returns the directory of the album at a snapshot path
+	// in place of joining the path to the content root, so that one
+	// snapshot can span several content roots.
+	Dir func(albumPath string) string
+
+	mu       sync.Mutex
+	vanished map[string]*vanishedAsset // keyed by former absolute path
+	last     *domain.Snapshot          // last built, see Remember
+}
+
+// Remember records snap as the last snapshot built, e.g. one restored
+// from the cache at startup. When IDs collide, the holders in the last
+// snapshot keep theirs.
+func (b *Builder) Remember(snap *domain.Snapshot) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.last = snap
+}
+
+// dirFunc returns the function mapping album paths to directories.
+func (b *Builder) dirFunc(contentRoot string) func(albumPath string) string {
+	if b.Dir != nil {
+		return b.Dir
+	}
+	return func(albumPath string) string { return filepath.Join(contentRoot, albumPath) }
+}
+
+// finish resolves duplicate IDs in snap against prev, adds the issues
+// found and records snap as the last snapshot built.
+func (b *Builder) finish(contentRoot string, snap, prev *domain.Snapshot, issues []domain.IdentityIssue) (*domain.Snapshot, error) {
+	dupes, err := dedupeIDs(b.dirFunc(contentRoot), snap, prev)
+	if err != nil {
+		return nil, err
+	}
+	snap.IdentityIssues = sortIssues(append(issues, dupes...))
+	b.Remember(snap)
+	return snap, nil
+}
+
+// Build is like [BuildSnapshot], using the builder's workers.
+func (b *Builder) Build(contentRoot string, scan *fswalk.ScanResult) (*domain.Snapshot, error) {
+	paths := make([]string, 0, len(scan.Albums))
+	for relPath := range scan.Albums {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+
+	b.mu.Lock()
+	prev := b.last
+	b.mu.Unlock()
+	albums, issues, err := b.buildAlbums(contentRoot, scan, paths, nil, prev)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &domain.Snapshot{
+		GeneratedAt: time.Now(),
+		Albums:      make(map[string]*domain.Album, len(paths)),
+	}
+	for i, relPath := range paths {
+		snap.Albums[relPath] = albums[i]
+	}
+	return b.finish(contentRoot, snap, prev, issues)
+}
+
+// Update is like [UpdateSnapshot], using the builder's workers.
+func (b *Builder) Update(contentRoot string, prev *domain.Snapshot, scan *fswalk.ScanResult, changed []string) (*domain.Snapshot, error) {
+	snap := &domain.Snapshot{
+		GeneratedAt: time.Now(),
+		Albums:      make(map[string]*domain.Album, len(scan.Albums)),
+	}
+	for relPath, album := range prev.Albums {
+		snap.Albums[relPath] = album
+	}
+
+	var rebuild []string
+	for _, relPath := range changed {
+		if _, ok := scan.Albums[relPath]; ok {
+			rebuild = append(rebuild, relPath)
+		} else {
+			delete(snap.Albums, relPath)
+		}
+	}
+	sort.Strings(rebuild)
+	albums, issues, err := b.buildAlbums(contentRoot, scan, rebuild, prev, prev)
+	if err != nil {
+		return nil, err
+	}
+	for i, relPath := range rebuild {
+		snap.Albums[relPath] = albums[i]
+	}
+
+	// Issues of rebuilt or removed albums are replaced by the new ones.
+	for _, issue := range prev.IdentityIssues {
+		if _, ok := scan.Albums[issue.AlbumPath]; ok && !slices.Contains(changed, issue.AlbumPath) {
+			issues = append(issues, issue)
+		}
+	}
+
+	for relPath, album := range snap.Albums {
+		scanned, ok := scan.Albums[relPath]
+		if !ok {
+			delete(snap.Albums, relPath)
+			continue
+		}
+		if !slices.Equal(album.Children, scanned.ChildPaths) {
+			cp := *album
+			cp.Children = scanned.ChildPaths
+			snap.Albums[relPath] = &cp
+		}
+	}
+
+	return b.finish(contentRoot, snap, prev, issues)
+}
+
+// buildAlbums builds the scanned albums at paths, in the same order. prev
+// is the snapshot being updated, or nil for a full build, and last the
+// snapshot built before, whose vanished albums may have moved.
+func (b *Builder) buildAlbums(contentRoot string, scan *fswalk.ScanResult, paths []string, prev, last *domain.Snapshot) ([]*domain.Album, []domain.IdentityIssue, error) {
+	workers := b.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	type assetTask struct{ album, asset int }
+	var tasks []assetTask
+	for i, relPath := range paths {
+		for j := range scan.Albums[relPath].Assets {
+			tasks = append(tasks, assetTask{i, j})
+		}
+	}
+	b.Progress.addTotals(len(paths), len(tasks))
+
+	dir := b.dirFunc(contentRoot)
+	gone := matchAlbumMoves(dir, scan, paths, last)
+	builds := make([]*albumBuild, len(paths))
+	err := forEach(workers, len(paths), func(i int) error {
+		ab, err := prepareAlbum(dir(paths[i]), paths[i], scan.Albums[paths[i]])
+		builds[i] = ab
+		b.Progress.albumDone()
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	issues := b.matchMoves(workers, dir, builds, gone, prev)
+
+	err = forEach(workers, len(tasks), func(k int) error {
+		t := tasks[k]
+		err := builds[t.album].buildAsset(t.asset)
+		b.Progress.assetDone()
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	albums := make([]*domain.Album, len(builds))
+	for i, ab := range builds {
+		albums[i] = ab.album
+		issues = append(issues, ab.issues...)
+	}
+	return albums, issues, nil
+}
+
+// sortIssues orders issues by album path, filename, then message.
+func sortIssues(issues []domain.IdentityIssue) []domain.IdentityIssue {
+	sort.Slice(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if a.AlbumPath != b.AlbumPath {
+			return a.AlbumPath < b.AlbumPath
+		}
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Message < b.Message
+	})
+	return issues
+}
+
+// forEach calls fn(0) … fn(n-1) on at most workers goroutines and returns
+// the error of the lowest index that failed. Once a call fails, calls not
+// yet started are skipped.
+func forEach(workers, n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	var next atomic.Int64
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for range min(workers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !failed.Load() {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				if errs[i] = fn(i); errs[i] != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Progress tracks a running (re)index for reporting. Its methods are safe
+// for concurrent use, and a nil *Progress ignores updates.
+type Progress struct {
+	mu         sync.Mutex
+	kind       string
+	phase      string
+	startedAt  time.Time
+	finishedAt time.Time
+	lastErr    string
+
+	dirsScanned atomic.Int64
+	albumsDone  atomic.Int64
+	albumsTotal atomic.Int64
+	assetsDone  atomic.Int64
+	assetsTotal atomic.Int64
+}
+
+// Progress phases.
+const (
+	PhaseIdle     = "idle"
+	PhaseScanning = "scanning"
+	PhaseIndexing = "indexing"
+)
+
+// ProgressReport is a point-in-time copy of a [Progress].
+type ProgressReport struct {
+	// Kind describes the run, e.g. "full" or "incremental".
+	Kind  string
+	Phase string
+
+	StartedAt  time.Time
+	FinishedAt time.Time
+	LastError  string
+
+	DirsScanned int64
+	AlbumsDone  int64
+	AlbumsTotal int64
+	AssetsDone  int64
+	AssetsTotal int64
+}
+
+// Start resets the counters for a new run and enters the scanning phase.
+func (p *Progress) Start(kind string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.kind = kind
+	p.phase = PhaseScanning
+	p.startedAt = time.Now()
+	p.finishedAt = time.Time{}
+	p.lastErr = ""
+	p.dirsScanned.Store(0)
+	p.albumsDone.Store(0)
+	p.albumsTotal.Store(0)
+	p.assetsDone.Store(0)
+	p.assetsTotal.Store(0)
+}
+
+// Indexing enters the indexing phase, once scanning is done.
+func (p *Progress) Indexing() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phase = PhaseIndexing
+}
+
+// Finish ends the run, recording err if it failed.
+func (p *Progress) Finish(err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phase = PhaseIdle
+	p.finishedAt = time.Now()
+	if err != nil {
+		p.lastErr = err.Error()
+	}
+}
+
+// DirScanned counts one directory read; suitable as [fswalk.Scanner.OnDir].
+func (p *Progress) DirScanned() {
+	if p != nil {
+		p.dirsScanned.Add(1)
+	}
+}
+
+func (p *Progress) addTotals(albums, assets int) {
+	if p != nil {
+		p.albumsTotal.Add(int64(albums))
+		p.assetsTotal.Add(int64(assets))
+	}
+}
+
+func (p *Progress) albumDone() {
+	if p != nil {
+		p.albumsDone.Add(1)
+	}
+}
+
+func (p *Progress) assetDone() {
+	if p != nil {
+		p.assetsDone.Add(1)
+	}
+}
+
+// Report returns the current state.
+func (p *Progress) Report() ProgressReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	phase := p.phase
+	if phase == "" {
+		phase = PhaseIdle
+	}
+	return ProgressReport{
+		Kind:        p.kind,
+		Phase:       phase,
+		StartedAt:   p.startedAt,
+		FinishedAt:  p.finishedAt,
+		LastError:   p.lastErr,
+		DirsScanned: p.dirsScanned.Load(),
+		AlbumsDone:  p.albumsDone.Load(),
+		AlbumsTotal: p.albumsTotal.Load(),
+		AssetsDone:  p.assetsDone.Load(),
+		AssetsTotal: p.assetsTotal.Load(),
+	}
+}
@@ -0,0 +1,79 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/fswalk"
+)
+
+func TestBuilder_DeterministicAcrossWorkers(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root", "latitude": 38.72, "longitude": -9.14}`)
+	for i := range 6 {
+		for j := range 5 {
+			writeFile(t, filepath.Join(root, fmt.Sprintf("album%d", i), fmt.Sprintf("img%d.jpg", j)))
+		}
+	}
+
+	scan, err := fswalk.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first build mints IDs; later builds must agree on everything.
+	want, err := (&Builder{Workers: 1}).Build(root, scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{2, 8, 64} {
+		progress := &Progress{}
+		progress.Start("full")
+		got, err := (&Builder{Workers: workers, Progress: progress}).Build(root, scan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got.GeneratedAt = want.GeneratedAt
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("workers=%d: snapshot differs from sequential build", workers)
+		}
+
+		r := progress.Report()
+		if r.AlbumsDone != 7 || r.AlbumsTotal != 7 || r.AssetsDone != 30 || r.AssetsTotal != 30 {
+			t.Errorf("workers=%d: progress = %+v", workers, r)
+		}
+	}
+}
+
+func TestForEach_ReportsLowestFailingIndex(t *testing.T) {
+	errLow, errHigh := errors.New("low"), errors.New("high")
+	for _, workers := range []int{1, 4, 100} {
+		err := forEach(workers, 50, func(i int) error {
+			switch i {
+			case 7:
+				return errLow
+			case 30:
+				return errHigh
+			}
+			return nil
+		})
+		if err != errLow {
+			t.Errorf("workers=%d: err = %v, want %v", workers, err, errLow)
+		}
+	}
+
+	if err := forEach(4, 0, func(int) error { return errLow }); err != nil {
+		t.Errorf("no tasks: err = %v", err)
+	}
+}
+
+func TestProgress_NilIsNoop(t *testing.T) {
+	var p *Progress
+	p.Start("full")
+	p.DirScanned()
+	p.Indexing()
+	p.Finish(nil)
+}
@@ -0,0 +1,345 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/fswalk"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+// DefaultRenameWindow is how long an asset that vanished during an
+// incremental update can still be matched with a new file.
+const DefaultRenameWindow = 10 * time.Minute
+
+// fingerprintChunk is how much of the start and the end of a file is
+// hashed. Together with the size this tells images apart without reading
+// them whole.
+const fingerprintChunk = 64 << 10
+
+// fingerprint returns the content fingerprint of a file, "<size>:<hash>".
+func fingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, min(size, fingerprintChunk)); err != nil {
+		return "", err
+	}
+	if size > 2*fingerprintChunk {
+		if _, err := f.Seek(-fingerprintChunk, io.SeekEnd); err != nil {
+			return "", err
+		}
+	}
+	if size > fingerprintChunk {
+		if _, err := io.CopyN(h, f, min(size-fingerprintChunk, fingerprintChunk)); err != nil {
+			return "", err
+		}
+	}
+	return strconv.FormatInt(size, 10) + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fingerprintSize returns the size recorded in a fingerprint, or -1.
+func fingerprintSize(fp string) int64 {
+	sizeStr, _, ok := strings.Cut(fp, ":")
+	if !ok {
+		return -1
+	}
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// vanishedAsset is an asset whose file is gone but whose sidecar is still
+// on disk, so a new file with the same content can take over its ID.
+type vanishedAsset struct {
+	albumPath string
+	absPath   string
+	filename  string
+	id        string
+	fp        string
+	since     time.Time
+}
+
+// arrival is a scanned file that has no sidecar yet.
+type arrival struct {
+	ab *albumBuild
+	i  int
+}
+
+func (a arrival) filename() string { return a.ab.scanned.Assets[a.i].Filename }
+
+// matchAlbumMoves moves the state of albums that were in last but are no
+// longer scanned to new albums at paths holding the same files, so that a
+// renamed or moved directory keeps its album and asset IDs, cover, order
+// and ACL overrides when its state is not kept inside it (a state root or
+// PostgreSQL). A vanished and a new album match when each shares more
+// files, by name and size, with the other than with any other album, and
+// more than half of the vanished album's files are among them. It returns
+// the vanished albums left unmatched.
+func matchAlbumMoves(dir func(string) string, scan *fswalk.ScanResult, paths []string, last *domain.Snapshot) []string {
+	if last == nil {
+		return nil
+	}
+	holders := make(map[string][]string) // vanished albums by file
+	var vanished []string
+	for relPath, album := range last.Albums {
+		if _, ok := scan.Albums[relPath]; ok {
+			continue
+		}
+		vanished = append(vanished, relPath)
+		for _, asset := range album.Assets {
+			key := fileKey(asset.Filename, asset.SizeBytes)
+			holders[key] = append(holders[key], relPath)
+		}
+	}
+	if len(vanished) == 0 {
+		return nil
+	}
+	sort.Strings(vanished)
+
+	// shared counts the files each new album shares with each vanished one.
+	shared := make(map[[2]string]int)
+	for _, relPath := range paths {
+		if _, ok := last.Albums[relPath]; ok {
+			continue
+		}
+		for _, sa := range scan.Albums[relPath].Assets {
+			for _, from := range holders[fileKey(sa.Filename, sa.SizeBytes)] {
+				shared[[2]string{from, relPath}]++
+			}
+		}
+	}
+	best := func(side int) map[string]string {
+		top := make(map[string]int)
+		match := make(map[string]string)
+		for pair, n := range shared {
+			k, other := pair[side], pair[1-side]
+			switch {
+			case n > top[k]:
+				top[k], match[k] = n, other
+			case n == top[k]:
+				match[k] = "" // a tie: no best match
+			}
+		}
+		return match
+	}
+	bestTo, bestFrom := best(0), best(1)
+
+	var gone []string
+	for _, from := range vanished {
+		to := bestTo[from]
+		if to == "" || bestFrom[to] != from || 2*shared[[2]string{from, to}] <= len(last.Albums[from].Assets) {
+			gone = append(gone, from)
+			continue
+		}
+		err := state.MoveAlbumState(dir(from), dir(to))
+		switch {
+		case err == nil:
+			slog.Info("album moved, keeping its ID", "from", from, "to", to)
+		case errors.Is(err, fs.ErrExist):
+			// The state moved with the directory.
+		case errors.Is(err, fs.ErrNotExist):
+			gone = append(gone, from)
+		default:
+			slog.Warn("failed to migrate album state", "from", from, "to", to, "error", err)
+			gone = append(gone, from)
+		}
+	}
+	return gone
+}
+
+// fileKey identifies a file by name and size for [matchAlbumMoves].
+func fileKey(name string, size int64) string {
+	return name + "\x00" + strconv.FormatInt(size, 10)
+}
+
+// matchMoves gives new files the sidecars of vanished assets with the
+// same content, so renamed and moved files keep their IDs. With prev nil
+// (a full build) every orphaned sidecar in builds is a candidate; in an
+// incremental update only assets that were in prev are, and they remain
+// candidates for the rename window, so a move split across two updates is
+// still recognised. The sidecars of the albums in gone, which vanished
+// altogether, are candidates too. A fingerprint shared by several
+// candidates or several new files is not migrated but reported.
+func (b *Builder) matchMoves(workers int, dir func(string) string, builds []*albumBuild, gone []string, prev *domain.Snapshot) []domain.IdentityIssue {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	window := b.RenameWindow
+	if window <= 0 {
+		window = DefaultRenameWindow
+	}
+	if b.vanished == nil {
+		b.vanished = make(map[string]*vanishedAsset)
+	}
+	for key, v := range b.vanished {
+		if now.Sub(v.since) > window {
+			delete(b.vanished, key)
+		}
+	}
+
+	addCandidate := func(albumPath, absPath, name string) {
+		key := filepath.Join(absPath, name)
+		if _, ok := b.vanished[key]; ok {
+			return
+		}
+		st, err := state.LoadAssetState(absPath, name)
+		if err != nil || st == nil || st.ObjectID == "" || st.Fingerprint == "" {
+			return
+		}
+		b.vanished[key] = &vanishedAsset{
+			albumPath: albumPath,
+			absPath:   absPath,
+			filename:  name,
+			id:        st.ObjectID,
+			fp:        st.Fingerprint,
+			since:     now,
+		}
+	}
+	for _, relPath := range gone {
+		absPath := dir(relPath)
+		names, err := state.ListAssetStates(absPath)
+		if err != nil {
+			slog.Warn("listing state of vanished album", "album", relPath, "error", err)
+			continue
+		}
+		for _, name := range names {
+			addCandidate(relPath, absPath, name)
+		}
+	}
+	for _, ab := range builds {
+		var known map[string]bool
+		if prev != nil {
+			known = make(map[string]bool)
+			if pa, ok := prev.Albums[ab.album.Path]; ok {
+				for _, asset := range pa.Assets {
+					known[asset.Filename] = true
+				}
+			}
+		}
+		for _, name := range ab.orphans {
+			if prev == nil || known[name] {
+				addCandidate(ab.album.Path, ab.absPath, name)
+			}
+		}
+	}
+	if len(b.vanished) == 0 {
+		return nil
+	}
+
+	// Only files of a size some candidate has are worth hashing.
+	sizes := make(map[int64]bool)
+	for _, v := range b.vanished {
+		sizes[fingerprintSize(v.fp)] = true
+	}
+	var arrivals []arrival
+	for _, ab := range builds {
+		for _, i := range ab.arrivals {
+			if sizes[ab.scanned.Assets[i].SizeBytes] {
+				arrivals = append(arrivals, arrival{ab, i})
+			}
+		}
+	}
+	_ = forEach(workers, len(arrivals), func(k int) error {
+		a := arrivals[k]
+		fp, err := fingerprint(filepath.Join(a.ab.absPath, a.filename()))
+		if err != nil {
+			slog.Warn("fingerprinting failed", "album", a.ab.album.Path, "file", a.filename(), "error", err)
+			return nil
+		}
+		a.ab.fingerprints[a.i] = fp
+		return nil
+	})
+
+	candidates := make(map[string][]*vanishedAsset)
+	for _, v := range b.vanished {
+		candidates[v.fp] = append(candidates[v.fp], v)
+	}
+	matches := make(map[string][]arrival)
+	for _, a := range arrivals {
+		if fp := a.ab.fingerprints[a.i]; fp != "" && len(candidates[fp]) > 0 {
+			matches[fp] = append(matches[fp], a)
+		}
+	}
+	fps := make([]string, 0, len(matches))
+	for fp := range matches {
+		fps = append(fps, fp)
+	}
+	sort.Strings(fps)
+
+	var issues []domain.IdentityIssue
+	for _, fp := range fps {
+		cands, arrs := candidates[fp], matches[fp]
+		sort.Slice(cands, func(i, j int) bool { return cands[i].id < cands[j].id })
+		switch {
+		case len(cands) > 1:
+			ids := make([]string, len(cands))
+			for i, v := range cands {
+				ids[i] = v.id
+			}
+			for _, a := range arrs {
+				issues = append(issues, domain.IdentityIssue{
+					AlbumPath: a.ab.album.Path,
+					Filename:  a.filename(),
+					Message: fmt.Sprintf("content matches %d vanished assets (%s); assigned a new ID",
+						len(cands), strings.Join(ids, ", ")),
+				})
+			}
+		case len(arrs) > 1:
+			v := cands[0]
+			for _, a := range arrs {
+				issues = append(issues, domain.IdentityIssue{
+					AlbumPath: a.ab.album.Path,
+					Filename:  a.filename(),
+					Message: fmt.Sprintf("content matches vanished asset %s (%s), as do %d other new files; assigned a new ID",
+						v.id, filepath.Join(v.albumPath, v.filename), len(arrs)-1),
+				})
+			}
+		default:
+			b.migrate(cands[0], arrs[0])
+		}
+	}
+	return issues
+}
+
+// migrate moves the sidecar of v to the new file a. Must be called with
+// b.mu held.
+func (b *Builder) migrate(v *vanishedAsset, a arrival) {
+	key := filepath.Join(v.absPath, v.filename)
+	delete(b.vanished, key)
+	// The file may have come back since it vanished; its ID stays there.
+	if _, err := os.Stat(key); !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err := state.MoveAssetState(v.absPath, v.filename, a.ab.absPath, a.filename()); err != nil {
+		slog.Warn("failed to migrate asset state", "id", v.id, "from", filepath.Join(v.albumPath, v.filename), "error", err)
+		return
+	}
+	slog.Info("asset moved, keeping its ID", "id", v.id,
+		"from", filepath.Join(v.albumPath, v.filename),
+		"to", filepath.Join(a.ab.album.Path, a.filename()))
+}
@@ -0,0 +1,297 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perrito666/gollery/backend/internal/domain"
+	"github.com/perrito666/gollery/backend/internal/fswalk"
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+func writeContent(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func rename(t *testing.T, from, to string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func scanTree(t *testing.T, root string) *fswalk.ScanResult {
+	t.Helper()
+	scan, err := fswalk.Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scan
+}
+
+func assetID(t *testing.T, b *Builder, root, album, filename string) string {
+	t.Helper()
+	snap, err := b.Build(root, scanTree(t, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, ok := snap.Albums[album]
+	if !ok {
+		t.Fatalf("album %q missing", album)
+	}
+	for _, asset := range a.Assets {
+		if asset.Filename == filename {
+			return asset.ID
+		}
+	}
+	t.Fatalf("asset %q missing from %q", filename, album)
+	return ""
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	big := strings.Repeat("x", 3*fingerprintChunk)
+	for name, content := range map[string]string{"small": "abc", "mid": big[:fingerprintChunk+10], "big": big} {
+		path := filepath.Join(dir, name)
+		writeContent(t, path, content)
+		fp, err := fingerprint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fingerprintSize(fp); got != int64(len(content)) {
+			t.Errorf("%s: size %d, want %d", name, got, len(content))
+		}
+	}
+
+	// A change in the middle of a large file is not seen, one at the end is.
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeContent(t, a, big)
+	writeContent(t, b, big[:len(big)-1]+"y")
+	fa, _ := fingerprint(a)
+	fb, _ := fingerprint(b)
+	if fa == fb {
+		t.Error("files differing in the tail should differ")
+	}
+	if fingerprintSize("garbage") != -1 {
+		t.Error("unparseable fingerprint should have size -1")
+	}
+}
+
+func TestBuild_RenameAndMoveKeepID(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeContent(t, filepath.Join(root, "trip", "a.jpg"), "content a")
+	writeContent(t, filepath.Join(root, "trip", "b.jpg"), "content b")
+
+	b := &Builder{}
+	idA := assetID(t, b, root, "trip", "a.jpg")
+	idB := assetID(t, b, root, "trip", "b.jpg")
+
+	rename(t, filepath.Join(root, "trip", "a.jpg"), filepath.Join(root, "trip", "renamed.jpg"))
+	rename(t, filepath.Join(root, "trip", "b.jpg"), filepath.Join(root, "other", "b.jpg"))
+
+	if got := assetID(t, b, root, "trip", "renamed.jpg"); got != idA {
+		t.Errorf("renamed asset ID = %s, want %s", got, idA)
+	}
+	if got := assetID(t, b, root, "other", "b.jpg"); got != idB {
+		t.Errorf("moved asset ID = %s, want %s", got, idB)
+	}
+	if _, err := os.Stat(filepath.Join(root, "trip", ".gallery", "assets", "a.jpg.json")); !os.IsNotExist(err) {
+		t.Error("old sidecar should have been moved")
+	}
+}
+
+func TestBuild_LegacySidecarsAreNotRewritten(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeContent(t, filepath.Join(root, "a.jpg"), "content a")
+	legacy := &state.AssetState{ObjectID: "ast_legacy", GeoResolved: true, DateResolved: true, PlaceResolved: true}
+	if err := state.SaveAssetState(root, "a.jpg", legacy); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(state.AssetStatePath(root, "a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := BuildSnapshot(root, scanTree(t, root)); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.ReadFile(state.AssetStatePath(root, "a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("sidecar rewritten to add a fingerprint:\n%s", after)
+	}
+}
+
+func TestUpdate_MoveAcrossUpdatesWithinWindow(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeContent(t, filepath.Join(root, "a", "x.jpg"), "content x")
+	writeContent(t, filepath.Join(root, "b", "keep.jpg"), "content keep")
+
+	b := &Builder{}
+	scan := scanTree(t, root)
+	snap, err := b.Build(root, scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := snap.Albums["a"].Assets[0].ID
+
+	// The file leaves a in one update and shows up in b in the next.
+	staging := filepath.Join(t.TempDir(), "x.jpg")
+	rename(t, filepath.Join(root, "a", "x.jpg"), staging)
+	scan, changed, err := fswalk.Rescan(root, scan, []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap, err = b.Update(root, snap, scan, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	rename(t, staging, filepath.Join(root, "b", "y.jpg"))
+	scan, changed, err = fswalk.Rescan(root, scan, []string{"b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap, err = b.Update(root, snap, scan, changed); err != nil {
+		t.Fatal(err)
+	}
+	for _, asset := range snap.Albums["b"].Assets {
+		if asset.Filename == "y.jpg" && asset.ID != id {
+			t.Errorf("moved asset ID = %s, want %s", asset.ID, id)
+		}
+	}
+
+	// Once the window has passed, a returning copy gets a new ID.
+	b.RenameWindow = time.Nanosecond
+	rename(t, filepath.Join(root, "b", "y.jpg"), staging)
+	scan, changed, _ = fswalk.Rescan(root, scan, []string{"b"})
+	if snap, err = b.Update(root, snap, scan, changed); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	rename(t, staging, filepath.Join(root, "a", "z.jpg"))
+	scan, changed, _ = fswalk.Rescan(root, scan, []string{"a"})
+	if snap, err = b.Update(root, snap, scan, changed); err != nil {
+		t.Fatal(err)
+	}
+	if got := snap.Albums["a"].Assets[0].ID; got == id {
+		t.Error("asset outside the rename window should get a new ID")
+	}
+}
+
+func TestBuild_AmbiguousMatchIsReported(t *testing.T) {
+	root := t.TempDir()
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeContent(t, filepath.Join(root, "a", "one.jpg"), "same")
+	writeContent(t, filepath.Join(root, "b", "two.jpg"), "same")
+
+	b := &Builder{}
+	idOne := assetID(t, b, root, "a", "one.jpg")
+	idTwo := assetID(t, b, root, "b", "two.jpg")
+
+	if err := os.Remove(filepath.Join(root, "a", "one.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "b", "two.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	writeContent(t, filepath.Join(root, "c", "three.jpg"), "same")
+
+	snap, err := b.Build(root, scanTree(t, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := snap.Albums["c"].Assets[0].ID
+	if got == idOne || got == idTwo {
+		t.Errorf("ambiguous match should get a new ID, got %s", got)
+	}
+	if len(snap.IdentityIssues) != 1 {
+		t.Fatalf("issues = %+v, want 1", snap.IdentityIssues)
+	}
+	issue := snap.IdentityIssues[0]
+	if issue.AlbumPath != "c" || issue.Filename != "three.jpg" ||
+		!strings.Contains(issue.Message, idOne) || !strings.Contains(issue.Message, idTwo) {
+		t.Errorf("issue = %+v", issue)
+	}
+}
+
+func TestRenamedAlbumKeepsStateUnderStateRoot(t *testing.T) {
+	root, stateRoot := t.TempDir(), t.TempDir()
+	state.SetStateRoot(root, stateRoot)
+	t.Cleanup(func() { state.SetStateRoot(root, "") })
+	writeAlbumJSON(t, root, `{"title": "Root"}`)
+	writeContent(t, filepath.Join(root, "a", "w.jpg"), "content w")
+	writeContent(t, filepath.Join(root, "a", "x.jpg"), "content x")
+	writeContent(t, filepath.Join(root, "a", "sub", "y.jpg"), "content y")
+	writeContent(t, filepath.Join(root, "old", "z.jpg"), "content z")
+
+	b := &Builder{}
+	scan := scanTree(t, root)
+	snap, err := b.Build(root, scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	albumID := snap.Albums["a"].ID
+	x := snap.Albums["a"].Assets[1]
+	y := snap.Albums["a/sub"].Assets[0]
+	z := snap.Albums["old"].Assets[0]
+	st, err := state.LoadAssetState(filepath.Join(root, "a"), "x.jpg")
+	if err != nil || st == nil {
+		t.Fatalf("asset state = %v, %v", st, err)
+	}
+	st.AccessOverride = &state.AccessOverride{View: "restricted"}
+	if err := state.SaveAssetState(filepath.Join(root, "a"), "x.jpg", st); err != nil {
+		t.Fatal(err)
+	}
+	if snap, err = b.Build(root, scan); err != nil {
+		t.Fatal(err)
+	}
+
+	// a/ is renamed to b/, sub-album included, and old/ is removed after
+	// its file was moved into b/.
+	rename(t, filepath.Join(root, "a"), filepath.Join(root, "b"))
+	rename(t, filepath.Join(root, "old", "z.jpg"), filepath.Join(root, "b", "z.jpg"))
+	if err := os.Remove(filepath.Join(root, "old")); err != nil {
+		t.Fatal(err)
+	}
+	scan, changed, err := fswalk.Rescan(root, scan, []string{"", "a", "b", "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap, err = b.Update(root, snap, scan, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := snap.Albums["b"].ID; got != albumID {
+		t.Errorf("renamed album ID = %s, want %s", got, albumID)
+	}
+	ids := make(map[string]domain.Asset)
+	for _, asset := range snap.Albums["b"].Assets {
+		ids[asset.Filename] = asset
+	}
+	if got := ids["x.jpg"]; got.ID != x.ID || got.Access == nil || got.Access.View != "restricted" {
+		t.Errorf("renamed asset = %+v, want ID %s with its access override", got, x.ID)
+	}
+	if got := ids["z.jpg"]; got.ID != z.ID {
+		t.Errorf("asset moved out of a removed album = %s, want %s", got.ID, z.ID)
+	}
+	if got := snap.Albums["b/sub"].Assets[0].ID; got != y.ID {
+		t.Errorf("asset of renamed sub-album = %s, want %s", got, y.ID)
+	}
+}
@@ -0,0 +1,296 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TIFF field types used by the test fixtures.
+const (
+	tiffASCII    = 2
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+// ifdEntry is one tag of a hand-built TIFF directory.
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func asciiEntry(tag uint16, s string) ifdEntry {
+	b := append([]byte(s), 0)
+	return ifdEntry{tag: tag, typ: tiffASCII, count: uint32(len(b)), data: b}
+}
+
+func rationalEntry(tag uint16, vals ...[2]uint32) ifdEntry {
+	var b []byte
+	for _, v := range vals {
+		b = binary.LittleEndian.AppendUint32(b, v[0])
+		b = binary.LittleEndian.AppendUint32(b, v[1])
+	}
+	return ifdEntry{tag: tag, typ: tiffRational, count: uint32(len(vals)), data: b}
+}
+
+func longEntry(tag uint16, v uint32) ifdEntry {
+	return ifdEntry{tag: tag, typ: tiffLong, count: 1, data: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+// encodeIFD lays out a directory starting at offset start, with values
+// longer than four bytes stored right after it.
+func encodeIFD(start int, entries []ifdEntry) []byte {
+	le := binary.LittleEndian
+	var dir, extra []byte
+	dir = le.AppendUint16(dir, uint16(len(entries)))
+	dataOff := start + 2 + 12*len(entries) + 4
+	for _, e := range entries {
+		dir = le.AppendUint16(dir, e.tag)
+		dir = le.AppendUint16(dir, e.typ)
+		dir = le.AppendUint32(dir, e.count)
+		if len(e.data) <= 4 {
+			v := make([]byte, 4)
+			copy(v, e.data)
+			dir = append(dir, v...)
+			continue
+		}
+		dir = le.AppendUint32(dir, uint32(dataOff+len(extra)))
+		extra = append(extra, e.data...)
+	}
+	dir = le.AppendUint32(dir, 0) // no next IFD
+	return append(dir, extra...)
+}
+
+// writeEXIFJPEG writes a small JPEG whose APP1 segment holds an Exif
+// sub-IFD with exifEntries and, if non-empty, a GPS IFD with gpsEntries.
+func writeEXIFJPEG(t *testing.T, path string, exifEntries, gpsEntries []ifdEntry) {
+	t.Helper()
+
+	const ifd0Start = 8
+	ifd0Len := 2 + 12*2 + 4
+	exifStart := ifd0Start + ifd0Len
+	exifIFD := encodeIFD(exifStart, exifEntries)
+	gpsStart := exifStart + len(exifIFD)
+	gpsIFD := encodeIFD(gpsStart, gpsEntries)
+
+	ifd0 := encodeIFD(ifd0Start, []ifdEntry{
+		longEntry(0x8769, uint32(exifStart)), // ExifIFDPointer
+		longEntry(0x8825, uint32(gpsStart)),  // GPSInfoIFDPointer
+	})
+
+	var tiffData bytes.Buffer
+	tiffData.WriteString("II")
+	binary.Write(&tiffData, binary.LittleEndian, uint16(42))
+	binary.Write(&tiffData, binary.LittleEndian, uint32(ifd0Start))
+	tiffData.Write(ifd0)
+	tiffData.Write(exifIFD)
+	tiffData.Write(gpsIFD)
+
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	app1 := append([]byte("Exif\x00\x00"), tiffData.Bytes()...)
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(app1)+2))
+	out.Write(app1)
+	out.Write(img.Bytes()[2:]) // skip the encoder's own SOI marker
+
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtract_DateTakenWithOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tz.jpg")
+	writeEXIFJPEG(t, path, []ifdEntry{
+		asciiEntry(0x9003, "2024:06:15 12:00:00"), // DateTimeOriginal
+		asciiEntry(0x9011, "+09:00"),              // OffsetTimeOriginal
+	}, nil)
+
+	m, err := Extract(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.DateTaken == nil {
+		t.Fatal("date taken should be set")
+	}
+	if !m.DateTakenHasOffset {
+		t.Error("DateTakenHasOffset should be true")
+	}
+	if got := m.DateTaken.UTC().Hour(); got != 3 {
+		t.Errorf("UTC hour = %d, want 3", got)
+	}
+}
+
+func TestExtract_DateTakenWithoutOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "local.jpg")
+	writeEXIFJPEG(t, path, []ifdEntry{
+		asciiEntry(0x9003, "2024:06:15 12:00:00"),
+	}, nil)
+
+	m, err := Extract(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.DateTaken == nil {
+		t.Fatal("date taken should be set")
+	}
+	if m.DateTakenHasOffset {
+		t.Error("DateTakenHasOffset should be false without OffsetTimeOriginal")
+	}
+	// Wall-clock reading is preserved in UTC for later zone resolution.
+	if m.DateTaken.Location() != time.UTC || m.DateTaken.Hour() != 12 {
+		t.Errorf("date taken = %v, want 12:00 wall clock in UTC", m.DateTaken)
+	}
+}
+
+func TestExtract_GPS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gps.jpg")
+	writeEXIFJPEG(t, path, nil, []ifdEntry{
+		asciiEntry(0x0001, "N"),
+		rationalEntry(0x0002, [2]uint32{48, 1}, [2]uint32{51, 1}, [2]uint32{2376, 100}),
+		asciiEntry(0x0003, "E"),
+		rationalEntry(0x0004, [2]uint32{2, 1}, [2]uint32{21, 1}, [2]uint32{792, 100}),
+	})
+
+	m, err := Extract(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Latitude == nil || m.Longitude == nil {
+		t.Fatal("expected GPS coordinates")
+	}
+	if *m.Latitude < 48.85 || *m.Latitude > 48.86 {
+		t.Errorf("lat = %f, want ~48.8566", *m.Latitude)
+	}
+	if *m.Longitude < 2.35 || *m.Longitude > 2.36 {
+		t.Errorf("lon = %f, want ~2.3522", *m.Longitude)
+	}
+}
+
+func byteEntry(tag uint16, v byte) ifdEntry {
+	return ifdEntry{tag: tag, typ: 1, count: 1, data: []byte{v}}
+}
+
+func TestExtract_Altitude(t *testing.T) {
+	tests := []struct {
+		name string
+		ref  byte
+		want float64
+	}{
+		{"above sea level", 0, 1234.5},
+		{"below sea level", 1, -1234.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "alt.jpg")
+			writeEXIFJPEG(t, path, nil, []ifdEntry{
+				byteEntry(0x0005, tt.ref),                   // GPSAltitudeRef
+				rationalEntry(0x0006, [2]uint32{12345, 10}), // GPSAltitude
+			})
+
+			m, err := Extract(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Altitude == nil || *m.Altitude != tt.want {
+				t.Errorf("altitude = %v, want %v", m.Altitude, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripJPEGLocation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gps.jpg")
+	writeEXIFJPEG(t, path, []ifdEntry{
+		asciiEntry(0x9003, "2024:06:15 12:00:00"),
+	}, []ifdEntry{
+		asciiEntry(0x0001, "N"),
+		rationalEntry(0x0002, [2]uint32{48, 1}, [2]uint32{51, 1}, [2]uint32{2376, 100}),
+		asciiEntry(0x0003, "E"),
+		rationalEntry(0x0004, [2]uint32{2, 1}, [2]uint32{21, 1}, [2]uint32{792, 100}),
+	})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Append an XMP packet carrying the coordinates after the Exif segment.
+	xmp := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), `<exif:GPSLatitude>48,51.396N</exif:GPSLatitude>`...)
+	seg := append([]byte{0xFF, 0xE1}, binary.BigEndian.AppendUint16(nil, uint16(len(xmp)+2))...)
+	trailer := data
+	data = append(data[:2:2], append(append(seg, xmp...), data[2:]...)...)
+	// A secondary image after the main one, as in MPF or motion photo
+	// files, with its own GPS directory.
+	data = append(data, trailer...)
+
+	var buf bytes.Buffer
+	if err := StripJPEGLocation(&buf, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	stripped := buf.Bytes()
+	if bytes.Contains(stripped, []byte("GPSLatitude")) {
+		t.Error("XMP packet should be dropped")
+	}
+	if n := bytes.Count(stripped, exifHeader); n != 1 {
+		t.Errorf("stripped file has %d Exif segments, want the trailing image dropped", n)
+	}
+	if !bytes.HasSuffix(stripped, []byte{0xFF, 0xD9}) {
+		t.Error("stripped file should end at the first image's EOI")
+	}
+	out := filepath.Join(t.TempDir(), "stripped.jpg")
+	if err := os.WriteFile(out, stripped, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Extract(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Latitude != nil || m.Longitude != nil {
+		t.Errorf("coordinates survived: %v, %v", *m.Latitude, *m.Longitude)
+	}
+	if m.DateTaken == nil {
+		t.Error("the rest of EXIF should be kept")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("stripped file no longer decodes: %v", err)
+	}
+
+	buf.Reset()
+	if err := StripJPEGLocation(&buf, bytes.NewReader([]byte("not a jpeg"))); err == nil {
+		t.Error("expected error for non-JPEG input")
+	}
+	// Files that fail before the first scan write nothing.
+	buf.Reset()
+	if err := StripJPEGLocation(&buf, bytes.NewReader(data[:40])); err == nil || buf.Len() != 0 {
+		t.Errorf("truncated header: err = %v, %d bytes written", err, buf.Len())
+	}
+}
+
+func TestStripJPEGLocation_StreamsScans(t *testing.T) {
+	// Noise compresses badly, so the scan outgrows the read buffer.
+	img := image.NewGray(image.Rect(0, 0, 256, 256))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7919 >> 3)
+	}
+	var src bytes.Buffer
+	if err := jpeg.Encode(&src, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := StripJPEGLocation(&out, bytes.NewReader(src.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), src.Bytes()) {
+		t.Errorf("a file without a location should be copied unchanged (%d bytes in, %d out)", src.Len(), out.Len())
+	}
+}
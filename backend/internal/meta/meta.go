@@ -2,14 +2,64 @@
 package meta
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
 
 	"github.com/perrito666/gollery/backend/internal/domain"
 )
 
+// EXIF 2.31 offset tags. goexif predates them, so they are loaded by
+// [offsetParser] from the Exif sub-IFD under these field names.
+const (
+	OffsetTime         exif.FieldName = "OffsetTime"
+	OffsetTimeOriginal exif.FieldName = "OffsetTimeOriginal"
+)
+
+var offsetFields = map[uint16]exif.FieldName{
+	0x9010: OffsetTime,
+	0x9011: OffsetTimeOriginal,
+}
+
+// exifTimeLayout is the EXIF DateTime format ("YYYY:MM:DD HH:MM:SS").
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+func init() {
+	exif.RegisterParsers(offsetParser{})
+}
+
+// offsetParser loads the OffsetTime* tags from the Exif sub-IFD.
+// Parse errors are swallowed: the tags are optional and a broken
+// sub-IFD must not hide the fields goexif already decoded.
+type offsetParser struct{}
+
+func (offsetParser) Parse(x *exif.Exif) error {
+	tag, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return nil
+	}
+	offset, err := tag.Int64(0)
+	if err != nil {
+		return nil
+	}
+	r := bytes.NewReader(x.Raw)
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil
+	}
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return nil
+	}
+	x.LoadTags(dir, offsetFields, false)
+	return nil
+}
+
 // Extract reads EXIF metadata from a JPEG file.
 // Returns a zero ImageMetadata (not an error) for files without EXIF data.
 func Extract(filePath string) (*domain.ImageMetadata, error) {
@@ -48,13 +98,90 @@ func Extract(filePath string) (*domain.ImageMetadata, error) {
 			m.Height = v
 		}
 	}
-	if t, err := x.DateTime(); err == nil {
+	if t, hasOffset, ok := dateTaken(x); ok {
 		m.DateTaken = &t
+		m.DateTakenHasOffset = hasOffset
 	}
 	if lat, lon, err := x.LatLong(); err == nil {
 		m.Latitude = &lat
 		m.Longitude = &lon
 	}
+	if alt, ok := altitude(x); ok {
+		m.Altitude = &alt
+	}
 
 	return m, nil
 }
+
+// altitude reads GPSAltitude in meters, negated when GPSAltitudeRef
+// marks it as below sea level.
+func altitude(x *exif.Exif) (float64, bool) {
+	tag, err := x.Get(exif.GPSAltitude)
+	if err != nil {
+		return 0, false
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return 0, false
+	}
+	alt := float64(num) / float64(den)
+	if ref, err := x.Get(exif.GPSAltitudeRef); err == nil {
+		if v, err := ref.Int(0); err == nil && v == 1 {
+			alt = -alt
+		}
+	}
+	return alt, true
+}
+
+// dateTaken reads DateTimeOriginal (falling back to DateTime). When the
+// matching OffsetTime* tag is present the result is an absolute time in
+// that fixed zone. Otherwise the camera's wall-clock reading is returned
+// with a UTC location and hasOffset=false, leaving zone resolution to
+// the caller.
+func dateTaken(x *exif.Exif) (t time.Time, hasOffset, ok bool) {
+	dateField, offsetField := exif.DateTimeOriginal, OffsetTimeOriginal
+	dateStr, ok := stringTag(x, dateField)
+	if !ok {
+		dateField, offsetField = exif.DateTime, OffsetTime
+		if dateStr, ok = stringTag(x, dateField); !ok {
+			return time.Time{}, false, false
+		}
+	}
+
+	if offStr, ok := stringTag(x, offsetField); ok {
+		if loc, ok := parseOffset(offStr); ok {
+			if t, err := time.ParseInLocation(exifTimeLayout, dateStr, loc); err == nil {
+				return t, true, true
+			}
+		}
+	}
+
+	t, err := time.ParseInLocation(exifTimeLayout, dateStr, time.UTC)
+	if err != nil {
+		return time.Time{}, false, false
+	}
+	return t, false, true
+}
+
+// parseOffset parses an EXIF offset string such as "+02:00" or "-05:30".
+func parseOffset(s string) (*time.Location, bool) {
+	t, err := time.Parse("-07:00", s)
+	if err != nil {
+		return nil, false
+	}
+	_, secs := t.Zone()
+	return time.FixedZone(s, secs), true
+}
+
+func stringTag(x *exif.Exif, name exif.FieldName) (string, bool) {
+	tag, err := x.Get(name)
+	if err != nil {
+		return "", false
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return "", false
+	}
+	s = strings.TrimSpace(strings.TrimRight(s, "\x00"))
+	return s, s != ""
+}
@@ -0,0 +1,250 @@
+package meta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// JPEG APP1 payload prefixes.
+var (
+	exifHeader        = []byte("Exif\x00\x00")
+	xmpHeader         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtendedHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	mpfHeader         = []byte("MPF\x00")
+)
+
+const tagGPSInfoIFD = 0x8825
+
+// tiffTypeSizes maps TIFF field types to their size in bytes.
+var tiffTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// StripJPEGLocation copies a JPEG file from r to w with its location
+// removed: the EXIF GPS directory is blanked in place (so orientation,
+// capture time and the rest of EXIF survive) and XMP packets, which may
+// repeat the coordinates, are dropped. Image data is copied unchanged.
+// The file ends at the first image's EOI: images stored after it, such as
+// MPF secondary images or motion photo trailers, carry their own EXIF and
+// are dropped together with the MPF index that points at them.
+//
+// The segments before the first scan are held back until it is reached,
+// so a file that fails to parse up to there leaves w untouched; past it,
+// the file is streamed.
+func StripJPEGLocation(w io.Writer, r io.Reader) error {
+	s := &jpegStripper{r: bufio.NewReader(r), w: w}
+	var soi [2]byte
+	if _, err := io.ReadFull(s.r, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return errors.New("not a JPEG file")
+	}
+	s.write(soi[:])
+	err := s.run()
+	if err == nil {
+		s.flush()
+		err = s.err
+	}
+	return err
+}
+
+// jpegStripper holds the state of [StripJPEGLocation].
+type jpegStripper struct {
+	r *bufio.Reader
+	w io.Writer
+
+	// head collects the output until the first scan.
+	head      bytes.Buffer
+	streaming bool
+
+	// err is the first write error.
+	err error
+}
+
+// write appends p to the output.
+func (s *jpegStripper) write(p []byte) {
+	switch {
+	case s.err != nil:
+	case s.streaming:
+		_, s.err = s.w.Write(p)
+	default:
+		s.head.Write(p)
+	}
+}
+
+// flush writes the held back segments and streams the rest.
+func (s *jpegStripper) flush() {
+	if !s.streaming {
+		s.streaming = true
+		s.write(s.head.Bytes())
+	}
+}
+
+// run copies the segments following SOI up to EOI or the end of input.
+func (s *jpegStripper) run() error {
+	for s.err == nil {
+		b, err := s.r.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		marker, err := s.r.ReadByte()
+		if b != 0xFF || err != nil {
+			return errors.New("jpeg: malformed marker")
+		}
+		switch {
+		case marker == 0xFF:
+			// Fill byte.
+			s.write([]byte{0xFF})
+			s.r.UnreadByte()
+			continue
+		case marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			s.write([]byte{0xFF, marker})
+			continue
+		case marker == 0xD9:
+			s.write([]byte{0xFF, marker})
+			return nil
+		}
+
+		var size [2]byte
+		if _, err := io.ReadFull(s.r, size[:]); err != nil {
+			return errors.New("jpeg: truncated segment")
+		}
+		n := int(binary.BigEndian.Uint16(size[:]))
+		if n < 2 {
+			return errors.New("jpeg: truncated segment")
+		}
+		seg := append([]byte{0xFF, marker, size[0], size[1]}, make([]byte, n-2)...)
+		if _, err := io.ReadFull(s.r, seg[4:]); err != nil {
+			return errors.New("jpeg: truncated segment")
+		}
+
+		switch payload := seg[4:]; marker {
+		case 0xE1:
+			switch {
+			case bytes.HasPrefix(payload, xmpHeader), bytes.HasPrefix(payload, xmpExtendedHeader):
+				continue
+			case bytes.HasPrefix(payload, exifHeader):
+				blankGPS(payload[len(exifHeader):])
+			}
+		case 0xE2:
+			if bytes.HasPrefix(payload, mpfHeader) {
+				continue
+			}
+		case 0xDA:
+			// Start of scan: the entropy-coded data runs up to the next
+			// marker other than a restart marker.
+			s.write(seg)
+			s.flush()
+			if err := s.copyEntropy(); err != nil {
+				return err
+			}
+			continue
+		}
+		s.write(seg)
+	}
+	return nil
+}
+
+// copyEntropy copies entropy-coded data up to the first marker that ends
+// it, or the end of input.
+func (s *jpegStripper) copyEntropy() error {
+	for s.err == nil {
+		if _, err := s.r.Peek(2); err == io.EOF {
+			rest, _ := s.r.Peek(s.r.Buffered())
+			s.write(rest)
+			s.r.Discard(len(rest))
+			return nil
+		} else if err != nil && err != bufio.ErrBufferFull {
+			return err
+		}
+		data, _ := s.r.Peek(s.r.Buffered())
+		i := bytes.IndexByte(data, 0xFF)
+		switch {
+		case i < 0:
+			i = len(data)
+		case i+1 == len(data):
+			// The byte after 0xFF is not buffered yet.
+		default:
+			switch next := data[i+1]; {
+			case next == 0xFF:
+				// Fill byte.
+				i++
+			case next == 0x00, next >= 0xD0 && next <= 0xD7:
+				// Stuffed byte or restart marker.
+				i += 2
+			default:
+				s.write(data[:i])
+				s.r.Discard(i)
+				return nil
+			}
+		}
+		s.write(data[:i])
+		s.r.Discard(i)
+	}
+	return nil
+}
+
+// blankGPS empties the GPS directory of a TIFF structure in place: its
+// entries and out-of-line values are zeroed and its entry count set to
+// zero. Malformed structures are left as they are past the first bad
+// offset.
+func blankGPS(tiff []byte) {
+	if len(tiff) < 8 {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+
+	ifd0 := order.Uint32(tiff[4:8])
+	n, ok := ifdCount(tiff, ifd0, order)
+	if !ok {
+		return
+	}
+	for i := range n {
+		e := ifd0 + 2 + 12*i
+		if order.Uint16(tiff[e:]) != tagGPSInfoIFD {
+			continue
+		}
+		gps := order.Uint32(tiff[e+8:])
+		gn, ok := ifdCount(tiff, gps, order)
+		if !ok {
+			return
+		}
+		for j := range gn {
+			ge := gps + 2 + 12*j
+			size := tiffTypeSizes[order.Uint16(tiff[ge+2:])] * order.Uint32(tiff[ge+4:])
+			if size > 4 {
+				if off := order.Uint32(tiff[ge+8:]); uint64(off)+uint64(size) <= uint64(len(tiff)) {
+					clear(tiff[off : off+size])
+				}
+			}
+			clear(tiff[ge : ge+12])
+		}
+		order.PutUint16(tiff[gps:], 0)
+		return
+	}
+}
+
+// ifdCount returns the entry count of the directory at off, checking
+// that the directory fits in the buffer.
+func ifdCount(tiff []byte, off uint32, order binary.ByteOrder) (uint32, bool) {
+	if uint64(off)+2 > uint64(len(tiff)) {
+		return 0, false
+	}
+	n := uint32(order.Uint16(tiff[off:]))
+	if uint64(off)+2+12*uint64(n) > uint64(len(tiff)) {
+		return 0, false
+	}
+	return n, true
+}
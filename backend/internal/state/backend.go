@@ -0,0 +1,209 @@
+package state
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/perrito666/gollery/backend/internal/ignore"
+)
+
+// Backend stores album and asset state. Objects are addressed by the
+// absolute path of their album directory and, for assets, their filename,
+// as the scanner finds them; backends that do not keep files next to the
+// content map these to their own keys.
+//
+// Load methods return nil without error for objects that have no state.
+// State that exists but cannot be decoded is reported with an error
+// wrapping [ErrCorrupt].
+type Backend interface {
+	LoadAlbumState(albumAbsPath string) (*AlbumState, error)
+	SaveAlbumState(albumAbsPath string, s *AlbumState) error
+	LoadAssetState(albumAbsPath, filename string) (*AssetState, error)
+	SaveAssetState(albumAbsPath, filename string, s *AssetState) error
+	DeleteAssetState(albumAbsPath, filename string) error
+
+	// ListAssetStates returns the filenames that have asset state in the
+	// album, whether or not the file itself still exists.
+	ListAssetStates(albumAbsPath string) ([]string, error)
+
+	// MoveAssetState rekeys an asset's state, failing with [os.ErrExist]
+	// if the destination already has state.
+	MoveAssetState(fromAlbumAbsPath, fromFilename, toAlbumAbsPath, toFilename string) error
+
+	// MoveAlbumState rekeys an album's state together with that of its
+	// assets, but not of its sub-albums. It fails with [os.ErrExist] if the
+	// destination already has album or asset state, and with
+	// [os.ErrNotExist] if the source has none.
+	MoveAlbumState(fromAlbumAbsPath, toAlbumAbsPath string) error
+
+	// QuarantineAlbumState and QuarantineAssetState set corrupt state
+	// aside, so fresh state can be created, and return where it went.
+	QuarantineAlbumState(albumAbsPath string) (string, error)
+	QuarantineAssetState(albumAbsPath, filename string) (string, error)
+
+	// Location describes where an object's state is kept, for reports:
+	// the album's when filename is empty.
+	Location(albumAbsPath, filename string) string
+}
+
+// backend is the Backend used by the package-level functions.
+var backend struct {
+	sync.RWMutex
+	b Backend
+}
+
+// SetBackend makes the package-level functions use b. A nil b restores
+// the default, [Sidecars]. Like [SetStateRoot], it should be called
+// before any state is read, normally once at startup.
+func SetBackend(b Backend) {
+	backend.Lock()
+	defer backend.Unlock()
+	backend.b = b
+}
+
+func current() Backend {
+	backend.RLock()
+	defer backend.RUnlock()
+	if backend.b == nil {
+		return Sidecars{}
+	}
+	return backend.b
+}
+
+// LoadAlbumState reads the album state.
+// Returns nil without error if there is none.
+func LoadAlbumState(albumAbsPath string) (*AlbumState, error) {
+	return current().LoadAlbumState(albumAbsPath)
+}
+
+// SaveAlbumState writes the album state.
+func SaveAlbumState(albumAbsPath string, s *AlbumState) error {
+	return current().SaveAlbumState(albumAbsPath, s)
+}
+
+// LoadAssetState reads the asset state.
+// Returns nil without error if there is none.
+func LoadAssetState(albumAbsPath, filename string) (*AssetState, error) {
+	return current().LoadAssetState(albumAbsPath, filename)
+}
+
+// SaveAssetState writes the asset state.
+func SaveAssetState(albumAbsPath, filename string, s *AssetState) error {
+	return current().SaveAssetState(albumAbsPath, filename, s)
+}
+
+// DeleteAssetState removes the asset state. Missing state is not an error.
+func DeleteAssetState(albumAbsPath, filename string) error {
+	return current().DeleteAssetState(albumAbsPath, filename)
+}
+
+// ListAssetStates returns the filenames that have asset state in the
+// album, whether or not the file itself still exists.
+func ListAssetStates(albumAbsPath string) ([]string, error) {
+	return current().ListAssetStates(albumAbsPath)
+}
+
+// MoveAssetState moves an asset's state to another filename, possibly in
+// another album, so a renamed or moved file keeps its ID. It fails with
+// [os.ErrExist] if the destination already has state.
+func MoveAssetState(fromAlbumAbsPath, fromFilename, toAlbumAbsPath, toFilename string) error {
+	return current().MoveAssetState(fromAlbumAbsPath, fromFilename, toAlbumAbsPath, toFilename)
+}
+
+// MoveAlbumState moves an album's state and that of its assets to another
+// directory, so a renamed or moved album keeps its IDs when its state is
+// not kept inside it. It fails with [os.ErrExist] if the destination
+// already has state, and with [os.ErrNotExist] if the source has none.
+func MoveAlbumState(fromAlbumAbsPath, toAlbumAbsPath string) error {
+	return current().MoveAlbumState(fromAlbumAbsPath, toAlbumAbsPath)
+}
+
+// QuarantineAlbumState sets the album's corrupt state aside, so a fresh
+// one can be created, and returns where it went.
+func QuarantineAlbumState(albumAbsPath string) (string, error) {
+	return current().QuarantineAlbumState(albumAbsPath)
+}
+
+// QuarantineAssetState sets the asset's corrupt state aside, so a fresh
+// one can be created, and returns where it went.
+func QuarantineAssetState(albumAbsPath, filename string) (string, error) {
+	return current().QuarantineAssetState(albumAbsPath, filename)
+}
+
+// Location describes where an object's state is kept: the album's when
+// filename is empty.
+func Location(albumAbsPath, filename string) string {
+	return current().Location(albumAbsPath, filename)
+}
+
+// CopyReport summarizes a [Copy].
+type CopyReport struct {
+	Albums int
+	Assets int
+
+	// Errors lists the objects that could not be copied.
+	Errors []error
+}
+
+// Copy copies the state of every directory in the content tree from src
+// to dst, overwriting what dst has for the same objects. It visits the
+// directories the scanner does, and copies asset state whether or not the
+// file still exists; state kept for directories that no longer exist is
+// not copied. Objects that fail to load or save are reported and skipped.
+// An error is returned only if the content tree cannot be walked.
+func Copy(dst, src Backend, contentRoot string) (*CopyReport, error) {
+	report := &CopyReport{}
+	fail := func(err error) { report.Errors = append(report.Errors, err) }
+	err := ignore.WalkDir(contentRoot, contentRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != contentRoot && strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+
+		album, err := src.LoadAlbumState(path)
+		switch {
+		case err != nil:
+			fail(fmt.Errorf("%s: %w", src.Location(path, ""), err))
+		case album != nil:
+			if err := dst.SaveAlbumState(path, album); err != nil {
+				fail(fmt.Errorf("%s: %w", dst.Location(path, ""), err))
+			} else {
+				report.Albums++
+			}
+		}
+
+		names, err := src.ListAssetStates(path)
+		if err != nil {
+			fail(fmt.Errorf("%s: %w", path, err))
+			return nil
+		}
+		for _, name := range names {
+			asset, err := src.LoadAssetState(path, name)
+			if err != nil || asset == nil {
+				if err == nil {
+					err = os.ErrNotExist
+				}
+				fail(fmt.Errorf("%s: %w", src.Location(path, name), err))
+				continue
+			}
+			if err := dst.SaveAssetState(path, name, asset); err != nil {
+				fail(fmt.Errorf("%s: %w", dst.Location(path, name), err))
+				continue
+			}
+			report.Assets++
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("walking content tree: %w", err)
+	}
+	return report, nil
+}
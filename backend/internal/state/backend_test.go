@@ -0,0 +1,118 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// memBackend keeps state in maps, keyed by album path and filename.
+type memBackend struct {
+	albums map[string]*AlbumState
+	assets map[[2]string]*AssetState
+}
+
+func newMemBackend() *memBackend {
+	return &memBackend{albums: make(map[string]*AlbumState), assets: make(map[[2]string]*AssetState)}
+}
+
+func (m *memBackend) LoadAlbumState(album string) (*AlbumState, error) { return m.albums[album], nil }
+func (m *memBackend) SaveAlbumState(album string, s *AlbumState) error {
+	m.albums[album] = s
+	return nil
+}
+func (m *memBackend) LoadAssetState(album, name string) (*AssetState, error) {
+	return m.assets[[2]string{album, name}], nil
+}
+func (m *memBackend) SaveAssetState(album, name string, s *AssetState) error {
+	m.assets[[2]string{album, name}] = s
+	return nil
+}
+func (m *memBackend) DeleteAssetState(album, name string) error {
+	delete(m.assets, [2]string{album, name})
+	return nil
+}
+func (m *memBackend) ListAssetStates(album string) ([]string, error) {
+	var names []string
+	for k := range m.assets {
+		if k[0] == album {
+			names = append(names, k[1])
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+func (m *memBackend) MoveAssetState(fromAlbum, fromName, toAlbum, toName string) error {
+	m.assets[[2]string{toAlbum, toName}] = m.assets[[2]string{fromAlbum, fromName}]
+	delete(m.assets, [2]string{fromAlbum, fromName})
+	return nil
+}
+func (m *memBackend) MoveAlbumState(fromAlbum, toAlbum string) error {
+	m.albums[toAlbum] = m.albums[fromAlbum]
+	delete(m.albums, fromAlbum)
+	for k, s := range m.assets {
+		if k[0] == fromAlbum {
+			m.assets[[2]string{toAlbum, k[1]}] = s
+			delete(m.assets, k)
+		}
+	}
+	return nil
+}
+func (m *memBackend) QuarantineAlbumState(album string) (string, error)       { return "", nil }
+func (m *memBackend) QuarantineAssetState(album, name string) (string, error) { return "", nil }
+func (m *memBackend) Location(album, name string) string                      { return "mem:" + filepath.Join(album, name) }
+
+func TestSetBackend(t *testing.T) {
+	mem := newMemBackend()
+	SetBackend(mem)
+	t.Cleanup(func() { SetBackend(nil) })
+
+	dir := t.TempDir()
+	s, created, err := EnsureAssetID(dir, "a.jpg")
+	if err != nil || !created {
+		t.Fatalf("EnsureAssetID = %v, %v", created, err)
+	}
+	if got := mem.assets[[2]string{dir, "a.jpg"}]; got == nil || got.ObjectID != s.ObjectID {
+		t.Errorf("state not in the configured backend: %+v", got)
+	}
+	if _, err := os.Stat(GalleryDir(dir)); !os.IsNotExist(err) {
+		t.Error("no sidecars should be written")
+	}
+}
+
+func TestCopy(t *testing.T) {
+	content := t.TempDir()
+	album := filepath.Join(content, "trips")
+	if err := SaveAlbumState(content, &AlbumState{ObjectID: "alb_root"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAlbumState(album, &AlbumState{ObjectID: "alb_trips"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAssetState(album, "a.jpg", &AssetState{ObjectID: "ast_a", Title: "Beach"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Import into the other backend...
+	mem := newMemBackend()
+	report, err := Copy(mem, Sidecars{}, content)
+	if err != nil || report.Albums != 2 || report.Assets != 1 || len(report.Errors) != 0 {
+		t.Fatalf("import = %+v, %v", report, err)
+	}
+	if got := mem.assets[[2]string{album, "a.jpg"}]; got == nil || got.Title != "Beach" {
+		t.Errorf("imported asset = %+v", got)
+	}
+
+	// ...and export it back over empty sidecars.
+	if err := os.RemoveAll(GalleryDir(album)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Copy(Sidecars{}, mem, content); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadAssetState(album, "a.jpg")
+	if err != nil || got == nil || got.ObjectID != "ast_a" {
+		t.Errorf("exported asset = %+v, %v", got, err)
+	}
+}
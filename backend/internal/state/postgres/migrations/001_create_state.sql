@@ -0,0 +1,32 @@
+-- Album and asset state, keyed by album path relative to the content root
+-- ('' for the root) and filename. The state column holds the same JSON
+-- document the sidecar files do.
+CREATE TABLE IF NOT EXISTS album_state (
+    album_path  TEXT        PRIMARY KEY,
+    state       JSONB       NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS asset_state (
+    album_path  TEXT        NOT NULL,
+    filename    TEXT        NOT NULL,
+    state       JSONB       NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (album_path, filename)
+);
+
+-- State set aside because it could not be decoded; filename is '' for
+-- album state.
+CREATE TABLE IF NOT EXISTS quarantined_state (
+    id              BIGSERIAL   PRIMARY KEY,
+    album_path      TEXT        NOT NULL,
+    filename        TEXT        NOT NULL,
+    state           JSONB       NOT NULL,
+    quarantined_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS quarantined_state;
+DROP TABLE IF EXISTS asset_state;
+DROP TABLE IF EXISTS album_state;
@@ -0,0 +1,391 @@
+// Package postgres implements a state.Backend in PostgreSQL.
+//
+// Album and asset state is stored as the same JSON documents the sidecar
+// files hold, one row per object, keyed by the album's path relative to
+// the content root and the asset's filename. With several libraries the
+// album path starts with the library name, as in the snapshot. Every call
+// is a single statement, so each update is atomic and a rename never
+// loses state. Unlike sidecars, the state does not move when a directory
+// is renamed outside the server; the indexer moves it with
+// [Backend.MoveAlbumState] when it recognises the album at its new path.
+package postgres
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/tern/v2/migrate"
+
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// queryTimeout bounds each statement. The state API has no context: it is
+// called from the indexer and handlers much like file I/O.
+const queryTimeout = 30 * time.Second
+
+// uniqueViolation is the SQLSTATE of a primary key conflict.
+const uniqueViolation = "23505"
+
+// Backend implements state.Backend using PostgreSQL via pgx.
+type Backend struct {
+	pool  *pgxpool.Pool
+	roots []root
+}
+
+// root is a content root whose albums are keyed below prefix.
+type root struct {
+	prefix string
+	dir    string
+}
+
+// New creates a backend for the albums under contentRoot.
+func New(pool *pgxpool.Pool, contentRoot string) *Backend {
+	return &Backend{pool: pool, roots: []root{{dir: filepath.Clean(contentRoot)}}}
+}
+
+// NewLibraries creates a backend for the albums of several libraries,
+// given as a map from library name to content root.
+func NewLibraries(pool *pgxpool.Pool, libraries map[string]string) *Backend {
+	b := &Backend{pool: pool}
+	for name, dir := range libraries {
+		b.roots = append(b.roots, root{prefix: name, dir: filepath.Clean(dir)})
+	}
+	return b
+}
+
+// Connect creates a new pgx connection pool from a DSN string.
+func Connect(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parsing DSN: %w", err)
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to postgres: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("pinging postgres: %w", err)
+	}
+	return pool, nil
+}
+
+// Migrate runs all pending database migrations. They are tracked apart
+// from the analytics migrations, so both can share a database.
+func (b *Backend) Migrate(ctx context.Context) error {
+	conn, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring connection: %w", err)
+	}
+	defer conn.Release()
+
+	m, err := migrate.NewMigrator(ctx, conn.Conn(), "public.state_schema_version")
+	if err != nil {
+		return fmt.Errorf("creating migrator: %w", err)
+	}
+	subFS, err := fs.Sub(migrationFS, "migrations")
+	if err != nil {
+		return fmt.Errorf("creating sub FS: %w", err)
+	}
+	if err := m.LoadMigrations(subFS); err != nil {
+		return fmt.Errorf("loading migrations: %w", err)
+	}
+	if err := m.Migrate(ctx); err != nil {
+		return fmt.Errorf("running migrations: %w", err)
+	}
+	return nil
+}
+
+// Close releases the connection pool.
+func (b *Backend) Close() error {
+	b.pool.Close()
+	return nil
+}
+
+// key returns the album's path relative to its content root, with
+// forward slashes and below its library's name, and "" for the root of a
+// single content root.
+func (b *Backend) key(albumAbsPath string) (string, error) {
+	for _, r := range b.roots {
+		rel, err := filepath.Rel(r.dir, filepath.Clean(albumAbsPath))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if rel == "." {
+			rel = ""
+		}
+		return path.Join(r.prefix, filepath.ToSlash(rel)), nil
+	}
+	return "", fmt.Errorf("album %q is outside the content root", albumAbsPath)
+}
+
+// LoadAlbumState reads an album's state, or returns nil if it has none.
+func (b *Backend) LoadAlbumState(albumAbsPath string) (*state.AlbumState, error) {
+	var s state.AlbumState
+	err := b.load(&s, state.KindAlbum, `SELECT state FROM album_state WHERE album_path = $1`, albumAbsPath)
+	switch {
+	case errors.Is(err, errUpgraded):
+		b.rewrite(b.SaveAlbumState(albumAbsPath, &s), albumAbsPath, "")
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveAlbumState inserts or replaces an album's state.
+func (b *Backend) SaveAlbumState(albumAbsPath string, s *state.AlbumState) error {
+	s.SchemaVersion = state.AlbumSchemaVersion
+	return b.save(s, state.KindAlbum,
+		`INSERT INTO album_state (album_path, state) VALUES ($1, $2)
+		 ON CONFLICT (album_path) DO UPDATE SET state = EXCLUDED.state, updated_at = now()`,
+		albumAbsPath)
+}
+
+// LoadAssetState reads an asset's state, or returns nil if it has none.
+func (b *Backend) LoadAssetState(albumAbsPath, filename string) (*state.AssetState, error) {
+	var s state.AssetState
+	err := b.load(&s, state.KindAsset, `SELECT state FROM asset_state WHERE album_path = $1 AND filename = $2`, albumAbsPath, filename)
+	switch {
+	case errors.Is(err, errUpgraded):
+		b.rewrite(b.SaveAssetState(albumAbsPath, filename, &s), albumAbsPath, filename)
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveAssetState inserts or replaces an asset's state.
+func (b *Backend) SaveAssetState(albumAbsPath, filename string, s *state.AssetState) error {
+	s.SchemaVersion = state.AssetSchemaVersion
+	return b.save(s, state.KindAsset,
+		`INSERT INTO asset_state (album_path, state, filename) VALUES ($1, $2, $3)
+		 ON CONFLICT (album_path, filename) DO UPDATE SET state = EXCLUDED.state, updated_at = now()`,
+		albumAbsPath, filename)
+}
+
+// errUpgraded is returned by load, with v loaded, when the document had
+// an older schema version and should be saved again.
+var errUpgraded = errors.New("state upgraded")
+
+// load reads one state document into v, upgrading it to the current
+// schema version. The first arg is the album path.
+func (b *Backend) load(v any, kind, query, albumAbsPath string, args ...any) error {
+	key, err := b.key(albumAbsPath)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	var data []byte
+	if err := b.pool.QueryRow(ctx, query, append([]any{key}, args...)...).Scan(&data); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		return fmt.Errorf("reading %s state: %w", kind, err)
+	}
+	data, from, err := state.Upgrade(kind, data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s state: %w: %w", kind, state.ErrCorrupt, err)
+	}
+	if from < state.SchemaVersion(kind) {
+		return errUpgraded
+	}
+	return nil
+}
+
+// rewrite logs a failure to save upgraded state. The loaded state is
+// still good, and the next load retries.
+func (b *Backend) rewrite(err error, albumAbsPath, filename string) {
+	if err != nil {
+		slog.Warn("could not rewrite upgraded state", "location", b.Location(albumAbsPath, filename), "error", err)
+	}
+}
+
+// save upserts one state document; query takes the album path and the
+// document, then args.
+func (b *Backend) save(v any, kind, query, albumAbsPath string, args ...any) error {
+	key, err := b.key(albumAbsPath)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshaling JSON: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	if _, err := b.pool.Exec(ctx, query, append([]any{key, data}, args...)...); err != nil {
+		return fmt.Errorf("writing %s state: %w", kind, err)
+	}
+	return nil
+}
+
+// DeleteAssetState removes an asset's state.
+func (b *Backend) DeleteAssetState(albumAbsPath, filename string) error {
+	key, err := b.key(albumAbsPath)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	if _, err := b.pool.Exec(ctx, `DELETE FROM asset_state WHERE album_path = $1 AND filename = $2`, key, filename); err != nil {
+		return fmt.Errorf("removing asset state: %w", err)
+	}
+	return nil
+}
+
+// ListAssetStates returns the filenames with state in the album, sorted.
+func (b *Backend) ListAssetStates(albumAbsPath string) ([]string, error) {
+	key, err := b.key(albumAbsPath)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	rows, err := b.pool.Query(ctx, `SELECT filename FROM asset_state WHERE album_path = $1 ORDER BY filename`, key)
+	if err != nil {
+		return nil, fmt.Errorf("listing asset states: %w", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("listing asset states: %w", err)
+	}
+	return names, nil
+}
+
+// MoveAssetState rekeys the row in one statement; the primary key turns a
+// taken destination into os.ErrExist.
+func (b *Backend) MoveAssetState(fromAlbumAbsPath, fromFilename, toAlbumAbsPath, toFilename string) error {
+	from, err := b.key(fromAlbumAbsPath)
+	if err != nil {
+		return err
+	}
+	to, err := b.key(toAlbumAbsPath)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	tag, err := b.pool.Exec(ctx,
+		`UPDATE asset_state SET album_path = $3, filename = $4, updated_at = now()
+		 WHERE album_path = $1 AND filename = $2`,
+		from, fromFilename, to, toFilename)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+		return fmt.Errorf("moving asset state: %w", os.ErrExist)
+	case err != nil:
+		return fmt.Errorf("moving asset state: %w", err)
+	case tag.RowsAffected() == 0:
+		return fmt.Errorf("moving asset state: %w", os.ErrNotExist)
+	}
+	return nil
+}
+
+// MoveAlbumState rekeys the album row and its asset rows in one
+// statement; the primary keys turn state already at the destination into
+// os.ErrExist.
+func (b *Backend) MoveAlbumState(fromAlbumAbsPath, toAlbumAbsPath string) error {
+	from, err := b.key(fromAlbumAbsPath)
+	if err != nil {
+		return err
+	}
+	to, err := b.key(toAlbumAbsPath)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	var moved int64
+	err = b.pool.QueryRow(ctx,
+		`WITH albums AS (
+		     UPDATE album_state SET album_path = $2, updated_at = now()
+		     WHERE album_path = $1 RETURNING 1
+		 ), assets AS (
+		     UPDATE asset_state SET album_path = $2, updated_at = now()
+		     WHERE album_path = $1 RETURNING 1
+		 )
+		 SELECT (SELECT count(*) FROM albums) + (SELECT count(*) FROM assets)`,
+		from, to).Scan(&moved)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+		return fmt.Errorf("moving album state: %w", os.ErrExist)
+	case err != nil:
+		return fmt.Errorf("moving album state: %w", err)
+	case moved == 0:
+		return fmt.Errorf("moving album state: %w", os.ErrNotExist)
+	}
+	return nil
+}
+
+// QuarantineAlbumState moves an album's state to quarantined_state.
+func (b *Backend) QuarantineAlbumState(albumAbsPath string) (string, error) {
+	return b.quarantine(
+		`WITH moved AS (DELETE FROM album_state WHERE album_path = $1 RETURNING album_path, state)
+		 INSERT INTO quarantined_state (album_path, filename, state)
+		 SELECT album_path, '', state FROM moved RETURNING id`,
+		albumAbsPath)
+}
+
+// QuarantineAssetState moves an asset's state to quarantined_state.
+func (b *Backend) QuarantineAssetState(albumAbsPath, filename string) (string, error) {
+	return b.quarantine(
+		`WITH moved AS (DELETE FROM asset_state WHERE album_path = $1 AND filename = $2 RETURNING album_path, filename, state)
+		 INSERT INTO quarantined_state (album_path, filename, state)
+		 SELECT album_path, filename, state FROM moved RETURNING id`,
+		albumAbsPath, filename)
+}
+
+// quarantine moves a row to quarantined_state and returns its location
+// there.
+func (b *Backend) quarantine(query, albumAbsPath string, args ...any) (string, error) {
+	key, err := b.key(albumAbsPath)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	var id int64
+	if err := b.pool.QueryRow(ctx, query, append([]any{key}, args...)...).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = os.ErrNotExist
+		}
+		return "", fmt.Errorf("quarantining state: %w", err)
+	}
+	return fmt.Sprintf("postgres:quarantined_state/%d", id), nil
+}
+
+// Location returns "postgres:/<album path>/<filename>".
+func (b *Backend) Location(albumAbsPath, filename string) string {
+	key, err := b.key(albumAbsPath)
+	if err != nil {
+		key = filepath.ToSlash(albumAbsPath)
+	}
+	return "postgres:" + path.Join("/", key, filename)
+}
+
+var _ state.Backend = (*Backend)(nil)
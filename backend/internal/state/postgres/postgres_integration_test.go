@@ -0,0 +1,99 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/perrito666/gollery/backend/internal/state"
+)
+
+func setupBackend(t *testing.T, contentRoot string) *Backend {
+	t.Helper()
+	dsn := os.Getenv("GOLLERY_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("GOLLERY_TEST_POSTGRES_DSN not set; skipping integration test")
+	}
+	ctx := context.Background()
+	pool, err := Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connecting: %v", err)
+	}
+	t.Cleanup(func() { pool.Close() })
+
+	b := New(pool, contentRoot)
+	if err := b.Migrate(ctx); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	pool.Exec(ctx, "DELETE FROM album_state")
+	pool.Exec(ctx, "DELETE FROM asset_state")
+	pool.Exec(ctx, "DELETE FROM quarantined_state")
+	return b
+}
+
+func TestBackend_RoundTrip(t *testing.T) {
+	root := "/content"
+	b := setupBackend(t, root)
+	album := filepath.Join(root, "trips")
+
+	if s, err := b.LoadAlbumState(album); s != nil || err != nil {
+		t.Fatalf("missing album state = %v, %v", s, err)
+	}
+	if err := b.SaveAlbumState(album, &state.AlbumState{ObjectID: "alb_1"}); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := b.LoadAlbumState(album); err != nil || s.ObjectID != "alb_1" {
+		t.Fatalf("album state = %+v, %v", s, err)
+	}
+
+	for _, name := range []string{"b.jpg", "a.jpg"} {
+		if err := b.SaveAssetState(album, name, &state.AssetState{ObjectID: "ast_" + name, Title: "t"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := b.ListAssetStates(album)
+	if err != nil || strings.Join(names, ",") != "a.jpg,b.jpg" {
+		t.Fatalf("names = %v, %v", names, err)
+	}
+
+	if err := b.MoveAssetState(album, "a.jpg", root, "c.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := b.LoadAssetState(root, "c.jpg"); s == nil || s.ObjectID != "ast_a.jpg" {
+		t.Errorf("moved state = %+v", s)
+	}
+	if err := b.MoveAssetState(album, "b.jpg", root, "c.jpg"); !errors.Is(err, os.ErrExist) {
+		t.Errorf("move onto existing = %v, want ErrExist", err)
+	}
+
+	moved := filepath.Join(root, "journeys")
+	if err := b.MoveAlbumState(album, moved); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := b.LoadAlbumState(moved); s == nil || s.ObjectID != "alb_1" {
+		t.Errorf("moved album state = %+v", s)
+	}
+	if s, _ := b.LoadAssetState(moved, "b.jpg"); s == nil || s.ObjectID != "ast_b.jpg" {
+		t.Errorf("asset state did not move with its album: %+v", s)
+	}
+	if err := b.MoveAlbumState(album, moved); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("move of missing album = %v, want ErrNotExist", err)
+	}
+	album = moved
+
+	if _, err := b.QuarantineAssetState(album, "b.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := b.LoadAssetState(album, "b.jpg"); s != nil {
+		t.Error("quarantined state should be gone")
+	}
+
+	if _, err := b.LoadAlbumState("/elsewhere"); err == nil {
+		t.Error("albums outside the content root should be rejected")
+	}
+}
@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	single := New(nil, "/content")
+	libs := NewLibraries(nil, map[string]string{"photos": "/disk1", "scans": "/disk2/scans"})
+	tests := []struct {
+		b     *Backend
+		album string
+		want  string
+	}{
+		{single, "/content", ""},
+		{single, filepath.Join("/content", "trips", "rome"), "trips/rome"},
+		{libs, "/disk1", "photos"},
+		{libs, filepath.Join("/disk2", "scans", "1990"), "scans/1990"},
+	}
+	for _, tt := range tests {
+		got, err := tt.b.key(tt.album)
+		if err != nil || got != tt.want {
+			t.Errorf("key(%q) = %q, %v, want %q", tt.album, got, err, tt.want)
+		}
+	}
+	for _, outside := range []string{"/elsewhere", "/disk2"} {
+		if _, err := libs.key(outside); err == nil {
+			t.Errorf("key(%q) should fail", outside)
+		}
+	}
+}
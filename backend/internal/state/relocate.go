@@ -0,0 +1,116 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/perrito666/gollery/backend/internal/ignore"
+)
+
+// Relocation is one .gallery directory handled by [MoveToStateRoot].
+type Relocation struct {
+	// From and To are the directory's in-tree and state root paths.
+	From, To string
+
+	// Err is set when the directory could not be moved. It wraps
+	// [os.ErrExist] when the state root already has state for the album.
+	Err error
+}
+
+// MoveToStateRoot moves every .gallery directory in the content tree to
+// the same relative path below stateRoot, where [GalleryDir] looks for it
+// once [SetStateRoot] is in effect. It visits the directories the scanner
+// does, skipping other hidden directories. An album that already has
+// state below stateRoot is left alone and reported, so nothing is
+// overwritten. With dryRun it only reports what it would move.
+//
+// Directories are renamed when both trees are on the same filesystem and
+// copied and then removed otherwise. The server must not be running.
+func MoveToStateRoot(contentRoot, stateRoot string, dryRun bool) ([]Relocation, error) {
+	var moves []Relocation
+	err := ignore.WalkDir(contentRoot, contentRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == contentRoot || !strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		if d.Name() != galleryDir {
+			return fs.SkipDir
+		}
+		rel, err := filepath.Rel(contentRoot, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		m := Relocation{From: path, To: filepath.Join(stateRoot, rel, galleryDir)}
+		if _, err := os.Lstat(m.To); err == nil {
+			m.Err = fmt.Errorf("state root already has state for %q: %w", rel, os.ErrExist)
+		} else if !dryRun {
+			m.Err = moveDir(m.From, m.To)
+		}
+		moves = append(moves, m)
+		return fs.SkipDir
+	})
+	if err != nil {
+		return moves, fmt.Errorf("walking content tree: %w", err)
+	}
+	return moves, nil
+}
+
+// moveDir moves a directory to dst, whose parent is created if needed.
+func moveDir(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	// Another filesystem: copy, then remove the original only once the
+	// copy is complete.
+	if err := copyDir(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,160 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/perrito666/gollery/backend/internal/ignore"
+)
+
+// Kinds of state document.
+const (
+	KindAlbum = "album"
+	KindAsset = "asset"
+)
+
+// Schema versions written by this build. Documents without a
+// schema_version are version 0.
+const (
+	AlbumSchemaVersion = 1
+	AssetSchemaVersion = 1
+)
+
+// ErrUnsupportedSchema is returned for state written by a newer build. It
+// is not [ErrCorrupt]: such state must be left alone, not quarantined.
+var ErrUnsupportedSchema = errors.New("state schema version newer than supported")
+
+// Migration upgrades a state document from schema version From to From+1.
+// It works on the decoded JSON rather than on [AlbumState] or
+// [AssetState], whose shape is that of the latest version.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]any) error
+}
+
+// migrations holds, for each kind, the migrations from version 0 up to
+// the current one, in order: migrations[kind][v] upgrades version v.
+var migrations = map[string][]Migration{
+	KindAlbum: {
+		{From: 0, Description: "add schema_version", Apply: func(map[string]any) error { return nil }},
+	},
+	KindAsset: {
+		{From: 0, Description: "add schema_version", Apply: func(map[string]any) error { return nil }},
+	},
+}
+
+// SchemaVersion returns the version of the given kind this build writes.
+func SchemaVersion(kind string) int {
+	if kind == KindAlbum {
+		return AlbumSchemaVersion
+	}
+	return AssetSchemaVersion
+}
+
+// Upgrade brings an encoded state document of the given kind up to the
+// current schema version. It returns the document, re-encoded if it was
+// upgraded, and the version it had. Unknown fields are kept.
+func Upgrade(kind string, data []byte) ([]byte, int, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, fmt.Errorf("parsing %s state: %w: %w", kind, ErrCorrupt, err)
+	}
+	if doc == nil {
+		// "null" decodes as empty state.
+		doc = make(map[string]any)
+	}
+	from := 0
+	if v, ok := doc["schema_version"]; ok {
+		n, ok := v.(float64)
+		if !ok || n < 0 || n != float64(int(n)) {
+			return nil, 0, fmt.Errorf("parsing %s state: %w: invalid schema_version %v", kind, ErrCorrupt, v)
+		}
+		from = int(n)
+	}
+	to := SchemaVersion(kind)
+	switch {
+	case from > to:
+		return nil, from, fmt.Errorf("%s state has schema version %d, this build supports up to %d: %w", kind, from, to, ErrUnsupportedSchema)
+	case from == to:
+		return data, from, nil
+	}
+	for _, m := range migrations[kind][from:to] {
+		if err := m.Apply(doc); err != nil {
+			return nil, from, fmt.Errorf("upgrading %s state from version %d (%s): %w", kind, m.From, m.Description, err)
+		}
+	}
+	doc["schema_version"] = to
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, from, fmt.Errorf("marshaling JSON: %w", err)
+	}
+	return out, from, nil
+}
+
+// SchemaUpgrade is one sidecar reported by [UpgradeSidecars].
+type SchemaUpgrade struct {
+	Path     string
+	Kind     string
+	From, To int
+
+	// Err is set when the file could not be read, parsed or upgraded.
+	Err error
+}
+
+// UpgradeSidecars finds the sidecar files under contentRoot (or its state
+// root) that have an older schema version, and upgrades them in place
+// unless dryRun is set. Loading state upgrades it anyway; this previews
+// the upgrades, or applies them all at once. It visits the directories
+// the scanner does, and reports only files that need upgrading or fail.
+func UpgradeSidecars(contentRoot string, dryRun bool) ([]SchemaUpgrade, error) {
+	var upgrades []SchemaUpgrade
+	check := func(kind, path string) {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+		u := SchemaUpgrade{Path: path, Kind: kind, To: SchemaVersion(kind), Err: err}
+		if err == nil {
+			data, u.From, u.Err = Upgrade(kind, data)
+		}
+		if u.Err == nil && u.From == u.To {
+			return
+		}
+		if u.Err == nil && !dryRun {
+			u.Err = atomicWriteJSON(path, json.RawMessage(data))
+		}
+		upgrades = append(upgrades, u)
+	}
+
+	err := ignore.WalkDir(contentRoot, contentRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != contentRoot && strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+		check(KindAlbum, AlbumStatePath(path))
+		names, err := Sidecars{}.ListAssetStates(path)
+		if err != nil {
+			upgrades = append(upgrades, SchemaUpgrade{Path: filepath.Join(GalleryDir(path), assetsDir), Kind: KindAsset, Err: err})
+			return nil
+		}
+		for _, name := range names {
+			check(KindAsset, AssetStatePath(path, name))
+		}
+		return nil
+	})
+	if err != nil {
+		return upgrades, fmt.Errorf("walking content tree: %w", err)
+	}
+	return upgrades, nil
+}
@@ -0,0 +1,120 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrations_Complete(t *testing.T) {
+	for _, kind := range []string{KindAlbum, KindAsset} {
+		ms := migrations[kind]
+		if len(ms) != SchemaVersion(kind) {
+			t.Errorf("%s: %d migrations for schema version %d", kind, len(ms), SchemaVersion(kind))
+		}
+		for i, m := range ms {
+			if m.From != i || m.Apply == nil {
+				t.Errorf("%s: migration %d is %+v", kind, i, m)
+			}
+		}
+	}
+}
+
+func writeSidecar(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadAlbumState_UpgradesInPlace(t *testing.T) {
+	dir := t.TempDir()
+	path := AlbumStatePath(dir)
+	writeSidecar(t, path, `{"object_id":"alb_old","future_field":true}`)
+
+	s, err := LoadAlbumState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ObjectID != "alb_old" || s.SchemaVersion != AlbumSchemaVersion {
+		t.Errorf("loaded %+v", s)
+	}
+	data, _ := os.ReadFile(path)
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["schema_version"] != float64(1) {
+		t.Errorf("file not upgraded: %s", data)
+	}
+	if doc["future_field"] != true {
+		t.Errorf("unknown field dropped: %s", data)
+	}
+}
+
+func TestLoadAssetState_NewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	path := AssetStatePath(dir, "a.jpg")
+	const doc = `{"schema_version":99,"object_id":"ast_new"}`
+	writeSidecar(t, path, doc)
+
+	_, err := LoadAssetState(dir, "a.jpg")
+	if !errors.Is(err, ErrUnsupportedSchema) || errors.Is(err, ErrCorrupt) {
+		t.Fatalf("err = %v, want ErrUnsupportedSchema only", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != doc {
+		t.Errorf("file changed: %s", data)
+	}
+}
+
+func TestUpgradeSidecars(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	writeSidecar(t, AlbumStatePath(root), `{"object_id":"alb_root"}`)
+	writeSidecar(t, AssetStatePath(sub, "a.jpg"), `{"object_id":"ast_a"}`)
+	writeSidecar(t, AssetStatePath(sub, "b.jpg"), `{"schema_version":1,"object_id":"ast_b"}`)
+	writeSidecar(t, AssetStatePath(sub, "c.jpg"), `{"schema_version":"x"}`)
+
+	// A dry run reports without writing.
+	ups, err := UpgradeSidecars(root, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ups) != 3 {
+		t.Fatalf("dry run reported %+v", ups)
+	}
+	for _, u := range ups {
+		switch u.Path {
+		case AlbumStatePath(root), AssetStatePath(sub, "a.jpg"):
+			if u.Err != nil || u.From != 0 || u.To != 1 {
+				t.Errorf("%+v", u)
+			}
+		case AssetStatePath(sub, "c.jpg"):
+			if !errors.Is(u.Err, ErrCorrupt) {
+				t.Errorf("%+v", u)
+			}
+		default:
+			t.Errorf("unexpected %+v", u)
+		}
+	}
+	if data, _ := os.ReadFile(AlbumStatePath(root)); strings.Contains(string(data), "schema_version") {
+		t.Errorf("dry run wrote %s", data)
+	}
+
+	if _, err := UpgradeSidecars(root, false); err != nil {
+		t.Fatal(err)
+	}
+	ups, err = UpgradeSidecars(root, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ups) != 1 || ups[0].Path != AssetStatePath(sub, "c.jpg") {
+		t.Errorf("after upgrade reported %+v", ups)
+	}
+}
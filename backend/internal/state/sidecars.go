@@ -0,0 +1,186 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sidecars is the default [Backend]: JSON files in .gallery/ directories,
+// in the content tree or under a state root (see [GalleryDir]).
+type Sidecars struct{}
+
+// LoadAlbumState reads the album state from .gallery/album.state.json,
+// upgrading the file if it has an older schema version.
+// Returns nil without error if the file does not exist.
+func (Sidecars) LoadAlbumState(albumAbsPath string) (*AlbumState, error) {
+	var s AlbumState
+	if ok, err := loadSidecar(KindAlbum, AlbumStatePath(albumAbsPath), &s); !ok {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveAlbumState writes the album state atomically to .gallery/album.state.json.
+func (Sidecars) SaveAlbumState(albumAbsPath string, s *AlbumState) error {
+	dir := GalleryDir(albumAbsPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating .gallery dir: %w", err)
+	}
+	s.SchemaVersion = AlbumSchemaVersion
+	return atomicWriteJSON(AlbumStatePath(albumAbsPath), s)
+}
+
+// LoadAssetState reads the asset state from .gallery/assets/<filename>.json,
+// upgrading the file if it has an older schema version.
+// Returns nil without error if the file does not exist.
+func (Sidecars) LoadAssetState(albumAbsPath, filename string) (*AssetState, error) {
+	var s AssetState
+	if ok, err := loadSidecar(KindAsset, AssetStatePath(albumAbsPath, filename), &s); !ok {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveAssetState writes the asset state atomically to .gallery/assets/<filename>.json.
+func (Sidecars) SaveAssetState(albumAbsPath, filename string, s *AssetState) error {
+	dir := filepath.Join(GalleryDir(albumAbsPath), assetsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating .gallery/assets dir: %w", err)
+	}
+	s.SchemaVersion = AssetSchemaVersion
+	return atomicWriteJSON(AssetStatePath(albumAbsPath, filename), s)
+}
+
+// loadSidecar reads a state file into v, upgrading it in place first if
+// needed. It returns false, with a nil error if the file does not exist,
+// when v was not loaded. A failed rewrite is logged rather than returned:
+// the upgraded state is still good, and the next load retries.
+func loadSidecar(kind, path string, v any) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("reading %s state: %w", kind, err)
+	}
+	data, from, err := Upgrade(kind, data)
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("parsing %s state: %w: %w", kind, ErrCorrupt, err)
+	}
+	if from < SchemaVersion(kind) {
+		if err := atomicWriteJSON(path, json.RawMessage(data)); err != nil {
+			slog.Warn("could not rewrite upgraded state", "path", path, "error", err)
+		}
+	}
+	return true, nil
+}
+
+// DeleteAssetState removes the asset's sidecar. A missing sidecar is not
+// an error.
+func (Sidecars) DeleteAssetState(albumAbsPath, filename string) error {
+	if err := os.Remove(AssetStatePath(albumAbsPath, filename)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing asset state: %w", err)
+	}
+	return nil
+}
+
+// ListAssetStates lists the files in .gallery/assets/.
+func (Sidecars) ListAssetStates(albumAbsPath string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(GalleryDir(albumAbsPath), assetsDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("listing asset states: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".tmp-") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(name, ".json"))
+	}
+	return names, nil
+}
+
+// MoveAssetState writes the sidecar under its new name before removing
+// the old one, so a crash in between leaves a duplicate, never a loss.
+func (sc Sidecars) MoveAssetState(fromAlbumAbsPath, fromFilename, toAlbumAbsPath, toFilename string) error {
+	s, err := sc.LoadAssetState(fromAlbumAbsPath, fromFilename)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return fmt.Errorf("moving asset state: %w", os.ErrNotExist)
+	}
+	if _, err := os.Stat(AssetStatePath(toAlbumAbsPath, toFilename)); err == nil {
+		return fmt.Errorf("moving asset state: %w", os.ErrExist)
+	}
+	if err := sc.SaveAssetState(toAlbumAbsPath, toFilename, s); err != nil {
+		return err
+	}
+	if err := os.Remove(AssetStatePath(fromAlbumAbsPath, fromFilename)); err != nil {
+		return fmt.Errorf("removing moved asset state: %w", err)
+	}
+	return nil
+}
+
+// MoveAlbumState renames the album's .gallery directory, which holds its
+// own state and its assets' but not its sub-albums'.
+func (Sidecars) MoveAlbumState(fromAlbumAbsPath, toAlbumAbsPath string) error {
+	from, to := GalleryDir(fromAlbumAbsPath), GalleryDir(toAlbumAbsPath)
+	if _, err := os.Stat(to); err == nil {
+		return fmt.Errorf("moving album state: %w", os.ErrExist)
+	}
+	if _, err := os.Stat(from); err != nil {
+		return fmt.Errorf("moving album state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("moving album state: %w", err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("moving album state: %w", err)
+	}
+	return nil
+}
+
+// QuarantineAlbumState moves the album's state file into
+// .gallery/quarantine/ and returns its new path.
+func (Sidecars) QuarantineAlbumState(albumAbsPath string) (string, error) {
+	return quarantine(albumAbsPath, AlbumStatePath(albumAbsPath))
+}
+
+// QuarantineAssetState moves the asset's state file into
+// .gallery/quarantine/ and returns its new path.
+func (Sidecars) QuarantineAssetState(albumAbsPath, filename string) (string, error) {
+	return quarantine(albumAbsPath, AssetStatePath(albumAbsPath, filename))
+}
+
+func quarantine(albumAbsPath, path string) (string, error) {
+	dir := filepath.Join(GalleryDir(albumAbsPath), quarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating quarantine dir: %w", err)
+	}
+	dest := filepath.Join(dir, filepath.Base(path)+"."+time.Now().UTC().Format("20060102T150405.000000000"))
+	if err := os.Rename(path, dest); err != nil {
+		return "", fmt.Errorf("quarantining state file: %w", err)
+	}
+	return dest, nil
+}
+
+// Location returns the path of the state file.
+func (Sidecars) Location(albumAbsPath, filename string) string {
+	if filename == "" {
+		return AlbumStatePath(albumAbsPath)
+	}
+	return AssetStatePath(albumAbsPath, filename)
+}
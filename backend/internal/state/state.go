@@ -25,6 +25,37 @@
 //	        ├── image1.jpg.json (asset ID, ACL override, discussion bindings)
 //	        └── image2.jpg.json
 //
+// With a state root (see [SetStateRoot]) the .gallery/ directories live in
+// a separate tree that mirrors the content tree instead, so the content
+// can be mounted read-only:
+//
+//	<state root>/<album path>/.gallery/album.state.json
+//
+// Every path is derived from [GalleryDir], so the layout below .gallery/
+// is the same in both places, and [MoveToStateRoot] moves existing
+// directories across unchanged.
+//
+// Unparseable state files are reported as [ErrCorrupt]. The indexer moves
+// them to .gallery/quarantine/ and starts afresh rather than failing the
+// whole index.
+//
+// # Backends
+//
+// The layout above is that of the default [Backend], [Sidecars]. The
+// package-level functions delegate to the backend set with [SetBackend],
+// so a database can hold the state instead (see package state/postgres);
+// [Copy] moves state between backends. Everything below describes the
+// sidecars, but IDs and the semantics of each call are the same whatever
+// the backend.
+//
+// # Schema versions
+//
+// Every document records its schema_version. When one written by an
+// older build is loaded, the migrations registered for its kind upgrade
+// it step by step, and it is rewritten in place (see [Upgrade]); state
+// from a newer build fails with [ErrUnsupportedSchema] and is left
+// untouched. [UpgradeSidecars] previews or applies all pending upgrades.
+//
 // # Atomicity
 //
 // All writes use [atomicWriteJSON]: marshal to temp file in the same
@@ -39,10 +70,14 @@
 // if absent. This means the first scan of new content creates sidecar
 // files, and subsequent scans reuse them.
 //
+// Asset sidecars are keyed by filename. [MoveAssetState] lets the indexer
+// carry a sidecar over to a renamed or moved file, matched by its content
+// fingerprint, so the ID survives.
+//
 // # Important: the server writes here
 //
 // The .gallery/ directories are the only place the server writes into the
-// content tree. album.json is strictly read-only (declarative config owned
+// content tree, and with a state root it writes nothing there at all. album.json is strictly read-only (declarative config owned
 // by the user). This separation is a core invariant of the architecture.
 package state
 
@@ -50,36 +85,130 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/perrito666/gollery/backend/internal/domain"
 )
 
 const (
 	galleryDir     = ".gallery"
 	albumStateFile = "album.state.json"
 	assetsDir      = "assets"
+	quarantineDir  = "quarantine"
 	albumIDPrefix  = "alb_"
 	assetIDPrefix  = "ast_"
 	idRandomBytes  = 16
 )
 
+// ErrCorrupt is wrapped by the errors of state files that exist but cannot
+// be parsed. Such files can be moved aside with [QuarantineAlbumState] and
+// [QuarantineAssetState].
+var ErrCorrupt = errors.New("corrupt state file")
+
 // AlbumState holds the mutable editorial state for an album.
 type AlbumState struct {
+	// SchemaVersion is the shape of the stored document; see [Upgrade].
+	SchemaVersion int `json:"schema_version"`
+
 	ObjectID    string              `json:"object_id"`
 	Discussions []DiscussionBinding `json:"discussions,omitempty"`
+
+	// CoverID is the ID of the asset an admin picked as the album's
+	// cover. It takes precedence over the cover named in album.json.
+	CoverID string `json:"cover_id,omitempty"`
+
+	// AssetOrder and ChildOrder are the asset and child album IDs in the
+	// order an admin set, used by the "manual" sort orders.
+	AssetOrder []string `json:"asset_order,omitempty"`
+	ChildOrder []string `json:"child_order,omitempty"`
 }
 
 // AssetState holds the mutable editorial state for an asset.
 type AssetState struct {
+	// SchemaVersion is the shape of the stored document; see [Upgrade].
+	SchemaVersion int `json:"schema_version"`
+
 	ObjectID       string              `json:"object_id"`
 	Title          string              `json:"title,omitempty"`
 	Description    string              `json:"description,omitempty"`
+	Keywords       []string            `json:"keywords,omitempty"`
+	Rating         int                 `json:"rating,omitempty"`
 	Discussions    []DiscussionBinding `json:"discussions,omitempty"`
 	AccessOverride *AccessOverride     `json:"access_override,omitempty"`
 	Latitude       *float64            `json:"latitude,omitempty"`
 	Longitude      *float64            `json:"longitude,omitempty"`
 	GeoResolved    bool                `json:"geo_resolved,omitempty"`
+
+	// Altitude is the elevation in meters from EXIF or the matched track.
+	Altitude *float64 `json:"altitude,omitempty"`
+
+	// GeoMatch records where Latitude/Longitude came from and, for
+	// track matches, how trustworthy they are.
+	GeoMatch *GeoMatch `json:"geo_match,omitempty"`
+
+	// TrackOptions is the album's track matching settings the asset was
+	// last matched with, whether or not a position was found; nil if it
+	// never was. Changing them matches it again.
+	TrackOptions *TrackOptions `json:"track_options,omitempty"`
+
+	// DateTaken is the EXIF capture time resolved to an absolute time
+	// (camera offset, album timezone or zone inferred from coordinates).
+	// Set alongside GeoResolved. DateResolved records that the lookup ran,
+	// so files without a capture time are not read again on every scan.
+	// DateTakenHasOffset records whether the camera stored its UTC offset,
+	// as [domain.ImageMetadata.DateTakenHasOffset].
+	DateTaken          *time.Time `json:"date_taken,omitempty"`
+	DateResolved       bool       `json:"date_resolved,omitempty"`
+	DateTakenHasOffset bool       `json:"date_taken_has_offset,omitempty"`
+
+	// DateClock is the album clock settings DateTaken was resolved with,
+	// nil for none, so that changing them resolves it again.
+	DateClock *DateClock `json:"date_clock,omitempty"`
+
+	// Place caches the reverse-geocoded location of Latitude/Longitude.
+	// PlaceResolved records that the lookup ran, so assets without a
+	// match are not looked up again on every scan.
+	Place         *domain.Place `json:"place,omitempty"`
+	PlaceResolved bool          `json:"place_resolved,omitempty"`
+
+	// Fingerprint identifies the file's content ("<size>:<hash>"), so a
+	// renamed or moved file can be matched with this sidecar and keep
+	// its ID.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// DateClock is the album's timezone and camera_clock_offset, as used to
+// resolve a capture time.
+type DateClock struct {
+	Timezone          string `json:"timezone,omitempty"`
+	CameraClockOffset string `json:"camera_clock_offset,omitempty"`
+}
+
+// TrackOptions is the album's gpx_tolerance and gpx_max_gap, as used to
+// match an asset on its tracks.
+type TrackOptions struct {
+	Tolerance string `json:"gpx_tolerance"`
+	MaxGap    string `json:"gpx_max_gap"`
+}
+
+// GeoMatch describes how an asset's coordinates were resolved.
+type GeoMatch struct {
+	// Source is "exif", "track" or "manual" (set or cleared through the API).
+	Source string `json:"source"`
+
+	// Method is "nearest" (snapped to a trackpoint) or "interpolated"
+	// (between two trackpoints). Empty for EXIF coordinates.
+	Method string `json:"method,omitempty"`
+
+	// OffsetSeconds is the time between the capture and the nearest
+	// recorded trackpoint. Larger values mean a less reliable match.
+	OffsetSeconds float64 `json:"offset_seconds,omitempty"`
 }
 
 // AccessOverride stores per-asset ACL overrides in sidecar state.
@@ -118,65 +247,63 @@ func generateID(prefix string) (string, error) {
 	return prefix + hex.EncodeToString(b), nil
 }
 
-// GalleryDir returns the path to the .gallery directory for a given album path.
-func GalleryDir(albumAbsPath string) string {
-	return filepath.Join(albumAbsPath, galleryDir)
+// stateRoots maps content roots to the state roots set with SetStateRoot.
+var stateRoots struct {
+	sync.RWMutex
+	m map[string]string
 }
 
-// LoadAlbumState reads the album state from .gallery/album.state.json.
-// Returns nil without error if the file does not exist.
-func LoadAlbumState(albumAbsPath string) (*AlbumState, error) {
-	path := filepath.Join(albumAbsPath, galleryDir, albumStateFile)
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("reading album state: %w", err)
-	}
-	var s AlbumState
-	if err := json.Unmarshal(data, &s); err != nil {
-		return nil, fmt.Errorf("parsing album state: %w", err)
+// SetStateRoot keeps the sidecars of albums under contentRoot below
+// stateRoot, at the album's relative path, instead of in the content tree.
+// An empty stateRoot puts them back in the content tree. It applies to
+// every function in this package and should be called before any state is
+// read, normally once at startup.
+func SetStateRoot(contentRoot, stateRoot string) {
+	stateRoots.Lock()
+	defer stateRoots.Unlock()
+	contentRoot = filepath.Clean(contentRoot)
+	if stateRoot == "" {
+		delete(stateRoots.m, contentRoot)
+		return
 	}
-	return &s, nil
-}
-
-// SaveAlbumState writes the album state atomically to .gallery/album.state.json.
-func SaveAlbumState(albumAbsPath string, s *AlbumState) error {
-	dir := filepath.Join(albumAbsPath, galleryDir)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("creating .gallery dir: %w", err)
+	if stateRoots.m == nil {
+		stateRoots.m = make(map[string]string)
 	}
-	path := filepath.Join(dir, albumStateFile)
-	return atomicWriteJSON(path, s)
+	stateRoots.m[contentRoot] = filepath.Clean(stateRoot)
 }
 
-// LoadAssetState reads the asset state from .gallery/assets/<filename>.json.
-// Returns nil without error if the file does not exist.
-func LoadAssetState(albumAbsPath, filename string) (*AssetState, error) {
-	path := filepath.Join(albumAbsPath, galleryDir, assetsDir, filename+".json")
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
+// GalleryDir returns the path to the .gallery directory for a given album
+// path: inside the album, or at the same relative path below the state
+// root when the album lies under a content root that has one.
+func GalleryDir(albumAbsPath string) string {
+	stateRoots.RLock()
+	defer stateRoots.RUnlock()
+	albumAbsPath = filepath.Clean(albumAbsPath)
+	var best, dir string
+	for contentRoot, stateRoot := range stateRoots.m {
+		rel, err := filepath.Rel(contentRoot, albumAbsPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		// The innermost content root wins.
+		if len(contentRoot) > len(best) {
+			best, dir = contentRoot, filepath.Join(stateRoot, rel, galleryDir)
 		}
-		return nil, fmt.Errorf("reading asset state: %w", err)
 	}
-	var s AssetState
-	if err := json.Unmarshal(data, &s); err != nil {
-		return nil, fmt.Errorf("parsing asset state: %w", err)
+	if dir != "" {
+		return dir
 	}
-	return &s, nil
+	return filepath.Join(albumAbsPath, galleryDir)
 }
 
-// SaveAssetState writes the asset state atomically to .gallery/assets/<filename>.json.
-func SaveAssetState(albumAbsPath, filename string, s *AssetState) error {
-	dir := filepath.Join(albumAbsPath, galleryDir, assetsDir)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("creating .gallery/assets dir: %w", err)
-	}
-	path := filepath.Join(dir, filename+".json")
-	return atomicWriteJSON(path, s)
+// AlbumStatePath returns the path of the album's state file.
+func AlbumStatePath(albumAbsPath string) string {
+	return filepath.Join(GalleryDir(albumAbsPath), albumStateFile)
+}
+
+// AssetStatePath returns the path of the asset's state file.
+func AssetStatePath(albumAbsPath, filename string) string {
+	return filepath.Join(GalleryDir(albumAbsPath), assetsDir, filename+".json")
 }
 
 // EnsureAlbumID loads existing album state or creates a new one with a fresh ID.
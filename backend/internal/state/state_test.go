@@ -1,6 +1,7 @@
 package state
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -207,3 +208,137 @@ func TestGalleryDir(t *testing.T) {
 		t.Errorf("GalleryDir = %q, want %q", got, want)
 	}
 }
+
+func TestSetStateRoot(t *testing.T) {
+	content, stateRoot := t.TempDir(), t.TempDir()
+	SetStateRoot(content, stateRoot)
+	t.Cleanup(func() { SetStateRoot(content, "") })
+
+	album := filepath.Join(content, "trips", "rome")
+	if got, want := GalleryDir(album), filepath.Join(stateRoot, "trips", "rome", ".gallery"); got != want {
+		t.Errorf("GalleryDir = %q, want %q", got, want)
+	}
+	if err := SaveAssetState(album, "a.jpg", &AssetState{ObjectID: "ast_a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(stateRoot, "trips", "rome", ".gallery", "assets", "a.jpg.json")); err != nil {
+		t.Errorf("sidecar not under state root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(album, ".gallery")); !os.IsNotExist(err) {
+		t.Error("nothing should be written into the content tree")
+	}
+
+	// Albums under other content roots are unaffected.
+	if got, want := GalleryDir("/elsewhere/a"), filepath.Join("/elsewhere/a", ".gallery"); got != want {
+		t.Errorf("GalleryDir = %q, want %q", got, want)
+	}
+}
+
+func TestMoveToStateRoot(t *testing.T) {
+	content, stateRoot := t.TempDir(), t.TempDir()
+	for _, dir := range []string{content, filepath.Join(content, "a"), filepath.Join(content, "b")} {
+		if err := SaveAlbumState(dir, &AlbumState{ObjectID: "alb_" + filepath.Base(dir)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b already has state below the state root.
+	if err := os.MkdirAll(filepath.Join(stateRoot, "b", ".gallery"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	moves, err := MoveToStateRoot(content, stateRoot, true)
+	if err != nil || len(moves) != 3 {
+		t.Fatalf("dry run = %+v, %v", moves, err)
+	}
+	if _, err := os.Stat(filepath.Join(content, "a", ".gallery")); err != nil {
+		t.Error("dry run should not move anything")
+	}
+
+	moves, err = MoveToStateRoot(content, stateRoot, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failed []string
+	for _, m := range moves {
+		if m.Err != nil {
+			failed = append(failed, m.From)
+			if !errors.Is(m.Err, os.ErrExist) {
+				t.Errorf("%s: err = %v, want ErrExist", m.From, m.Err)
+			}
+		}
+	}
+	if len(failed) != 1 || failed[0] != filepath.Join(content, "b", ".gallery") {
+		t.Errorf("failed moves = %v, want only b", failed)
+	}
+
+	SetStateRoot(content, stateRoot)
+	t.Cleanup(func() { SetStateRoot(content, "") })
+	s, err := LoadAlbumState(filepath.Join(content, "a"))
+	if err != nil || s == nil || s.ObjectID != "alb_a" {
+		t.Errorf("moved album state = %+v, %v", s, err)
+	}
+}
+
+func TestMoveAssetState(t *testing.T) {
+	from, to := t.TempDir(), t.TempDir()
+	if err := SaveAssetState(from, "a.jpg", &AssetState{ObjectID: "ast_a", Title: "Sunset"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MoveAssetState(from, "a.jpg", to, "b.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadAssetState(to, "b.jpg")
+	if err != nil || got == nil {
+		t.Fatalf("moved state = %v, %v", got, err)
+	}
+	if got.ObjectID != "ast_a" || got.Title != "Sunset" {
+		t.Errorf("moved state = %+v", got)
+	}
+	if names, _ := ListAssetStates(from); len(names) != 0 {
+		t.Errorf("source still has states %v", names)
+	}
+	if names, _ := ListAssetStates(to); len(names) != 1 || names[0] != "b.jpg" {
+		t.Errorf("destination states = %v", names)
+	}
+
+	// An existing destination is never overwritten.
+	if err := SaveAssetState(from, "c.jpg", &AssetState{ObjectID: "ast_c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveAssetState(from, "c.jpg", to, "b.jpg"); !errors.Is(err, os.ErrExist) {
+		t.Errorf("err = %v, want ErrExist", err)
+	}
+}
+
+func TestListAssetStates_NoGalleryDir(t *testing.T) {
+	names, err := ListAssetStates(t.TempDir())
+	if err != nil || names != nil {
+		t.Errorf("ListAssetStates = %v, %v", names, err)
+	}
+}
+
+func TestLoadAssetState_CorruptIsQuarantinable(t *testing.T) {
+	dir := t.TempDir()
+	path := AssetStatePath(dir, "a.jpg")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadAssetState(dir, "a.jpg"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("err = %v, want ErrCorrupt", err)
+	}
+	dest, err := QuarantineAssetState(dir, "a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(dest) != filepath.Join(dir, ".gallery", "quarantine") {
+		t.Errorf("quarantined to %s", dest)
+	}
+	if s, err := LoadAssetState(dir, "a.jpg"); s != nil || err != nil {
+		t.Errorf("after quarantine: %v, %v", s, err)
+	}
+}
@@ -0,0 +1,123 @@
+// Package symlink decides which symbolic links in a content tree are
+// followed, so that albums can be assembled from directories kept
+// elsewhere.
+//
+// A link is followed when its target lies within one of the allowed
+// roots of a [Policy]. Links are never followed into the content root
+// itself, where the target is already published at its own path, nor to
+// a directory containing the link, which would make the walk endless.
+// Links are identified by their path in the content tree: albums and
+// assets reached through one keep the link's path, never the target's,
+// so their identity does not change when the target moves.
+package symlink
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrOutside is returned for links whose target is outside the
+	// allowed roots.
+	ErrOutside = errors.New("target is outside the allowed roots")
+
+	// ErrInContent is returned for links whose target is inside the
+	// content root.
+	ErrInContent = errors.New("target is inside the content root")
+
+	// ErrCycle is returned for links to a directory that contains them.
+	ErrCycle = errors.New("target contains the link")
+)
+
+// Policy is the set of directories symbolic links may point into.
+type Policy struct {
+	roots []string
+}
+
+// New returns a policy allowing links into the given directories, or nil
+// when there are none, meaning links are not followed. Roots that are
+// themselves reached through links are resolved.
+func New(allowedRoots []string) *Policy {
+	if len(allowedRoots) == 0 {
+		return nil
+	}
+	p := &Policy{}
+	for _, root := range allowedRoots {
+		p.roots = append(p.roots, resolve(root))
+	}
+	return p
+}
+
+// Follow resolves the symbolic link at relPath below contentRoot and
+// returns the info of its target, named after the link. It fails when
+// the target does not exist or the policy does not allow it.
+func (p *Policy) Follow(contentRoot, relPath string) (fs.FileInfo, error) {
+	linkPath := filepath.Join(contentRoot, relPath)
+	target, err := filepath.EvalSymlinks(linkPath)
+	if err != nil {
+		return nil, err
+	}
+	allowed := false
+	for _, root := range p.roots {
+		if within(target, root) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%s: %w", target, ErrOutside)
+	}
+	info, err := os.Stat(linkPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		// The directories the link is in, as the walk reached them,
+		// must all lie outside the target.
+		for dir := parentDir(relPath); ; dir = parentDir(dir) {
+			real, err := filepath.EvalSymlinks(filepath.Join(contentRoot, dir))
+			if err == nil && within(real, target) {
+				return nil, fmt.Errorf("%s: %w", target, ErrCycle)
+			}
+			if dir == "" {
+				break
+			}
+		}
+	}
+	if within(target, resolve(contentRoot)) {
+		return nil, fmt.Errorf("%s: %w", target, ErrInContent)
+	}
+	return info, nil
+}
+
+// resolve returns the absolute path of dir with links resolved, or just
+// cleaned when it cannot be resolved.
+func resolve(dir string) string {
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return dir
+}
+
+// within reports whether path is dir or lies below it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// parentDir returns the relative path of relPath's parent directory,
+// with the content root as "".
+func parentDir(relPath string) string {
+	parent := filepath.Dir(relPath)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
@@ -0,0 +1,94 @@
+package symlink
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func mkdir(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func link(t *testing.T, target, path string) {
+	t.Helper()
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "content")
+	nas := filepath.Join(base, "nas")
+	mkdir(t, filepath.Join(root, "album"))
+	mkdir(t, filepath.Join(nas, "trip"))
+	mkdir(t, filepath.Join(base, "private"))
+	if err := os.WriteFile(filepath.Join(nas, "photo.jpg"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	link(t, filepath.Join(nas, "trip"), filepath.Join(root, "trip"))
+	link(t, filepath.Join(nas, "photo.jpg"), filepath.Join(root, "photo.jpg"))
+	link(t, filepath.Join(base, "private"), filepath.Join(root, "private"))
+	link(t, filepath.Join(root, "album"), filepath.Join(root, "again"))
+	link(t, filepath.Join(nas, "gone"), filepath.Join(root, "gone"))
+	// Inside the linked directory, a link back to the allowed root,
+	// which contains it.
+	link(t, nas, filepath.Join(nas, "trip", "up"))
+	// A relative link between two linked directories is fine.
+	mkdir(t, filepath.Join(nas, "other"))
+	link(t, "../other", filepath.Join(nas, "trip", "other"))
+
+	p := New([]string{nas})
+	tests := []struct {
+		relPath string
+		dir     bool
+		err     error
+	}{
+		{"trip", true, nil},
+		{"photo.jpg", false, nil},
+		{filepath.Join("trip", "other"), true, nil},
+		{"private", false, ErrOutside},
+		{"again", false, ErrOutside},
+		{filepath.Join("trip", "up"), false, ErrCycle},
+	}
+	for _, tt := range tests {
+		info, err := p.Follow(root, tt.relPath)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Follow(%q) error = %v, want %v", tt.relPath, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if info.IsDir() != tt.dir {
+			t.Errorf("Follow(%q) IsDir = %v, want %v", tt.relPath, info.IsDir(), tt.dir)
+		}
+		if info.Name() != filepath.Base(tt.relPath) {
+			t.Errorf("Follow(%q) name = %q, want the link's", tt.relPath, info.Name())
+		}
+	}
+	if _, err := p.Follow(root, "gone"); err == nil {
+		t.Error("a dangling link should not be followed")
+	}
+
+	// Allowing the content root's parent still keeps links out of the
+	// content root, and away from its ancestors.
+	p = New([]string{base})
+	if _, err := p.Follow(root, "again"); !errors.Is(err, ErrInContent) {
+		t.Errorf("link into the content root: %v, want %v", err, ErrInContent)
+	}
+	link(t, base, filepath.Join(root, "base"))
+	if _, err := p.Follow(root, "base"); !errors.Is(err, ErrCycle) {
+		t.Errorf("link to the content root's parent: %v, want %v", err, ErrCycle)
+	}
+
+	if New(nil) != nil {
+		t.Error("a policy without roots should be nil")
+	}
+}
@@ -0,0 +1,277 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/perrito666/gollery/backend/internal/ignore"
+)
+
+// watchMask selects the events that can change what a scan would see.
+// IN_ATTRIB covers touched modification times.
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB |
+	syscall.IN_ONLYDIR | syscall.IN_EXCL_UNLINK
+
+// notifier tracks the inotify watches on the content tree.
+type notifier struct {
+	contentRoot string
+	file        *os.File
+	fd          int
+
+	// wds maps watch descriptors to relative directory paths, and paths
+	// back to descriptors.
+	wds   map[int32]string
+	paths map[string]int32
+
+	// rules caches the ignore rules in effect in watched directories,
+	// until an ignore file changes.
+	rules map[string]*ignore.Rules
+
+	// follow resolves the links to watch as directories, if any.
+	follow ignore.FollowFunc
+}
+
+func newNotifier(contentRoot string, follow ignore.FollowFunc) (*notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotifyUnavailable, err)
+	}
+	return &notifier{
+		contentRoot: contentRoot,
+		// Non-blocking, so reads go through the runtime poller and
+		// Close unblocks them.
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		wds:    make(map[int32]string),
+		paths:  make(map[string]int32),
+		rules:  make(map[string]*ignore.Rules),
+		follow: follow,
+	}, nil
+}
+
+// addTree watches relRoot and every non-hidden directory below it and
+// returns their relative paths. Directories are watched before they are
+// listed, so a subdirectory created concurrently is either walked or
+// reported by an event.
+func (n *notifier) addTree(relRoot string) ([]string, error) {
+	var dirs []string
+	err := walkDirs(n.contentRoot, relRoot, n.follow, func(relPath, absPath string) error {
+		wd, err := syscall.InotifyAddWatch(n.fd, absPath, watchMask)
+		if err != nil {
+			if errors.Is(err, syscall.ENOSPC) {
+				return fmt.Errorf("%w: watch limit reached: %v", errNotifyUnavailable, err)
+			}
+			// Vanished or unreadable: nothing to watch.
+			return nil
+		}
+		n.wds[int32(wd)] = relPath
+		n.paths[relPath] = int32(wd)
+		dirs = append(dirs, relPath)
+		return nil
+	})
+	return dirs, err
+}
+
+// removeTree drops the watches of relRoot and everything below it, for a
+// directory moved away. The kernel keeps watching a moved directory under
+// the old descriptor.
+func (n *notifier) removeTree(relRoot string) {
+	for relPath, wd := range n.paths {
+		if relPath == relRoot || strings.HasPrefix(relPath, relRoot+string(filepath.Separator)) {
+			syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.paths, relPath)
+			delete(n.wds, wd)
+		}
+	}
+}
+
+// prune drops the watches of directories at or below relRoot other than
+// those in keep, for directories that became ignored.
+func (n *notifier) prune(relRoot string, keep []string) {
+	kept := make(map[string]bool, len(keep))
+	for _, relPath := range keep {
+		kept[relPath] = true
+	}
+	for relPath, wd := range n.paths {
+		if !kept[relPath] && (relRoot == "" || relPath == relRoot || strings.HasPrefix(relPath, relRoot+string(filepath.Separator))) {
+			syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.paths, relPath)
+			delete(n.wds, wd)
+		}
+	}
+}
+
+// ignored reports whether the entry name of the watched directory dir is
+// ignored.
+func (n *notifier) ignored(dir, name string, isDir bool) bool {
+	rules, ok := n.rules[dir]
+	if !ok {
+		rules, _ = ignore.For(n.contentRoot, dir)
+		n.rules[dir] = rules
+	}
+	return rules.Match(filepath.Join(dir, name), isDir)
+}
+
+// linkedDir reports whether the entry at relPath is a link watched as a
+// directory, or one to watch as such. Events on links do not say whether
+// they point to a directory.
+func (n *notifier) linkedDir(relPath string) bool {
+	if _, ok := n.paths[relPath]; ok {
+		return true
+	}
+	if n.follow == nil {
+		return false
+	}
+	info, err := n.follow(relPath)
+	return err == nil && info.IsDir()
+}
+
+// forget drops a watch the kernel already removed.
+func (n *notifier) forget(wd int32) {
+	if relPath, ok := n.wds[wd]; ok {
+		delete(n.wds, wd)
+		if n.paths[relPath] == wd {
+			delete(n.paths, relPath)
+		}
+	}
+}
+
+func (n *notifier) close() error {
+	return n.file.Close()
+}
+
+// runNotify is the inotify loop. running reports whether the initial
+// registration succeeded, i.e. whether a fallback could have missed events.
+func (w *Watcher) runNotify(ctx context.Context) (running bool, err error) {
+	n, err := newNotifier(w.contentRoot, w.follow())
+	if err != nil {
+		return false, err
+	}
+	defer n.close()
+	if _, err := n.addTree(""); err != nil {
+		return false, err
+	}
+	w.markReady()
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- w.readEvents(n)
+	}()
+
+	// Debounce is checked a few times per window rather than once per
+	// poll interval, since nothing is polled.
+	ticker := time.NewTicker(max(w.debounce/4, 10*time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case err := <-readErr:
+			return true, err
+		case <-ticker.C:
+			w.maybeReconcile(ctx)
+		}
+	}
+}
+
+// readEvents reads and handles events until the notifier is closed.
+func (w *Watcher) readEvents(n *notifier) error {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		nr, err := n.file.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("reading inotify events: %w", err)
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= nr; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameBytes := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+
+			if err := w.handleEvent(n, ev.Wd, ev.Mask, name); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleEvent marks the directories affected by one event dirty and keeps
+// the watches in step with the tree.
+func (w *Watcher) handleEvent(n *notifier, wd int32, mask uint32, name string) error {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// Events were dropped: pick up any directories we did not see
+		// created and rescan everything.
+		if _, err := n.addTree(""); err != nil {
+			return err
+		}
+		w.markAllDirty()
+		return nil
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		n.forget(wd)
+		return nil
+	}
+
+	dir, ok := n.wds[wd]
+	if ok && name == ignore.FileName {
+		// Directories below may have become ignored or stopped being:
+		// watch exactly those left, and rescan.
+		clear(n.rules)
+		dirs, err := n.addTree(dir)
+		if err != nil {
+			return err
+		}
+		n.prune(dir, dirs)
+		w.markDirty(dir)
+		return nil
+	}
+	if !ok || strings.HasPrefix(name, ".") {
+		// Stale watch, or a hidden entry such as the .gallery sidecar
+		// directory, which scans skip too.
+		return nil
+	}
+	if name == "" {
+		w.markDirty(dir)
+		return nil
+	}
+	relPath := filepath.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0 || n.linkedDir(relPath)
+	if n.ignored(dir, name, isDir) {
+		return nil
+	}
+
+	if !isDir {
+		w.markDirty(dir)
+		return nil
+	}
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		// Files may have landed before the watch was added, so the whole
+		// new subtree is dirty.
+		dirs, err := n.addTree(relPath)
+		if err != nil {
+			return err
+		}
+		w.markDirty(append(dirs, dir)...)
+	case mask&(syscall.IN_MOVED_FROM|syscall.IN_DELETE) != 0:
+		// A deleted link leaves its target watched.
+		n.removeTree(relPath)
+		w.markDirty(dir, relPath)
+	default:
+		w.markDirty(dir, relPath)
+	}
+	return nil
+}
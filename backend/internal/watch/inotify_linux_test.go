@@ -0,0 +1,202 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/perrito666/gollery/backend/internal/symlink"
+)
+
+// startNotify runs an inotify watcher and returns a channel receiving
+// each reconciled batch of dirty paths, sorted.
+func startNotify(t *testing.T, root string) <-chan []string {
+	t.Helper()
+	return startNotifyLinks(t, root, nil)
+}
+
+// startNotifyLinks is startNotify for a watcher following links.
+func startNotifyLinks(t *testing.T, root string, links *symlink.Policy) <-chan []string {
+	t.Helper()
+	batches := make(chan []string, 16)
+	w := New(Config{
+		ContentRoot:   root,
+		Mode:          ModeInotify,
+		Links:         links,
+		DebounceDelay: 50 * time.Millisecond,
+		Reconcile: func(_ context.Context, paths []string) error {
+			sort.Strings(paths)
+			batches <- paths
+			return nil
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("Run returned %v", err)
+		}
+	})
+	// Let registration finish before the test changes the tree.
+	select {
+	case <-w.ready:
+	case err := <-done:
+		done <- err // for the cleanup
+		t.Fatalf("Run returned %v before watching", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the watcher to register the tree")
+	}
+	return batches
+}
+
+// waitFor collects batches until all want paths were reported.
+func waitFor(t *testing.T, batches <-chan []string, want ...string) []string {
+	t.Helper()
+	var got []string
+	deadline := time.After(5 * time.Second)
+	for {
+		missing := slices.DeleteFunc(slices.Clone(want), func(p string) bool { return slices.Contains(got, p) })
+		if len(missing) == 0 {
+			return got
+		}
+		select {
+		case b := <-batches:
+			got = append(got, b...)
+		case <-deadline:
+			t.Fatalf("timed out waiting for %v, got %v", missing, got)
+		}
+	}
+}
+
+func TestNotify_FileChanges(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "album.json"), `{}`)
+	writeFile(t, filepath.Join(root, "sub", "a.jpg"), "data")
+	batches := startNotify(t, root)
+
+	writeFile(t, filepath.Join(root, "sub", "b.jpg"), "data")
+	got := waitFor(t, batches, "sub")
+	if slices.Contains(got, "") {
+		t.Errorf("root should not be dirty, got %v", got)
+	}
+
+	if err := os.Remove(filepath.Join(root, "sub", "a.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, batches, "sub")
+}
+
+func TestNotify_NewDirectoryIsRegisteredRecursively(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "album.json"), `{}`)
+	batches := startNotify(t, root)
+
+	// Created outside the tree and moved in, so no events fire for its
+	// contents: they must be picked up by registration.
+	staging := t.TempDir()
+	writeFile(t, filepath.Join(staging, "trip", "day1", "a.jpg"), "data")
+	if err := os.Rename(filepath.Join(staging, "trip"), filepath.Join(root, "trip")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, batches, "", "trip", filepath.Join("trip", "day1"))
+
+	// The new directories are watched.
+	writeFile(t, filepath.Join(root, "trip", "day1", "b.jpg"), "data")
+	waitFor(t, batches, filepath.Join("trip", "day1"))
+}
+
+func TestNotify_HiddenEntriesIgnored(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "album.json"), `{}`)
+	batches := startNotify(t, root)
+
+	writeFile(t, filepath.Join(root, ".gallery", "album.state.json"), `{}`)
+	writeFile(t, filepath.Join(root, ".gallery", "assets", "a.jpg.json"), `{}`)
+	select {
+	case b := <-batches:
+		t.Errorf("hidden changes should not be reported, got %v", b)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestNotify_OverflowMarksEverythingDirty(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "x.jpg"), "data")
+	writeFile(t, filepath.Join(root, "b", "c", "y.jpg"), "data")
+	writeFile(t, filepath.Join(root, ".gallery", "z.json"), "{}")
+
+	w := New(Config{ContentRoot: root})
+	n, err := newNotifier(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.close()
+
+	if err := w.handleEvent(n, -1, syscall.IN_Q_OVERFLOW, ""); err != nil {
+		t.Fatal(err)
+	}
+	got := w.DirtyPaths()
+	sort.Strings(got)
+	want := []string{"", "a", "b", filepath.Join("b", "c")}
+	if !slices.Equal(got, want) {
+		t.Errorf("dirty = %v, want %v", got, want)
+	}
+	if len(n.paths) != len(want) {
+		t.Errorf("watching %d directories, want %d", len(n.paths), len(want))
+	}
+}
+
+func TestNotify_IgnoredPaths(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".galleryignore"), "_rejects\n*.tmp.jpg\n")
+	writeFile(t, filepath.Join(root, "_rejects", "a.jpg"), "data")
+	writeFile(t, filepath.Join(root, "sub", "a.jpg"), "data")
+	batches := startNotify(t, root)
+
+	// Neither an ignored directory nor an ignored file triggers anything.
+	writeFile(t, filepath.Join(root, "_rejects", "b.jpg"), "data")
+	writeFile(t, filepath.Join(root, "sub", "b.tmp.jpg"), "data")
+	select {
+	case b := <-batches:
+		t.Fatalf("ignored changes reconciled: %v", b)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// Un-ignoring a directory rescans and starts watching it.
+	writeFile(t, filepath.Join(root, ".galleryignore"), "*.tmp.jpg\n")
+	waitFor(t, batches, "")
+	writeFile(t, filepath.Join(root, "_rejects", "c.jpg"), "data")
+	waitFor(t, batches, "_rejects")
+}
+
+func TestNotify_Symlinks(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "content")
+	nas := filepath.Join(base, "nas")
+	writeFile(t, filepath.Join(root, "album.json"), `{"title":"root"}`)
+	writeFile(t, filepath.Join(nas, "trip", "a.jpg"), "a")
+	writeFile(t, filepath.Join(nas, "later", "b.jpg"), "b")
+	if err := os.Symlink(filepath.Join(nas, "trip"), filepath.Join(root, "trip")); err != nil {
+		t.Fatal(err)
+	}
+	batches := startNotifyLinks(t, root, symlink.New([]string{nas}))
+
+	// Changes in a linked directory are reported at the link's path.
+	writeFile(t, filepath.Join(nas, "trip", "c.jpg"), "c")
+	waitFor(t, batches, "trip")
+
+	// A new link is watched like a new directory.
+	if err := os.Symlink(filepath.Join(nas, "later"), filepath.Join(root, "later")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, batches, "", "later")
+	writeFile(t, filepath.Join(nas, "later", "d.jpg"), "d")
+	waitFor(t, batches, "later")
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package watch
+
+import (
+	"context"
+	"fmt"
+)
+
+// runNotify is not supported on this platform; Run falls back to polling.
+func (w *Watcher) runNotify(ctx context.Context) (running bool, err error) {
+	return false, fmt.Errorf("%w: not supported on this platform", errNotifyUnavailable)
+}
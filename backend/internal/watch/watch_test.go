@@ -4,10 +4,13 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/perrito666/gollery/backend/internal/symlink"
 )
 
 func writeFile(t *testing.T, path, content string) {
@@ -119,6 +122,59 @@ func TestHiddenDirsSkipped(t *testing.T) {
 	}
 }
 
+func TestIgnoredPathsSkipped(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".galleryignore"), "_rejects\n*.tmp.jpg\n")
+	writeFile(t, filepath.Join(root, "_rejects", "a.jpg"), "data")
+
+	w := New(Config{ContentRoot: root})
+	w.ScanOnce()
+
+	writeFile(t, filepath.Join(root, "_rejects", "b.jpg"), "data")
+	writeFile(t, filepath.Join(root, "sub", "c.tmp.jpg"), "data")
+	dirty := w.DetectChanges()
+	sort.Strings(dirty)
+	// Only the new directory itself shows up, not the ignored files.
+	if len(dirty) != 2 || dirty[0] != "" || dirty[1] != "sub" {
+		t.Errorf("dirty = %v, want [\"\" sub]", dirty)
+	}
+	w.MarkClean(dirty...)
+
+	// Editing the ignore file marks its directory dirty.
+	time.Sleep(10 * time.Millisecond)
+	writeFile(t, filepath.Join(root, ".galleryignore"), "*.tmp.jpg\n")
+	dirty = w.DetectChanges()
+	if !slices.Contains(dirty, "") || !slices.Contains(dirty, "_rejects") {
+		t.Errorf("dirty = %v, want the root and _rejects", dirty)
+	}
+}
+
+func TestSymlinksFollowed(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "content")
+	nas := filepath.Join(base, "nas")
+	writeFile(t, filepath.Join(root, "album.json"), `{"title":"root"}`)
+	writeFile(t, filepath.Join(nas, "trip", "a.jpg"), "a")
+	if err := os.Symlink(filepath.Join(nas, "trip"), filepath.Join(root, "trip")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New(Config{ContentRoot: root, Links: symlink.New([]string{nas})})
+	w.ScanOnce()
+	writeFile(t, filepath.Join(nas, "trip", "b.jpg"), "b")
+	if dirty := w.DetectChanges(); !slices.Equal(dirty, []string{"trip"}) {
+		t.Errorf("dirty = %v, want [trip]", dirty)
+	}
+
+	// Without a policy the link is a plain entry of the root.
+	w = New(Config{ContentRoot: root})
+	w.ScanOnce()
+	writeFile(t, filepath.Join(nas, "trip", "c.jpg"), "c")
+	if dirty := w.DetectChanges(); len(dirty) != 0 {
+		t.Errorf("dirty = %v, want nothing", dirty)
+	}
+}
+
 func TestReconcileCallback(t *testing.T) {
 	root := t.TempDir()
 	writeFile(t, filepath.Join(root, "album.json"), `{}`)
@@ -199,3 +255,18 @@ func TestNoDirtyPathsOnCleanDirectory(t *testing.T) {
 		t.Errorf("expected 0 dirty paths on stable dir, got %v", dirty)
 	}
 }
+
+func TestRun_PollModeStillAvailable(t *testing.T) {
+	root := t.TempDir()
+	w := New(Config{ContentRoot: root, Mode: ModePoll, PollInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := w.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run = %v, want deadline exceeded", err)
+	}
+
+	w = New(Config{ContentRoot: root, Mode: "bogus"})
+	if err := w.Run(context.Background()); err == nil {
+		t.Error("unknown mode should fail")
+	}
+}
@@ -0,0 +1,422 @@
+// Package xmp writes editorial metadata into Adobe XMP sidecar files.
+//
+// # Why XMP
+//
+// Edits made through the API land in the server's own sidecar state
+// (.gallery/assets/<file>.json), which no other tool understands. XMP
+// sidecars are the de-facto interchange format between photo tools, so
+// albums can opt in to having title, description, keywords, rating and
+// GPS position mirrored into <name>.xmp next to the original image
+// (<name>.<ext>.xmp when another image shares the name).
+// The original image file is never modified.
+//
+// # Merging with existing sidecars
+//
+// A desktop DAM may already own the .xmp file and store develop settings,
+// labels or history in it. [Write] therefore rewrites the file token by
+// token: every property it does not manage is copied through untouched.
+// Managed properties are dropped from every top-level rdf:Description,
+// since tools split properties across several of them, and written anew
+// into the first. Properties are recognised by namespace URI, whatever
+// prefix the file binds it to. When no sidecar exists, a minimal XMP packet is
+// created.
+//
+// Writes are atomic (temp file + rename), matching the state package.
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Namespace URIs for the properties this package manages.
+const (
+	nsRDF  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC   = "http://purl.org/dc/elements/1.1/"
+	nsXMP  = "http://ns.adobe.com/xap/1.0/"
+	nsEXIF = "http://ns.adobe.com/exif/1.0/"
+)
+
+// emptyPacket is the skeleton used when no sidecar exists yet.
+const emptyPacket = `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="">
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`
+
+// Fields holds the editorial metadata mirrored into a sidecar.
+// Zero values mean "absent": the corresponding property is removed.
+type Fields struct {
+	Title       string
+	Description string
+	Keywords    []string
+	Rating      int
+	Latitude    *float64
+	Longitude   *float64
+}
+
+// managed lists the properties (namespace URI and local name) this
+// package owns on rdf:Description. Existing values are dropped and
+// rewritten.
+var managed = map[xml.Name]bool{
+	{Space: nsDC, Local: "title"}:          true,
+	{Space: nsDC, Local: "description"}:    true,
+	{Space: nsDC, Local: "subject"}:        true,
+	{Space: nsXMP, Local: "Rating"}:        true,
+	{Space: nsEXIF, Local: "GPSLatitude"}:  true,
+	{Space: nsEXIF, Local: "GPSLongitude"}: true,
+}
+
+// prefixes are the namespace prefixes [writeFields] uses.
+var prefixes = []struct{ prefix, uri string }{
+	{"rdf", nsRDF},
+	{"dc", nsDC},
+	{"xmp", nsXMP},
+	{"exif", nsEXIF},
+}
+
+// SidecarPath returns the XMP sidecar path for an image, following the
+// Adobe convention of replacing the extension (photo.jpg → photo.xmp).
+// When another file in the directory has the same name with a different
+// extension (IMG_1.jpg and IMG_1.png), that sidecar would be shared, so
+// the full filename is kept instead (IMG_1.jpg.xmp, as darktable does).
+func SidecarPath(imagePath string) (string, error) {
+	dir, name := filepath.Split(imagePath)
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return "", fmt.Errorf("listing image directory: %w", err)
+	}
+	for _, e := range entries {
+		other := e.Name()
+		ext := filepath.Ext(other)
+		if other != name && !strings.EqualFold(ext, ".xmp") &&
+			strings.EqualFold(strings.TrimSuffix(other, ext), stem) {
+			return imagePath + ".xmp", nil
+		}
+	}
+	return filepath.Join(dir, stem+".xmp"), nil
+}
+
+// Write creates or updates the XMP sidecar at path with the given fields.
+// Properties not managed by this package are preserved.
+func Write(path string, f Fields) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("reading xmp sidecar: %w", err)
+		}
+		src = []byte(emptyPacket)
+	}
+
+	out, err := rewrite(src, f)
+	if err != nil {
+		return fmt.Errorf("rewriting xmp sidecar: %w", err)
+	}
+	return atomicWrite(path, out)
+}
+
+// rewrite copies the XMP document in src, dropping managed properties
+// from every rdf:Description directly below rdf:RDF and writing the
+// values from f into the first.
+func rewrite(src []byte, f Fields) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(src))
+	var buf bytes.Buffer
+
+	var (
+		depth     int      // current element depth
+		rdfDepth  = -1     // depth of rdf:RDF, -1 until seen
+		descDepth = -1     // depth of the current rdf:Description, -1 outside
+		skipDepth = -1     // depth of a managed element being dropped
+		done      bool     // first rdf:Description has been rewritten
+		ns        nsScopes // namespace declarations in scope
+	)
+
+	for {
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			ns.push(t.Attr)
+			if skipDepth >= 0 {
+				continue
+			}
+			name := ns.resolve(t.Name, true)
+			if name == (xml.Name{Space: nsRDF, Local: "RDF"}) && rdfDepth < 0 {
+				rdfDepth = depth
+			} else if name == (xml.Name{Space: nsRDF, Local: "Description"}) && rdfDepth >= 0 && depth == rdfDepth+1 {
+				descDepth = depth
+				if t.Attr, err = descriptionAttrs(t.Attr, &ns, !done); err != nil {
+					return nil, err
+				}
+			} else if descDepth >= 0 && depth == descDepth+1 && managed[name] {
+				skipDepth = depth
+				continue
+			}
+			writeStart(&buf, t)
+
+		case xml.EndElement:
+			ns.pop()
+			if skipDepth >= 0 {
+				if depth == skipDepth {
+					skipDepth = -1
+				}
+				depth--
+				continue
+			}
+			if depth == descDepth {
+				if !done {
+					writeFields(&buf, f)
+					done = true
+				}
+				descDepth = -1
+			}
+			depth--
+			fmt.Fprintf(&buf, "</%s>", qname(t.Name))
+
+		case xml.CharData:
+			if skipDepth >= 0 {
+				continue
+			}
+			escape(&buf, t)
+
+		case xml.Comment:
+			if skipDepth >= 0 {
+				continue
+			}
+			fmt.Fprintf(&buf, "<!--%s-->", t)
+
+		case xml.ProcInst:
+			fmt.Fprintf(&buf, "<?%s %s?>", t.Target, t.Inst)
+
+		case xml.Directive:
+			fmt.Fprintf(&buf, "<!%s>", t)
+		}
+	}
+
+	if !done {
+		return nil, fmt.Errorf("no rdf:Description element found")
+	}
+	return buf.Bytes(), nil
+}
+
+// descriptionAttrs drops managed shorthand attributes from rdf:Description
+// and, on the one [writeFields] writes to, makes sure the prefixes it
+// uses are bound to its namespaces. ns must already hold the element's
+// own declarations.
+func descriptionAttrs(attrs []xml.Attr, ns *nsScopes, fields bool) ([]xml.Attr, error) {
+	out := attrs[:0]
+	for _, a := range attrs {
+		if managed[ns.resolve(a.Name, false)] {
+			continue
+		}
+		out = append(out, a)
+	}
+	if !fields {
+		return out, nil
+	}
+	for _, p := range prefixes {
+		if uri, _ := ns.lookup(p.prefix); uri == p.uri {
+			continue
+		}
+		if _, ok := ns.top()[p.prefix]; ok {
+			return nil, fmt.Errorf("prefix %q is bound to another namespace", p.prefix)
+		}
+		out = append(out, xml.Attr{
+			Name:  xml.Name{Space: "xmlns", Local: p.prefix},
+			Value: p.uri,
+		})
+	}
+	return out, nil
+}
+
+// nsScopes tracks the namespace declarations of the open elements, keyed
+// by prefix ("" for the default namespace).
+type nsScopes []map[string]string
+
+// push opens an element scope with the declarations among attrs.
+func (s *nsScopes) push(attrs []xml.Attr) {
+	scope := make(map[string]string)
+	for _, a := range attrs {
+		switch {
+		case a.Name.Space == "xmlns":
+			scope[a.Name.Local] = a.Value
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+			scope[""] = a.Value
+		}
+	}
+	*s = append(*s, scope)
+}
+
+// pop closes the innermost element scope.
+func (s *nsScopes) pop() {
+	if len(*s) > 0 {
+		*s = (*s)[:len(*s)-1]
+	}
+}
+
+// top returns the innermost element's own declarations.
+func (s nsScopes) top() map[string]string {
+	if len(s) == 0 {
+		return nil
+	}
+	return s[len(s)-1]
+}
+
+// lookup returns the namespace URI bound to prefix.
+func (s nsScopes) lookup(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return "http://www.w3.org/XML/1998/namespace", true
+	}
+	for i := len(s) - 1; i >= 0; i-- {
+		if uri, ok := s[i][prefix]; ok {
+			return uri, true
+		}
+	}
+	return "", false
+}
+
+// resolve replaces the prefix of a raw name with its namespace URI.
+// Unprefixed element names take the default namespace; unprefixed
+// attributes have none. Unbound prefixes are kept as they are.
+func (s nsScopes) resolve(n xml.Name, element bool) xml.Name {
+	if n.Space == "" && !element {
+		return n
+	}
+	if uri, ok := s.lookup(n.Space); ok {
+		return xml.Name{Space: uri, Local: n.Local}
+	}
+	return n
+}
+
+// writeFields emits the managed properties as child elements of
+// rdf:Description. Empty fields are omitted.
+func writeFields(buf *bytes.Buffer, f Fields) {
+	if f.Title != "" {
+		writeLangAlt(buf, "dc:title", f.Title)
+	}
+	if f.Description != "" {
+		writeLangAlt(buf, "dc:description", f.Description)
+	}
+	if len(f.Keywords) > 0 {
+		buf.WriteString("\n   <dc:subject>\n    <rdf:Bag>")
+		for _, k := range f.Keywords {
+			buf.WriteString("\n     <rdf:li>")
+			escape(buf, []byte(k))
+			buf.WriteString("</rdf:li>")
+		}
+		buf.WriteString("\n    </rdf:Bag>\n   </dc:subject>")
+	}
+	if f.Rating != 0 {
+		fmt.Fprintf(buf, "\n   <xmp:Rating>%d</xmp:Rating>", f.Rating)
+	}
+	if f.Latitude != nil && f.Longitude != nil {
+		fmt.Fprintf(buf, "\n   <exif:GPSLatitude>%s</exif:GPSLatitude>", FormatCoordinate(*f.Latitude, 'N', 'S'))
+		fmt.Fprintf(buf, "\n   <exif:GPSLongitude>%s</exif:GPSLongitude>", FormatCoordinate(*f.Longitude, 'E', 'W'))
+	}
+	buf.WriteString("\n  ")
+}
+
+func writeLangAlt(buf *bytes.Buffer, name, value string) {
+	fmt.Fprintf(buf, "\n   <%s>\n    <rdf:Alt>\n     <rdf:li xml:lang=\"x-default\">", name)
+	escape(buf, []byte(value))
+	fmt.Fprintf(buf, "</rdf:li>\n    </rdf:Alt>\n   </%s>", name)
+}
+
+// FormatCoordinate renders a decimal degree value in the XMP GPSCoordinate
+// form "DDD,MM.mmmmmmR", where R is pos for values >= 0 and neg otherwise.
+func FormatCoordinate(v float64, pos, neg byte) string {
+	ref := pos
+	if v < 0 {
+		ref = neg
+		v = -v
+	}
+	deg := math.Floor(v)
+	minutes := (v - deg) * 60
+	return strconv.Itoa(int(deg)) + "," + strconv.FormatFloat(minutes, 'f', 6, 64) + string(ref)
+}
+
+func writeStart(buf *bytes.Buffer, t xml.StartElement) {
+	buf.WriteString("<" + qname(t.Name))
+	for _, a := range t.Attr {
+		buf.WriteString(" " + qname(a.Name) + `="`)
+		escape(buf, []byte(a.Value))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(">")
+}
+
+// escape writes s with XML special characters escaped. Unlike
+// [xml.EscapeText] it leaves whitespace alone, so the indentation of
+// the original document survives a rewrite.
+func escape(buf *bytes.Buffer, s []byte) {
+	for _, c := range s {
+		switch c {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		case '"':
+			buf.WriteString("&quot;")
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+// qname joins a raw (unresolved) name back into prefix:local form.
+func qname(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+// atomicWrite writes data to path via a temp file in the same directory.
+func atomicWrite(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*.xmp")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("writing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("closing temp file: %w", err)
+	}
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("setting permissions: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("renaming temp file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package xmp
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestSidecarPath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"beach.jpg", "beach.xmp", "IMG_0001.JPEG", "noext", "IMG_1.jpg", "IMG_1.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{"beach.jpg", "beach.xmp"},
+		{"IMG_0001.JPEG", "IMG_0001.xmp"},
+		{"noext", "noext.xmp"},
+		// Images sharing a name keep their extension.
+		{"IMG_1.jpg", "IMG_1.jpg.xmp"},
+		{"IMG_1.png", "IMG_1.png.xmp"},
+	}
+	for _, tt := range tests {
+		got, err := SidecarPath(filepath.Join(dir, tt.in))
+		if err != nil || got != filepath.Join(dir, tt.want) {
+			t.Errorf("SidecarPath(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatCoordinate(t *testing.T) {
+	if got := FormatCoordinate(48.8566, 'N', 'S'); got != "48,51.396000N" {
+		t.Errorf("lat = %q", got)
+	}
+	if got := FormatCoordinate(-74.0060, 'E', 'W'); got != "74,0.360000W" {
+		t.Errorf("lon = %q", got)
+	}
+}
+
+func TestWrite_CreatesSidecar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "beach.xmp")
+	err := Write(path, Fields{
+		Title:       "Sunset & sea",
+		Description: "At the beach",
+		Keywords:    []string{"beach", "sunset"},
+		Rating:      4,
+		Latitude:    floatPtr(48.8566),
+		Longitude:   floatPtr(2.3522),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		`<rdf:li xml:lang="x-default">Sunset &amp; sea</rdf:li>`,
+		`<rdf:li xml:lang="x-default">At the beach</rdf:li>`,
+		`<rdf:li>beach</rdf:li>`,
+		`<rdf:li>sunset</rdf:li>`,
+		`<xmp:Rating>4</xmp:Rating>`,
+		`<exif:GPSLatitude>48,51.396000N</exif:GPSLatitude>`,
+		`xmlns:dc="http://purl.org/dc/elements/1.1/"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	// Must remain well-formed XML.
+	if err := xml.Unmarshal(data, new(struct{})); err != nil {
+		t.Errorf("output is not well-formed: %v", err)
+	}
+}
+
+func TestWrite_PreservesForeignProperties(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "beach.xmp")
+	existing := `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:crs="http://ns.adobe.com/camera-raw-settings/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmp:Rating="1"
+    crs:Exposure2012="+0.50">
+   <dc:title>
+    <rdf:Alt>
+     <rdf:li xml:lang="x-default">Old title</rdf:li>
+    </rdf:Alt>
+   </dc:title>
+   <crs:ToneCurve>
+    <rdf:Seq>
+     <rdf:li>0, 0</rdf:li>
+    </rdf:Seq>
+   </crs:ToneCurve>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Write(path, Fields{Title: "New title", Rating: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	out := string(data)
+	if strings.Contains(out, "Old title") {
+		t.Error("old title should be replaced")
+	}
+	if strings.Contains(out, `xmp:Rating="1"`) {
+		t.Error("shorthand rating attribute should be replaced")
+	}
+	for _, want := range []string{
+		"New title",
+		`<xmp:Rating>5</xmp:Rating>`,
+		`crs:Exposure2012="+0.50"`,
+		`<rdf:li>0, 0</rdf:li>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, `xmlns:dc=`) != 1 {
+		t.Errorf("dc namespace should be declared once:\n%s", out)
+	}
+}
+
+func TestWrite_ReplacesManagedPropertiesInEveryDescription(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "split.xmp")
+	existing := `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:crs="http://ns.adobe.com/camera-raw-settings/1.0/" crs:Exposure2012="+0.50">
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="1">
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>old keyword</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+   <dc:creator>
+    <rdf:Seq>
+     <rdf:li>Ana</rdf:li>
+    </rdf:Seq>
+   </dc:creator>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+`
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Write(path, Fields{Keywords: []string{"new keyword"}, Rating: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	out := string(data)
+	for _, stale := range []string{"old keyword", `xmp:Rating="1"`} {
+		if strings.Contains(out, stale) {
+			t.Errorf("output still holds %q:\n%s", stale, out)
+		}
+	}
+	if strings.Count(out, "<dc:subject>") != 1 || strings.Count(out, "xmp:Rating") != 2 {
+		t.Errorf("managed properties should be written once:\n%s", out)
+	}
+	for _, want := range []string{"new keyword", `crs:Exposure2012="+0.50"`, "<rdf:li>Ana</rdf:li>"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWrite_MatchesPropertiesByNamespace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prefixes.xmp")
+	existing := `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <r:RDF xmlns:r="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:purl="http://purl.org/dc/elements/1.1/">
+  <r:Description r:about="">
+   <purl:title>
+    <r:Alt>
+     <r:li xml:lang="x-default">Old title</r:li>
+    </r:Alt>
+   </purl:title>
+  </r:Description>
+  <r:Description r:about="" xmlns:dc="http://example.com/not-dc/" dc:title="Not a Dublin Core title">
+  </r:Description>
+ </r:RDF>
+</x:xmpmeta>
+`
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Write(path, Fields{Title: "New title"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	out := string(data)
+	if strings.Contains(out, "Old title") {
+		t.Errorf("title under another prefix should be replaced:\n%s", out)
+	}
+	for _, want := range []string{"New title", `dc:title="Not a Dublin Core title"`, `xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if err := xml.Unmarshal(data, new(struct{})); err != nil {
+		t.Errorf("output is not well-formed: %v", err)
+	}
+}
+
+func TestWrite_ClearsRemovedFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.xmp")
+	if err := Write(path, Fields{Title: "T", Keywords: []string{"k"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(path, Fields{Title: "T"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "dc:subject") {
+		t.Errorf("keywords should be removed:\n%s", data)
+	}
+}
+
+func TestWrite_InvalidSidecar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.xmp")
+	os.WriteFile(path, []byte("<x:xmpmeta><unclosed>"), 0644)
+
+	if err := Write(path, Fields{Title: "T"}); err == nil {
+		t.Error("expected error for malformed sidecar")
+	}
+	// Original must be left untouched.
+	data, _ := os.ReadFile(path)
+	if string(data) != "<x:xmpmeta><unclosed>" {
+		t.Errorf("malformed sidecar was modified: %q", data)
+	}
+}